@@ -1,11 +1,26 @@
 package main
 
 import (
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/VMitov/payments/pkg/approval"
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/config"
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/fraud"
+	"github.com/VMitov/payments/pkg/health"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/ratelimit"
+	"github.com/VMitov/payments/pkg/reconcile"
+	"github.com/VMitov/payments/pkg/routing"
+	"github.com/VMitov/payments/pkg/screening"
+	"github.com/VMitov/payments/pkg/trace"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/render"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -18,7 +33,29 @@ const (
 )
 
 type api struct {
-	db *sqlx.DB
+	db            *sqlx.DB
+	authenticator auth.Authenticator
+	tolerance     reconcile.Tolerance
+	calendars     *calendar.Registry
+	// calendarOrganisation is the organisation whose admins change the
+	// shared calendars
+	calendarOrganisation string
+	routing              *routing.Engine
+	screener             *screening.Screener
+	fraud                *fraud.Engine
+	approvals            *approval.PolicySet
+	rateLimits           *rateLimits
+	quotas               quota.Limits
+	quotasMu             sync.RWMutex
+	tracer               *trace.Tracer
+	logger               *slog.Logger
+	logLevel             slog.LevelVar
+	health               *health.Checker
+	started              time.Time
+	config               *config.Config
+	maxBody              int64
+	events               *events.Broker
+	publisher            events.Publisher
 }
 
 func newAPI(dbconn string) (*api, error) {
@@ -26,28 +63,128 @@ func newAPI(dbconn string) (*api, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "connecting to DB failed")
 	}
-	return &api{db: db}, nil
+	return &api{
+		db:            db,
+		authenticator: auth.APIKeys{DB: db},
+		calendars:     calendar.NewRegistry(),
+		started:       time.Now(),
+	}, nil
 }
 
 func newRouter(api *api) http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(instrument)
+	r.Use(api.traceRequests)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.Logger)
+	r.Use(api.logRequests)
 	r.Use(middleware.Recoverer)
+	r.Use(api.limitBody)
 	r.Use(middleware.URLFormat)
-	r.Use(render.SetContentType(render.ContentTypeJSON))
+	r.Use(negotiate)
 
-	r.Route("/payments", func(r chi.Router) {
-		r.Get("/", api.listPayments)
-		r.Post("/", api.createPayment)
+	// The probes of the orchestrator are not authenticated
+	r.Get("/healthz", api.healthz)
+	r.Get("/readyz", api.readyz)
+
+	// The description of the API is public as well, the extension of
+	// /openapi.json is taken by URLFormat
+	r.Get("/openapi", api.getOpenAPI)
+	r.Get("/docs", api.getReference)
+
+	// Every other route is authenticated by its guard, after the requests
+	// limited by ip are limited
+	r.Group(func(r chi.Router) {
+		read := api.guard(auth.PermissionRead, ratelimit.ClassRead)
+		export := api.guard(auth.PermissionRead, ratelimit.ClassExport)
+		write := api.guard(auth.PermissionWrite, ratelimit.ClassWrite)
+		approve := api.guard(auth.PermissionApprove, ratelimit.ClassWrite)
+		admin := api.guard(auth.PermissionAdmin, ratelimit.ClassWrite)
+
+		r.With(api.authenticated).Get("/permissions", api.getPermissions)
+		r.With(admin).Get("/admin/log-level", api.getLogLevel)
+		r.With(admin).Put("/admin/log-level", api.setLogLevel)
+		r.With(admin).Get("/diagnostics", api.getDiagnostics)
+		r.With(read).Get("/usage", api.getUsage)
+		r.With(read).Get("/events", api.streamEvents)
+
+		r.Route("/payments", func(r chi.Router) {
+			r.With(export).Get("/", api.listPayments)
+			r.With(write, api.idempotent).Post("/", api.createPayment)
+
+			r.Route("/{paymentID}", func(r chi.Router) {
+				r.With(read).Get("/", api.getPayment)
+				r.With(write).Put("/", api.updatePayment)
+				r.With(write).Patch("/", api.patchPayment)
+				r.With(write).Delete("/", api.deletePayment)
+				r.With(read).Get("/reconciliation", api.getPaymentReconciliation)
+				r.With(read).Get("/refunds", api.listRefunds)
+				r.With(write, api.idempotent).Post("/refunds", api.createRefund)
+				r.With(write, api.idempotent).Post("/reversal", api.createReversal)
+				r.With(read).Get("/route", api.getPaymentRoute)
+				r.With(approve).Put("/route", api.overridePaymentRoute)
+				r.With(read).Get("/fraud-decisions", api.listFraudDecisions)
+				r.With(approve).Post("/fraud-review", api.reviewPayment)
+				r.With(read).Get("/approvals", api.getApprovals)
+				r.With(approve).Post("/approvals/approve", api.approvePayment)
+				r.With(approve).Post("/approvals/reject", api.rejectPayment)
+			})
 
-		r.Route("/{paymentID}", func(r chi.Router) {
-			r.Get("/", api.getPayment)
-			r.Put("/", api.updatePayment)
-			r.Delete("/", api.deletePayment)
 		})
 
+		r.Route("/approvals", func(r chi.Router) {
+			r.With(read).Get("/", api.listPendingApprovals)
+			r.With(approve).Post("/bulk", api.bulkApprove)
+		})
+
+		r.Route("/calendars", func(r chi.Router) {
+			r.With(read).Get("/", api.listCalendars)
+
+			r.Route("/{calendar}", func(r chi.Router) {
+				r.With(read).Get("/", api.getCalendar)
+				r.With(admin).Put("/", api.putCalendar)
+				r.With(read).Get("/business-day", api.getBusinessDay)
+			})
+		})
+
+		r.Route("/payment-schedules", func(r chi.Router) {
+			r.With(read).Get("/", api.listSchedules)
+			r.With(write, api.idempotent).Post("/", api.createSchedule)
+
+			r.Route("/{scheduleID}", func(r chi.Router) {
+				r.With(read).Get("/", api.getSchedule)
+				r.With(write).Delete("/", api.cancelSchedule)
+				r.With(write).Post("/resume", api.resumeSchedule)
+				r.With(read).Get("/runs", api.listScheduleRuns)
+			})
+		})
+
+		r.Route("/routing", func(r chi.Router) {
+			r.With(read).Get("/rules", api.getRoutingRules)
+			r.With(read).Post("/dry-run", api.dryRunRoute)
+		})
+
+		r.Route("/screening/cases", func(r chi.Router) {
+			r.With(read).Get("/", api.listScreeningCases)
+
+			r.Route("/{caseID}", func(r chi.Router) {
+				r.With(read).Get("/", api.getScreeningCase)
+				r.With(approve).Post("/clear", api.clearScreeningCase)
+				r.With(approve).Post("/confirm", api.confirmScreeningCase)
+			})
+		})
+
+		r.Route("/statements", func(r chi.Router) {
+			r.With(export).Get("/", api.listStatements)
+			r.With(write).Post("/", api.createStatements)
+		})
+
+		r.Route("/reconciliation", func(r chi.Router) {
+			r.With(export).Get("/exceptions", api.listReconciliationExceptions)
+			r.With(write).Post("/matches", api.createReconciliation)
+			r.With(read).Get("/matches/{matchID}", api.getReconciliation)
+			r.With(write).Delete("/matches/{matchID}", api.deleteReconciliation)
+		})
 	})
 
 	return r
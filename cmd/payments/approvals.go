@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/approval"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+)
+
+// user returns the id of the principal making the request
+func user(r *http.Request) string {
+	if p := principal(r); p != nil {
+		return p.ID
+	}
+	return ""
+}
+
+// requireApproval makes the payment wait for approvals if a policy applies,
+// within the transaction that creates or changes it
+func (api *api) requireApproval(tx *sqlx.Tx, r *http.Request, id string, p *payment.Payment) error {
+	if api.approvals == nil {
+		return nil
+	}
+
+	details, err := p.Details()
+	if err != nil {
+		return err
+	}
+
+	policy := api.approvals.Required(details.Currency, details.Amount)
+	if policy == nil {
+		return nil
+	}
+
+	return approval.RequireTx(tx, org(r), id, user(r), policy)
+}
+
+func (api *api) getApprovals(w http.ResponseWriter, r *http.Request) {
+	paymentID := chi.URLParam(r, "paymentID")
+	req, err := approval.Get(api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, approval.NewResource(req, "/payments/"+paymentID+"/approvals"))
+}
+
+func (api *api) listPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	requests, err := approval.SelectPending(api.db, org(r))
+	if err == sql.ErrNoRows {
+		requests = []approval.Request{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, approval.NewListResource(requests, "/approvals"))
+}
+
+func (api *api) approvePayment(w http.ResponseWriter, r *http.Request) {
+	api.decideApproval(w, r, approval.DecisionApprove)
+}
+
+func (api *api) rejectPayment(w http.ResponseWriter, r *http.Request) {
+	api.decideApproval(w, r, approval.DecisionReject)
+}
+
+func (api *api) decideApproval(w http.ResponseWriter, r *http.Request, decision string) {
+	data := &approval.DecisionResource{}
+	if r.ContentLength != 0 {
+		if err := render.Bind(r, data); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	paymentID := chi.URLParam(r, "paymentID")
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	switch err := approval.Decide(api.db, org(r), paymentID, user(r), decision, data.Comment(), api.released(org(r))); err {
+	case nil:
+		api.publishChange(r, paymentID)
+	case approval.ErrMissingApprover:
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	case approval.ErrNotPending, approval.ErrSelfApproval, approval.ErrAlreadyDecided:
+		render.Render(w, r, errConflict(err))
+		return
+	default:
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	req, err := approval.Get(api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, approval.NewResource(req, "/payments/"+paymentID+"/approvals"))
+}
+
+func (api *api) bulkApprove(w http.ResponseWriter, r *http.Request) {
+	data := &approval.BulkResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	approver := user(r)
+	if approver == "" {
+		render.Render(w, r, errInvalidRequest(approval.ErrMissingApprover))
+		return
+	}
+
+	// Every payment is approved on its own so one failure does not fail the batch
+	results := []approval.Result{}
+	for _, id := range data.Data.Attributes.PaymentIDs {
+		result := approval.Result{PaymentID: id}
+		if err := approval.Decide(api.db, org(r), id, approver, approval.DecisionApprove, data.Data.Attributes.Comment, api.released(org(r))); err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		api.publishChange(r, id)
+		if req, err := approval.Get(api.db, org(r), id); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Status = req.Status
+		}
+		results = append(results, result)
+	}
+
+	render.Render(w, r, approval.NewResultListResource(results, "/approvals/bulk"))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/go-chi/render"
+)
+
+// authenticate authenticates the caller of the request and places its
+// principal in the request context
+func (api *api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			p   *auth.Principal
+			err error = auth.ErrNoCredentials
+		)
+		if api.authenticator != nil {
+			p, err = api.authenticator.Authenticate(r)
+		}
+
+		if err == auth.ErrNoCredentials || auth.Invalid(err) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="payments"`)
+			render.Render(w, r, errUnauthorized(err))
+			return
+		} else if err != nil {
+			render.Render(w, r, errSystem(err))
+			return
+		}
+
+		r = annotate(r, slog.String("principal", p.ID), slog.String("auth_method", p.Method))
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), p)))
+	})
+}
+
+// authenticated authenticates the request and scopes it to the
+// organisation of its principal
+func (api *api) authenticated(next http.Handler) http.Handler {
+	return api.authenticate(api.scope(next))
+}
+
+// principal returns the authenticated caller of the request
+func principal(r *http.Request) *auth.Principal {
+	p, _ := auth.FromContext(r.Context())
+	return p
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+// limitBody rejects the requests with bodies larger than the limit of the
+// api. Bodies without a declared length fail when reading past the limit.
+func (api *api) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.maxBody <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > api.maxBody {
+			render.Render(w, r, errRequestTooLarge(fmt.Errorf("request body of %d bytes exceeds the limit of %d bytes", r.ContentLength, api.maxBody)))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, api.maxBody)
+		next.ServeHTTP(w, r)
+	})
+}
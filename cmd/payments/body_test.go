@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	body := `{"data":{"type":"Payment","attributes":{"amount":"100.21","currency":"GBP"}}}`
+
+	testCases := map[string]struct {
+		contentLength int64
+		expected      int
+	}{
+		"Declared": {contentLength: int64(len(body)), expected: http.StatusRequestEntityTooLarge},
+		// Chunked bodies fail once read past the limit
+		"Undeclared": {contentLength: -1, expected: http.StatusRequestEntityTooLarge},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			a := newTestAPI(nil)
+			a.maxBody = 16
+			router := testRouter(a)
+
+			req := httptest.NewRequest("POST", "/payments", ioutil.NopCloser(strings.NewReader(body)))
+			req.ContentLength = tc.contentLength
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tc.expected {
+				t.Errorf("expected %d, got %d: %s", tc.expected, resp.Code, resp.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+// errSharedCalendars refuses the changes of the calendars by the organisations
+// other than the one operating the service, since every organisation uses them
+var errSharedCalendars = errors.New("calendars are shared by every organisation and changed by the admins of the calendar organisation only")
+
+func (api *api) listCalendars(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, calendar.NewListResource(api.calendars.List(), "/calendars"))
+}
+
+func (api *api) getCalendar(w http.ResponseWriter, r *http.Request) {
+	c, ok := api.calendars.Get(chi.URLParam(r, "calendar"))
+	if !ok {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, calendar.NewResource(c, "/calendars/"+c.Name()))
+}
+
+func (api *api) putCalendar(w http.ResponseWriter, r *http.Request) {
+	if api.calendarOrganisation == "" || org(r) != api.calendarOrganisation {
+		render.Render(w, r, errForbidden(errSharedCalendars))
+		return
+	}
+
+	data := &calendar.Resource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	def := *data.Data.Attributes
+	def.Name = chi.URLParam(r, "calendar")
+	c, err := calendar.New(def)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if err := api.calendars.Save(api.db, c); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, calendar.NewResource(c, "/calendars/"+c.Name()))
+}
+
+func (api *api) getBusinessDay(w http.ResponseWriter, r *http.Request) {
+	c, ok := api.calendars.Get(chi.URLParam(r, "calendar"))
+	if !ok {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	query := r.URL.Query()
+	date := time.Now().UTC()
+	if query.Get("date") != "" {
+		var err error
+		if date, err = time.Parse(calendar.DateLayout, query.Get("date")); err != nil {
+			render.Render(w, r, errInvalidRequest(fmt.Errorf("invalid date %q", query.Get("date"))))
+			return
+		}
+	}
+
+	lag := 0
+	if query.Get("lag") != "" {
+		var err error
+		if lag, err = strconv.Atoi(query.Get("lag")); err != nil || lag < 0 {
+			render.Render(w, r, errInvalidRequest(fmt.Errorf("invalid lag %q", query.Get("lag"))))
+			return
+		}
+	}
+
+	convention := query.Get("convention")
+	if convention == "" {
+		convention = calendar.Following
+	}
+	rolled, err := c.Roll(date, convention)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	render.Render(w, r, calendar.NewBusinessDayResource(c, &calendar.BusinessDay{
+		Date:                date.Format(calendar.DateLayout),
+		IsBusinessDay:       c.IsBusinessDay(date),
+		Convention:          convention,
+		RolledDate:          rolled.Format(calendar.DateLayout),
+		NextBusinessDay:     c.Next(date).Format(calendar.DateLayout),
+		PreviousBusinessDay: c.Previous(date).Format(calendar.DateLayout),
+		SettlementDate:      c.SettlementDate(date, lag).Format(calendar.DateLayout),
+	}))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestPutCalendarOrganisation changes a shared calendar on behalf of several
+// organisations. Only the calendar organisation changes it.
+func TestPutCalendarOrganisation(t *testing.T) {
+	const body = `{"data":{"type":"Calendar","attributes":{"holidays":[{"date":"2018-12-25","name":"Christmas Day"}]}}}`
+
+	testCases := map[string]struct {
+		calendarOrganisation string
+		code                 int
+	}{
+		"NoCalendarOrganisation": {code: 403},
+		"OtherOrganisation":      {calendarOrganisation: otherOrganisation, code: 403},
+		"CalendarOrganisation":   {calendarOrganisation: testOrganisation, code: 200},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			if tc.code == 200 {
+				mock.ExpectExec("INSERT INTO calendars").WithArgs("GB", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+			a.calendars = calendar.NewRegistry()
+			a.calendarOrganisation = tc.calendarOrganisation
+			req := httptest.NewRequest("PUT", "/calendars/GB", strings.NewReader(body))
+			resp := httptest.NewRecorder()
+			testRouter(a).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body)
+			}
+			if _, ok := a.calendars.Get("GB"); ok != (tc.code == 200) {
+				t.Errorf("expected the calendar to be changed only by the calendar organisation")
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
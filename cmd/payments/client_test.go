@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/client"
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/idempotency"
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestClient calls the router through the client
+func TestClient(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	body := `{"data":{"type":"Payment","attributes":{"amount":"100.21"}}}`
+	paymentRows := func(attributes string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(attributes), "created")
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	srv := httptest.NewServer(testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.APIKey("secret"))
+	ctx := client.WithIdempotencyKey(context.Background(), "order-42")
+
+	// The first request creates the payment and keeps the response
+	expectScoped(mock, testOrganisation)
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs(testOrganisation, "order-42", idempotency.Hash("POST", "/payments", []byte(body)), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("INSERT INTO payments").
+		WithArgs(testOrganisation, `{"amount":"100.21"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.21"}`))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectExec("UPDATE idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	created, err := c.CreatePayment(ctx, map[string]string{"amount": "100.21"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != id || created.Status != "created" || string(created.Attributes) != `{"amount":"100.21"}` {
+		t.Errorf("unexpected payment %+v", created)
+	}
+
+	// The retry gets the kept response
+	expectScoped(mock, testOrganisation)
+	mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT request_hash").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "location", "etag", "body"}).
+			AddRow(idempotency.Hash("POST", "/payments", []byte(body)), 201, jsonapi.MediaType, "/payments/"+id, "", []byte(`{"data":{"id":"`+id+`","type":"Payment","attributes":{"amount":"100.21"},"links":{"self":"/payments/`+id+`"}},"jsonapi":{"version":"1.1"}}`)))
+	mock.ExpectCommit()
+
+	replayed, err := c.CreatePayment(ctx, map[string]string{"amount": "100.21"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != id {
+		t.Errorf("expected the created payment, got %+v", replayed)
+	}
+
+	// Patching merges the attributes
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.21","currency":"GBP"}`))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.21","currency":"GBP"}`))
+	mock.ExpectExec("UPDATE payments").
+		WithArgs(`{"amount":"100.22","currency":"GBP"}`, id, testOrganisation).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.22","currency":"GBP"}`))
+	mock.ExpectCommit()
+
+	var patched struct{ Amount, Currency string }
+	p, err := c.PatchPayment(context.Background(), id, map[string]string{"amount": "100.22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Decode(&patched); err != nil || patched.Amount != "100.22" || patched.Currency != "GBP" {
+		t.Errorf("unexpected attributes %+v: %v", patched, err)
+	}
+
+	// The iterator follows the pages
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WithArgs(testOrganisation, "00000000-0000-0000-0000-000000000000", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
+			AddRow("09a8fe0d-e239-4aff-8098-7923eadd0b98", []byte(`{}`)).
+			AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{}`)))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WithArgs(testOrganisation, "09a8fe0d-e239-4aff-8098-7923eadd0b98", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
+			AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{}`)))
+	mock.ExpectCommit()
+
+	it := c.Payments(context.Background(), 1)
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 payments, got %d", count)
+	}
+
+	// The errors of the service are decoded
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}))
+	mock.ExpectRollback()
+
+	if err := c.DeletePayment(context.Background(), id); !client.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientIfMatch(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	paymentRows := func(attributes string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(attributes), "created")
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	srv := httptest.NewServer(testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))))
+	defer srv.Close()
+	c := client.New(srv.URL, nil)
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.21"}`))
+	mock.ExpectCommit()
+
+	p, err := c.GetPayment(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ETag == "" {
+		t.Fatal("expected the ETag of the payment")
+	}
+
+	// Someone else changed the amount in the meantime
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100.22"}`))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT .* FOR UPDATE").WillReturnRows(paymentRows(`{"amount":"100.22"}`))
+	mock.ExpectRollback()
+
+	ctx := client.WithIfMatch(context.Background(), p.ETag)
+	if _, err := c.UpdatePayment(ctx, id, map[string]string{"amount": "100.23"}); !client.IsModified(err) {
+		t.Errorf("expected the update to fail, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+	a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+	a.events = events.NewBroker()
+	a.publisher = a.events
+	srv := httptest.NewServer(testRouter(a))
+	defer srv.Close()
+	c := client.New(srv.URL, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := c.Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+		AddRow(id, []byte(`{}`), "created"))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+	mock.ExpectExec("DELETE FROM payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := c.DeletePayment(context.Background(), id); err != nil {
+		t.Fatal(err)
+	}
+
+	if !stream.Next() {
+		t.Fatalf("expected an event, got %v", stream.Err())
+	}
+	if e := stream.Event(); e.Type != events.PaymentDeleted || e.PaymentID != id || e.Status != "created" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// The stream ends with the server
+	a.events.Close()
+	if stream.Next() {
+		t.Errorf("expected the stream to end, got %+v", stream.Event())
+	}
+	if err := stream.Err(); err != nil {
+		t.Error(err)
+	}
+}
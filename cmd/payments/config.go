@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/VMitov/payments/pkg/config"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/ratelimit"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// rateLimitFlags are the flags of the rate limits of the route classes
+var rateLimitFlags = map[string]string{
+	"rate-limit-read":   ratelimit.ClassRead,
+	"rate-limit-write":  ratelimit.ClassWrite,
+	"rate-limit-export": ratelimit.ClassExport,
+}
+
+// validateConfig checks all the settings before the service starts so the
+// problems are reported together with where the values come from
+func validateConfig(cfg *config.Config, fs *flag.FlagSet) error {
+	var errs config.Errors
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s from %s: %v", name, cfg.Source(name), err))
+		}
+	}
+	value := func(name string) string {
+		return fs.Lookup(name).Value.String()
+	}
+	oneOf := func(name string, allowed ...string) {
+		for _, a := range allowed {
+			if value(name) == a {
+				return
+			}
+		}
+		check(name, errors.Errorf("%q is not one of %q", value(name), allowed))
+	}
+	atLeast := func(name string, min float64) {
+		n, err := strconv.ParseFloat(value(name), 64)
+		if d, derr := time.ParseDuration(value(name)); derr == nil {
+			n, err = d.Seconds(), nil
+		}
+		if err == nil && n < min {
+			check(name, errors.Errorf("must be at least %v", min))
+		}
+	}
+
+	var level slog.Level
+	check("log-level", level.UnmarshalText([]byte(value("log-level"))))
+	for name := range rateLimitFlags {
+		_, err := ratelimit.ParseLimit(value(name))
+		check(name, err)
+	}
+	oneOf("rate-limit-by", limitByPrincipal, limitByOrganisation, limitByIP)
+	oneOf("rate-limit-store", "memory", "postgres")
+	_, err := parseProxies(value("trusted-proxies"))
+	check("trusted-proxies", err)
+	oneOf("trace-exporter", "", "otlp", "file")
+	_, err = decimal.NewFromString(value("recon-amount-tolerance"))
+	check("recon-amount-tolerance", err)
+
+	for _, name := range []string{"quota-daily", "quota-monthly", "recon-days-tolerance", "max-body-bytes", "scheduler-interval"} {
+		atLeast(name, 0)
+	}
+	for _, name := range []string{"ready-timeout", "routing-reload", "fraud-reload", "calendars-reload", "tls-reload"} {
+		if d, _ := time.ParseDuration(value(name)); d <= 0 {
+			check(name, errors.New("must be positive"))
+		}
+	}
+	for _, name := range []string{"screening-threshold", "screening-phonetic-threshold"} {
+		if t, _ := strconv.ParseFloat(value(name), 64); t < 0 || t > 1 {
+			check(name, errors.New("must be between 0 and 1"))
+		}
+	}
+	if (value("tls-cert") == "") != (value("tls-key") == "") {
+		check("tls-key", errors.New("tls-cert and tls-key are set together"))
+	}
+
+	return errs.Err()
+}
+
+// reloadable applies the changes of the settings that are safe to change
+// while serving
+func (api *api) reloadable(cfg *config.Config) {
+	cfg.OnReload("log-level", func(value string) error {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return err
+		}
+		api.logLevel.Set(level)
+		return nil
+	})
+
+	for name, class := range rateLimitFlags {
+		class := class
+		cfg.OnReload(name, func(value string) error {
+			if api.rateLimits == nil {
+				return errors.New("rate limiting was disabled at start, restart to enable it")
+			}
+			return api.rateLimits.set(class, value)
+		})
+	}
+
+	quotaReloader := func(set func(limits *quota.Limits, n int)) func(string) error {
+		return func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return errors.New("must be at least 0")
+			}
+			limits := api.quotaLimits()
+			set(&limits, n)
+			api.setQuotaLimits(limits)
+			return nil
+		}
+	}
+	cfg.OnReload("quota-daily", quotaReloader(func(limits *quota.Limits, n int) { limits.Daily = n }))
+	cfg.OnReload("quota-monthly", quotaReloader(func(limits *quota.Limits, n int) { limits.Monthly = n }))
+}
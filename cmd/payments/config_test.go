@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/config"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/ratelimit"
+)
+
+func newTestFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("payments", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.String("config", "", "")
+	fs.String("log-level", "info", "")
+	fs.String("rate-limit-read", "", "")
+	fs.String("rate-limit-write", "", "")
+	fs.String("rate-limit-export", "", "")
+	fs.String("rate-limit-by", limitByPrincipal, "")
+	fs.String("rate-limit-store", "memory", "")
+	fs.String("trusted-proxies", "", "")
+	fs.String("trace-exporter", "", "")
+	fs.String("recon-amount-tolerance", "0", "")
+	fs.Int("quota-daily", 0, "")
+	fs.Int("quota-monthly", 0, "")
+	fs.Int("recon-days-tolerance", 1, "")
+	fs.Int64("max-body-bytes", 1<<20, "")
+	fs.Duration("scheduler-interval", time.Minute, "")
+	fs.Duration("ready-timeout", 2*time.Second, "")
+	fs.Duration("routing-reload", 30*time.Second, "")
+	fs.Duration("fraud-reload", 30*time.Second, "")
+	fs.Duration("calendars-reload", 30*time.Second, "")
+	fs.Duration("tls-reload", time.Minute, "")
+	fs.Float64("screening-threshold", 0.85, "")
+	fs.Float64("screening-phonetic-threshold", 0.75, "")
+	fs.String("tls-cert", "", "")
+	fs.String("tls-key", "", "")
+	return fs
+}
+
+func TestValidateConfig(t *testing.T) {
+	fs := newTestFlags()
+	cfg := config.New(fs, "PAYMENTS_TEST")
+	if err := cfg.Load([]string{"-log-level", "loud", "-rate-limit-by", "user", "-quota-daily", "-1", "-ready-timeout", "0s", "-screening-threshold", "1.5", "-tls-cert", "tls.crt", "-trusted-proxies", "10.0.0.0/33"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := validateConfig(cfg, fs)
+	if err == nil {
+		t.Fatal("expected the settings to be invalid")
+	}
+	for _, s := range []string{
+		`log-level from flag: slog: level string "loud": unknown name`,
+		`rate-limit-by from flag: "user" is not one of ["principal" "organisation" "ip"]`,
+		`quota-daily from flag: must be at least 0`,
+		`ready-timeout from flag: must be positive`,
+		`screening-threshold from flag: must be between 0 and 1`,
+		`tls-key from default: tls-cert and tls-key are set together`,
+		`trusted-proxies from flag: invalid trusted proxy "10.0.0.0/33"`,
+	} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected %s in\n%v", s, err)
+		}
+	}
+
+	if err := validateConfig(config.New(newTestFlags(), "PAYMENTS_TEST"), newTestFlags()); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "payments.yaml")
+	ioutil.WriteFile(file, []byte("rate-limit:\n  read: 10/m\n"), 0600)
+
+	fs := newTestFlags()
+	cfg := config.New(fs, "PAYMENTS_TEST")
+	if err := cfg.Load([]string{"-config", file}); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newTestAPI(nil)
+	a.rateLimits, err = newRateLimits(nil, limitByPrincipal, "memory", "", map[string]string{ratelimit.ClassRead: "10/m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.quotas = quota.Limits{Monthly: 1000}
+	a.reloadable(cfg)
+
+	ioutil.WriteFile(file, []byte("log-level: debug\nrate-limit:\n  read: 100/m:20\nquota:\n  daily: 50\n"), 0600)
+	if err := cfg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.logLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected the debug level, got %s", a.logLevel.Level())
+	}
+	if limit := a.rateLimits.get(ratelimit.ClassRead); limit.Burst != 20 {
+		t.Errorf("expected the reloaded read limit, got %+v", limit)
+	}
+	if limits := a.quotaLimits(); limits != (quota.Limits{Daily: 50, Monthly: 1000}) {
+		t.Errorf("expected the reloaded daily quota, got %+v", limits)
+	}
+}
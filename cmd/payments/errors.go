@@ -1,18 +1,34 @@
 package main
 
 import (
+	stderrors "errors"
 	"net/http"
 
 	"github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/VMitov/payments/pkg/links"
 	"github.com/go-chi/render"
 )
 
-var errNotFound = &errors.ErrResponse{
-	HTTPStatusCode: http.StatusNotFound,
-	StatusText:     "Resource not found.",
+func errNotFound() render.Renderer {
+	return &errors.ErrResponse{
+		HTTPStatusCode: http.StatusNotFound,
+		StatusText:     "Resource not found.",
+	}
 }
 
 func errInvalidRequest(err error) render.Renderer {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
+		return errRequestTooLarge(err)
+	}
+	if stderrors.Is(err, jsonapi.ErrUnsupportedMediaType) {
+		return errUnsupportedMediaType(err)
+	}
+	// JSON:API takes the resource objects of another type as a conflict
+	if stderrors.Is(err, links.ErrType) {
+		return errConflict(err)
+	}
 	return &errors.ErrResponse{
 		Err:            err,
 		HTTPStatusCode: http.StatusBadRequest,
@@ -29,3 +45,93 @@ func errSystem(err error) render.Renderer {
 		ErrorText:      err.Error(),
 	}
 }
+
+func errConflict(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusConflict,
+		StatusText:     "Conflict with the current state of the resource.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errPreconditionFailed(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusPreconditionFailed,
+		StatusText:     "The resource was modified.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errBlocked(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnprocessableEntity,
+		StatusText:     "Payment blocked.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errUnprocessable(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnprocessableEntity,
+		StatusText:     "Request can not be processed.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errForbidden(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "Request is not allowed.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errTooManyRequests(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusTooManyRequests,
+		StatusText:     "Too many requests.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errUnauthorized(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnauthorized,
+		StatusText:     "Authentication required.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errRequestTooLarge(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+		StatusText:     "Request body too large.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errUnsupportedMediaType(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusUnsupportedMediaType,
+		StatusText:     "Unsupported media type.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errNotAcceptable(err error) render.Renderer {
+	return &errors.ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusNotAcceptable,
+		StatusText:     "Not acceptable.",
+		ErrorText:      err.Error(),
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/go-chi/render"
+)
+
+// keepAlive is how often an idle stream is written to so the proxies do
+// not close it
+const keepAlive = 30 * time.Second
+
+// publish publishes the change of the payment, failing to is only logged
+// since the change is done
+func (api *api) publish(r *http.Request, typ string, p *payment.Payment) {
+	api.publishTo(r.Context(), org(r), typ, p)
+}
+
+// publishChange publishes the change of the status of the payment made by
+// an approval, a screening decision or a fraud review
+func (api *api) publishChange(r *http.Request, id string) {
+	api.publishID(r.Context(), org(r), events.PaymentUpdated, id)
+}
+
+// publishID gets the payment of the organisation and publishes its change
+func (api *api) publishID(ctx context.Context, org, typ, id string) {
+	if api.publisher == nil {
+		return
+	}
+
+	p, err := payment.Get(ctx, api.db, org, id)
+	if err != nil {
+		logging.FromContext(ctx).Error("publishing event failed", logging.Error(err), "event", typ)
+		return
+	}
+	api.publishTo(ctx, org, typ, p)
+}
+
+func (api *api) publishTo(ctx context.Context, org, typ string, p *payment.Payment) {
+	if api.publisher == nil {
+		return
+	}
+
+	e := events.Event{
+		Type:         typ,
+		PaymentID:    p.ID,
+		Kind:         p.Kind,
+		Status:       p.Status,
+		Time:         time.Now().UTC(),
+		Organisation: org,
+	}
+	if err := api.publisher.Publish(e); err != nil {
+		logging.FromContext(ctx).Error("publishing event failed", logging.Error(err), "event", typ)
+	}
+}
+
+// streamEvents streams the changes of the payments of the organisation as
+// server-sent events until the client goes away or falls behind
+func (api *api) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if api.events == nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	ch, cancel := api.events.Subscribe(org(r))
+	defer cancel()
+
+	// The stream outlives the write timeout of the server
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("encoding event failed", logging.Error(err))
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
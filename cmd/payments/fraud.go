@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/fraud"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/screening"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// evaluateFraud runs the fraud rules of the event for the payment of the
+// organisation or returns nil without rules
+func (api *api) evaluateFraud(org string, p *payment.Payment, event string, now time.Time) (d *fraud.Decision, err error) {
+	if api.fraud == nil {
+		return nil, nil
+	}
+
+	err = tenant.Scoped(api.db, org, func(tx *sqlx.Tx) error {
+		d, err = api.fraud.Evaluate(p, fraud.DBCounters{DB: tx, Organisation: org}, event, now)
+		return err
+	})
+	return d, err
+}
+
+// checkFraud evaluates the rules of the event on a payment that is changed
+// or released and applies the decision within the transaction. The payment
+// is not counted against itself.
+func (api *api) checkFraud(tx *sqlx.Tx, org, id string, p *payment.Payment, event string) (*fraud.Decision, error) {
+	if api.fraud == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	d, err := api.fraud.Evaluate(p, fraud.DBCounters{DB: tx, Organisation: org, Exclude: id}, event, now)
+	if err != nil {
+		return nil, err
+	}
+	return d, fraud.ApplyTx(tx, org, id, p, d, now)
+}
+
+// released evaluates the fraud rules again on a payment of the organisation
+// released from approval or screening, since the counters may have moved
+// while it waited
+func (api *api) released(org string) payment.Hook {
+	return func(tx *sqlx.Tx, id string) error {
+		if api.fraud == nil {
+			return nil
+		}
+
+		p, err := payment.GetTx(tx, org, id)
+		if err != nil {
+			return err
+		}
+		_, err = api.checkFraud(tx, org, id, p, fraud.EventRelease)
+		return err
+	}
+}
+
+func blocked(paymentID string, d *fraud.Decision) error {
+	return fmt.Errorf("payment %s blocked: %s", paymentID, strings.Join(d.Reasons, "; "))
+}
+
+func (api *api) listFraudDecisions(w http.ResponseWriter, r *http.Request) {
+	paymentID := chi.URLParam(r, "paymentID")
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	decisions, err := fraud.SelectDecisions(api.db, org(r), paymentID)
+	if err == sql.ErrNoRows {
+		decisions = []fraud.StoredDecision{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, fraud.NewDecisionListResource(decisions, "/payments/"+paymentID+"/fraud-decisions"))
+}
+
+func (api *api) reviewPayment(w http.ResponseWriter, r *http.Request) {
+	data := &fraud.ReviewResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	paymentID := chi.URLParam(r, "paymentID")
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	review := data.Data.Attributes
+	if review.Outcome == fraud.OutcomeAllow {
+		open, err := screening.OpenCase(api.db, org(r), paymentID)
+		if err != nil {
+			render.Render(w, r, errSystem(err))
+			return
+		}
+		if open {
+			render.Render(w, r, errConflict(fmt.Errorf("payment has an open screening case")))
+			return
+		}
+	}
+
+	if err := fraud.Review(api.db, org(r), paymentID, review.Outcome, user(r), review.Note); err != nil {
+		if err == fraud.ErrMissingReviewer {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+		if errors.Cause(err) == payment.ErrInvalidTransition {
+			render.Render(w, r, errConflict(err))
+			return
+		}
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	pay, err := payment.Get(r.Context(), api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	api.publish(r, events.PaymentUpdated, pay)
+
+	render.Render(w, r, newPayment(pay))
+}
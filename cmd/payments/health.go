@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/health"
+	"github.com/VMitov/payments/pkg/links"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+)
+
+// checkDatabase checks that the database accepts connections
+func checkDatabase(db *sqlx.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+func (api *api) healthz(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, map[string]string{"status": health.StatusOK})
+}
+
+func (api *api) readyz(w http.ResponseWriter, r *http.Request) {
+	report := &health.Report{Status: health.StatusOK, CheckedAt: time.Now(), Checks: []health.Result{}}
+	if api.health != nil {
+		report = api.health.Check(r.Context())
+	}
+
+	if !report.OK() {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, report)
+}
+
+// DiagnosticsType is the type of the diagnostics resource
+const DiagnosticsType = "Diagnostics"
+
+type diagnostics struct {
+	Build         map[string]string `json:"build"`
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds float64           `json:"uptime_seconds"`
+	Goroutines    int               `json:"goroutines"`
+	Config        map[string]string `json:"config"`
+	Database      sql.DBStats       `json:"database"`
+	Health        *health.Report    `json:"health"`
+}
+
+type diagnosticsResource struct {
+	Data struct {
+		ID         string       `json:"id"`
+		Type       string       `json:"type"`
+		Attributes *diagnostics `json:"attributes"`
+
+		links.Resource
+	} `json:"data"`
+}
+
+// Render implements render.Render
+func (resource *diagnosticsResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (api *api) getDiagnostics(w http.ResponseWriter, r *http.Request) {
+	d := &diagnostics{
+		Build:         buildInfo(),
+		StartedAt:     api.started,
+		UptimeSeconds: time.Since(api.started).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+	}
+	if api.config != nil {
+		d.Config = api.config.Effective()
+	}
+	if api.db != nil {
+		d.Database = api.db.Stats()
+	}
+	if api.health != nil {
+		d.Health = api.health.Check(r.Context())
+	}
+
+	resource := &diagnosticsResource{}
+	resource.Data.ID = "diagnostics"
+	resource.Data.Type = DiagnosticsType
+	resource.Data.Attributes = d
+	resource.Data.Links.Self = "/diagnostics"
+	render.Render(w, r, resource)
+}
+
+// buildInfo returns the versions the binary was built from
+func buildInfo() map[string]string {
+	info := map[string]string{"go_version": runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info["path"] = bi.Path
+	info["version"] = bi.Main.Version
+	for _, s := range bi.Settings {
+		if strings.HasPrefix(s.Key, "vcs.") {
+			info[s.Key] = s.Value
+		}
+	}
+	return info
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/idempotency"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+)
+
+// idempotencyKeyTTL is how long the responses are kept for the retries
+const idempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a request may hold its key before a retry
+// takes it over. It is longer than any request may take.
+const idempotencyLease = 5 * time.Minute
+
+// committedKey is the context key of the flag set once a request changed
+// the data
+type committedKey struct{}
+
+// committed marks the request of an idempotent handler as having changed the
+// data, so its key is kept even if it fails afterwards
+func committed(r *http.Request) {
+	if done, ok := r.Context().Value(committedKey{}).(*bool); ok {
+		*done = true
+	}
+}
+
+// idempotent answers the retries of the requests with an Idempotency-Key
+// with the response of the first request instead of repeating it. The
+// failures a retry may get past are not kept unless the handler committed
+// changes before failing.
+func (api *api) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotency.Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > idempotency.MaxKeyLength {
+			render.Render(w, r, errInvalidRequest(fmt.Errorf("Idempotency-Key is longer than %d characters", idempotency.MaxKeyLength)))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash := idempotency.Hash(r.Method, r.URL.Path, body)
+
+		stored, err := idempotency.Begin(api.db, org(r), key, hash, time.Now().Add(-idempotencyLease))
+		if err != nil {
+			render.Render(w, r, errSystem(err))
+			return
+		}
+		if stored != nil {
+			switch err := stored.Replayable(hash); err {
+			case nil:
+			case idempotency.ErrInProgress:
+				w.Header().Set("Retry-After", "1")
+				render.Render(w, r, errConflict(err))
+				return
+			default:
+				render.Render(w, r, errUnprocessable(err))
+				return
+			}
+
+			w.Header().Set("Content-Type", stored.ContentType)
+			if stored.Location != "" {
+				w.Header().Set("Location", stored.Location)
+			}
+			if stored.ETag != "" {
+				w.Header().Set("ETag", stored.ETag)
+			}
+			w.Header().Set(idempotency.ReplayedHeader, "true")
+			w.WriteHeader(*stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		kept, done := false, false
+		r = r.WithContext(context.WithValue(r.Context(), committedKey{}, &done))
+		defer func() {
+			// Also releases the key when the handler panics before it
+			// committed
+			if !kept && !done {
+				if err := idempotency.Release(api.db, org(r), key); err != nil {
+					logging.FromContext(r.Context()).Error("releasing idempotency key failed", logging.Error(err))
+				}
+			}
+		}()
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if !done && (status >= http.StatusInternalServerError || status == http.StatusTooManyRequests) {
+			return
+		}
+
+		// A response that fails to be stored is not released either so the
+		// retries can not repeat the request
+		kept = true
+		res := &idempotency.Response{
+			Status:      &status,
+			ContentType: ww.Header().Get("Content-Type"),
+			Location:    ww.Header().Get("Location"),
+			ETag:        ww.Header().Get("ETag"),
+			Body:        buf.Bytes(),
+		}
+		if err := idempotency.Complete(api.db, org(r), key, res); err != nil {
+			logging.FromContext(r.Context()).Error("storing idempotent response failed", logging.Error(err))
+		}
+	})
+}
+
+// pruneIdempotencyKeys deletes the expired keys every hour until the
+// context is cancelled
+func (api *api) pruneIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := idempotency.Prune(api.db, time.Now().Add(-idempotencyKeyTTL)); err != nil {
+			slog.Error("pruning idempotency keys failed", logging.Error(err))
+		}
+	}
+}
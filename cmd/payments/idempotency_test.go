@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/idempotency"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestIdempotentFailure fails creates with an Idempotency-Key before and
+// after the payment is committed. Only the key of the uncommitted create is
+// released for the retries.
+func TestIdempotentFailure(t *testing.T) {
+	const (
+		id   = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		body = `{"data":{"type":"Payment","attributes":{"amount":"100.21"}}}`
+	)
+
+	testCases := map[string]struct {
+		givenF func(mock sqlmock.Sqlmock)
+	}{
+		"BeforeCommit": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("INSERT INTO payments").WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		"AfterCommit": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("INSERT INTO payments").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectExec("UPDATE idempotency_keys").WithArgs(500, sqlmock.AnyArg(), "", "", sqlmock.AnyArg(), testOrganisation, "order-42").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			expectScoped(mock, testOrganisation)
+			mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			tc.givenF(mock)
+
+			req := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+			req.Header.Set(idempotency.Header, "order-42")
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != 500 {
+				t.Errorf("expected 500, got %d", resp.Code)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestIdempotentRetry retries a create with an Idempotency-Key while the
+// first one is processed and after it completed
+func TestIdempotentRetry(t *testing.T) {
+	const (
+		id   = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		body = `{"data":{"type":"Payment","attributes":{"amount":"100.21"}}}`
+	)
+	hash := idempotency.Hash("POST", "/payments", []byte(body))
+
+	testCases := map[string]struct {
+		status  interface{}
+		code    int
+		headers map[string]string
+	}{
+		"InProgress": {
+			status:  nil,
+			code:    409,
+			headers: map[string]string{"Retry-After": "1", "Location": "", idempotency.ReplayedHeader: ""},
+		},
+		"Completed": {
+			status:  201,
+			code:    201,
+			headers: map[string]string{"Location": "/payments/" + id, "ETag": `"1"`, idempotency.ReplayedHeader: "true"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			expectScoped(mock, testOrganisation)
+			mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("SELECT request_hash").
+				WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status", "content_type", "location", "etag", "body"}).
+					AddRow(hash, tc.status, "application/vnd.api+json", "/payments/"+id, `"1"`, []byte(`{"data":{"id":"`+id+`","type":"Payment","attributes":{"amount":"100.21"},"links":{"self":"/payments/`+id+`"}},"jsonapi":{"version":"1.1"}}`)))
+			mock.ExpectCommit()
+
+			req := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+			req.Header.Set(idempotency.Header, "order-42")
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, resp.Code)
+			}
+			for header, value := range tc.headers {
+				if got := resp.Header().Get(header); got != value {
+					t.Errorf("expected %s %q, got %q", header, value, got)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
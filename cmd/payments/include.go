@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VMitov/payments/pkg/approval"
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/links"
+	"github.com/VMitov/payments/pkg/payment"
+)
+
+// includable are the relationships of the payments that can be included in
+// their documents
+var includable = map[string]bool{"refunds": true, "original": true, "approvals": true}
+
+// notIncludable are the reasons the relationships asked for that are not
+// resources of the service can not be included
+var notIncludable = map[string]string{
+	"batch":       "the payments are not grouped in batches",
+	"beneficiary": "the beneficiary is the beneficiary_party attribute of the payment, select it with fields[Payment]",
+}
+
+// compound is how the request shapes the documents of the payments: the
+// relationships to include and the sparse fieldsets
+type compound struct {
+	include []string
+	fields  links.Fieldsets
+}
+
+// parseCompound parses the include and the fields[TYPE] parameters of the
+// request
+func parseCompound(r *http.Request) (*compound, error) {
+	query := r.URL.Query()
+	c := &compound{fields: links.Fieldsets{}}
+
+	if include := query.Get("include"); include != "" {
+		for _, path := range strings.Split(include, ",") {
+			if reason, ok := notIncludable[path]; ok {
+				return nil, errors.Parameter("include", fmt.Errorf("%q can not be included, %s", path, reason))
+			}
+			if !includable[path] {
+				return nil, errors.Parameter("include", fmt.Errorf("%q can not be included", path))
+			}
+			c.include = append(c.include, path)
+		}
+	}
+
+	for param, values := range query {
+		typ, ok := links.FieldsetType(param)
+		if !ok {
+			continue
+		}
+		fields, err := links.ParseFieldset(strings.Join(values, ","))
+		if err != nil {
+			return nil, errors.Parameter(param, err)
+		}
+		c.fields[typ] = fields
+	}
+
+	return c, nil
+}
+
+// shape includes the related resources of the payments in the document and
+// limits the payments to their fieldset
+func (api *api) shape(r *http.Request, c *compound, doc *links.Document, data ...*payment.ResourceData) error {
+	fields := c.fields[payment.Type]
+
+	ids := make([]string, len(data))
+	byID := map[string]*payment.ResourceData{}
+	seen := map[links.Identifier]bool{}
+	for i, d := range data {
+		ids[i] = d.ID
+		byID[d.ID] = d
+		seen[links.Identifier{Type: payment.Type, ID: d.ID}] = true
+	}
+
+	var payments []*payment.ResourceData
+	includePayments := func(ps []payment.Payment) {
+		for i := range ps {
+			id := links.Identifier{Type: payment.Type, ID: ps[i].ID}
+			if !seen[id] {
+				seen[id] = true
+				payments = append(payments, newPayment(&ps[i]).Data)
+			}
+		}
+	}
+
+	var approvals []*approval.ResourceData
+	for _, path := range c.include {
+		switch path {
+		case "refunds":
+			refunds, err := payment.SelectRefundsOf(r.Context(), api.db, org(r), ids, fields)
+			if err != nil {
+				return err
+			}
+			byOriginal := map[string][]*links.Identifier{}
+			for _, refund := range refunds {
+				byOriginal[*refund.OriginalID] = append(byOriginal[*refund.OriginalID],
+					&links.Identifier{Type: payment.Type, ID: refund.ID})
+			}
+			for _, d := range data {
+				if d.OriginalID != nil {
+					continue
+				}
+				identifiers := byOriginal[d.ID]
+				if identifiers == nil {
+					identifiers = []*links.Identifier{}
+				}
+				d.Relate("refunds", links.Related("/payments/"+d.ID+"/refunds", identifiers))
+			}
+			includePayments(refunds)
+
+		case "original":
+			var originalIDs []string
+			for _, d := range data {
+				if d.OriginalID != nil {
+					originalIDs = append(originalIDs, *d.OriginalID)
+				}
+			}
+			if len(originalIDs) == 0 {
+				continue
+			}
+			originals, err := payment.SelectIn(r.Context(), api.db, org(r), originalIDs, fields)
+			if err != nil {
+				return err
+			}
+			includePayments(originals)
+
+		case "approvals":
+			requests, err := approval.SelectFor(api.db, org(r), ids)
+			if err != nil {
+				return err
+			}
+			for i := range requests {
+				self := "/payments/" + requests[i].PaymentID + "/approvals"
+				resource := approval.NewResource(&requests[i], self).Data
+				byID[requests[i].PaymentID].Relate("approvals",
+					links.Related(self, &links.Identifier{Type: approval.Type, ID: resource.ID}))
+				approvals = append(approvals, resource)
+			}
+		}
+	}
+
+	for _, d := range data {
+		if err := d.Sparse(fields); err != nil {
+			return err
+		}
+	}
+	for _, d := range payments {
+		if err := d.Sparse(fields); err != nil {
+			return err
+		}
+		doc.Included = append(doc.Included, d)
+	}
+	for _, a := range approvals {
+		if fields, ok := c.fields[approval.Type]; ok {
+			obj, err := fields.Object(a)
+			if err != nil {
+				return err
+			}
+			doc.Included = append(doc.Included, obj)
+			continue
+		}
+		doc.Included = append(doc.Included, a)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestInclude gets a refunded payment with its refunds and approvals
+// included, limited to the amount and the currency
+func TestInclude(t *testing.T) {
+	const refundID = "7eb8277a-6c91-45e9-8a03-a27f82aca350"
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	attributes := []byte(`{"amount":"100.21","currency":"GBP","beneficiary_party":{"name":"W Owens","account_number":"31926819"}}`)
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery(`SELECT \* FROM payments WHERE id=\$1`).WithArgs(testPaymentID, testOrganisation).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+			AddRow(testPaymentID, attributes, "partially_refunded", "payment"))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery(`SELECT id, organisation_id, status, kind, original_id, reconciled_at,.+FROM payments WHERE original_id = ANY\(\$1\)`).
+		WithArgs("{\""+testPaymentID+"\"}", testOrganisation, `{"amount","beneficiary_party","refunds"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind", "original_id"}).
+			AddRow(refundID, []byte(`{"amount":"10.00"}`), "submitted", "refund", testPaymentID))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery(`SELECT \* FROM approval_requests WHERE payment_id = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_id", "maker", "policy", "required", "status", "created_at"}).
+			AddRow(testPaymentID, "maker", "large", 1, "approved", time.Now()))
+	mock.ExpectQuery(`SELECT \* FROM approvals WHERE payment_id = ANY\(\$1\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"payment_id", "approver", "decision", "decided_at"}).
+			AddRow(testPaymentID, "checker", "approve", time.Now()))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("GET", "/payments/"+testPaymentID+
+		"?include=refunds,approvals&fields[Payment]=amount,beneficiary_party.name,refunds&fields[PaymentApproval]=status", nil)
+	req.Header.Set("Accept", jsonapi.MediaType)
+	resp := httptest.NewRecorder()
+	testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	var doc struct {
+		Data struct {
+			Attributes    json.RawMessage `json:"attributes"`
+			Relationships map[string]struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"relationships"`
+		} `json:"data"`
+		Included []struct {
+			Type       string          `json:"type"`
+			ID         string          `json:"id"`
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"included"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(doc.Data.Attributes), `{"amount":"100.21","beneficiary_party":{"name":"W Owens"}}`; got != want {
+		t.Errorf("expected attributes %s, got %s", want, got)
+	}
+	if got, want := string(doc.Data.Relationships["refunds"].Data), `[{"type":"Payment","id":"`+refundID+`"}]`; got != want {
+		t.Errorf("expected refunds %s, got %s", want, got)
+	}
+	if _, ok := doc.Data.Relationships["approvals"]; ok {
+		t.Errorf("expected the approvals relationship out of the fieldset, got %s", resp.Body.String())
+	}
+
+	want := []struct{ typ, id, attributes string }{
+		{"Payment", refundID, `{"amount":"10.00"}`},
+		{"PaymentApproval", testPaymentID, `{"status":"approved"}`},
+	}
+	if len(doc.Included) != len(want) {
+		t.Fatalf("expected %d included, got %s", len(want), resp.Body.String())
+	}
+	for i, w := range want {
+		got := doc.Included[i]
+		if got.Type != w.typ || got.ID != w.id || string(got.Attributes) != w.attributes {
+			t.Errorf("expected included %s %s %s, got %s %s %s", w.typ, w.id, w.attributes, got.Type, got.ID, got.Attributes)
+		}
+	}
+}
+
+func TestParseCompoundNotIncludable(t *testing.T) {
+	testCases := map[string]string{
+		"batch":       `"batch" can not be included, the payments are not grouped in batches`,
+		"beneficiary": `"beneficiary" can not be included, the beneficiary is the beneficiary_party attribute`,
+		"mandate":     `"mandate" can not be included`,
+	}
+
+	for path, expected := range testCases {
+		t.Run(path, func(t *testing.T) {
+			_, err := parseCompound(httptest.NewRequest("GET", "/payments?include=refunds,"+path, nil))
+			if err == nil || !strings.HasPrefix(err.Error(), expected) {
+				t.Errorf("expected %s, got %v", expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/go-chi/render"
+)
+
+func init() {
+	// The resources are rendered and bound as JSON:API documents in the
+	// negotiated format
+	render.Respond = jsonapi.Respond
+	render.Decode = jsonapi.Decode
+}
+
+// negotiate refuses the requests with the JSON:API media type only with
+// parameters the service does not support, extensions in particular, and
+// the requests for the extensions of no format
+func negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.Header.Get("Content-Type"); !jsonapi.SupportedContentType(contentType) {
+			render.Render(w, r, errUnsupportedMediaType(errors.Header("Content-Type",
+				fmt.Errorf("%s parameters are not supported", contentType))))
+			return
+		}
+		if _, err := jsonapi.Negotiate(r); err != nil {
+			render.Render(w, r, errNotAcceptable(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+const testPaymentID = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+
+// TestNegotiation requests the JSON:API media type with parameters the
+// service does not support
+func TestNegotiation(t *testing.T) {
+	const payment = `{"data":{"type":"Payment","attributes":{"amount":"100.21"}}}`
+
+	testCases := map[string]struct {
+		method, path, contentType, accept string
+		status                            int
+		header                            string
+	}{
+		"ContentTypeExtension": {
+			method: "POST", path: "/payments", contentType: jsonapi.MediaType + `; ext="https://jsonapi.org/ext/atomic"`,
+			status: http.StatusUnsupportedMediaType, header: "Content-Type",
+		},
+		"ContentTypeCharset": {
+			method: "POST", path: "/payments", contentType: jsonapi.MediaType + "; charset=utf-8",
+			status: http.StatusUnsupportedMediaType, header: "Content-Type",
+		},
+		"ContentTypeText": {
+			method: "POST", path: "/payments", contentType: "text/plain",
+			status: http.StatusUnsupportedMediaType, header: "Content-Type",
+		},
+		"AcceptExtension": {
+			method: "GET", path: "/permissions", accept: jsonapi.MediaType + `; ext="https://jsonapi.org/ext/atomic"`,
+			status: http.StatusNotAcceptable, header: "Accept",
+		},
+		"AcceptOneWithoutParameters": {
+			method: "GET", path: "/permissions", accept: jsonapi.MediaType + `; ext="https://jsonapi.org/ext/atomic", ` + jsonapi.MediaType,
+			status: http.StatusOK,
+		},
+		"AcceptProfile": {
+			method: "GET", path: "/permissions", accept: jsonapi.MediaType + `; profile="https://example.com/profile"`,
+			status: http.StatusOK,
+		},
+		"AcceptAny": {
+			method: "GET", path: "/permissions", accept: "*/*",
+			status: http.StatusOK,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(payment))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, resp.Code, resp.Body.String())
+			}
+			if ct := resp.Header().Get("Content-Type"); ct != jsonapi.MediaType {
+				t.Errorf("expected %s, got %s", jsonapi.MediaType, ct)
+			}
+			if tc.header != "" {
+				if source := errorSource(t, resp); source.Header != tc.header {
+					t.Errorf("expected the error of %s, got %+v", tc.header, source)
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+// TestErrorSource sends invalid documents and expects the errors to point at
+// the members at fault
+func TestErrorSource(t *testing.T) {
+	const other = "7eb8277a-6c91-45e9-8a03-a27f82aca350"
+
+	testCases := map[string]struct {
+		method, path, body string
+		status             int
+		source             errors.Source
+	}{
+		"NotAnObject": {
+			method: "POST", path: "/payments", body: `{"data":"payment"}`,
+			status: http.StatusBadRequest, source: errors.Source{Pointer: "/data"},
+		},
+		"NoType": {
+			method: "POST", path: "/payments", body: `{"data":{"attributes":{}}}`,
+			status: http.StatusBadRequest, source: errors.Source{Pointer: "/data/type"},
+		},
+		"OtherType": {
+			method: "POST", path: "/payments", body: `{"data":{"type":"Refund","attributes":{}}}`,
+			status: http.StatusConflict, source: errors.Source{Pointer: "/data/type"},
+		},
+		"NoAttributes": {
+			method: "POST", path: "/payments", body: `{"data":{"type":"Payment"}}`,
+			status: http.StatusBadRequest, source: errors.Source{Pointer: "/data/attributes"},
+		},
+		"ClientIDNotUUID": {
+			method: "POST", path: "/payments", body: `{"data":{"type":"Payment","id":"1","attributes":{}}}`,
+			status: http.StatusForbidden, source: errors.Source{Pointer: "/data/id"},
+		},
+		"RefundClientID": {
+			method: "POST", path: "/payments/" + testPaymentID + "/refunds", body: `{"data":{"type":"Payment","id":"` + other + `","attributes":{}}}`,
+			status: http.StatusForbidden, source: errors.Source{Pointer: "/data/id"},
+		},
+		"UpdateOtherID": {
+			method: "PUT", path: "/payments/" + testPaymentID, body: `{"data":{"type":"Payment","id":"` + other + `","attributes":{}}}`,
+			status: http.StatusConflict, source: errors.Source{Pointer: "/data/id"},
+		},
+		"PageSize": {
+			method: "GET", path: "/payments?page[size]=0",
+			status: http.StatusBadRequest, source: errors.Source{Parameter: "page[size]"},
+		},
+		"FilterKind": {
+			method: "GET", path: "/payments?filter[kind]=transfer",
+			status: http.StatusBadRequest, source: errors.Source{Parameter: "filter[kind]"},
+		},
+		"FilterPath": {
+			method: "GET", path: "/payments?filter[beneficiary_party..name]=Jane",
+			status: http.StatusBadRequest, source: errors.Source{Parameter: "filter[beneficiary_party..name]"},
+		},
+		"IncludeUnknown": {
+			method: "GET", path: "/payments?include=refunds,batch",
+			status: http.StatusBadRequest, source: errors.Source{Parameter: "include"},
+		},
+		"FieldsInvalid": {
+			method: "GET", path: "/payments/" + testPaymentID + "?fields[Payment]=amount,,currency",
+			status: http.StatusBadRequest, source: errors.Source{Parameter: "fields[Payment]"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, _, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", jsonapi.MediaType)
+
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, resp.Code, resp.Body.String())
+			}
+			if source := errorSource(t, resp); source != tc.source {
+				t.Errorf("expected %+v, got %+v", tc.source, source)
+			}
+		})
+	}
+}
+
+// errorSource returns the source of the error of the response
+func errorSource(t *testing.T, resp *httptest.ResponseRecorder) errors.Source {
+	t.Helper()
+
+	var doc errors.Document
+	if err := json.Unmarshal(resp.Body.Bytes(), &doc); err != nil || len(doc.Errors) != 1 {
+		t.Fatalf("expected an error document, got %s", resp.Body.String())
+	}
+	if doc.JSONAPI == nil || doc.JSONAPI.Version != "1.1" {
+		t.Errorf("expected the jsonapi member, got %s", resp.Body.String())
+	}
+	if doc.Errors[0].Source == nil {
+		return errors.Source{}
+	}
+	return *doc.Errors[0].Source
+}
+
+func TestClientGeneratedID(t *testing.T) {
+	const body = `{"data":{"type":"Payment","id":"` + testPaymentID + `","attributes":{"amount":"100.21"}}}`
+
+	testCases := map[string]struct {
+		insertErr error
+		status    int
+	}{
+		"Created": {status: http.StatusCreated},
+		"Taken":   {insertErr: &pq.Error{Code: "23505"}, status: http.StatusConflict},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			expectScoped(mock, testOrganisation)
+			insert := mock.ExpectQuery(`INSERT INTO payments \(id, organisation_id, attributes\)`).
+				WithArgs(testPaymentID, testOrganisation, `{"amount":"100.21"}`)
+			if tc.insertErr != nil {
+				insert.WillReturnError(tc.insertErr)
+				mock.ExpectRollback()
+			} else {
+				insert.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testPaymentID))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow(testPaymentID, []byte(`{"amount":"100.21"}`), "created"))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest("POST", "/payments", strings.NewReader(body))
+			req.Header.Set("Content-Type", jsonapi.MediaType)
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, resp.Code, resp.Body.String())
+			}
+			if tc.status == http.StatusCreated {
+				if location := resp.Header().Get("Location"); location != "/payments/"+testPaymentID {
+					t.Errorf("expected the location of the payment, got %q", location)
+				}
+			} else if source := errorSource(t, resp); source.Pointer != "/data/id" {
+				t.Errorf("expected the error of the id, got %+v", source)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+// TestFormats reads and writes the payments in every format, by the
+// extension of the URL and by the headers
+func TestFormats(t *testing.T) {
+	const attributes = `{"amount":"100.21","currency":"GBP"}`
+
+	testCases := map[string]struct {
+		path, accept, contentType string
+		format                    *jsonapi.Format
+		create                    bool
+	}{
+		"GetXMLExtension":      {path: "/payments/" + testPaymentID + ".xml", format: jsonapi.Formats[1]},
+		"GetCSVAccept":         {path: "/payments/" + testPaymentID, accept: "text/csv", format: jsonapi.Formats[2]},
+		"GetMessagePackAccept": {path: "/payments/" + testPaymentID, accept: "application/msgpack", format: jsonapi.Formats[3]},
+		"CreateXML":            {path: "/payments", contentType: "application/xml", accept: "application/xml", format: jsonapi.Formats[1], create: true},
+		"CreateCSV":            {path: "/payments.csv", format: jsonapi.Formats[2], create: true},
+		"CreateMessagePack":    {path: "/payments.msgpack", contentType: "application/x-msgpack", format: jsonapi.Formats[3], create: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			method, body := "GET", &bytes.Buffer{}
+			if tc.create {
+				method = "POST"
+				doc := map[string]interface{}{
+					"data": map[string]interface{}{"type": payment.Type, "attributes": json.RawMessage(attributes)},
+				}
+				if err := tc.format.Encode(body, doc); err != nil {
+					t.Fatal(err)
+				}
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery(`INSERT INTO payments \(organisation_id, attributes\)`).
+					WithArgs(testOrganisation, attributes).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testPaymentID))
+				mock.ExpectCommit()
+			}
+			expectScoped(mock, testOrganisation)
+			mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+				AddRow(testPaymentID, []byte(attributes), "created"))
+			mock.ExpectCommit()
+
+			req := httptest.NewRequest(method, tc.path, body)
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK && resp.Code != http.StatusCreated {
+				t.Fatalf("expected success, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if ct := resp.Header().Get("Content-Type"); ct != tc.format.MediaType {
+				t.Errorf("expected %s, got %s", tc.format.MediaType, ct)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+
+			got := &payment.Resource{}
+			if err := tc.format.Decode(resp.Body, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Data == nil || got.Data.Payment == nil || got.Data.ID != testPaymentID || got.Data.Type != payment.Type {
+				t.Fatalf("expected the payment, got %+v", got.Data)
+			}
+			var decoded, expected map[string]string
+			json.Unmarshal(got.Data.Attributes, &decoded)
+			json.Unmarshal([]byte(attributes), &expected)
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("expected %s, got %s", attributes, got.Data.Attributes)
+			}
+			if got.Data.Links.Self != "/payments/"+testPaymentID {
+				t.Errorf("expected the link of the payment, got %q", got.Data.Links.Self)
+			}
+		})
+	}
+}
+
+func TestFormatNotAcceptable(t *testing.T) {
+	mockDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	req := httptest.NewRequest("GET", "/payments/"+testPaymentID+".html", nil)
+	resp := httptest.NewRecorder()
+	testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected %d, got %d: %s", http.StatusNotAcceptable, resp.Code, resp.Body.String())
+	}
+	if ct := resp.Header().Get("Content-Type"); ct != jsonapi.MediaType {
+		t.Errorf("expected %s, got %s", jsonapi.MediaType, ct)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/trace"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+)
+
+// logRequests logs a JSON line for every request with the fields collected
+// while handling it. Server errors are logged with their error.
+func (api *api) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		logger := api.log().With(slog.String("request_id", middleware.GetReqID(r.Context())))
+		if sc := trace.FromContext(r.Context()).SpanContext(); sc.IsValid() {
+			logger = logger.With(slog.String("trace_id", sc.TraceID.String()))
+		}
+		ctx, fields := logging.WithFields(logging.NewContext(r.Context(), logger))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", code),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("latency_ms", float64(time.Since(start))/float64(time.Millisecond)),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				attrs = append(attrs, slog.String("route", pattern))
+			}
+			if id := rctx.URLParam("paymentID"); id != "" {
+				attrs = append(attrs, slog.String("payment_id", id))
+			}
+		}
+		attrs = append(attrs, fields.Attrs()...)
+
+		level := slog.LevelInfo
+		if code >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// annotate adds the attributes to the line of the request and to the logger
+// of its handlers
+func annotate(r *http.Request, attrs ...slog.Attr) *http.Request {
+	logging.Add(r.Context(), attrs...)
+
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = a
+	}
+	return r.WithContext(logging.NewContext(r.Context(), logging.FromContext(r.Context()).With(args...)))
+}
+
+func (api *api) log() *slog.Logger {
+	if api.logger == nil {
+		return slog.Default()
+	}
+	return api.logger
+}
+
+func (api *api) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, logging.NewLevelResource(api.logLevel.Level(), "/admin/log-level"))
+}
+
+func (api *api) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	data := &logging.LevelResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	from := api.logLevel.Level()
+	api.logLevel.Set(data.Level())
+	logging.FromContext(r.Context()).Warn("log level changed",
+		slog.String("from", from.String()), slog.String("to", data.Level().String()))
+
+	render.Render(w, r, logging.NewLevelResource(api.logLevel.Level(), "/admin/log-level"))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestRequestLog(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payments").WillReturnError(errors.New("connection refused"))
+	mock.ExpectRollback()
+
+	buf := &bytes.Buffer{}
+	a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+	a.logger = logging.New(buf, &a.logLevel)
+
+	req := httptest.NewRequest("GET", "/payments", nil)
+	req.Header.Set(userHeader, "alice")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp := httptest.NewRecorder()
+	testRouter(a).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	line := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range map[string]interface{}{
+		"level":        "ERROR",
+		"msg":          "request",
+		"method":       "GET",
+		"route":        "/payments/",
+		"status":       float64(500),
+		"principal":    "alice",
+		"organisation": testOrganisation,
+	} {
+		if line[k] != v {
+			t.Errorf("expected %s %v, got %v", k, v, line[k])
+		}
+	}
+	if id, _ := line["request_id"].(string); id == "" {
+		t.Errorf("expected a request id, got %v", line["request_id"])
+	}
+	if e, _ := line["error"].(map[string]interface{}); e == nil || e["message"] != "connection refused" {
+		t.Errorf("expected the error of the response, got %v", line["error"])
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("expected no credentials in the logs, got %s", buf.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	a := newTestAPI(nil)
+	a.logger = logging.New(buf, &a.logLevel)
+	router := testRouter(a)
+
+	request := func(method, body, scopes string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body))
+		req.Header.Set(scopesHeader, scopes)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	if resp := request("PUT", `{"data":{"type":"LogLevel","attributes":{"level":"debug"}}}`, "payments:write"); resp.Code != http.StatusForbidden {
+		t.Errorf("expected only admins to change the level, got %d", resp.Code)
+	}
+	if resp := request("PUT", `{"data":{"type":"LogLevel","attributes":{"level":"verbose"}}}`, "admin"); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown level to be refused, got %d", resp.Code)
+	}
+
+	resp := request("PUT", `{"data":{"type":"LogLevel","attributes":{"level":"debug"}}}`, "admin")
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Body.String(), `"level":"debug"`) {
+		t.Errorf("expected the new level, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if a.logLevel.Level() != slog.LevelDebug {
+		t.Errorf("expected debug level, got %s", a.logLevel.Level())
+	}
+
+	resp = request("GET", "", "admin")
+	if !strings.Contains(resp.Body.String(), `"level":"debug"`) {
+		t.Errorf("expected the current level, got %s", resp.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VMitov/payments/pkg/metrics"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+var (
+	httpRequestsTotal = metrics.NewCounter("payments_http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "code")
+	httpRequestDuration = metrics.NewHistogram("payments_http_request_duration_seconds",
+		"Duration of the HTTP requests by method and route pattern.", metrics.DefaultBuckets, "method", "route")
+	httpRequestsInFlight = metrics.NewGauge("payments_http_requests_in_flight",
+		"HTTP requests being served.")
+)
+
+// instrument measures the requests by the pattern of the route they matched
+// so the paths with ids do not make a series each
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpRequestsInFlight.Inc()
+		defer httpRequestsInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		httpRequestsTotal.Inc(r.Method, route, strconv.Itoa(code))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// newMetricsRouter serves the metrics apart from the API so they are not
+// exposed with it
+func newMetricsRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Method("GET", "/metrics", metrics.Default.Handler())
+	return r
+}
+
+// serveMetrics serves the metrics on the address until the context is
+// cancelled
+func serveMetrics(addr string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		srv := &http.Server{Addr: addr, Handler: newMetricsRouter(), ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		<-ctx.Done()
+		srv.Close()
+	}
+}
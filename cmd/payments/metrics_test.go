@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/calendar"
+)
+
+// scrape returns the values of the metrics by series
+func scrape(t *testing.T) map[string]float64 {
+	resp := httptest.NewRecorder()
+	newMetricsRouter().ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid metric %q: %v", line, err)
+		}
+		values[line[:i]] = v
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	a := newTestAPI(nil)
+	a.calendars = calendar.NewRegistry()
+	router := testRouter(a)
+
+	before := scrape(t)
+	for _, path := range []string{"/calendars/GB", "/calendars/DE", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	after := scrape(t)
+
+	for series, delta := range map[string]float64{
+		`payments_http_requests_total{method="GET",route="/calendars/{calendar}/",code="404"}`:                 2,
+		`payments_http_requests_total{method="GET",route="unmatched",code="404"}`:                              1,
+		`payments_http_request_duration_seconds_count{method="GET",route="/calendars/{calendar}/"}`:            2,
+		`payments_http_request_duration_seconds_bucket{method="GET",route="/calendars/{calendar}/",le="+Inf"}`: 2,
+	} {
+		if got := after[series] - before[series]; got != delta {
+			t.Errorf("expected %s to increase by %v, got %v", series, delta, got)
+		}
+	}
+	if v, ok := after["payments_http_requests_in_flight"]; !ok || v != 0 {
+		t.Errorf("expected no requests in flight, got %v", v)
+	}
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VMitov/payments/pkg/approval"
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/fraud"
+	"github.com/VMitov/payments/pkg/health"
+	"github.com/VMitov/payments/pkg/jsonapi"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/openapi"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/reconcile"
+	"github.com/VMitov/payments/pkg/routing"
+	"github.com/VMitov/payments/pkg/schedule"
+	"github.com/VMitov/payments/pkg/screening"
+	"github.com/VMitov/payments/pkg/statement"
+	"github.com/shopspring/decimal"
+)
+
+// spec builds the OpenAPI description of the routes
+type spec struct {
+	*openapi.Document
+}
+
+// operation is an operation being described
+type operation struct {
+	*openapi.Operation
+	c *openapi.Components
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+const (
+	// public operations are not authenticated
+	public auth.Permission = ""
+	// authenticated operations require no permission
+	authenticated auth.Permission = "*"
+)
+
+// add describes the operation of the route. The operations with a
+// permission are authenticated, rate limited and may fail with the common
+// errors.
+func (s *spec) add(method, path, tag, id, summary string, perm auth.Permission) *operation {
+	op := &operation{Operation: s.Add(method, path, &openapi.Operation{
+		OperationID: id,
+		Summary:     summary,
+		Tags:        []string{tag},
+		Responses:   map[string]*openapi.Response{},
+	}), c: s.Components}
+
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema := &openapi.Schema{Type: "string"}
+		if strings.HasSuffix(m[1], "ID") {
+			schema.Format = "uuid"
+		}
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+
+	if perm == public {
+		op.Security = &[]map[string][]string{}
+		return op
+	}
+	if perm != authenticated {
+		op.Description = fmt.Sprintf("Requires the %s permission.", perm)
+	}
+	return op.errors(http.StatusUnauthorized, http.StatusForbidden, http.StatusNotAcceptable,
+		http.StatusTooManyRequests, http.StatusInternalServerError)
+}
+
+func (op *operation) describe(description string) *operation {
+	if op.Description != "" {
+		description += " " + op.Description
+	}
+	op.Description = description
+	return op
+}
+
+func (op *operation) query(name, description string, schema *openapi.Schema) *operation {
+	op.Parameters = append(op.Parameters, &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema})
+	return op
+}
+
+// compound sets the parameters including the related resources of the
+// payments and limiting their fields
+func (op *operation) compound() *operation {
+	paths := make([]string, 0, len(includable))
+	for path := range includable {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	excluded := make([]string, 0, len(notIncludable))
+	for path, reason := range notIncludable {
+		excluded = append(excluded, path+": "+reason)
+	}
+	sort.Strings(excluded)
+
+	fieldset := &openapi.Schema{Type: "string", Description: "comma separated names, dotted for the nested attributes"}
+	return op.
+		query("include", "Comma separated relationships to include: "+strings.Join(paths, ", ")+
+			". Other paths get 400, "+strings.Join(excluded, "; "), &openapi.Schema{Type: "string"}).
+		query("fields["+payment.Type+"]", "Attributes and relationships of the payments to return", fieldset).
+		query("fields["+approval.Type+"]", "Attributes of the included approvals to return", fieldset).
+		errors(http.StatusBadRequest)
+}
+
+func (op *operation) header(name, description string) *operation {
+	op.Parameters = append(op.Parameters, &openapi.Parameter{
+		Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"},
+	})
+	return op
+}
+
+// representations returns the content of the document of the schema in
+// every format, the schema describes the JSON the others are made of
+func representations(schema *openapi.Schema) map[string]*openapi.MediaType {
+	content := map[string]*openapi.MediaType{}
+	for _, f := range jsonapi.Formats {
+		content[f.MediaType] = &openapi.MediaType{Schema: schema}
+	}
+	return content
+}
+
+// body sets the JSON:API document of the request
+func (op *operation) body(schema *openapi.Schema, required bool) *operation {
+	op.RequestBody = &openapi.RequestBody{
+		Required: required,
+		Content:  representations(schema),
+	}
+	return op.errors(http.StatusUnsupportedMediaType)
+}
+
+// returns sets the response of the status, JSON:API document of the value
+// if not nil
+func (op *operation) returns(status int, description string, v interface{}) *operation {
+	resp := &openapi.Response{Description: description}
+	if v != nil {
+		resp.Content = representations(op.c.SchemaOf(v))
+	}
+	op.Responses[fmt.Sprint(status)] = resp
+	return op
+}
+
+// returnsJSON sets the response of the status, plain JSON of the value
+func (op *operation) returnsJSON(status int, description string, v interface{}) *operation {
+	op.Responses[fmt.Sprint(status)] = &openapi.Response{Description: description, Content: op.c.JSON(v)}
+	return op
+}
+
+// errors sets the error responses of the statuses and the default one
+func (op *operation) errors(statuses ...int) *operation {
+	for _, status := range statuses {
+		op.Responses[fmt.Sprint(status)] = openapi.ResponseRef(errorResponses[status])
+	}
+	op.Responses["default"] = openapi.ResponseRef("Error")
+	return op
+}
+
+// errorResponses names the error responses of the statuses
+var errorResponses = map[int]string{
+	http.StatusBadRequest:            "InvalidRequest",
+	http.StatusUnauthorized:          "Unauthorized",
+	http.StatusForbidden:             "Forbidden",
+	http.StatusNotFound:              "NotFound",
+	http.StatusNotAcceptable:         "NotAcceptable",
+	http.StatusConflict:              "Conflict",
+	http.StatusPreconditionFailed:    "PreconditionFailed",
+	http.StatusRequestEntityTooLarge: "RequestTooLarge",
+	http.StatusUnsupportedMediaType:  "UnsupportedMediaType",
+	http.StatusUnprocessableEntity:   "Unprocessable",
+	http.StatusTooManyRequests:       "TooManyRequests",
+	http.StatusInternalServerError:   "Error",
+}
+
+// resourceRequest is the schema of a request with a resource of the type
+func resourceRequest(typ string, attributes *openapi.Schema) *openapi.Schema {
+	return &openapi.Schema{
+		Type:     "object",
+		Required: []string{"data"},
+		Properties: map[string]*openapi.Schema{
+			"data": {
+				Type:     "object",
+				Required: []string{"type", "attributes"},
+				Properties: map[string]*openapi.Schema{
+					"type":       {Type: "string", Enum: []interface{}{typ}},
+					"id":         {Type: "string"},
+					"attributes": attributes,
+				},
+			},
+		},
+	}
+}
+
+func stringEnum(values ...string) *openapi.Schema {
+	enum := make([]interface{}, len(values))
+	for i, v := range values {
+		enum[i] = v
+	}
+	return &openapi.Schema{Type: "string", Enum: enum}
+}
+
+// paymentAttributes are the attributes of a payment the service
+// understands, the others are kept as they are
+var paymentAttributes = &openapi.Schema{
+	Type:        "object",
+	Description: "The attributes of the payment. The service understands the ones described and keeps the others.",
+	Properties: map[string]*openapi.Schema{
+		"amount":               {Type: "string", Pattern: `^[0-9]+(\.[0-9]+)?$`},
+		"currency":             {Type: "string", Description: "ISO 4217 code"},
+		"end_to_end_reference": {Type: "string"},
+		"payment_scheme":       {Type: "string"},
+		"processing_date":      {Type: "string", Format: "date"},
+		"urgency":              {Type: "string"},
+		"beneficiary_party":    {Type: "object"},
+		"debtor_party":         {Type: "object"},
+	},
+}
+
+// newOpenAPI describes the routes of newRouter
+func newOpenAPI() *openapi.Document {
+	s := &spec{openapi.New(openapi.Info{
+		Title:   "Payments API",
+		Version: "1.0.0",
+		Description: "Payments, their refunds, approvals, screening, routing and reconciliation. " +
+			"The resources are JSON:API 1.1 documents of the media type application/vnd.api+json. " +
+			"They are also represented as XML, CSV and MessagePack, chosen by Accept or by the extension " +
+			"of the URL, like /payments.xml.",
+	})}
+	c := s.Components
+
+	c.Define(decimal.Decimal{}, &openapi.Schema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]+)?$`})
+	c.Define(fraud.Duration{}, &openapi.Schema{Type: "string", Description: "duration like 24h"})
+	c.Named(errors.Document{}, "Errors")
+	c.Named(errors.Object{}, "Error")
+	c.Named(errors.Meta{}, "ErrorMeta")
+	c.Named(errors.Source{}, "ErrorSource")
+	c.Named(diagnosticsResource{}, "DiagnosticsResource")
+	c.Named(diagnostics{}, "Diagnostics")
+
+	c.SecuritySchemes["apiKey"] = &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+	c.SecuritySchemes["bearer"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	s.Security = []map[string][]string{{"apiKey": {}}, {"bearer": {}}}
+
+	errorContent := representations(c.SchemaOf(errors.Document{}))
+	for status, name := range errorResponses {
+		c.Responses[name] = &openapi.Response{Description: http.StatusText(status), Content: errorContent}
+	}
+	c.Responses["Error"] = &openapi.Response{Description: "The request failed", Content: errorContent}
+	c.Responses["TooManyRequests"].Headers = map[string]*openapi.Header{
+		"Retry-After": {Description: "Seconds to wait before retrying", Schema: &openapi.Schema{Type: "integer"}},
+	}
+
+	s.Tags = []openapi.Tag{
+		{Name: "Payments", Description: "The payments and their refunds and reversals."},
+		{Name: "Approvals", Description: "The approvals required by the policies before the payments are submitted."},
+		{Name: "Fraud", Description: "The decisions of the fraud rules and their reviews."},
+		{Name: "Screening", Description: "The cases of the payments matching the watchlists."},
+		{Name: "Routing", Description: "The payment schemes the payments are routed to."},
+		{Name: "Schedules", Description: "The payments made on a schedule."},
+		{Name: "Calendars", Description: "The business day calendars of the currencies and the schemes."},
+		{Name: "Reconciliation", Description: "The bank statements and their matches to the payments."},
+		{Name: "Service", Description: "The state and the settings of the service."},
+	}
+
+	const (
+		read    = auth.PermissionRead
+		write   = auth.PermissionWrite
+		approve = auth.PermissionApprove
+		admin   = auth.PermissionAdmin
+	)
+	paymentRequest := resourceRequest(payment.Type, paymentAttributes)
+	uuid := &openapi.Schema{Type: "string", Format: "uuid"}
+
+	// Service
+	s.add("GET", "/healthz", "Service", "getHealth", "Report that the process is alive", public).
+		returnsJSON(200, "The process is alive", map[string]string{})
+	s.add("GET", "/readyz", "Service", "getReadiness", "Report if the dependencies are ready", public).
+		returnsJSON(200, "The dependencies are ready", health.Report{}).
+		returnsJSON(503, "A dependency is not ready", health.Report{})
+	s.add("GET", "/openapi", "Service", "getOpenAPI", "Describe the API", public).
+		describe("This document, also served as /openapi.json.").
+		returns(200, "This document", nil).Responses["200"].Content = map[string]*openapi.MediaType{
+		"application/json": {Schema: &openapi.Schema{Type: "object"}},
+	}
+	s.add("GET", "/docs", "Service", "getReference", "Show the reference of the API", public).
+		returns(200, "The reference of the API", nil).Responses["200"].Content = map[string]*openapi.MediaType{
+		"text/html": {Schema: &openapi.Schema{Type: "string"}},
+	}
+	s.add("GET", "/permissions", "Service", "getPermissions", "Show the permissions of the caller", authenticated).
+		returns(200, "The permissions", auth.PermissionsResource{})
+	s.add("GET", "/admin/log-level", "Service", "getLogLevel", "Show the log level", admin).
+		returns(200, "The log level", logging.LevelResource{})
+	s.add("PUT", "/admin/log-level", "Service", "setLogLevel", "Change the log level until the restart", admin).
+		body(resourceRequest(logging.LevelType, &openapi.Schema{
+			Type:       "object",
+			Required:   []string{"level"},
+			Properties: map[string]*openapi.Schema{"level": stringEnum("debug", "info", "warn", "error")},
+		}), true).
+		returns(200, "The new log level", logging.LevelResource{}).
+		errors(400)
+	s.add("GET", "/diagnostics", "Service", "getDiagnostics", "Show the build, the settings and the state of the service", admin).
+		returns(200, "The diagnostics", diagnosticsResource{})
+	s.add("GET", "/usage", "Service", "getUsage", "Show the usage of the quotas of the organisation", read).
+		returns(200, "The usage", quota.Resource{})
+	s.add("GET", "/events", "Payments", "streamEvents", "Follow the changes of the payments", read).
+		describe("Server-sent events of the payments created, updated and deleted by any replica from the time "+
+			"the stream is opened, the payments created by the schedules and the changes of their status by "+
+			"approvals, screening decisions and fraud reviews included. The stream ends when the client falls "+
+			"behind or the service shuts down.").
+		returns(200, "The stream of the events", nil).
+		errors(404).Responses["200"].Content = map[string]*openapi.MediaType{
+		"text/event-stream": {Schema: &openapi.Schema{Type: "string"}},
+	}
+
+	// Payments
+	s.add("GET", "/payments", "Payments", "listPayments", "List the payments", read).
+		describe("Without page parameters all the payments are listed. "+
+			"filter[PATH] lists only the payments with the string attribute at the dotted path, "+
+			"like filter[currency]=GBP or filter[beneficiary_party.name]=Jane, and can be repeated for other paths.").
+		query("page[size]", fmt.Sprintf("Payments in a page, up to %d", maxPageSize), &openapi.Schema{Type: "integer"}).
+		query("page[after]", "Id of the last payment of the previous page", uuid).
+		query("filter[status]", "Status of the listed payments", &openapi.Schema{Type: "string"}).
+		query("filter[kind]", "Kind of the listed payments", &openapi.Schema{Type: "string", Enum: []interface{}{payment.KindPayment, payment.KindRefund, payment.KindReversal}}).
+		compound().
+		returns(200, "The payments, links.next is the next page", payment.ListResource{}).
+		errors(400)
+	s.add("POST", "/payments", "Payments", "createPayment", "Create a payment", write).
+		describe("A retry with the same Idempotency-Key gets the response of the first request, "+
+			"or 409 with Retry-After while the first request is being processed. "+
+			"The client may generate the id of the payment, a UUID.").
+		header("Idempotency-Key", "Key making the request safe to retry for 24 hours").
+		body(paymentRequest, true).
+		returns(201, "The created payment", payment.Resource{}).
+		errors(400, 409, 413, 422)
+	s.add("GET", "/payments/{paymentID}", "Payments", "getPayment", "Get a payment", read).
+		compound().
+		returns(200, "The payment, its ETag is the version for If-Match", payment.Resource{}).
+		errors(404)
+	s.add("PUT", "/payments/{paymentID}", "Payments", "updatePayment", "Replace the attributes of a payment", write).
+		describe("Held and rejected payments can not be changed. The new parties are screened.").
+		header("If-Match", "ETag of the version of the payment the change is based on").
+		body(paymentRequest, true).
+		returns(200, "The updated payment", payment.Resource{}).
+		errors(400, 404, 409, 412, 413)
+	s.add("PATCH", "/payments/{paymentID}", "Payments", "patchPayment", "Merge into the attributes of a payment", write).
+		describe("The attributes are merged as a JSON merge patch (RFC 7396), null removes an attribute. Held and rejected payments can not be changed. The new parties are screened.").
+		header("If-Match", "ETag of the version of the payment the change is based on").
+		body(paymentRequest, true).
+		returns(200, "The updated payment", payment.Resource{}).
+		errors(400, 404, 409, 412, 413)
+	s.add("DELETE", "/payments/{paymentID}", "Payments", "deletePayment", "Delete a payment", write).
+		describe("Held and rejected payments can not be deleted.").
+		returns(200, "The payment was deleted", nil).
+		errors(404, 409)
+	s.add("GET", "/payments/{paymentID}/refunds", "Payments", "listRefunds", "List the refunds of a payment", read).
+		returns(200, "The refunds", payment.ListResource{}).
+		errors(404)
+	s.add("POST", "/payments/{paymentID}/refunds", "Payments", "createRefund", "Refund a payment in full or in part", write).
+		header("Idempotency-Key", "Key making the request safe to retry for 24 hours").
+		body(paymentRequest, true).
+		returns(201, "The refund", payment.Resource{}).
+		errors(400, 404, 409, 413, 422)
+	s.add("POST", "/payments/{paymentID}/reversal", "Payments", "createReversal", "Reverse a payment", write).
+		header("Idempotency-Key", "Key making the request safe to retry for 24 hours").
+		returns(201, "The reversal", payment.Resource{}).
+		errors(404, 409, 422)
+
+	// Approvals
+	decision := resourceRequest(approval.DecisionType, &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"comment": {Type: "string"}},
+	})
+	s.add("GET", "/payments/{paymentID}/approvals", "Approvals", "getApprovals", "Get the approvals of a payment", read).
+		returns(200, "The approvals", approval.Resource{}).
+		errors(404)
+	s.add("POST", "/payments/{paymentID}/approvals/approve", "Approvals", "approvePayment", "Approve a payment", approve).
+		body(decision, false).
+		returns(200, "The approvals", approval.Resource{}).
+		errors(400, 404, 409)
+	s.add("POST", "/payments/{paymentID}/approvals/reject", "Approvals", "rejectPayment", "Reject a payment", approve).
+		body(decision, false).
+		returns(200, "The approvals", approval.Resource{}).
+		errors(400, 404, 409)
+	s.add("GET", "/approvals", "Approvals", "listPendingApprovals", "List the payments waiting for approvals", read).
+		returns(200, "The pending approvals", approval.ListResource{})
+	s.add("POST", "/approvals/bulk", "Approvals", "bulkApprove", "Approve many payments", approve).
+		describe("Every payment is approved on its own so one failure does not fail the others.").
+		body(resourceRequest(approval.BulkType, &openapi.Schema{
+			Type:     "object",
+			Required: []string{"payment_ids"},
+			Properties: map[string]*openapi.Schema{
+				"payment_ids": {Type: "array", Items: uuid},
+				"comment":     {Type: "string"},
+			},
+		}), true).
+		returns(200, "The result of every payment", approval.ResultListResource{}).
+		errors(400)
+
+	// Fraud
+	s.add("GET", "/payments/{paymentID}/fraud-decisions", "Fraud", "listFraudDecisions", "List the fraud decisions of a payment", read).
+		returns(200, "The decisions", fraud.DecisionListResource{}).
+		errors(404)
+	s.add("POST", "/payments/{paymentID}/fraud-review", "Fraud", "reviewPayment", "Release or block a held payment", approve).
+		body(resourceRequest(fraud.ReviewType, c.SchemaOf(fraud.ReviewAttributes{})), true).
+		returns(200, "The payment", payment.Resource{}).
+		errors(400, 404, 409)
+
+	// Screening
+	screeningDecision := resourceRequest(screening.DecisionType, c.SchemaOf(screening.Decision{}))
+	s.add("GET", "/screening/cases", "Screening", "listScreeningCases", "List the screening cases", read).
+		query("status", "List only the cases with the status", &openapi.Schema{Type: "string"}).
+		returns(200, "The cases", screening.CaseListResource{})
+	s.add("GET", "/screening/cases/{caseID}", "Screening", "getScreeningCase", "Get a screening case", read).
+		returns(200, "The case", screening.CaseResource{}).
+		errors(404)
+	s.add("POST", "/screening/cases/{caseID}/clear", "Screening", "clearScreeningCase", "Clear the hits of a case as false positives", approve).
+		body(screeningDecision, true).
+		returns(200, "The case", screening.CaseResource{}).
+		errors(400, 404, 409)
+	s.add("POST", "/screening/cases/{caseID}/confirm", "Screening", "confirmScreeningCase", "Confirm a hit of a case and reject the payment", approve).
+		body(screeningDecision, true).
+		returns(200, "The case", screening.CaseResource{}).
+		errors(400, 404, 409)
+
+	// Routing
+	s.add("GET", "/payments/{paymentID}/route", "Routing", "getPaymentRoute", "Get the route of a payment", read).
+		returns(200, "The route", routing.Resource{}).
+		errors(404)
+	s.add("PUT", "/payments/{paymentID}/route", "Routing", "overridePaymentRoute", "Route a payment to another scheme", approve).
+		describe("The operator is the user that makes the request. Held, rejected and pending approval payments "+
+			"can not be routed to another scheme.").
+		header("If-Match", "ETag of the version of the payment the override is made from").
+		body(resourceRequest(routing.Type, c.SchemaOf(routing.OverrideAttributes{})), true).
+		returns(200, "The route", routing.Resource{}).
+		errors(400, 404, 409, 412)
+	s.add("GET", "/routing/rules", "Routing", "getRoutingRules", "Show the routing rules", read).
+		returns(200, "The rules", routing.RuleSetResource{}).
+		errors(404)
+	s.add("POST", "/routing/dry-run", "Routing", "dryRunRoute", "Route a payment without creating it", read).
+		body(paymentRequest, true).
+		returns(200, "The route the payment would take", routing.Resource{}).
+		errors(400, 404)
+
+	// Schedules
+	s.add("GET", "/payment-schedules", "Schedules", "listSchedules", "List the payment schedules", read).
+		returns(200, "The schedules", schedule.ListResource{})
+	s.add("POST", "/payment-schedules", "Schedules", "createSchedule", "Schedule a payment", write).
+		header("Idempotency-Key", "Key making the request safe to retry for 24 hours").
+		body(resourceRequest(schedule.Type, c.SchemaOf(schedule.Attributes{})), true).
+		returns(201, "The schedule", schedule.Resource{}).
+		errors(400, 409, 413, 422)
+	s.add("GET", "/payment-schedules/{scheduleID}", "Schedules", "getSchedule", "Get a payment schedule", read).
+		returns(200, "The schedule", schedule.Resource{}).
+		errors(404)
+	s.add("DELETE", "/payment-schedules/{scheduleID}", "Schedules", "cancelSchedule", "Cancel a payment schedule", write).
+		returns(200, "The schedule was cancelled", nil).
+		errors(404)
+	s.add("POST", "/payment-schedules/{scheduleID}/resume", "Schedules", "resumeSchedule", "Resume a suspended payment schedule", write).
+		describe(fmt.Sprintf("A schedule is suspended after its run of a date failed %d times. "+
+			"Resuming it retries the run on the next tick.", schedule.MaxFailures)).
+		returns(200, "The schedule", schedule.Resource{}).
+		errors(404, 409)
+	s.add("GET", "/payment-schedules/{scheduleID}/runs", "Schedules", "listScheduleRuns", "List the runs of a payment schedule", read).
+		returns(200, "The runs", schedule.RunListResource{}).
+		errors(404)
+
+	// Calendars
+	s.add("GET", "/calendars", "Calendars", "listCalendars", "List the calendars", read).
+		returns(200, "The calendars", calendar.ListResource{})
+	s.add("GET", "/calendars/{calendar}", "Calendars", "getCalendar", "Get a calendar", read).
+		returns(200, "The calendar", calendar.Resource{}).
+		errors(404)
+	s.add("PUT", "/calendars/{calendar}", "Calendars", "putCalendar", "Create or replace a calendar", admin).
+		describe("The calendars are shared by every organisation. Only the admins of the organisation set by "+
+			"`-calendar-organisation` change them, the other replicas load the change within `-calendars-reload`.").
+		body(resourceRequest(calendar.Type, c.SchemaOf(calendar.Definition{})), true).
+		returns(200, "The calendar", calendar.Resource{}).
+		errors(400)
+	s.add("GET", "/calendars/{calendar}/business-day", "Calendars", "getBusinessDay", "Check a date against a calendar", read).
+		query("date", "The date, today if empty", &openapi.Schema{Type: "string", Format: "date"}).
+		query("lag", "Business days to the settlement", &openapi.Schema{Type: "integer"}).
+		query("convention", "How a date that is not a business day is rolled", stringEnum(calendar.Following, calendar.Preceding, calendar.ModifiedFollowing)).
+		returns(200, "The business days around the date", calendar.BusinessDayResource{}).
+		errors(400, 404)
+
+	// Reconciliation
+	s.add("GET", "/statements", "Reconciliation", "listStatements", "List the bank statements", read).
+		returns(200, "The statements", statement.ListResource{})
+	s.add("POST", "/statements", "Reconciliation", "createStatements", "Import bank statements and reconcile them", write).
+		describe("The statements of the upload are stored and reconciled together. A statement with the reference "+
+			"of one already uploaded refuses the whole upload.").
+		query("format", "Format of the statements, detected if empty", stringEnum(statement.FormatCAMT053, statement.FormatMT940)).
+		returns(201, "The statements with the summary of their reconciliation in meta", statement.ListResource{}).
+		errors(400, 409, 413).RequestBody = &openapi.RequestBody{
+		Required: true,
+		Content: map[string]*openapi.MediaType{
+			"application/xml": {Schema: &openapi.Schema{Type: "string", Description: "camt.053"}},
+			"text/plain":      {Schema: &openapi.Schema{Type: "string", Description: "MT940"}},
+		},
+	}
+	s.add("GET", "/reconciliation/exceptions", "Reconciliation", "listReconciliationExceptions", "List the unmatched payments and entries", read).
+		query("all", "Include the resolved exceptions", &openapi.Schema{Type: "boolean"}).
+		returns(200, "The exceptions", reconcile.ExceptionListResource{})
+	s.add("POST", "/reconciliation/matches", "Reconciliation", "createReconciliation", "Match a payment to a statement entry", write).
+		body(resourceRequest(reconcile.MatchType, &openapi.Schema{
+			Type:     "object",
+			Required: []string{"payment_id", "entry_id"},
+			Properties: map[string]*openapi.Schema{
+				"payment_id": uuid,
+				"entry_id":   uuid,
+			},
+		}), true).
+		returns(201, "The match", reconcile.MatchResource{}).
+		errors(400, 404, 409)
+	s.add("GET", "/reconciliation/matches/{matchID}", "Reconciliation", "getReconciliation", "Get a match", read).
+		returns(200, "The match", reconcile.MatchResource{}).
+		errors(404)
+	s.add("DELETE", "/reconciliation/matches/{matchID}", "Reconciliation", "deleteReconciliation", "Undo a match", write).
+		returns(200, "The match was undone", nil).
+		errors(404)
+	s.add("GET", "/payments/{paymentID}/reconciliation", "Reconciliation", "getPaymentReconciliation", "Get the match of a payment", read).
+		returns(200, "The match", reconcile.MatchResource{}).
+		errors(404)
+
+	return s.Document
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  *openapi.Document
+	openAPIJSON []byte
+	openAPIHTML []byte
+)
+
+// openAPI returns the description of the API, built once
+func openAPI() (*openapi.Document, []byte, []byte) {
+	openAPIOnce.Do(func() {
+		openAPIDoc = newOpenAPI()
+
+		var err error
+		if openAPIJSON, err = json.MarshalIndent(openAPIDoc, "", "  "); err != nil {
+			panic(err)
+		}
+		var buf bytes.Buffer
+		if err := openAPIDoc.HTML(&buf); err != nil {
+			panic(err)
+		}
+		openAPIHTML = buf.Bytes()
+	})
+	return openAPIDoc, openAPIJSON, openAPIHTML
+}
+
+func (api *api) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	_, doc, _ := openAPI()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+}
+
+func (api *api) getReference(w http.ResponseWriter, r *http.Request) {
+	_, _, page := openAPI()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
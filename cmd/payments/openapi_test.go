@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// Every response of the router in the tests is checked against the OpenAPI
+// description, the failures are reported by TestMain
+var (
+	validationMu       sync.Mutex
+	validationFailures = map[string]bool{}
+)
+
+// testRouter returns the router of the api that checks its responses
+func testRouter(a *api) http.Handler {
+	return validateResponses(newRouter(a))
+}
+
+// validateResponses checks the responses of the handler against the OpenAPI
+// description
+func validateResponses(h http.Handler) http.Handler {
+	doc, _, _ := openAPI()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.NewRouteContext()
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+
+		// The requests refused before the routing have no route
+		if rctx.RoutePattern() == "" {
+			return
+		}
+		path := routePath(rctx.RoutePattern())
+		if doc.Operation(r.Method, path) == nil &&
+			(rec.status == http.StatusNotFound || rec.status == http.StatusMethodNotAllowed) {
+			return
+		}
+		err := doc.ValidateResponse(r.Method, path, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+		if err != nil {
+			validationMu.Lock()
+			validationFailures[err.Error()] = true
+			validationMu.Unlock()
+		}
+	})
+}
+
+// TestMain fails the tests if any response of testRouter did not match the
+// OpenAPI description
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if len(validationFailures) > 0 {
+		var errs []string
+		for err := range validationFailures {
+			errs = append(errs, err)
+		}
+		sort.Strings(errs)
+		fmt.Fprintf(os.Stderr, "responses do not match the OpenAPI description:\n\t%s\n", strings.Join(errs, "\n\t"))
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// responseRecorder keeps a copy of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// routePath turns the pattern of a chi route into the path of the document
+func routePath(pattern string) string {
+	pattern = strings.Replace(pattern, "/*/", "/", -1)
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+// TestOpenAPIRoutes checks that the routes and the description agree
+func TestOpenAPIRoutes(t *testing.T) {
+	doc, _, _ := openAPI()
+
+	routes := map[string]bool{}
+	err := chi.Walk(newRouter(&api{}).(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes[method+" "+routePath(route)] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for route := range routes {
+		method, path := splitRoute(route)
+		if doc.Operation(method, path) == nil {
+			t.Errorf("%s is not documented", route)
+		}
+	}
+	for path, item := range doc.Paths {
+		for method := range item {
+			if route := strings.ToUpper(method) + " " + path; !routes[route] {
+				t.Errorf("%s is documented but not routed", route)
+			}
+		}
+	}
+}
+
+func splitRoute(route string) (string, string) {
+	i := strings.Index(route, " ")
+	return route[:i], route[i+1:]
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := httptest.NewServer(testRouter(&api{}))
+	defer srv.Close()
+
+	tests := map[string]struct {
+		path        string
+		contentType string
+		contains    string
+	}{
+		"document":  {"/openapi.json", "application/json", `"openapi": "3.1.0"`},
+		"reference": {"/docs", "text/html; charset=utf-8", "createPayment"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var body bytes.Buffer
+			body.ReadFrom(resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("got status %d", resp.StatusCode)
+			}
+			if got := resp.Header.Get("Content-Type"); got != test.contentType {
+				t.Errorf("got content type %q, want %q", got, test.contentType)
+			}
+			if !strings.Contains(body.String(), test.contains) {
+				t.Errorf("%q not in the body", test.contains)
+			}
+		})
+	}
+
+	t.Run("valid JSON", func(t *testing.T) {
+		_, doc, _ := openAPI()
+		var v map[string]interface{}
+		if err := json.Unmarshal(doc, &v); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"openapi", "info", "paths", "components", "security"} {
+			if _, ok := v[key]; !ok {
+				t.Errorf("no %s", key)
+			}
+		}
+	})
+}
@@ -2,11 +2,26 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/VMitov/payments/pkg/approval"
+	apierrors "github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/fraud"
 	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/routing"
+	"github.com/VMitov/payments/pkg/screening"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
 func newPayment(p *payment.Payment) *payment.Resource {
@@ -29,27 +44,114 @@ func (api *api) createPayment(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, errInvalidRequest(err))
 		return
 	}
+	if pay.ID != "" && !uuidPattern.MatchString(pay.ID) {
+		render.Render(w, r, errForbidden(apierrors.Pointer("/data/id", fmt.Errorf("client-generated ids must be UUIDs"))))
+		return
+	}
+
+	now := time.Now()
+	var route *routing.Decision
+	if api.routing != nil {
+		if route, err = api.routing.Apply(pay, now); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
 
-	id, err := payment.Create(api.db, pay)
+	if api.calendars != nil {
+		if err := api.calendars.AdjustPayment(pay, now); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	var hits []screening.Hit
+	if api.screener != nil {
+		if hits, err = api.screener.ScreenPayment(pay); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	decision, err := api.evaluateFraud(org(r), pay, fraud.EventCreate, now)
 	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	// The payment is created together with the records of its checks
+	id, err := payment.Create(r.Context(), api.db, org(r), pay, func(tx *sqlx.Tx, id string) error {
+		if err := api.consumeQuota(tx, r); err != nil {
+			return err
+		}
+
+		if route != nil {
+			if err := routing.SaveTx(tx, id, route); err != nil {
+				return err
+			}
+		}
+
+		if decision != nil {
+			if err := fraud.ApplyTx(tx, org(r), id, pay, decision, now); err != nil {
+				return err
+			}
+			if decision.Outcome == fraud.OutcomeBlock {
+				return nil
+			}
+		}
+
+		if len(hits) != 0 {
+			if _, err := screening.HoldTx(tx, org(r), id, hits); err != nil {
+				return err
+			}
+		}
+
+		return api.requireApproval(tx, r, id, pay)
+	})
+	if exceeded, ok := err.(*quota.ExceededError); ok {
+		quotaExceeded(w, r, exceeded)
+		return
+	} else if err == payment.ErrExists {
+		render.Render(w, r, errConflict(apierrors.Pointer("/data/id", err)))
+		return
+	} else if err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
 
-	newPay, err := payment.Get(api.db, id)
+	committed(r)
+
+	if decision != nil && decision.Outcome == fraud.OutcomeBlock {
+		render.Render(w, r, errBlocked(blocked(id, decision)))
+		return
+	}
+
+	newPay, err := payment.Get(r.Context(), api.db, org(r), id)
 	if err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
 
+	api.publish(r, events.PaymentCreated, newPay)
+	w.Header().Set("Location", "/payments/"+id)
 	render.Status(r, http.StatusCreated)
 	render.Render(w, r, newPayment(newPay))
 }
 
 func (api *api) updatePayment(w http.ResponseWriter, r *http.Request) {
+	api.changePayment(w, r, false)
+}
+
+// patchPayment merges the attributes of the request into the attributes of
+// the payment
+func (api *api) patchPayment(w http.ResponseWriter, r *http.Request) {
+	api.changePayment(w, r, true)
+}
+
+func (api *api) changePayment(w http.ResponseWriter, r *http.Request, patch bool) {
 	paymentID := chi.URLParam(r, "paymentID")
 	if paymentID == "" {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
 		return
 	}
 
@@ -58,10 +160,14 @@ func (api *api) updatePayment(w http.ResponseWriter, r *http.Request) {
 		render.Render(w, r, errInvalidRequest(err))
 		return
 	}
+	if data.Data.ID != "" && data.Data.ID != paymentID {
+		render.Render(w, r, errConflict(apierrors.Pointer("/data/id", fmt.Errorf("id %s is not the id of the payment", data.Data.ID))))
+		return
+	}
 
-	_, err := payment.Get(api.db, paymentID)
+	oldPay, err := payment.Get(r.Context(), api.db, org(r), paymentID)
 	if err != nil {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
 		return
 	}
 
@@ -71,22 +177,127 @@ func (api *api) updatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := payment.Update(api.db, paymentID, newPay); err != nil {
+	if patch {
+		if newPay.Attributes, err = payment.Merge(oldPay.Attributes, newPay.Attributes); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	// A changed amount, currency or date may need another scheme
+	var route *routing.Decision
+	if api.routing != nil {
+		if route, err = api.routing.Apply(newPay, time.Now()); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	var hits []screening.Hit
+	if api.screener != nil {
+		if hits, err = api.screener.ScreenPayment(newPay); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	// The new details go through the routing, the fraud rules, the screening
+	// and the approval policies as a new payment would, so a changed party is
+	// screened and raising the amount or changing the currency is approved
+	var decision *fraud.Decision
+	check := func(tx *sqlx.Tx, id string) (err error) {
+		// Amounts under approval must not change behind the approvers' backs
+		if api.approvals != nil {
+			pending, err := approval.PendingTx(tx, org(r), id)
+			if err != nil {
+				return err
+			}
+			if pending {
+				return approval.ErrUnderApproval
+			}
+		}
+
+		if route != nil {
+			if err := routing.SaveTx(tx, id, route); err != nil {
+				return err
+			}
+		}
+
+		if decision, err = api.checkFraud(tx, org(r), id, newPay, fraud.EventUpdate); err != nil {
+			return err
+		}
+		if decision != nil && decision.Outcome == fraud.OutcomeBlock {
+			return nil
+		}
+
+		if len(hits) != 0 {
+			if _, err := screening.HoldTx(tx, org(r), id, hits); err != nil {
+				return err
+			}
+		}
+
+		return api.requireApproval(tx, r, id, newPay)
+	}
+
+	// If-Match guards the changes made from a stale copy of the payment
+	if etag := r.Header.Get("If-Match"); etag != "" && etag != "*" {
+		err = payment.UpdateIfMatch(r.Context(), api.db, org(r), paymentID, etag, newPay, check)
+	} else {
+		err = payment.Update(r.Context(), api.db, org(r), paymentID, newPay, check)
+	}
+	if err == payment.ErrModified {
+		render.Render(w, r, errPreconditionFailed(err))
+		return
+	} else if cause := errors.Cause(err); err == payment.ErrLocked || cause == payment.ErrInvalidTransition ||
+		cause == approval.ErrUnderApproval || cause == approval.ErrRequested {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
 
-	newPay, err = payment.Get(api.db, paymentID)
+	if decision != nil && decision.Outcome == fraud.OutcomeBlock {
+		render.Render(w, r, errBlocked(blocked(paymentID, decision)))
+		return
+	}
+
+	newPay, err = payment.Get(r.Context(), api.db, org(r), paymentID)
 	if err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
 
+	api.publish(r, events.PaymentUpdated, newPay)
+	w.Header().Set("ETag", newPay.ETag())
 	render.Render(w, r, newPayment(newPay))
 }
 
+// maxPageSize is the largest page of payments
+const maxPageSize = 1000
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 func (api *api) listPayments(w http.ResponseWriter, r *http.Request) {
-	payments, err := payment.Select(api.db)
+	c, err := parseCompound(r)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("page[size]") != "" || query.Get("page[after]") != "" {
+		api.listPaymentsPage(w, r, c, filter)
+		return
+	}
+
+	payments, err := payment.Select(r.Context(), api.db, org(r), filter, c.fields[payment.Type])
 	if err == sql.ErrNoRows {
 		payments = []payment.Payment{}
 	} else if err != nil {
@@ -94,26 +305,139 @@ func (api *api) listPayments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := render.Render(w, r, newPaymentList(payments)); err != nil {
+	list := newPaymentList(payments)
+	if q := filterQuery(r.URL.Query()); q != "" {
+		list.Links.Self += "?" + q
+	}
+	if err := api.shape(r, c, &list.Document, list.Data...); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	if err := render.Render(w, r, list); err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
 }
 
+// listPaymentsPage lists a page of the payments after the id of the last
+// payment of the previous page, linking the next page if there are more
+func (api *api) listPaymentsPage(w http.ResponseWriter, r *http.Request, c *compound, filter payment.Filter) {
+	query := r.URL.Query()
+	size := 100
+	if s := query.Get("page[size]"); s != "" {
+		var err error
+		if size, err = strconv.Atoi(s); err != nil || size < 1 || size > maxPageSize {
+			render.Render(w, r, errInvalidRequest(apierrors.Parameter("page[size]", fmt.Errorf("page[size] must be between 1 and %d", maxPageSize))))
+			return
+		}
+	}
+
+	after := query.Get("page[after]")
+	if after != "" && !uuidPattern.MatchString(after) {
+		render.Render(w, r, errInvalidRequest(apierrors.Parameter("page[after]", fmt.Errorf("page[after] must be the id of a payment"))))
+		return
+	}
+	payments, more, err := payment.SelectPage(r.Context(), api.db, org(r), filter, after, size, c.fields[payment.Type])
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	list := newPaymentList(payments)
+	list.Links.Self = pageLink(size, after, filterQuery(query))
+	if more {
+		list.Links.Next = pageLink(size, payments[len(payments)-1].ID, filterQuery(query))
+	}
+	if err := api.shape(r, c, &list.Document, list.Data...); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	render.Render(w, r, list)
+}
+
+func pageLink(size int, after, filter string) string {
+	link := fmt.Sprintf("/payments?page[size]=%d", size)
+	if after != "" {
+		link += "&page[after]=" + after
+	}
+	if filter != "" {
+		link += "&" + filter
+	}
+	return link
+}
+
+// parseFilter parses the filter[status], filter[kind] and
+// filter[ATTRIBUTE PATH] parameters of a listing of the payments
+func parseFilter(query url.Values) (payment.Filter, error) {
+	var filter payment.Filter
+	for param, values := range query {
+		if !strings.HasPrefix(param, "filter[") || !strings.HasSuffix(param, "]") {
+			continue
+		}
+		name := param[len("filter[") : len(param)-1]
+		switch name {
+		case "status":
+			filter.Status = values[0]
+		case "kind":
+			switch values[0] {
+			case payment.KindPayment, payment.KindRefund, payment.KindReversal:
+			default:
+				return filter, apierrors.Parameter(param, fmt.Errorf("%s must be one of payment, refund or reversal", param))
+			}
+			filter.Kind = values[0]
+		default:
+			if filter.Attributes == nil {
+				filter.Attributes = map[string]string{}
+			}
+			filter.Attributes[name] = values[0]
+			if err := filter.Validate(); err != nil {
+				return filter, apierrors.Parameter(param, err)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// filterQuery returns the filter parameters of the query for the links
+func filterQuery(query url.Values) string {
+	filter := url.Values{}
+	for param, values := range query {
+		if strings.HasPrefix(param, "filter[") {
+			filter[param] = values
+		}
+	}
+	// The brackets are kept readable like in the other links
+	return strings.NewReplacer("%5B", "[", "%5D", "]").Replace(filter.Encode())
+}
+
 func (api *api) getPayment(w http.ResponseWriter, r *http.Request) {
 	paymentID := chi.URLParam(r, "paymentID")
 	if paymentID == "" {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	c, err := parseCompound(r)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
 		return
 	}
 
-	pay, err := payment.Get(api.db, paymentID)
+	pay, err := payment.Get(r.Context(), api.db, org(r), paymentID)
 	if err != nil {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
 		return
 	}
 
-	if err := render.Render(w, r, newPayment(pay)); err != nil {
+	resource := newPayment(pay)
+	if err := api.shape(r, c, &resource.Document, resource.Data); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	// The ETag is the version of the whole payment, whatever its fieldset
+	w.Header().Set("ETag", pay.ETag())
+	if err := render.Render(w, r, resource); err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
@@ -122,18 +446,22 @@ func (api *api) getPayment(w http.ResponseWriter, r *http.Request) {
 func (api *api) deletePayment(w http.ResponseWriter, r *http.Request) {
 	paymentID := chi.URLParam(r, "paymentID")
 	if paymentID == "" {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
 		return
 	}
 
-	_, err := payment.Get(api.db, paymentID)
+	pay, err := payment.Get(r.Context(), api.db, org(r), paymentID)
 	if err != nil {
-		render.Render(w, r, errNotFound)
+		render.Render(w, r, errNotFound())
 		return
 	}
 
-	if err := payment.Delete(api.db, paymentID); err != nil {
+	if err := payment.Delete(r.Context(), api.db, org(r), paymentID); err == payment.ErrLocked {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err != nil {
 		render.Render(w, r, errSystem(err))
 		return
 	}
+	api.publish(r, events.PaymentDeleted, pay)
 }
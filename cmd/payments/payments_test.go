@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"flag"
@@ -9,9 +10,14 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/VMitov/payments/pkg/approval"
+	"github.com/VMitov/payments/pkg/fraud"
 	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/screening"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
@@ -39,7 +45,9 @@ func TestPayments(t *testing.T) {
 		"GETNone": {
 			given: "Given a HTTP request for /payments",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("GET", "/payments", nil)
@@ -47,46 +55,48 @@ func TestPayments(t *testing.T) {
 			then: "Then the response should be a 200 and no payments in the payload",
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 200)
-				So(resp.Body.String(), ShouldEqual, `{"data":[],"links":{"self":"/payments"}}`+"\n")
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.Body.String(), ShouldEqual, `{"data":[],"links":{"self":"/payments"},"jsonapi":{"version":"1.1"},"meta":{"count":0}}`+"\n")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"GETList": {
 			given: "Given a HTTP request for /payments",
 			givenFInt: func(db *sqlx.DB) {
-				db.MustExec(`INSERT INTO payments (id, attributes) VALUES
-					('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '{"amount": "100.21"}'),
-					('216d4da9-e59a-4cc6-8df3-3da6e7580b77', '{"amount": "100.21"}'),
-					('7eb8277a-6c91-45e9-8a03-a27f82aca350', '{"amount": "100.21"}'),
-					('97fe60ba-1334-439f-91db-32cc3cde036a', '{"amount": "100.21"}'),
-					('ab4bbd28-33c6-4231-9b64-0e96190f59ef', '{"amount": "100.21"}'),
-					('7f172f5c-f810-4ebe-b015-cb1fc24c6b66', '{"amount": "100.21"}'),
-					('502758ff-505f-4d81-b9d2-83aa9c01ebe2', '{"amount": "100.21"}'),
-					('09fe827a-b3c2-4437-b999-6c0e780c0983', '{"amount": "100.21"}'),
-					('de1f6882-4dba-485a-a632-a80f59fbe4a6', '{"amount": "100.21"}'),
-					('b71afd98-4fba-40a4-b8f3-087d005187e3', '{"amount": "100.21"}'),
-					('dbb89036-4007-47ff-8fab-00bdd5cc4021', '{"amount": "100.21"}'),
-					('52611302-0758-4f69-aa15-c5f55ab7c3eb', '{"amount": "100.21"}'),
-					('6cd862ab-6d40-4a86-8037-77d446b3f6fc', '{"amount": "100.21"}'),
-					('09a8fe0d-e239-4aff-8098-7923eadd0b98', '{"amount": "100.21"}');
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES
+					('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('216d4da9-e59a-4cc6-8df3-3da6e7580b77', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('7eb8277a-6c91-45e9-8a03-a27f82aca350', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('97fe60ba-1334-439f-91db-32cc3cde036a', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('ab4bbd28-33c6-4231-9b64-0e96190f59ef', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('7f172f5c-f810-4ebe-b015-cb1fc24c6b66', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('502758ff-505f-4d81-b9d2-83aa9c01ebe2', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('09fe827a-b3c2-4437-b999-6c0e780c0983', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('de1f6882-4dba-485a-a632-a80f59fbe4a6', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('b71afd98-4fba-40a4-b8f3-087d005187e3', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('dbb89036-4007-47ff-8fab-00bdd5cc4021', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('52611302-0758-4f69-aa15-c5f55ab7c3eb', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('6cd862ab-6d40-4a86-8037-77d446b3f6fc', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}'),
+					('09a8fe0d-e239-4aff-8098-7923eadd0b98', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}');
 				`)
 			},
 			givenF: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`)).
-					AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{"amount": "100.21"}`)).
-					AddRow("7eb8277a-6c91-45e9-8a03-a27f82aca350", []byte(`{"amount": "100.21"}`)).
-					AddRow("97fe60ba-1334-439f-91db-32cc3cde036a", []byte(`{"amount": "100.21"}`)).
-					AddRow("ab4bbd28-33c6-4231-9b64-0e96190f59ef", []byte(`{"amount": "100.21"}`)).
-					AddRow("7f172f5c-f810-4ebe-b015-cb1fc24c6b66", []byte(`{"amount": "100.21"}`)).
-					AddRow("502758ff-505f-4d81-b9d2-83aa9c01ebe2", []byte(`{"amount": "100.21"}`)).
-					AddRow("09fe827a-b3c2-4437-b999-6c0e780c0983", []byte(`{"amount": "100.21"}`)).
-					AddRow("de1f6882-4dba-485a-a632-a80f59fbe4a6", []byte(`{"amount": "100.21"}`)).
-					AddRow("b71afd98-4fba-40a4-b8f3-087d005187e3", []byte(`{"amount": "100.21"}`)).
-					AddRow("dbb89036-4007-47ff-8fab-00bdd5cc4021", []byte(`{"amount": "100.21"}`)).
-					AddRow("52611302-0758-4f69-aa15-c5f55ab7c3eb", []byte(`{"amount": "100.21"}`)).
-					AddRow("6cd862ab-6d40-4a86-8037-77d446b3f6fc", []byte(`{"amount": "100.21"}`)).
-					AddRow("09a8fe0d-e239-4aff-8098-7923eadd0b98", []byte(`{"amount": "100.21"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("7eb8277a-6c91-45e9-8a03-a27f82aca350", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("97fe60ba-1334-439f-91db-32cc3cde036a", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("ab4bbd28-33c6-4231-9b64-0e96190f59ef", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("7f172f5c-f810-4ebe-b015-cb1fc24c6b66", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("502758ff-505f-4d81-b9d2-83aa9c01ebe2", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("09fe827a-b3c2-4437-b999-6c0e780c0983", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("de1f6882-4dba-485a-a632-a80f59fbe4a6", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("b71afd98-4fba-40a4-b8f3-087d005187e3", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("dbb89036-4007-47ff-8fab-00bdd5cc4021", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("52611302-0758-4f69-aa15-c5f55ab7c3eb", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("6cd862ab-6d40-4a86-8037-77d446b3f6fc", []byte(`{"amount": "100.21"}`), "created").
+					AddRow("09a8fe0d-e239-4aff-8098-7923eadd0b98", []byte(`{"amount": "100.21"}`), "created"))
+				mock.ExpectCommit()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("GET", "/payments", nil)
@@ -110,17 +120,52 @@ func TestPayments(t *testing.T) {
 				}
 
 				So(string(resource), ShouldEqual, strings.TrimRight(string(expected), "\n"))
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
+			},
+		},
+		"GETFiltered": {
+			given: "Given a HTTP request for the GBP payments to Jane created",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes, status) VALUES
+					('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21", "currency": "GBP", "beneficiary_party": {"name": "Jane"}}', 'created'),
+					('216d4da9-e59a-4cc6-8df3-3da6e7580b77', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21", "currency": "EUR", "beneficiary_party": {"name": "Jane"}}', 'created'),
+					('7eb8277a-6c91-45e9-8a03-a27f82aca350', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21", "currency": "GBP", "beneficiary_party": {"name": "Jane"}}', 'settled');
+				`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery(`SELECT \* FROM payments WHERE organisation_id=\$1 AND status=\$2 AND kind=\$3 AND attributes @> \$4`).
+					WithArgs(testOrganisation, "created", "payment", `{"beneficiary_party":{"name":"Jane"},"currency":"GBP"}`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+						AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21", "currency": "GBP", "beneficiary_party": {"name": "Jane"}}`), "created"))
+				mock.ExpectCommit()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("GET", "/payments?filter[status]=created&filter[kind]=payment&filter[currency]=GBP&filter[beneficiary_party.name]=Jane", nil)
+			},
+			then: "Then the response should be a 200 with the matching payment linked with the filter",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 200)
+
+				result := &payment.ListResource{}
+				if err := json.Unmarshal(resp.Body.Bytes(), result); err != nil {
+					t.Fatal(err)
+				}
+				So(len(result.Data), ShouldEqual, 1)
+				So(result.Data[0].Payment.ID, ShouldEqual, "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43")
+				So(result.Links.Self, ShouldEqual, "/payments?filter[beneficiary_party.name]=Jane&filter[currency]=GBP&filter[kind]=payment&filter[status]=created")
 			},
 		},
 		"GETOne": {
 			given: "Given a HTTP request for /payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenFInt: func(db *sqlx.DB) {
-				db.MustExec(`INSERT INTO payments(id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '{"amount": "100.21"}')`)
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}')`)
 			},
 			givenF: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created"))
+				mock.ExpectCommit()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("GET", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
@@ -129,14 +174,37 @@ func TestPayments(t *testing.T) {
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 200)
 				So(strings.TrimRight(resp.Body.String(), "\n"), ShouldEqual,
-					`{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.21"},"type":"Payment","links":{"self":"/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}}}`)
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+					`{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.21"},"type":"Payment","meta":{"status":"created"},"links":{"self":"/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}},"jsonapi":{"version":"1.1"}}`)
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
+			},
+		},
+		"GETReconciled": {
+			given: "Given a HTTP request for /payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43 matched to a statement entry",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes, reconciled_at) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount": "100.21"}', '2018-10-31T09:00:00Z')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "reconciled_at"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created", time.Date(2018, 10, 31, 9, 0, 0, 0, time.UTC)))
+				mock.ExpectCommit()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("GET", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
+			},
+			then: "Then the response should be a 200 and the payment should have the time it was reconciled",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 200)
+				So(strings.TrimRight(resp.Body.String(), "\n"), ShouldEqual,
+					`{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.21"},"type":"Payment","meta":{"status":"created","reconciled_at":"2018-10-31T09:00:00Z"},"links":{"self":"/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}},"jsonapi":{"version":"1.1"}}`)
 			},
 		},
 		"GETMissing": {
 			given: "Given a HTTP request for /payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("GET", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
@@ -144,13 +212,15 @@ func TestPayments(t *testing.T) {
 			then: "Then the response should be a 404",
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 404)
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"GETBadUUID": {
 			given: "Given a HTTP request for /payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("GET", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
@@ -158,21 +228,27 @@ func TestPayments(t *testing.T) {
 			then: "Then the response should be a 404",
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 404)
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"Create": {
 			given: "Given a HTTP request for POST:/payments",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("INSERT INTO payments").
-					WithArgs(`{"amount": "100.21"}`).
+					WithArgs(testOrganisation, `{"amount": "100.21"}`).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).
 						AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"))
+				mock.ExpectCommit()
 
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`)))
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created"))
+				mock.ExpectCommit()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("POST", "/payments", strings.NewReader(`{"data": {"type": "Payment", "attributes": {"amount": "100.21"}}}`))
@@ -191,11 +267,11 @@ func TestPayments(t *testing.T) {
 				}
 				req := httptest.NewRequest("GET", "/payments/"+pay.Data.ID, nil)
 				getResp := httptest.NewRecorder()
-				newRouter(&api{db: db}).ServeHTTP(getResp, req)
+				testRouter(newTestAPI(db)).ServeHTTP(getResp, req)
 
-				So(strings.TrimRight(getResp.Body.String(), "\n"), ShouldEqual, `{"data":{"id":"`+pay.Data.ID+`","attributes":{"amount":"100.21"},"type":"Payment","links":{"self":"/payments/`+pay.Data.ID+`"}}}`)
+				So(strings.TrimRight(getResp.Body.String(), "\n"), ShouldEqual, `{"data":{"id":"`+pay.Data.ID+`","attributes":{"amount":"100.21"},"type":"Payment","meta":{"status":"created"},"links":{"self":"/payments/`+pay.Data.ID+`"}},"jsonapi":{"version":"1.1"}}`)
 
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"CreateNoAttributes": {
@@ -216,7 +292,7 @@ func TestPayments(t *testing.T) {
 			then: "Then the response should be a 400",
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 400)
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"CreateNoPayload": {
@@ -242,18 +318,26 @@ func TestPayments(t *testing.T) {
 		"Update": {
 			given: "Given a HTTP request for PUT:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenFInt: func(db *sqlx.DB) {
-				db.MustExec(`INSERT INTO payments (id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '{"amount":"100.21"}')`)
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21"}')`)
 			},
 			givenF: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created"))
+				mock.ExpectCommit()
 
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.21"}`), "created"))
 				mock.ExpectExec("UPDATE payments").
-					WithArgs(`{"amount": "100.22"}`, "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43").
+					WithArgs(`{"amount": "100.22"}`, "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", testOrganisation).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.22"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount": "100.22"}`), "created"))
+				mock.ExpectCommit()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("PUT", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "100.22"}}}`))
@@ -261,8 +345,8 @@ func TestPayments(t *testing.T) {
 			then: "Then the response should be a 200 and the payload should be updated",
 			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
 				So(resp.Code, ShouldEqual, 200)
-				So(strings.TrimRight(resp.Body.String(), "\n"), ShouldEqual, `{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.22"},"type":"Payment","links":{"self":"/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}}}`)
-				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/json; charset=utf-8")
+				So(strings.TrimRight(resp.Body.String(), "\n"), ShouldEqual, `{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.22"},"type":"Payment","meta":{"status":"created"},"links":{"self":"/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"}},"jsonapi":{"version":"1.1"}}`)
+				So(resp.HeaderMap["Content-Type"], ShouldContain, "application/vnd.api+json")
 			},
 		},
 		"UpdateNoData": {
@@ -288,7 +372,9 @@ func TestPayments(t *testing.T) {
 		"UpdateMissing": {
 			given: "Given a HTTP request for PUT:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("PUT", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "100.21"}}}`))
@@ -301,7 +387,9 @@ func TestPayments(t *testing.T) {
 		"UpdateBadUUID": {
 			given: "Given a HTTP request for PUT:/payments/bad-uuid",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("PUT", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "100.22"}}}`))
@@ -311,18 +399,234 @@ func TestPayments(t *testing.T) {
 				So(resp.Code, ShouldEqual, 404)
 			},
 		},
+		"Refund": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				original := sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment")
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(original)
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("0"))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+				mock.ExpectExec("UPDATE payments SET status").
+					WithArgs("partially_refunded", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", testOrganisation).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("INSERT INTO payments").
+					WithArgs(testOrganisation, `{"amount":"10.00","currency":"GBP"}`, "refund", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind", "original_id"}).
+					AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{"amount":"10.00","currency":"GBP"}`), "created", "refund", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"))
+				mock.ExpectCommit()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "10"}}}`))
+			},
+			then: "Then the response should be a 201 and the refund should be linked to the original",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 201)
+
+				pay := &payment.Resource{}
+				if err := json.Unmarshal(resp.Body.Bytes(), pay); err != nil {
+					t.Fatal(err)
+				}
+				So(pay.Data.Meta.Kind, ShouldEqual, "refund")
+				So(string(pay.Data.Attributes), ShouldEqual, `{"amount":"10.00","currency":"GBP"}`)
+				So(pay.Data.Relationships["original"].Links.Related, ShouldEqual, "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43")
+			},
+		},
+		"RefundExceedsOriginal": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds with a larger amount",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("0"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "100.22"}}}`))
+			},
+			then: "Then the response should be a 409",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 409)
+			},
+		},
+		"RefundNegativeAmount": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds with a negative amount",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("0"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "-10"}}}`))
+			},
+			then: "Then the response should be a 400",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 400)
+			},
+		},
+		"RefundTooManyDecimals": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds with more decimals than the original",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("0"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "100.205"}}}`))
+			},
+			then: "Then the response should be a 400",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 400)
+			},
+		},
+		"ReversePartiallyRefunded": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/reversal of a partially refunded payment",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes, status) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}', 'partially_refunded')`)
+				db.MustExec(`INSERT INTO payments (organisation_id, attributes, kind, original_id) VALUES ('00000000-0000-0000-0000-000000000001', '{"amount":"10.00","currency":"GBP"}', 'refund', '4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				original := func() *sqlmock.Rows {
+					return sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+						AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "partially_refunded", "payment")
+				}
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(original())
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(original())
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("10.00"))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("partially_refunded"))
+				mock.ExpectExec("UPDATE payments SET status").
+					WithArgs("reversed", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", testOrganisation).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("INSERT INTO payments").
+					WithArgs(testOrganisation, `{"amount":"90.21","currency":"GBP"}`, "reversal", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind", "original_id"}).
+					AddRow("216d4da9-e59a-4cc6-8df3-3da6e7580b77", []byte(`{"amount":"90.21","currency":"GBP"}`), "created", "reversal", "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"))
+				mock.ExpectCommit()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/reversal", nil)
+			},
+			then: "Then the response should be a 201 with the remaining amount reversed",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 201)
+
+				pay := &payment.Resource{}
+				if err := json.Unmarshal(resp.Body.Bytes(), pay); err != nil {
+					t.Fatal(err)
+				}
+				So(pay.Data.Meta.Kind, ShouldEqual, "reversal")
+				So(string(pay.Data.Attributes), ShouldEqual, `{"amount":"90.21","currency":"GBP"}`)
+			},
+		},
+		"RefundOtherCurrency": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds in another currency",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21","currency":"GBP"}')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "kind"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21","currency":"GBP"}`), "created", "payment"))
+				mock.ExpectQuery("SELECT COALESCE").WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("0"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/refunds", strings.NewReader(`{"data":{"type": "Payment", "attributes": {"amount": "10", "currency": "EUR"}}}`))
+			},
+			then: "Then the response should be a 422",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 422)
+			},
+		},
+		"ApproveOwnPayment": {
+			given: "Given a HTTP request for POST:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/approvals/approve by its creator",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes, status) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"20000","currency":"GBP"}', 'pending_approval')`)
+				db.MustExec(`INSERT INTO approval_requests (payment_id, organisation_id, maker, policy, required) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', 'alice', 'GBP >= 10000 requires 1 approvers', 1)`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"20000","currency":"GBP"}`), "pending_approval"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM approval_requests").WillReturnRows(sqlmock.NewRows([]string{"payment_id", "maker", "required", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", "alice", 1, "pending"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				req := httptest.NewRequest("POST", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43/approvals/approve", nil)
+				req.Header.Set(userHeader, "alice")
+				return req
+			},
+			then: "Then the response should be a 409",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 409)
+			},
+		},
 		"Delete": {
 			given: "Given a HTTP request to DELETE:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
 			givenFInt: func(db *sqlx.DB) {
-				db.MustExec(`INSERT INTO payments (id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '{"amount":"100.21"}')`)
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21"}')`)
 			},
 			givenF: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes"}).
-					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21"}`)))
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21"}`), "created"))
+				mock.ExpectCommit()
 
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
 				mock.ExpectExec("DELETE FROM payments").
-					WithArgs("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43").
+					WithArgs("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", testOrganisation).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("DELETE", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
@@ -332,10 +636,35 @@ func TestPayments(t *testing.T) {
 				So(resp.Code, ShouldEqual, 200)
 			},
 		},
+		"DeleteHeld": {
+			given: "Given a HTTP request to DELETE:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43 held by the screening",
+			givenFInt: func(db *sqlx.DB) {
+				db.MustExec(`INSERT INTO payments (id, organisation_id, attributes, status) VALUES ('4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43', '00000000-0000-0000-0000-000000000001', '{"amount":"100.21"}', 'held')`)
+			},
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).
+					AddRow("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", []byte(`{"amount":"100.21"}`), "held"))
+				mock.ExpectCommit()
+
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("held"))
+				mock.ExpectRollback()
+			},
+			getReq: func() *http.Request {
+				return httptest.NewRequest("DELETE", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
+			},
+			then: "Then the response should be a 409 and the payment is kept",
+			thenF: func(db *sqlx.DB, resp *httptest.ResponseRecorder) {
+				So(resp.Code, ShouldEqual, 409)
+			},
+		},
 		"DeleteNonExisting": {
 			given: "Given a HTTP request to DELETE:/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43 which is not existing",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("DELETE", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
@@ -348,7 +677,9 @@ func TestPayments(t *testing.T) {
 		"DeleteInvalidUUID": {
 			given: "Given a HTTP request to DELETE:/payments/bad-uuid with wrong uuid",
 			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
 				mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+				mock.ExpectRollback()
 			},
 			getReq: func() *http.Request {
 				return httptest.NewRequest("DELETE", "/payments/bad-uuid", nil)
@@ -377,6 +708,13 @@ func TestPayments(t *testing.T) {
 				if err != nil {
 					t.Fatal(err)
 				}
+				migrator, err := newMigrator(db)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := migrator.Up(context.Background()); err != nil {
+					t.Fatal(err)
+				}
 			} else {
 				var (
 					mockDB *sql.DB
@@ -402,7 +740,7 @@ func TestPayments(t *testing.T) {
 
 					req := tc.getReq()
 					resp := httptest.NewRecorder()
-					newRouter(&api{db: db}).ServeHTTP(resp, req)
+					testRouter(newTestAPI(db)).ServeHTTP(resp, req)
 					Convey(tc.then, func() { tc.thenF(db, resp) })
 
 					if !integration {
@@ -421,3 +759,239 @@ func TestPayments(t *testing.T) {
 		})
 	}
 }
+
+// TestChangeChecks changes payments with the checks of new payments
+// configured. The new details are checked as a new payment would be.
+func TestChangeChecks(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	paymentRows := func(attributes, status string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(attributes), status)
+	}
+	policies, err := approval.ParsePolicySet([]byte(`{"version":"1","policies":[{"currency":"GBP","threshold":"10000","approvers":1}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := fraud.NewEngine("../../rules/fraud.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		givenF   func(mock sqlmock.Sqlmock)
+		fraud    bool
+		body     string
+		expected int
+		status   string
+	}{
+		"JustUnderThresholdIsHeld": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectExec("UPDATE payments SET attributes").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT EXISTS").WithArgs(id, testOrganisation, "pending").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectExec("INSERT INTO fraud_decisions").
+					WithArgs(id, "update", "hold", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+				mock.ExpectExec("UPDATE payments SET status").WithArgs("held", id, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM fraud_events").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"9950","currency":"GBP"}`, "held"))
+				mock.ExpectCommit()
+			},
+			fraud:    true,
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"9950","currency":"GBP"}}}`,
+			expected: 200,
+			status:   "held",
+		},
+		"RaisedAmountRequiresApproval": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectExec("UPDATE payments SET attributes").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT EXISTS").WithArgs(id, testOrganisation, "pending").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectExec("INSERT INTO approval_requests").
+					WithArgs("alice", "GBP >= 10000 requires 1 approvers", 1, id, testOrganisation).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+				mock.ExpectExec("UPDATE payments SET status").WithArgs("pending_approval", id, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"20000","currency":"GBP"}`, "pending_approval"))
+				mock.ExpectCommit()
+			},
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"20000","currency":"GBP"}}}`,
+			expected: 200,
+			status:   "pending_approval",
+		},
+		"ChangedPartyIsHeld": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "created"))
+				mock.ExpectExec("UPDATE payments SET attributes").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT EXISTS").WithArgs(id, testOrganisation, "pending").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+				mock.ExpectExec("UPDATE payments SET status").WithArgs("held", id, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("INSERT INTO screening_cases").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7eb8277a-6c91-45e9-8a03-a27f82aca350"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP","beneficiary_party":{"name":"Viktor Bout"}}`, "held"))
+				mock.ExpectCommit()
+			},
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"100","currency":"GBP","beneficiary_party":{"name":"Viktor Bout"}}}}`,
+			expected: 200,
+			status:   "held",
+		},
+		"UnderApproval": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"20000","currency":"GBP"}`, "pending_approval"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"20000","currency":"GBP"}`, "pending_approval"))
+				mock.ExpectExec("UPDATE payments SET attributes").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT EXISTS").WithArgs(id, testOrganisation, "pending").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+			},
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"30000","currency":"GBP"}}}`,
+			expected: 409,
+		},
+		"ApprovedAmountRaisedAgain": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"20000","currency":"GBP"}`, "created"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"20000","currency":"GBP"}`, "created"))
+				mock.ExpectExec("UPDATE payments SET attributes").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT EXISTS").WithArgs(id, testOrganisation, "pending").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectExec("INSERT INTO approval_requests").WillReturnError(&pq.Error{Code: "23505"})
+				mock.ExpectRollback()
+			},
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"30000","currency":"GBP"}}}`,
+			expected: 409,
+		},
+		"HeldIsLocked": {
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "held"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT").WillReturnRows(paymentRows(`{"amount":"100","currency":"GBP"}`, "held"))
+				mock.ExpectRollback()
+			},
+			body:     `{"data":{"type":"Payment","attributes":{"amount":"50","currency":"GBP"}}}`,
+			expected: 409,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			tc.givenF(mock)
+
+			a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+			a.approvals = policies
+			a.screener = screening.NewScreener()
+			a.screener.Add([]screening.Entry{{List: "ofac", ID: "1", Names: []string{"Viktor Bout"}}})
+			if tc.fraud {
+				a.fraud = rules
+			}
+
+			req := httptest.NewRequest("PUT", "/payments/"+id, strings.NewReader(tc.body))
+			req.Header.Set(userHeader, "alice")
+			resp := httptest.NewRecorder()
+			testRouter(a).ServeHTTP(resp, req)
+
+			if resp.Code != tc.expected {
+				t.Errorf("expected %d, got %d: %s", tc.expected, resp.Code, resp.Body)
+			}
+			if tc.status != "" && !strings.Contains(resp.Body.String(), `"status":"`+tc.status+`"`) {
+				t.Errorf("expected status %s, got %s", tc.status, resp.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestReleaseChecks approves a payment that went to a new beneficiary while
+// it waited for the approval. The fraud rules hold it when it is released.
+func TestReleaseChecks(t *testing.T) {
+	const id = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	const attributes = `{"amount":"15000","currency":"GBP","beneficiary_party":{"bank_id":"203301","account_number":"12345678"}}`
+	rules, err := fraud.NewEngine("../../rules/fraud.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(attributes), "pending_approval"))
+	mock.ExpectCommit()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM approval_requests").
+		WillReturnRows(sqlmock.NewRows([]string{"payment_id", "maker", "required", "status"}).AddRow(id, "alice", 1, "pending"))
+	mock.ExpectQuery("SELECT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("INSERT INTO approvals").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE approval_requests").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending_approval"))
+	mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("pending_approval"))
+	mock.ExpectExec("UPDATE payments SET status").WithArgs("created", id, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT \\* FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organisation_id", "attributes", "status"}).AddRow(id, testOrganisation, []byte(attributes), "created"))
+	mock.ExpectQuery("SELECT min").WithArgs(testOrganisation, fraud.KeyBeneficiary, "203301/12345678", id).
+		WillReturnRows(sqlmock.NewRows([]string{"min"}).AddRow(nil))
+	mock.ExpectQuery("SELECT count").WithArgs(testOrganisation, fraud.KeyBeneficiary, "203301/12345678", "GBP", sqlmock.AnyArg(), id).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "total"}).AddRow(0, "0"))
+	mock.ExpectExec("INSERT INTO fraud_decisions").
+		WithArgs(id, "release", "hold", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("created"))
+	mock.ExpectExec("UPDATE payments SET status").WithArgs("held", id, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM approval_requests").
+		WillReturnRows(sqlmock.NewRows([]string{"payment_id", "maker", "required", "status"}).AddRow(id, "alice", 1, "approved"))
+	mock.ExpectQuery("SELECT (.+) FROM approvals").WillReturnRows(sqlmock.NewRows([]string{"payment_id", "approver", "decision"}).AddRow(id, "bob", "approve"))
+	mock.ExpectCommit()
+
+	a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+	a.fraud = rules
+	req := httptest.NewRequest("POST", "/payments/"+id+"/approvals/approve", nil)
+	req.Header.Set(userHeader, "bob")
+	resp := httptest.NewRecorder()
+	testRouter(a).ServeHTTP(resp, req)
+
+	if resp.Code != 200 {
+		t.Errorf("expected 200, got %d: %s", resp.Code, resp.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
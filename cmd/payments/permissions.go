@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/go-chi/render"
+)
+
+// require allows the route only to principals with the permission
+func require(perm auth.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := principal(r).Require(perm); err != nil {
+				render.Render(w, r, errForbidden(err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (api *api) getPermissions(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, auth.NewPermissionsResource(principal(r), "/permissions"))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestAuthorization requests the endpoints without their permission. The
+// request must be refused before it reaches the database.
+func TestAuthorization(t *testing.T) {
+	const paymentID = "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+
+	testCases := map[string]struct {
+		method, path, scopes string
+	}{
+		"NoScopes":            {method: "GET", path: "/payments", scopes: ""},
+		"UnknownScope":        {method: "GET", path: "/payments", scopes: "openid profile"},
+		"ReaderCreates":       {method: "POST", path: "/payments", scopes: "payments:read"},
+		"ReaderDeletes":       {method: "DELETE", path: paymentID, scopes: "payments:read"},
+		"ReaderRefunds":       {method: "POST", path: paymentID + "/refunds", scopes: "payments:read"},
+		"WriterApproves":      {method: "POST", path: paymentID + "/approvals/approve", scopes: "payments:write"},
+		"WriterBulkApproves":  {method: "POST", path: "/approvals/bulk", scopes: "payments:write"},
+		"WriterClearsCase":    {method: "POST", path: "/screening/cases/7eb8277a-6c91-45e9-8a03-a27f82aca350/clear", scopes: "payments:write"},
+		"ApproverDeletes":     {method: "DELETE", path: paymentID, scopes: "payments:approve"},
+		"ApproverPutCalendar": {method: "PUT", path: "/calendars/GB", scopes: "payments:approve payments:write"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set(scopesHeader, tc.scopes)
+
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusForbidden {
+				t.Errorf("expected 403, got %d: %s", resp.Code, resp.Body.String())
+			}
+			if !strings.Contains(resp.Body.String(), "permission") {
+				t.Errorf("expected the missing permission, got %s", resp.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestGetPermissions(t *testing.T) {
+	req := httptest.NewRequest("GET", "/permissions", nil)
+	req.Header.Set(userHeader, "bob")
+	req.Header.Set(scopesHeader, "payments:write openid")
+
+	resp := httptest.NewRecorder()
+	testRouter(newTestAPI(nil)).ServeHTTP(resp, req)
+
+	expected := `{"data":{"id":"bob","type":"Permissions","attributes":{"organisation":"00000000-0000-0000-0000-000000000001","method":"test","scopes":["payments:write","openid"],"permissions":["payments:read","payments:write"]},"links":{"self":"/permissions"}}}`
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	if body := strings.TrimSpace(resp.Body.String()); body != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+}
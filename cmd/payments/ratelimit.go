@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/quota"
+	"github.com/VMitov/payments/pkg/ratelimit"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Clients the requests are rate limited by
+const (
+	limitByPrincipal    = "principal"
+	limitByOrganisation = "organisation"
+	limitByIP           = "ip"
+)
+
+// rateLimits are the limits of the route classes
+type rateLimits struct {
+	store ratelimit.Store
+	by    string
+	// proxies are the networks of the proxies whose X-Forwarded-For is
+	// trusted for the address of the client
+	proxies []*net.IPNet
+	mu      sync.RWMutex
+	limits  map[string]ratelimit.Limit
+}
+
+// newRateLimits returns the rate limits of the route classes or nil if
+// none of them is limited
+func newRateLimits(db *sqlx.DB, by, store, proxies string, limits map[string]string) (*rateLimits, error) {
+	l := &rateLimits{by: by, limits: map[string]ratelimit.Limit{}}
+	enabled := false
+	for class, limit := range limits {
+		parsed, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s rate limit", class)
+		}
+		l.limits[class] = parsed
+		enabled = enabled || parsed.Enabled()
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	switch by {
+	case limitByPrincipal, limitByOrganisation, limitByIP:
+	default:
+		return nil, errors.Errorf("invalid rate limit client %q", by)
+	}
+
+	var err error
+	if l.proxies, err = parseProxies(proxies); err != nil {
+		return nil, err
+	}
+
+	switch store {
+	case "memory":
+		l.store = ratelimit.NewMemory()
+	case "postgres":
+		l.store = ratelimit.Postgres{DB: db}
+	default:
+		return nil, errors.Errorf("invalid rate limit store %q", store)
+	}
+
+	return l, nil
+}
+
+// get returns the limit of the class
+func (l *rateLimits) get(class string) ratelimit.Limit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.limits[class]
+}
+
+// set changes the limit of the class
+func (l *rateLimits) set(class, limit string) error {
+	parsed, err := ratelimit.ParseLimit(limit)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[class] = parsed
+	return nil
+}
+
+// window is the longest time a bucket takes to refill
+func (l *rateLimits) window() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var window time.Duration
+	for _, limit := range l.limits {
+		if limit.Enabled() && limit.Window() > window {
+			window = limit.Window()
+		}
+	}
+	return window
+}
+
+// prune deletes the buckets of the postgres store that have refilled since
+// they were last used until the context is cancelled
+func (l *rateLimits) prune(ctx context.Context) {
+	pg, ok := l.store.(ratelimit.Postgres)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(l.window() + time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The limits may have been reloaded since the last run
+		if err := pg.Prune(time.Now().Add(-l.window())); err != nil {
+			slog.Error("pruning rate limits failed", logging.Error(err))
+		}
+	}
+}
+
+// parseProxies parses the comma separated addresses and networks of the
+// trusted proxies
+func parseProxies(value string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %q", s)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusted reports if the address is of a trusted proxy
+func (l *rateLimits) trusted(ip net.IP) bool {
+	for _, network := range l.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of the request. The
+// X-Forwarded-For of the requests of trusted proxies is followed from the
+// nearest address to the first one that is not of a trusted proxy, as the
+// addresses before it may be set by the client.
+func (l *rateLimits) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !l.trusted(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// client returns the key of the client of the request
+func (l *rateLimits) client(r *http.Request) string {
+	switch l.by {
+	case limitByOrganisation:
+		return "organisation:" + org(r)
+	case limitByIP:
+		return "ip:" + l.clientIP(r)
+	}
+	return "principal:" + principal(r).ID
+}
+
+// limit limits the rate of the requests of a client to the routes of the
+// class. The requests limited by ip are limited before they are
+// authenticated, so the requests failing authentication are limited too,
+// and the others after.
+func (api *api) limit(class string, authenticated bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if api.rateLimits == nil || (api.rateLimits.by != limitByIP) != authenticated {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limit := api.rateLimits.get(class)
+			if !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := api.rateLimits.store.Take(class+":"+api.rateLimits.client(r), limit, time.Now())
+			if err != nil {
+				// An unavailable store must not take the service down with it
+				logging.FromContext(r.Context()).Error("rate limiting failed", logging.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Window())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				render.Render(w, r, errTooManyRequests(fmt.Errorf("rate limit of %s requests exceeded", class)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// guard allows the route to the authenticated principals with the
+// permission within the rate limit of the class
+func (api *api) guard(perm auth.Permission, class string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return api.limit(class, false)(api.authenticated(api.limit(class, true)(require(perm)(next))))
+	}
+}
+
+// consumeQuota counts the creation of a payment against the quotas of the
+// organisation of the request within the transaction that creates it, so
+// the payments that are not created are not counted
+func (api *api) consumeQuota(tx *sqlx.Tx, r *http.Request) error {
+	limits := api.quotaLimits()
+	if !limits.Enabled() {
+		return nil
+	}
+
+	return quota.ConsumeTx(tx, org(r), limits, time.Now())
+}
+
+// quotaExceeded renders the error of an exceeded quota with the time it is
+// reset
+func quotaExceeded(w http.ResponseWriter, r *http.Request, exceeded *quota.ExceededError) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(exceeded.Reset))))
+	render.Render(w, r, errTooManyRequests(exceeded))
+}
+
+func (api *api) getUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := quota.Get(api.db, org(r), api.quotaLimits(), time.Now())
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, quota.NewResource(org(r), usage, "/usage"))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// quotaLimits returns the quotas of the organisations
+func (api *api) quotaLimits() quota.Limits {
+	api.quotasMu.RLock()
+	defer api.quotasMu.RUnlock()
+	return api.quotas
+}
+
+// setQuotaLimits changes the quotas of the organisations
+func (api *api) setQuotaLimits(limits quota.Limits) {
+	api.quotasMu.Lock()
+	defer api.quotasMu.Unlock()
+	api.quotas = limits
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	a := newTestAPI(nil)
+	a.calendars = calendar.NewRegistry()
+	a.rateLimits = &rateLimits{
+		store: ratelimit.NewMemory(),
+		by:    limitByPrincipal,
+		limits: map[string]ratelimit.Limit{
+			ratelimit.ClassRead: {Rate: 1.0 / 60, Burst: 2},
+		},
+	}
+	router := testRouter(a)
+
+	request := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/calendars", nil)
+		req.Header.Set(userHeader, user)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	steps := []struct {
+		user       string
+		code       int
+		remaining  string
+		retryAfter string
+	}{
+		{user: "alice", code: http.StatusOK, remaining: "1"},
+		{user: "alice", code: http.StatusOK, remaining: "0"},
+		{user: "alice", code: http.StatusTooManyRequests, remaining: "0", retryAfter: "60"},
+		{user: "bob", code: http.StatusOK, remaining: "1"},
+	}
+
+	for i, step := range steps {
+		resp := request(step.user)
+		if resp.Code != step.code {
+			t.Errorf("step %d: expected %d, got %d: %s", i, step.code, resp.Code, resp.Body.String())
+		}
+		if h := resp.Header().Get("RateLimit-Limit"); h != "2" {
+			t.Errorf("step %d: expected limit 2, got %q", i, h)
+		}
+		if h := resp.Header().Get("RateLimit-Remaining"); h != step.remaining {
+			t.Errorf("step %d: expected remaining %s, got %q", i, step.remaining, h)
+		}
+		if h := resp.Header().Get("Retry-After"); h != step.retryAfter {
+			t.Errorf("step %d: expected retry after %q, got %q", i, step.retryAfter, h)
+		}
+		if h := resp.Header().Get("RateLimit-Policy"); h != "2;w=120" {
+			t.Errorf("step %d: expected policy 2;w=120, got %q", i, h)
+		}
+	}
+
+	// Writes have no limit
+	req := httptest.NewRequest("PUT", "/calendars/GB", nil)
+	req.Header.Set(userHeader, "alice")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code == http.StatusTooManyRequests || resp.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("expected writes not to be limited, got %d %v", resp.Code, resp.Header())
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	a := newTestAPI(nil)
+	a.calendars = calendar.NewRegistry()
+	a.rateLimits = &rateLimits{
+		store: ratelimit.NewMemory(),
+		by:    limitByIP,
+		limits: map[string]ratelimit.Limit{
+			ratelimit.ClassRead: {Rate: 1.0 / 60, Burst: 1},
+		},
+	}
+	a.rateLimits.proxies, _ = parseProxies("10.0.0.1, 192.168.0.0/16")
+	a.authenticator = auth.AuthenticatorFunc(func(r *http.Request) (*auth.Principal, error) {
+		if r.Header.Get(userHeader) == "" {
+			return nil, auth.ErrNoCredentials
+		}
+		return testAuthenticator(r)
+	})
+	router := testRouter(a)
+
+	request := func(remoteAddr, forwarded, user string) int {
+		req := httptest.NewRequest("GET", "/calendars", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		if user != "" {
+			req.Header.Set(userHeader, user)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	steps := []struct {
+		remoteAddr, forwarded, user string
+		code                        int
+	}{
+		// Requests failing authentication take tokens of their address
+		{remoteAddr: "203.0.113.1:1234", code: http.StatusUnauthorized},
+		{remoteAddr: "203.0.113.1:1234", user: "alice", code: http.StatusTooManyRequests},
+		// The forwarded address of an untrusted peer is ignored
+		{remoteAddr: "203.0.113.1:1234", forwarded: "198.51.100.1", user: "alice", code: http.StatusTooManyRequests},
+		// The nearest address not of a trusted proxy is the client
+		{remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.1, 198.51.100.1, 192.168.1.1", user: "alice", code: http.StatusOK},
+		{remoteAddr: "10.0.0.1:1234", forwarded: "198.51.100.1", user: "alice", code: http.StatusTooManyRequests},
+		{remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.2", user: "alice", code: http.StatusOK},
+	}
+
+	for i, step := range steps {
+		if code := request(step.remoteAddr, step.forwarded, step.user); code != step.code {
+			t.Errorf("step %d: expected %d, got %d", i, step.code, code)
+		}
+	}
+}
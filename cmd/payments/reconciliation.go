@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/reconcile"
+	"github.com/VMitov/payments/pkg/statement"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+)
+
+func (api *api) createStatements(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		if format, err = statement.Detect(body); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	statements, err := statement.Parse(format, bytes.NewReader(body))
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	// The statements are stored and reconciled together, so a failed upload
+	// leaves neither statements nor matches behind and can be sent again
+	summaries := []*statement.Summary{}
+	err = tenant.Scoped(api.db, org(r), func(tx *sqlx.Tx) error {
+		for i := range statements {
+			if err := statement.CreateTx(tx, org(r), &statements[i]); err != nil {
+				return err
+			}
+
+			result, err := reconcile.ReconcileTx(tx, org(r), statements[i].Entries, api.tolerance)
+			if err != nil {
+				return err
+			}
+
+			summaries = append(summaries, &statement.Summary{
+				Entries:           len(statements[i].Entries),
+				Matched:           len(result.Matches),
+				UnmatchedPayments: len(result.UnmatchedPayments),
+				UnmatchedEntries:  len(result.UnmatchedEntries),
+			})
+		}
+		return nil
+	})
+	if err == statement.ErrExists {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, statement.NewListResource(statements, summaries, "/statements"))
+}
+
+func (api *api) listStatements(w http.ResponseWriter, r *http.Request) {
+	statements, err := statement.Select(api.db, org(r))
+	if err == sql.ErrNoRows {
+		statements = []statement.Statement{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, statement.NewListResource(statements, nil, "/statements"))
+}
+
+func (api *api) listReconciliationExceptions(w http.ResponseWriter, r *http.Request) {
+	exceptions, err := reconcile.SelectExceptions(api.db, org(r), r.URL.Query().Get("all") == "true")
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, reconcile.NewExceptionListResource(exceptions, "/reconciliation/exceptions"))
+}
+
+func (api *api) createReconciliation(w http.ResponseWriter, r *http.Request) {
+	data := &reconcile.MatchResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	paymentID, entryID := data.Data.Attributes.PaymentID, data.Data.Attributes.EntryID
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+	if _, err := statement.GetEntry(api.db, org(r), entryID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	match, err := reconcile.CreateMatch(api.db, org(r), paymentID, entryID)
+	if err == reconcile.ErrAlreadyMatched {
+		render.Render(w, r, errConflict(err))
+		return
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, reconcile.NewMatchResource(match, "/reconciliation/matches/"+match.ID))
+}
+
+func (api *api) getReconciliation(w http.ResponseWriter, r *http.Request) {
+	match, err := reconcile.GetMatch(api.db, org(r), chi.URLParam(r, "matchID"))
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, reconcile.NewMatchResource(match, "/reconciliation/matches/"+match.ID))
+}
+
+func (api *api) deleteReconciliation(w http.ResponseWriter, r *http.Request) {
+	matchID := chi.URLParam(r, "matchID")
+	if _, err := reconcile.GetMatch(api.db, org(r), matchID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	if err := reconcile.DeleteMatch(api.db, org(r), matchID); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+}
+
+func (api *api) getPaymentReconciliation(w http.ResponseWriter, r *http.Request) {
+	match, err := reconcile.GetMatchByPayment(api.db, org(r), chi.URLParam(r, "paymentID"))
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, reconcile.NewMatchResource(match, "/reconciliation/matches/"+match.ID))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestCreateStatementsOnce uploads a statement and then the same statement
+// again. The statement is stored and reconciled in one transaction and the
+// second upload is refused.
+func TestCreateStatementsOnce(t *testing.T) {
+	body, err := ioutil.ReadFile("../../testdata/statements/mt940.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		uploaded bool
+		code     int
+	}{
+		"New":      {code: 201},
+		"Uploaded": {uploaded: true, code: 409},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			expectScoped(mock, testOrganisation)
+			insert := mock.ExpectQuery("INSERT INTO statements").WithArgs(testOrganisation, "mt940", "STMT-2018-10-01", sqlmock.AnyArg(), "GBP", sqlmock.AnyArg())
+			if tc.uploaded {
+				insert.WillReturnError(&pq.Error{Code: "23505"})
+				mock.ExpectRollback()
+			} else {
+				insert.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9b1deb4d-3b7d-4bad-9bdd-2b0d7b3dcb6d"))
+				for _, id := range []string{"09fe827a-b3c2-4437-b999-6c0e780c0983", "1d5c0a6e-8e2b-4f3c-9a7d-2e4b6c8d0f1a"} {
+					mock.ExpectQuery("INSERT INTO statement_entries").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+				}
+				mock.ExpectQuery("SELECT (.+) FROM payments (.+) FOR UPDATE").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				for i := 0; i < 2; i++ {
+					mock.ExpectExec("INSERT INTO reconciliation_exceptions").WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest("POST", "/statements", strings.NewReader(string(body)))
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	apierrors "github.com/VMitov/payments/pkg/errors"
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/VMitov/payments/pkg/fraud"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func newRefundList(paymentID string, ps []payment.Payment) *payment.ListResource {
+	return payment.NewRelatedListResource(ps, "/payments/"+paymentID+"/refunds", "/payments")
+}
+
+func (api *api) createRefund(w http.ResponseWriter, r *http.Request) {
+	data := &payment.Resource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	refund, err := payment.NewFromResource(data)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+	if refund.ID != "" {
+		render.Render(w, r, errForbidden(apierrors.Pointer("/data/id", fmt.Errorf("refunds do not take client-generated ids"))))
+		return
+	}
+
+	api.refund(w, r, payment.KindRefund, refund)
+}
+
+func (api *api) createReversal(w http.ResponseWriter, r *http.Request) {
+	api.refund(w, r, payment.KindReversal, &payment.Payment{})
+}
+
+func (api *api) refund(w http.ResponseWriter, r *http.Request, kind string, refund *payment.Payment) {
+	paymentID := chi.URLParam(r, "paymentID")
+	original, err := payment.Get(r.Context(), api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	now := time.Now()
+	decision, err := api.evaluateFraud(org(r), refundCandidate(original, refund), kind, now)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+	if decision != nil && decision.Outcome == fraud.OutcomeBlock {
+		if err := fraud.Save(api.db, org(r), paymentID, decision); err != nil {
+			render.Render(w, r, errSystem(err))
+			return
+		}
+		render.Render(w, r, errBlocked(blocked(paymentID, decision)))
+		return
+	}
+
+	var hook payment.Hook
+	if decision != nil {
+		hook = func(tx *sqlx.Tx, id string) error {
+			return fraud.ApplyTx(tx, org(r), id, refund, decision, now)
+		}
+	}
+
+	id, err := payment.Refund(r.Context(), api.db, org(r), paymentID, kind, refund, hook)
+	switch errors.Cause(err) {
+	case nil:
+	case payment.ErrNotRefundable, payment.ErrRefundExceedsOriginal:
+		render.Render(w, r, errConflict(err))
+		return
+	case payment.ErrInvalidRefundAmount:
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	case payment.ErrRefundCurrency:
+		render.Render(w, r, errUnprocessable(err))
+		return
+	default:
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	committed(r)
+
+	newPay, err := payment.Get(r.Context(), api.db, org(r), id)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	api.publish(r, events.PaymentCreated, newPay)
+	w.Header().Set("Location", "/payments/"+id)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, newPayment(newPay))
+}
+
+// refundCandidate returns the payment the fraud rules see for a refund: the
+// original payment with the amount of the refund if it has one
+func refundCandidate(original, refund *payment.Payment) *payment.Payment {
+	candidate := &payment.Payment{ID: original.ID, Attributes: original.Attributes}
+	if details, err := refund.Details(); err == nil && !details.Amount.IsZero() {
+		candidate.SetAttributes(map[string]interface{}{"amount": details.Amount.String()})
+	}
+	return candidate
+}
+
+func (api *api) listRefunds(w http.ResponseWriter, r *http.Request) {
+	paymentID := chi.URLParam(r, "paymentID")
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	refunds, err := payment.SelectRefunds(r.Context(), api.db, org(r), paymentID)
+	if err == sql.ErrNoRows {
+		refunds = []payment.Payment{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, newRefundList(paymentID, refunds))
+}
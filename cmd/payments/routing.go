@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/routing"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+func (api *api) getRoutingRules(w http.ResponseWriter, r *http.Request) {
+	if api.routing == nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, routing.NewRuleSetResource(api.routing.Rules(), "/routing/rules"))
+}
+
+func (api *api) dryRunRoute(w http.ResponseWriter, r *http.Request) {
+	if api.routing == nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	data := &payment.Resource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	pay, err := payment.NewFromResource(data)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	decision, err := api.routing.Route(pay, time.Now())
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	render.Render(w, r, routing.NewDecisionResource(decision, "/routing/dry-run"))
+}
+
+func (api *api) getPaymentRoute(w http.ResponseWriter, r *http.Request) {
+	paymentID := chi.URLParam(r, "paymentID")
+	route, err := routing.Get(api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, routing.NewResource(route, "/payments/"+paymentID+"/route"))
+}
+
+func (api *api) overridePaymentRoute(w http.ResponseWriter, r *http.Request) {
+	paymentID := chi.URLParam(r, "paymentID")
+	data := &routing.OverrideResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if _, err := payment.Get(r.Context(), api.db, org(r), paymentID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	// If-Match guards the overrides made from a stale copy of the payment
+	etag := r.Header.Get("If-Match")
+	if etag == "*" {
+		etag = ""
+	}
+	attributes := data.Data.Attributes
+	switch err := routing.Override(api.db, org(r), paymentID, etag, attributes.Scheme, user(r), attributes.OverrideReason); err {
+	case nil:
+	case payment.ErrModified:
+		render.Render(w, r, errPreconditionFailed(err))
+		return
+	case payment.ErrLocked, routing.ErrUnderApproval:
+		render.Render(w, r, errConflict(err))
+		return
+	default:
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	api.publishChange(r, paymentID)
+
+	route, err := routing.Get(api.db, org(r), paymentID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, routing.NewResource(route, "/payments/"+paymentID+"/route"))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/routing"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestOverridePaymentRoute overrides the route of payments. The operator is
+// the user of the request and locked, pending approval and changed payments
+// keep their scheme.
+func TestOverridePaymentRoute(t *testing.T) {
+	const (
+		id   = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		body = `{"data":{"type":"PaymentRoute","attributes":{"scheme":"FPS","override_reason":"faster","overridden_by":"mallory"}}}`
+	)
+
+	testCases := map[string]struct {
+		status, ifMatch string
+		code            int
+	}{
+		"Override":        {status: "accepted", code: 200},
+		"Held":            {status: "held", code: 409},
+		"Rejected":        {status: "rejected", code: 409},
+		"PendingApproval": {status: "pending_approval", code: 409},
+		"Modified":        {status: "accepted", ifMatch: `"stale"`, code: 412},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			rows := func() *sqlmock.Rows {
+				return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(`{"amount":"10.00"}`), tc.status)
+			}
+			expectScoped(mock, testOrganisation)
+			mock.ExpectQuery("SELECT (.+) FROM payments").WillReturnRows(rows())
+			mock.ExpectCommit()
+			expectScoped(mock, testOrganisation)
+			mock.ExpectQuery("SELECT (.+) FROM payments (.+) FOR UPDATE").WillReturnRows(rows())
+			if tc.code != 200 {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectExec("UPDATE payments").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO payment_routes").WithArgs(id, "FPS", "alice", "faster").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM payment_routes").WillReturnRows(
+					sqlmock.NewRows([]string{"payment_id", "scheme", "overridden_by"}).AddRow(id, "FPS", "alice"))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest("PUT", "/payments/"+id+"/route", strings.NewReader(body))
+			req.Header.Set(userHeader, "alice")
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body)
+			}
+			if tc.code == 200 && !strings.Contains(resp.Body.String(), `"overridden_by":"alice"`) {
+				t.Errorf("expected the user as the operator, got %s", resp.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestUpdatePaymentRoute raises the amount of a payment over the limit of its
+// scheme. The payment is routed again with the change.
+func TestUpdatePaymentRoute(t *testing.T) {
+	const (
+		id         = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		attributes = `{"amount":"100.00","currency":"GBP","payment_scheme":"FPS","beneficiary_party":{"country":"GB"}}`
+	)
+	engine, err := routing.NewEngine("../../rules/routing.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	rows := func(attributes string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(attributes), "accepted")
+	}
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payments").WillReturnRows(rows(attributes))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payments (.+) FOR UPDATE").WillReturnRows(rows(attributes))
+	mock.ExpectExec("UPDATE payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payment_routes").WithArgs(id, "BACS", "bacs", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payments").WillReturnRows(rows(attributes))
+	mock.ExpectCommit()
+
+	a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+	a.routing = engine
+	req := httptest.NewRequest("PATCH", "/payments/"+id, strings.NewReader(`{"data":{"type":"Payment","attributes":{"amount":"300000.00"}}}`))
+	resp := httptest.NewRecorder()
+	testRouter(a).ServeHTTP(resp, req)
+
+	if resp.Code != 200 {
+		t.Errorf("expected 200, got %d: %s", resp.Code, resp.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
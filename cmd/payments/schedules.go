@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/schedule"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+func newSchedule(s *schedule.Schedule) *schedule.Resource {
+	return schedule.NewResource(s, "/payment-schedules/"+s.ID)
+}
+
+func (api *api) createSchedule(w http.ResponseWriter, r *http.Request) {
+	data := &schedule.Resource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	s, err := schedule.NewFromResource(data)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	s.CreatedBy = user(r)
+	id, err := schedule.Create(api.db, org(r), s, api.calendars)
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	committed(r)
+
+	newSched, err := schedule.Get(api.db, org(r), id)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, newSchedule(newSched))
+}
+
+func (api *api) listSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := schedule.Select(api.db, org(r))
+	if err == sql.ErrNoRows {
+		schedules = []schedule.Schedule{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, schedule.NewListResource(schedules, "/payment-schedules"))
+}
+
+func (api *api) getSchedule(w http.ResponseWriter, r *http.Request) {
+	s, err := schedule.Get(api.db, org(r), chi.URLParam(r, "scheduleID"))
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, newSchedule(s))
+}
+
+func (api *api) cancelSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduleID := chi.URLParam(r, "scheduleID")
+	if _, err := schedule.Get(api.db, org(r), scheduleID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	if err := schedule.Cancel(api.db, org(r), scheduleID); err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+}
+
+func (api *api) resumeSchedule(w http.ResponseWriter, r *http.Request) {
+	scheduleID := chi.URLParam(r, "scheduleID")
+	if _, err := schedule.Get(api.db, org(r), scheduleID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	switch err := schedule.Resume(api.db, org(r), scheduleID); err {
+	case nil:
+	case schedule.ErrNotSuspended:
+		render.Render(w, r, errConflict(err))
+		return
+	default:
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	s, err := schedule.Get(api.db, org(r), scheduleID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, newSchedule(s))
+}
+
+func (api *api) listScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	scheduleID := chi.URLParam(r, "scheduleID")
+	if _, err := schedule.Get(api.db, org(r), scheduleID); err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	runs, err := schedule.SelectRuns(api.db, org(r), scheduleID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	render.Render(w, r, schedule.NewRunListResource(runs, "/payment-schedules/"+scheduleID+"/runs"))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestResumeSchedule resumes a suspended schedule and an active one, only
+// the suspended one is resumed
+func TestResumeSchedule(t *testing.T) {
+	const id = "216d4da9-e59a-4cc6-8df3-3da6e7580b77"
+
+	testCases := map[string]struct {
+		resumed int64
+		code    int
+	}{
+		"Suspended": {resumed: 1, code: 200},
+		"Active":    {resumed: 0, code: 409},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			rows := func(status string) *sqlmock.Rows {
+				return sqlmock.NewRows([]string{"id", "attributes", "status"}).AddRow(id, []byte(`{"amount":"10.00"}`), status)
+			}
+			expectScoped(mock, testOrganisation)
+			mock.ExpectQuery("SELECT (.+) FROM payment_schedules").WillReturnRows(rows("suspended"))
+			mock.ExpectCommit()
+			expectScoped(mock, testOrganisation)
+			mock.ExpectExec("UPDATE payment_schedules").WithArgs("active", id, testOrganisation, "suspended").
+				WillReturnResult(sqlmock.NewResult(0, tc.resumed))
+			if tc.resumed == 0 {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM payment_schedules").WillReturnRows(rows("active"))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest("POST", "/payment-schedules/"+id+"/resume", nil)
+			resp := httptest.NewRecorder()
+			testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestCreateScheduleMaker creates a schedule. Its creator is kept as the
+// maker of its payments.
+func TestCreateScheduleMaker(t *testing.T) {
+	const id = "216d4da9-e59a-4cc6-8df3-3da6e7580b77"
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("INSERT INTO payment_schedules").
+		WithArgs(testOrganisation, `{"amount":"10.00"}`, sqlmock.AnyArg(), "", sqlmock.AnyArg(), "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectCommit()
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payment_schedules").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "attributes", "status", "created_by"}).AddRow(id, []byte(`{"amount":"10.00"}`), "active", "alice"))
+	mock.ExpectCommit()
+
+	body := `{"data":{"type":"PaymentSchedule","attributes":{"payment":{"amount":"10.00"},"start_date":"2030-01-01"}}}`
+	req := httptest.NewRequest("POST", "/payment-schedules", strings.NewReader(body))
+	req.Header.Set(userHeader, "alice")
+	resp := httptest.NewRecorder()
+	testRouter(newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))).ServeHTTP(resp, req)
+
+	if resp.Code != 201 {
+		t.Errorf("expected 201, got %d: %s", resp.Code, resp.Body)
+	}
+	if !strings.Contains(resp.Body.String(), `"created_by":"alice"`) {
+		t.Errorf("expected the creator, got %s", resp.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
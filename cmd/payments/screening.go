@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/fraud"
+	"github.com/VMitov/payments/pkg/screening"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/jmoiron/sqlx"
+)
+
+func newScreeningCase(c *screening.Case) *screening.CaseResource {
+	return screening.NewCaseResource(c, "/screening/cases/"+c.ID)
+}
+
+func (api *api) listScreeningCases(w http.ResponseWriter, r *http.Request) {
+	cases, err := screening.SelectCases(api.db, org(r), r.URL.Query().Get("status"))
+	if err == sql.ErrNoRows {
+		cases = []screening.Case{}
+	} else if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	self := "/screening/cases"
+	if r.URL.RawQuery != "" {
+		self += "?" + r.URL.RawQuery
+	}
+	render.Render(w, r, screening.NewCaseListResource(cases, self, "/screening/cases"))
+}
+
+func (api *api) getScreeningCase(w http.ResponseWriter, r *http.Request) {
+	c, err := screening.GetCase(api.db, org(r), chi.URLParam(r, "caseID"))
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	render.Render(w, r, newScreeningCase(c))
+}
+
+func (api *api) clearScreeningCase(w http.ResponseWriter, r *http.Request) {
+	c, err := screening.GetCase(api.db, org(r), chi.URLParam(r, "caseID"))
+	if err != nil {
+		render.Render(w, r, errNotFound())
+		return
+	}
+
+	// A payment also held by the fraud rules stays held until it is reviewed
+	held, err := fraud.PendingHold(api.db, org(r), c.PaymentID)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	if held {
+		render.Render(w, r, errConflict(fmt.Errorf("payment is held for fraud review")))
+		return
+	}
+
+	api.decideScreeningCase(w, r, func(db *sqlx.DB, org, id, officer, note string) error {
+		return screening.Clear(db, org, id, officer, note, api.released(org))
+	})
+}
+
+func (api *api) confirmScreeningCase(w http.ResponseWriter, r *http.Request) {
+	api.decideScreeningCase(w, r, screening.Confirm)
+}
+
+func (api *api) decideScreeningCase(w http.ResponseWriter, r *http.Request, decide func(db *sqlx.DB, org, id, officer, note string) error) {
+	data := &screening.DecisionResource{}
+	if err := render.Bind(r, data); err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	id := chi.URLParam(r, "caseID")
+	switch err := decide(api.db, org(r), id, user(r), data.Data.Attributes.Note); err {
+	case nil:
+	case screening.ErrMissingOfficer:
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	case sql.ErrNoRows:
+		render.Render(w, r, errNotFound())
+		return
+	case screening.ErrCaseClosed:
+		render.Render(w, r, errConflict(err))
+		return
+	default:
+		render.Render(w, r, errSystem(err))
+		return
+	}
+
+	c, err := screening.GetCase(api.db, org(r), id)
+	if err != nil {
+		render.Render(w, r, errSystem(err))
+		return
+	}
+	api.publishChange(r, c.PaymentID)
+
+	render.Render(w, r, newScreeningCase(c))
+}
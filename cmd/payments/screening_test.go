@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/events"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestScreeningOfficer confirms a case. The officer is the user that makes
+// the request rather than a member of the body and the rejection of the
+// payment is published.
+func TestScreeningOfficer(t *testing.T) {
+	const (
+		caseID    = "7eb8277a-6c91-45e9-8a03-a27f82aca350"
+		paymentID = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		body      = `{"data":{"type":"ScreeningDecision","attributes":{"officer":"mallory","note":"listed"}}}`
+	)
+
+	testCases := map[string]struct {
+		user   string
+		givenF func(mock sqlmock.Sqlmock)
+		code   int
+		event  string
+	}{
+		"Officer": {
+			user: "bob",
+			givenF: func(mock sqlmock.Sqlmock) {
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM screening_cases").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id", "status"}).AddRow(caseID, paymentID, "open"))
+				mock.ExpectExec("UPDATE screening_cases").WithArgs("confirmed", "bob", "listed", caseID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT status").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("held"))
+				mock.ExpectExec("UPDATE payments SET status").WithArgs("rejected", paymentID, testOrganisation).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM screening_cases").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "payment_id", "status", "decided_by"}).AddRow(caseID, paymentID, "confirmed", "bob"))
+				mock.ExpectCommit()
+				expectScoped(mock, testOrganisation)
+				mock.ExpectQuery("SELECT (.+) FROM payments").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(paymentID, "rejected"))
+				mock.ExpectCommit()
+			},
+			code:  200,
+			event: "rejected",
+		},
+		"NoUser": {
+			givenF: func(mock sqlmock.Sqlmock) {},
+			code:   400,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			tc.givenF(mock)
+
+			a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+			broker := events.NewBroker()
+			published, cancel := broker.Subscribe(testOrganisation)
+			defer cancel()
+			a.publisher = broker
+
+			req := httptest.NewRequest("POST", "/screening/cases/"+caseID+"/confirm", strings.NewReader(body))
+			req.Header.Set(userHeader, tc.user)
+			resp := httptest.NewRecorder()
+			testRouter(a).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body)
+			}
+			select {
+			case e := <-published:
+				if e.Type != events.PaymentUpdated || e.PaymentID != paymentID || e.Status != tc.event {
+					t.Errorf("expected the payment to be %s, got %+v", tc.event, e)
+				}
+			default:
+				if tc.event != "" {
+					t.Error("expected an event")
+				}
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/go-chi/render"
+)
+
+// scope scopes the request to the organisation of its principal and refuses
+// principals that do not act for one
+func (api *api) scope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := principal(r)
+		if p == nil || p.Organisation == "" || p.Organisation == tenant.System {
+			render.Render(w, r, errForbidden(tenant.ErrNoOrganisation))
+			return
+		}
+
+		r = annotate(r, slog.String("organisation", p.Organisation))
+		next.ServeHTTP(w, r.WithContext(tenant.NewContext(r.Context(), p.Organisation)))
+	})
+}
+
+// org returns the organisation the request acts for
+func org(r *http.Request) string {
+	id, _ := tenant.FromContext(r.Context())
+	return id
+}
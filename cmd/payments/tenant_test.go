@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/auth"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// Headers picking the principal of a test request
+const (
+	organisationHeader = "X-Organisation"
+	userHeader         = "X-User"
+	scopesHeader       = "X-Scopes"
+)
+
+const (
+	testOrganisation  = "00000000-0000-0000-0000-000000000001"
+	otherOrganisation = "6c1fd5ef-3f21-4f6f-9d1c-3b5a1b3d8f42"
+)
+
+// testAuthenticator trusts the principal the test request claims to be
+var testAuthenticator = auth.AuthenticatorFunc(func(r *http.Request) (*auth.Principal, error) {
+	p := &auth.Principal{ID: "tester", Organisation: testOrganisation, Method: "test", Scopes: []string{"admin"}}
+	if id, ok := r.Header[userHeader]; ok {
+		p.ID = id[0]
+	}
+	if org, ok := r.Header[organisationHeader]; ok {
+		p.Organisation = org[0]
+	}
+	if scopes, ok := r.Header[scopesHeader]; ok {
+		p.Scopes = strings.Fields(scopes[0])
+	}
+	return p, nil
+})
+
+func newTestAPI(db *sqlx.DB) *api {
+	return &api{db: db, authenticator: testAuthenticator}
+}
+
+// expectScoped expects a transaction scoped to the organisation
+func expectScoped(mock sqlmock.Sqlmock, org string) {
+	mock.ExpectBegin()
+	mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// TestOrganisationIsolation requests the resources of the default
+// organisation on behalf of another one. Every handler must scope its first
+// query to the organisation of the request and find nothing.
+func TestOrganisationIsolation(t *testing.T) {
+	const (
+		paymentID  = "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+		scheduleID = "/payment-schedules/216d4da9-e59a-4cc6-8df3-3da6e7580b77"
+		caseID     = "/screening/cases/7eb8277a-6c91-45e9-8a03-a27f82aca350"
+		matchID    = "/reconciliation/matches/97fe60ba-1334-439f-91db-32cc3cde036a"
+	)
+
+	testCases := map[string]struct {
+		method, path, body string
+		code               int
+	}{
+		"ListPayments":    {method: "GET", path: "/payments", code: 200},
+		"GetPayment":      {method: "GET", path: paymentID, code: 404},
+		"UpdatePayment":   {method: "PUT", path: paymentID, body: `{"data":{"type":"Payment","attributes":{"amount":"1"}}}`, code: 404},
+		"DeletePayment":   {method: "DELETE", path: paymentID, code: 404},
+		"ListRefunds":     {method: "GET", path: paymentID + "/refunds", code: 404},
+		"CreateRefund":    {method: "POST", path: paymentID + "/refunds", body: `{"data":{"type":"Payment","attributes":{"amount":"1"}}}`, code: 404},
+		"CreateReversal":  {method: "POST", path: paymentID + "/reversal", code: 404},
+		"GetRoute":        {method: "GET", path: paymentID + "/route", code: 404},
+		"OverrideRoute":   {method: "PUT", path: paymentID + "/route", body: `{"data":{"type":"PaymentRoute","attributes":{"scheme":"FPS","override_reason":"test"}}}`, code: 404},
+		"FraudDecisions":  {method: "GET", path: paymentID + "/fraud-decisions", code: 404},
+		"FraudReview":     {method: "POST", path: paymentID + "/fraud-review", body: `{"data":{"type":"FraudReview","attributes":{"outcome":"allow"}}}`, code: 404},
+		"GetApprovals":    {method: "GET", path: paymentID + "/approvals", code: 404},
+		"Approve":         {method: "POST", path: paymentID + "/approvals/approve", code: 404},
+		"Reconciliation":  {method: "GET", path: paymentID + "/reconciliation", code: 404},
+		"ListApprovals":   {method: "GET", path: "/approvals", code: 200},
+		"ListSchedules":   {method: "GET", path: "/payment-schedules", code: 200},
+		"GetSchedule":     {method: "GET", path: scheduleID, code: 404},
+		"CancelSchedule":  {method: "DELETE", path: scheduleID, code: 404},
+		"ScheduleRuns":    {method: "GET", path: scheduleID + "/runs", code: 404},
+		"ListCases":       {method: "GET", path: "/screening/cases", code: 200},
+		"GetCase":         {method: "GET", path: caseID, code: 404},
+		"ClearCase":       {method: "POST", path: caseID + "/clear", body: `{"data":{"type":"ScreeningDecision","attributes":{}}}`, code: 404},
+		"ConfirmCase":     {method: "POST", path: caseID + "/confirm", body: `{"data":{"type":"ScreeningDecision","attributes":{}}}`, code: 404},
+		"ListStatements":  {method: "GET", path: "/statements", code: 200},
+		"ListExceptions":  {method: "GET", path: "/reconciliation/exceptions", code: 200},
+		"GetMatch":        {method: "GET", path: matchID, code: 404},
+		"DeleteMatch":     {method: "DELETE", path: matchID, code: 404},
+		"CreateMatch":     {method: "POST", path: "/reconciliation/matches", body: `{"data":{"type":"Reconciliation","attributes":{"payment_id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","entry_id":"09fe827a-b3c2-4437-b999-6c0e780c0983"}}}`, code: 404},
+		"SystemForbidden": {method: "GET", path: "/payments", code: 403},
+		"NoOrganisation":  {method: "GET", path: "/payments", code: 403},
+		"Unauthenticated": {method: "GET", path: "/payments", code: 401},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+			db := sqlx.NewDb(mockDB, "sqlmock")
+
+			a := newTestAPI(db)
+			org := otherOrganisation
+			switch name {
+			case "SystemForbidden":
+				org = tenant.System
+			case "NoOrganisation":
+				org = ""
+			case "Unauthenticated":
+				a.authenticator = auth.APIKeys{DB: db}
+			}
+
+			if tc.code == http.StatusOK || tc.code == http.StatusNotFound {
+				expectScoped(mock, org)
+				query := mock.ExpectQuery("organisation_id")
+				if tc.code == http.StatusOK {
+					query.WillReturnRows(sqlmock.NewRows([]string{"organisation_id"}))
+					mock.ExpectCommit()
+				} else {
+					query.WillReturnError(sql.ErrNoRows)
+					mock.ExpectRollback()
+				}
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set(organisationHeader, org)
+
+			resp := httptest.NewRecorder()
+			testRouter(a).ServeHTTP(resp, req)
+
+			if resp.Code != tc.code {
+				t.Errorf("expected %d, got %d: %s", tc.code, resp.Code, resp.Body.String())
+			}
+			if tc.code == http.StatusOK && !strings.Contains(resp.Body.String(), `"data":[]`) {
+				t.Errorf("expected no data, got %s", resp.Body.String())
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/VMitov/payments/pkg/trace"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// traceRequests starts a server span for every request continuing the trace
+// of the caller and returns the trace in the traceresponse header
+func (api *api) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.tracer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		parent, err := trace.ParseTraceparent(r.Header.Get(trace.TraceparentHeader))
+		if err == nil {
+			parent.TraceState = r.Header.Get(trace.TracestateHeader)
+		}
+
+		ctx, span := api.tracer.StartRemote(r.Context(), r.Method, trace.KindServer, parent)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+
+		w.Header().Set(trace.TraceresponseHeader, span.SpanContext().Traceparent())
+		if state := span.SpanContext().TraceState; state != "" {
+			w.Header().Set(trace.TracestateHeader, state)
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttribute("http.route", rctx.RoutePattern())
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", strconv.Itoa(code))
+		if code >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", code, http.StatusText(code)))
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/trace"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) Export(spans []*trace.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	expectScoped(mock, testOrganisation)
+	mock.ExpectQuery("SELECT (.+) FROM payments").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec := &spanRecorder{}
+	a := newTestAPI(sqlx.NewDb(mockDB, "sqlmock"))
+	a.tracer = trace.NewTracer("payments", rec)
+
+	req := httptest.NewRequest("GET", "/payments/4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43", nil)
+	req.Header.Set(trace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(trace.TracestateHeader, "vendor=value")
+	resp := httptest.NewRecorder()
+	testRouter(a).ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d: %s", resp.Code, resp.Body.String())
+	}
+	tr, err := trace.ParseTraceparent(resp.Header().Get(trace.TraceresponseHeader))
+	if err != nil || tr.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace of the caller in the response, got %q", resp.Header().Get(trace.TraceresponseHeader))
+	}
+	if resp.Header().Get(trace.TracestateHeader) != "vendor=value" {
+		t.Errorf("expected the trace state to be propagated, got %q", resp.Header().Get(trace.TracestateHeader))
+	}
+	if !strings.Contains(resp.Body.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("expected the trace id in the error, got %s", resp.Body.String())
+	}
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(rec.spans))
+	}
+	query, server := rec.spans[0], rec.spans[1]
+	if server.Name != "GET /payments/{paymentID}/" || server.Attributes["http.status_code"] != "404" || server.Context.SpanID != tr.SpanID {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	if query.Name != "payment.get" || query.Parent != server.Context.SpanID || query.Error != sql.ErrNoRows.Error() {
+		t.Errorf("unexpected query span %+v", query)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
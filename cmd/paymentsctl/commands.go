@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// commands are the commands calling the API
+type commands struct {
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// whereFlag are the attributes the listed payments must have
+type whereFlag map[string]string
+
+func (w whereFlag) String() string {
+	return fmt.Sprint(map[string]string(w))
+}
+
+func (w whereFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i < 1 {
+		return errors.New("expected ATTRIBUTE=VALUE")
+	}
+	w[value[:i]] = value[i+1:]
+	return nil
+}
+
+func (cmd *commands) list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	format := fs.String("o", formatTable, "output format: table, json or csv")
+	status := fs.String("status", "", "list only the payments with the status")
+	kind := fs.String("kind", "", "list only the payments of the kind: payment, refund or reversal")
+	where := whereFlag{}
+	fs.Var(where, "where", "list only the payments with the attribute, like currency=GBP or beneficiary_party.name=Jane, repeatable")
+	limit := fs.Int("limit", 0, "most payments to list, 0 lists all")
+	pageSize := fs.Int("page-size", 100, "payments fetched per request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	pr, err := newPrinter(*format, cmd.stdout)
+	if err != nil {
+		return err
+	}
+
+	listed := 0
+	filter := client.Filter{Status: *status, Kind: *kind, Attributes: where}
+	it := cmd.client.PaymentsFiltered(ctx, filter, *pageSize)
+	for it.Next() && (*limit == 0 || listed < *limit) {
+		if err := pr.print(it.Payment()); err != nil {
+			return err
+		}
+		listed++
+	}
+	if err := pr.flush(); err != nil {
+		return err
+	}
+	return it.Err()
+}
+
+func (cmd *commands) get(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	format := fs.String("o", formatTable, "output format: table, json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: paymentsctl get [-o FORMAT] ID")
+	}
+
+	p, err := cmd.client.GetPayment(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printOne(*format, cmd.stdout, p)
+}
+
+func (cmd *commands) create(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	format := fs.String("o", formatTable, "output format: table, json or csv")
+	file := fs.String("f", "", "file with the attributes of the payment, - reads them from the standard input")
+	key := fs.String("idempotency-key", "", "key making it safe to run the command again, random if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("usage: paymentsctl create [-o FORMAT] [-idempotency-key KEY] -f FILE")
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = ioutil.ReadAll(cmd.stdin)
+	} else {
+		data, err = ioutil.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	attributes, err := readAttributes(data)
+	if err != nil {
+		return errors.Wrap(err, *file)
+	}
+
+	if *key != "" {
+		ctx = client.WithIdempotencyKey(ctx, *key)
+	}
+	p, err := cmd.client.CreatePayment(ctx, attributes)
+	if err != nil {
+		return err
+	}
+	return printOne(*format, cmd.stdout, p)
+}
+
+// readAttributes returns the attributes of the payment in the file, which
+// is either the attributes or a resource of the API with them
+func readAttributes(data []byte) (json.RawMessage, error) {
+	var resource struct {
+		Data *struct {
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return nil, err
+	}
+	if resource.Data != nil {
+		if resource.Data.Attributes == nil {
+			return nil, errors.New("the resource has no attributes")
+		}
+		return resource.Data.Attributes, nil
+	}
+	return json.RawMessage(bytes.TrimSpace(data)), nil
+}
+
+// editor opens the file in the editor of the user, VISUAL or EDITOR
+var editor = func(path string) error {
+	command := os.Getenv("VISUAL")
+	if command == "" {
+		command = os.Getenv("EDITOR")
+	}
+	if command == "" {
+		command = "vi"
+	}
+
+	args := strings.Fields(command)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// edit opens the attributes of the payment in the editor and replaces them
+// with the edited ones unless the payment changed in the meantime
+func (cmd *commands) edit(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: paymentsctl edit ID")
+	}
+
+	p, err := cmd.client.GetPayment(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	var original bytes.Buffer
+	if err := json.Indent(&original, p.Attributes, "", "  "); err != nil {
+		return err
+	}
+	original.WriteByte('\n')
+
+	f, err := ioutil.TempFile("", "payment-"+p.ID+"-*.json")
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+	_, err = f.Write(original.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	if err := editor(path); err != nil {
+		os.Remove(path)
+		return errors.Wrap(err, "editor failed")
+	}
+
+	edited, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, original.Bytes()) {
+		os.Remove(path)
+		fmt.Fprintln(cmd.stdout, "Edit cancelled, no changes made.")
+		return nil
+	}
+	// The edits are kept in the file when they are not saved
+	if !json.Valid(edited) {
+		return errors.Errorf("the attributes are not valid JSON, the edit is in %s", path)
+	}
+
+	_, err = cmd.client.UpdatePayment(client.WithIfMatch(ctx, p.ETag), p.ID, json.RawMessage(edited))
+	if client.IsModified(err) {
+		return errors.Errorf("payment %s changed since it was opened, edit it again, the edit is in %s", p.ID, path)
+	} else if err != nil {
+		return errors.Wrapf(err, "the edit is in %s", path)
+	}
+
+	os.Remove(path)
+	fmt.Fprintf(cmd.stdout, "payment %s updated\n", p.ID)
+	return nil
+}
+
+func (cmd *commands) delete(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: paymentsctl delete ID...")
+	}
+
+	for _, id := range args {
+		if err := cmd.client.DeletePayment(ctx, id); err != nil {
+			return errors.Wrap(err, id)
+		}
+		fmt.Fprintf(cmd.stdout, "payment %s deleted\n", id)
+	}
+	return nil
+}
+
+// reconnectDelay is the wait before following the events again when the
+// stream ended
+var reconnectDelay = time.Second
+
+// events follows the changes of the payments until interrupted
+func (cmd *commands) events(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	format := fs.String("o", formatTable, "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != formatTable && *format != formatJSON {
+		return errors.Errorf("unknown output format %q, use table or json", *format)
+	}
+
+	for {
+		stream, err := cmd.client.Events(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for stream.Next() {
+			if err := printEvent(*format, cmd.stdout, stream.Event()); err != nil {
+				stream.Close()
+				return err
+			}
+		}
+		err = stream.Err()
+		stream.Close()
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The stream ends when the service restarts or falls behind
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "paymentsctl: events stream failed:", err)
+		}
+		fmt.Fprintln(os.Stderr, "paymentsctl: reconnecting, changes may have been missed")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
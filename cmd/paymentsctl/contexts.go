@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/VMitov/payments/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// Context is an environment of the service and the credentials to call it
+// with. The secrets are better kept in files than in the configuration.
+type Context struct {
+	URL        string `json:"url"`
+	APIKey     string `json:"api_key,omitempty"`
+	APIKeyFile string `json:"api_key_file,omitempty"`
+	Token      string `json:"token,omitempty"`
+	TokenFile  string `json:"token_file,omitempty"`
+}
+
+// Config are the contexts of paymentsctl
+type Config struct {
+	Current  string              `json:"current,omitempty"`
+	Contexts map[string]*Context `json:"contexts"`
+
+	path string
+}
+
+// configPath returns the path of the configuration, PAYMENTSCTL_CONFIG or
+// paymentsctl/config.json in the configuration directory of the user
+func configPath() (string, error) {
+	if path := os.Getenv("PAYMENTSCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "paymentsctl", "config.json"), nil
+}
+
+// loadConfig reads the configuration, a missing one has no contexts
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{Contexts: map[string]*Context{}, path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, errors.Wrapf(err, "invalid configuration %s", path)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = map[string]*Context{}
+	}
+	return cfg, nil
+}
+
+// save writes the configuration readable only by the user since it may
+// hold credentials
+func (cfg *Config) save() error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cfg.path, append(data, '\n'), 0600)
+}
+
+// context returns the context with the name or the current one
+func (cfg *Config) context(name string) (string, *Context, error) {
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		return "", nil, errors.New("no context selected, add one with: paymentsctl context set NAME -url URL")
+	}
+	c, ok := cfg.Contexts[name]
+	if !ok {
+		return "", nil, errors.Errorf("unknown context %q", name)
+	}
+	return name, c, nil
+}
+
+// client returns a client of the service of the context
+func (c *Context) client() (*client.Client, error) {
+	if c.URL == "" {
+		return nil, errors.New("the context has no url")
+	}
+
+	var auth client.Authenticator
+	switch {
+	case c.APIKey != "" || c.APIKeyFile != "":
+		key, err := secret(c.APIKey, c.APIKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		auth = client.APIKey(key)
+	case c.Token != "" || c.TokenFile != "":
+		// The file is read for every request so refreshed tokens are used
+		if c.TokenFile != "" {
+			file := c.TokenFile
+			auth = client.AuthenticatorFunc(func(r *http.Request) error {
+				token, err := secret("", file)
+				if err != nil {
+					return err
+				}
+				return client.BearerToken(token).Authenticate(r)
+			})
+		} else {
+			auth = client.BearerToken(c.Token)
+		}
+	}
+
+	cl := client.New(c.URL, auth)
+	cl.UserAgent = "paymentsctl"
+	return cl, nil
+}
+
+// secret returns the value or the content of the file
+func secret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+const contextUsage = `usage:
+  paymentsctl context list
+  paymentsctl context use NAME
+  paymentsctl context set NAME [-url URL] [-api-key-file FILE | -token-file FILE | -api-key KEY | -token TOKEN]
+  paymentsctl context delete NAME`
+
+// contextCommand manages the contexts
+func contextCommand(cfg *Config, args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		return errors.New(contextUsage)
+	}
+
+	fs := flag.NewFlagSet("context "+args[0], flag.ContinueOnError)
+	url := fs.String("url", "", "URL of the service like https://payments.example.com")
+	apiKey := fs.String("api-key", "", "API key, prefer -api-key-file")
+	apiKeyFile := fs.String("api-key-file", "", "file with the API key")
+	token := fs.String("token", "", "JWT bearer token, prefer -token-file")
+	tokenFile := fs.String("token-file", "", "file with the JWT bearer token, read for every request")
+
+	// The name comes before the flags of the context
+	var name string
+	if args[0] != "list" {
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return errors.New(contextUsage)
+		}
+		name, args = args[1], append([]string{args[0]}, args[2:]...)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New(contextUsage)
+	}
+
+	if args[0] == "list" {
+		names := make([]string, 0, len(cfg.Contexts))
+		for name := range cfg.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tURL")
+		for _, name := range names {
+			current := ""
+			if name == cfg.Current {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, name, cfg.Contexts[name].URL)
+		}
+		return w.Flush()
+	}
+
+	switch args[0] {
+	case "use":
+		if _, ok := cfg.Contexts[name]; !ok {
+			return errors.Errorf("unknown context %q", name)
+		}
+		cfg.Current = name
+
+	case "set":
+		c, ok := cfg.Contexts[name]
+		if !ok {
+			c = &Context{}
+			cfg.Contexts[name] = c
+		}
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if set["url"] {
+			c.URL = *url
+		}
+		// The credentials replace each other
+		if set["api-key"] || set["api-key-file"] || set["token"] || set["token-file"] {
+			*c = Context{URL: c.URL, APIKey: *apiKey, APIKeyFile: *apiKeyFile, Token: *token, TokenFile: *tokenFile}
+		}
+		if c.URL == "" {
+			return errors.New("the url of the context is required")
+		}
+		if cfg.Current == "" {
+			cfg.Current = name
+		}
+
+	case "delete":
+		if _, ok := cfg.Contexts[name]; !ok {
+			return errors.Errorf("unknown context %q", name)
+		}
+		delete(cfg.Contexts, name)
+		if cfg.Current == name {
+			cfg.Current = ""
+		}
+
+	default:
+		return errors.New(contextUsage)
+	}
+
+	return cfg.save()
+}
@@ -0,0 +1,92 @@
+// Command paymentsctl inspects and changes the payments through the API
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const usage = `usage: paymentsctl [-context NAME] COMMAND [ARGS]
+
+Commands:
+  list     [-o table|json|csv] [-status STATUS] [-kind KIND] [-where ATTRIBUTE=VALUE]... [-limit N]
+  get      [-o table|json|csv] ID
+  create   [-o table|json|csv] [-idempotency-key KEY] -f FILE
+  edit     ID
+  delete   ID...
+  events   [-o table|json]
+  context  list | use NAME | set NAME [FLAGS] | delete NAME
+
+The contexts are kept in PAYMENTSCTL_CONFIG or paymentsctl/config.json in
+the configuration directory of the user. -context or PAYMENTSCTL_CONTEXT
+selects one instead of the current.`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "paymentsctl:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command of the arguments
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("paymentsctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), usage) }
+	contextName := fs.String("context", os.Getenv("PAYMENTSCTL_CONTEXT"), "context to use instead of the current")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New(usage)
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	if command == "context" {
+		return contextCommand(cfg, args, stdout)
+	}
+
+	_, c, err := cfg.context(*contextName)
+	if err != nil {
+		return err
+	}
+	cl, err := c.client()
+	if err != nil {
+		return err
+	}
+	cmd := &commands{client: cl, stdin: stdin, stdout: stdout}
+
+	switch command {
+	case "list":
+		return cmd.list(ctx, args)
+	case "get":
+		return cmd.get(ctx, args)
+	case "create":
+		return cmd.create(ctx, args)
+	case "edit":
+		return cmd.edit(ctx, args)
+	case "delete":
+		return cmd.delete(ctx, args)
+	case "events":
+		return cmd.events(ctx, args)
+	}
+	return errors.Errorf("unknown command %q\n%s", command, usage)
+}
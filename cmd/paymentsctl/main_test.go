@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const listJSON = `{"data":[
+	{"id":"1","type":"Payment","attributes":{"amount":"100.21","currency":"GBP","end_to_end_reference":"rent"},"meta":{"status":"created"}},
+	{"id":"2","type":"Payment","attributes":{"amount":"5.00","currency":"EUR"},"meta":{"status":"settled"}},
+	{"id":"3","type":"Payment","attributes":{"amount":"50.00","currency":"GBP"},"meta":{"status":"created","kind":"refund"},
+		"relationships":{"original":{"data":{"type":"Payment","id":"1"}}}}
+],"links":{"self":"/payments?page[size]=100"}}`
+
+// fakeAPI serves the payments of the tests and records the requests
+type fakeAPI struct {
+	etag     string
+	requests []*http.Request
+	bodies   []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+
+	switch {
+	case r.URL.Path == "/payments" && r.Method == http.MethodGet:
+		w.Write(filterList(r.URL.Query()))
+	case r.URL.Path == "/payments" && r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"id":"4","type":"Payment","attributes":{"amount":"1.00"},"meta":{"status":"created"}}}`))
+	case r.URL.Path == "/payments/1":
+		if match := r.Header.Get("If-Match"); match != "" && match != f.etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"errors":[{"status":"412","title":"The resource was modified.","detail":"payment was modified"}]}`))
+			return
+		}
+		w.Header().Set("ETag", f.etag)
+		w.Write([]byte(`{"data":{"id":"1","type":"Payment","attributes":{"amount":"100.21"},"meta":{"status":"created"}}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[{"status":"404","title":"Resource not found."}]}`))
+	}
+}
+
+// filterList filters the payments of listJSON like the service does with the
+// filter parameters of the query
+func filterList(query url.Values) []byte {
+	var list struct {
+		Data []struct {
+			Attributes map[string]interface{} `json:"attributes"`
+			Meta       map[string]string      `json:"meta"`
+		} `json:"data"`
+	}
+	var raw struct {
+		Data  []json.RawMessage `json:"data"`
+		Links json.RawMessage   `json:"links"`
+	}
+	json.Unmarshal([]byte(listJSON), &list)
+	json.Unmarshal([]byte(listJSON), &raw)
+
+	selected := []json.RawMessage{}
+	for i, p := range list.Data {
+		if p.Meta["kind"] == "" {
+			p.Meta["kind"] = "payment"
+		}
+		matches := true
+		for param := range query {
+			if !strings.HasPrefix(param, "filter[") {
+				continue
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(param, "filter["), "]")
+			value, ok := p.Meta[name]
+			if name != "status" && name != "kind" {
+				value, ok = p.Attributes[name].(string)
+			}
+			matches = matches && ok && value == query.Get(param)
+		}
+		if matches {
+			selected = append(selected, raw.Data[i])
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"data": selected, "links": raw.Links})
+	return data
+}
+
+// setup serves the fake API and selects a context of it
+func setup(t *testing.T) *fakeAPI {
+	api := &fakeAPI{etag: `"v1"`}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	t.Setenv("PAYMENTSCTL_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("PAYMENTSCTL_CONTEXT", "")
+	// The failed edits are kept in temporary files
+	t.Setenv("TMPDIR", t.TempDir())
+	if _, err := runCommand(t, "context", "set", "test", "-url", srv.URL, "-api-key", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	return api
+}
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := run(context.Background(), args, strings.NewReader(""), &stdout)
+	return stdout.String(), err
+}
+
+func TestList(t *testing.T) {
+	testCases := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"Table": {
+			args: []string{"list"},
+			expected: "ID  KIND     STATUS   AMOUNT  CURRENCY  REFERENCE\n" +
+				"1   payment  created  100.21  GBP       rent\n" +
+				"2   payment  settled  5.00    EUR       \n" +
+				"3   refund   created  50.00   GBP       \n",
+		},
+		"Filtered": {
+			args: []string{"list", "-status", "created", "-where", "currency=GBP", "-kind", "payment"},
+			expected: "ID  KIND     STATUS   AMOUNT  CURRENCY  REFERENCE\n" +
+				"1   payment  created  100.21  GBP       rent\n",
+		},
+		"CSV": {
+			args: []string{"list", "-o", "csv", "-limit", "1"},
+			expected: "id,kind,status,original_id,amount,currency,end_to_end_reference,attributes\n" +
+				`1,payment,created,,100.21,GBP,rent,"{""amount"":""100.21"",""currency"":""GBP"",""end_to_end_reference"":""rent""}"` + "\n",
+		},
+		"JSON": {
+			args: []string{"list", "-o", "json", "-kind", "refund"},
+			expected: `[
+  {
+    "id": "3",
+    "kind": "refund",
+    "status": "created",
+    "original_id": "1",
+    "attributes": {
+      "amount": "50.00",
+      "currency": "GBP"
+    }
+  }
+]
+`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			setup(t)
+
+			output, err := runCommand(t, tc.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, output)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	api := setup(t)
+
+	file := filepath.Join(t.TempDir(), "payment.json")
+	if err := ioutil.WriteFile(file, []byte(`{"data":{"type":"Payment","attributes":{"amount":"1.00"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runCommand(t, "create", "-idempotency-key", "ticket-7", "-f", file); err != nil {
+		t.Fatal(err)
+	}
+	if key := api.requests[0].Header.Get("Idempotency-Key"); key != "ticket-7" {
+		t.Errorf("expected the idempotency key, got %q", key)
+	}
+	if api.bodies[0] != `{"data":{"type":"Payment","attributes":{"amount":"1.00"}}}` {
+		t.Errorf("unexpected body %s", api.bodies[0])
+	}
+	if auth := api.requests[0].Header.Get("X-API-Key"); auth != "secret" {
+		t.Errorf("expected the API key of the context, got %q", auth)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	testCases := map[string]struct {
+		edit     string
+		modified bool
+		err      string
+		output   string
+	}{
+		"Updated": {
+			edit:   `{"amount":"100.22"}`,
+			output: "payment 1 updated\n",
+		},
+		"Unchanged": {
+			output: "Edit cancelled, no changes made.\n",
+		},
+		"Invalid": {
+			edit: `{"amount":`,
+			err:  "the attributes are not valid JSON",
+		},
+		"Modified": {
+			edit:     `{"amount":"100.22"}`,
+			modified: true,
+			err:      "payment 1 changed since it was opened",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			api := setup(t)
+
+			defer func(e func(string) error) { editor = e }(editor)
+			editor = func(path string) error {
+				if tc.modified {
+					api.etag = `"v2"`
+				}
+				if tc.edit == "" {
+					return nil
+				}
+				return ioutil.WriteFile(path, []byte(tc.edit), 0600)
+			}
+
+			output, err := runCommand(t, "edit", "1")
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != tc.output {
+				t.Errorf("expected %q, got %q", tc.output, output)
+			}
+
+			if tc.edit != "" {
+				put := api.requests[len(api.requests)-1]
+				if put.Method != http.MethodPut || put.Header.Get("If-Match") != `"v1"` {
+					t.Errorf("expected a conditional update, got %s If-Match %q", put.Method, put.Header.Get("If-Match"))
+				}
+			}
+		})
+	}
+}
+
+func TestContexts(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("PAYMENTSCTL_CONFIG", config)
+
+	steps := [][]string{
+		{"context", "set", "staging", "-url", "https://staging.example.com", "-token-file", "/run/token"},
+		{"context", "set", "live", "-url", "https://payments.example.com", "-api-key-file", "/run/key"},
+		{"context", "use", "live"},
+		// The credentials replace each other
+		{"context", "set", "staging", "-api-key", "key"},
+	}
+	for _, args := range steps {
+		if _, err := runCommand(t, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output, err := runCommand(t, "context", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "CURRENT  NAME     URL\n" +
+		"*        live     https://payments.example.com\n" +
+		"         staging  https://staging.example.com\n"
+	if output != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	cfg, err := loadConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.Contexts["staging"]; *c != (Context{URL: "https://staging.example.com", APIKey: "key"}) {
+		t.Errorf("unexpected context %+v", c)
+	}
+
+	// The credentials are only readable by the user
+	info, err := os.Stat(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected the configuration to be private, got %v", perm)
+	}
+
+	if _, err := runCommand(t, "-context", "dev", "list"); err == nil || !strings.Contains(err.Error(), `unknown context "dev"`) {
+		t.Errorf("expected the context to be unknown, got %v", err)
+	}
+}
+
+func TestReadAttributes(t *testing.T) {
+	for _, data := range []string{`{"amount":"1.00"}`, `{"data":{"attributes":{"amount":"1.00"}}}`} {
+		attributes, err := readAttributes([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v map[string]string
+		if err := json.Unmarshal(attributes, &v); err != nil || v["amount"] != "1.00" {
+			t.Errorf("unexpected attributes %s of %s", attributes, data)
+		}
+	}
+}
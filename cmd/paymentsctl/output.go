@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/VMitov/payments/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// columns are the attributes shown in the tables besides the status
+var columns = []string{"amount", "currency", "end_to_end_reference"}
+
+// paymentJSON is a payment in the JSON output
+type paymentJSON struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	OriginalID string          `json:"original_id,omitempty"`
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+// printer writes the payments in a format as they are listed
+type printer interface {
+	print(p *client.Payment) error
+	flush() error
+}
+
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case formatTable:
+		t := &tablePrinter{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+		fmt.Fprintln(t.w, "ID\tKIND\tSTATUS\tAMOUNT\tCURRENCY\tREFERENCE")
+		return t, nil
+	case formatJSON:
+		return &jsonPrinter{w: w}, nil
+	case formatCSV:
+		c := &csvPrinter{w: csv.NewWriter(w)}
+		return c, c.w.Write(append([]string{"id", "kind", "status", "original_id"}, append(columns, "attributes")...))
+	}
+	return nil, errors.Errorf("unknown output format %q, use table, json or csv", format)
+}
+
+type tablePrinter struct {
+	w *tabwriter.Writer
+}
+
+func (t *tablePrinter) print(p *client.Payment) error {
+	row := []string{p.ID, p.Kind, p.Status}
+	for _, column := range columns {
+		row = append(row, attribute(p.Attributes, column))
+	}
+	_, err := fmt.Fprintln(t.w, strings.Join(row, "\t"))
+	return err
+}
+
+func (t *tablePrinter) flush() error {
+	return t.w.Flush()
+}
+
+// jsonPrinter writes the payments as a JSON array, or a single object for
+// a single payment
+type jsonPrinter struct {
+	w        io.Writer
+	payments []paymentJSON
+}
+
+func (j *jsonPrinter) print(p *client.Payment) error {
+	j.payments = append(j.payments, paymentJSON{
+		ID: p.ID, Kind: p.Kind, Status: p.Status, OriginalID: p.OriginalID, Attributes: p.Attributes,
+	})
+	return nil
+}
+
+func (j *jsonPrinter) flush() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	if j.payments == nil {
+		return enc.Encode([]paymentJSON{})
+	}
+	return enc.Encode(j.payments)
+}
+
+// printOne writes a single payment
+func printOne(format string, w io.Writer, p *client.Payment) error {
+	if format == formatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(paymentJSON{
+			ID: p.ID, Kind: p.Kind, Status: p.Status, OriginalID: p.OriginalID, Attributes: p.Attributes,
+		})
+	}
+
+	pr, err := newPrinter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := pr.print(p); err != nil {
+		return err
+	}
+	return pr.flush()
+}
+
+type csvPrinter struct {
+	w *csv.Writer
+}
+
+func (c *csvPrinter) print(p *client.Payment) error {
+	row := []string{p.ID, p.Kind, p.Status, p.OriginalID}
+	for _, column := range columns {
+		row = append(row, attribute(p.Attributes, column))
+	}
+	return c.w.Write(append(row, string(p.Attributes)))
+}
+
+func (c *csvPrinter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// attribute returns the attribute at the dotted path like
+// beneficiary_party.name, the JSON of it if it is not a string
+func attribute(attributes json.RawMessage, path string) string {
+	var value interface{}
+	if err := json.Unmarshal(attributes, &value); err != nil {
+		return ""
+	}
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = object[name]; !ok {
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// printEvent writes an event as a line of a table or of JSON
+func printEvent(format string, w io.Writer, e client.Event) error {
+	if format == formatJSON {
+		return json.NewEncoder(w).Encode(e)
+	}
+	_, err := fmt.Fprintf(w, "%s  %-16s  %s  %s  %s\n", e.Time.Local().Format(time.RFC3339), e.Type, e.PaymentID, e.Kind, e.Status)
+	return err
+}
@@ -0,0 +1,9 @@
+// Package database holds the migrations of the schema of the service
+package database
+
+import "embed"
+
+// Migrations are the versioned up and down migrations of the schema
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
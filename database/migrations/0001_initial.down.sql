@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS payments;
+
+DROP EXTENSION IF EXISTS "uuid-ossp";
@@ -0,0 +1,8 @@
+-- The schema as it was created by schema.sql before the migrations
+
+CREATE EXTENSION "uuid-ossp";
+
+CREATE TABLE payments (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    attributes  json
+);
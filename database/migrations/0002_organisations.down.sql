@@ -0,0 +1,33 @@
+DROP POLICY IF EXISTS organisation_isolation ON payments;
+ALTER TABLE payments NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE payments DISABLE ROW LEVEL SECURITY;
+
+DROP INDEX IF EXISTS payments_original_id;
+DROP INDEX IF EXISTS payments_organisation_id;
+
+ALTER TABLE payments
+    DROP COLUMN original_id,
+    DROP COLUMN kind,
+    DROP COLUMN status,
+    DROP COLUMN organisation_id;
+
+DROP TABLE IF EXISTS
+    payment_quota_usage,
+    rate_limits,
+    api_keys,
+    approvals,
+    approval_requests,
+    fraud_decisions,
+    fraud_events,
+    screening_cases,
+    payment_routes,
+    calendars,
+    payment_schedule_runs,
+    payment_schedules,
+    reconciliation_exceptions,
+    reconciliations,
+    statement_entries,
+    statements,
+    organisations;
+
+DROP FUNCTION IF EXISTS current_organisation_allows(uuid);
@@ -0,0 +1,289 @@
+-- The organisations the service acts for and the tables of its features
+
+CREATE TABLE organisations (
+    id         uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name       text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+INSERT INTO organisations (id, name) VALUES ('00000000-0000-0000-0000-000000000001', 'Default');
+
+-- The payments that were created before the organisations belong to the
+-- default organisation
+ALTER TABLE payments
+    ADD COLUMN organisation_id uuid REFERENCES organisations (id),
+    ADD COLUMN status          text NOT NULL DEFAULT 'created',
+    ADD COLUMN kind            text NOT NULL DEFAULT 'payment',
+    ADD COLUMN original_id     uuid REFERENCES payments (id);
+
+UPDATE payments SET organisation_id = '00000000-0000-0000-0000-000000000001';
+
+ALTER TABLE payments ALTER COLUMN organisation_id SET NOT NULL;
+
+CREATE INDEX payments_organisation_id ON payments (organisation_id);
+CREATE INDEX payments_original_id ON payments (original_id);
+
+CREATE TABLE statements (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    format          text NOT NULL,
+    reference       text NOT NULL,
+    account         text NOT NULL,
+    currency        text NOT NULL,
+    date            date,
+    received_at     timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX statements_organisation_id ON statements (organisation_id);
+
+CREATE TABLE statement_entries (
+    id           uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    statement_id uuid NOT NULL REFERENCES statements (id) ON DELETE CASCADE,
+    reference    text NOT NULL,
+    amount       numeric NOT NULL,
+    currency     text NOT NULL,
+    credit_debit text NOT NULL,
+    value_date   date,
+    booking_date date,
+    description  text NOT NULL
+);
+
+CREATE TABLE reconciliations (
+    id         uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id uuid NOT NULL UNIQUE REFERENCES payments (id) ON DELETE CASCADE,
+    entry_id   uuid NOT NULL UNIQUE REFERENCES statement_entries (id) ON DELETE CASCADE,
+    method     text NOT NULL,
+    matched_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE reconciliation_exceptions (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    kind            text NOT NULL,
+    item_id         uuid NOT NULL,
+    reason          text NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    resolved_at     timestamptz
+);
+
+CREATE INDEX reconciliation_exceptions_organisation_id ON reconciliation_exceptions (organisation_id);
+
+CREATE TABLE payment_schedules (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    attributes      json NOT NULL,
+    start_date      date NOT NULL,
+    recurrence      text NOT NULL DEFAULT '',
+    next_run        date,
+    runs            integer NOT NULL DEFAULT 0,
+    status          text NOT NULL DEFAULT 'active',
+    created_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX payment_schedules_organisation_id ON payment_schedules (organisation_id);
+CREATE INDEX payment_schedules_due ON payment_schedules (next_run) WHERE status = 'active';
+
+CREATE TABLE payment_schedule_runs (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    schedule_id uuid NOT NULL REFERENCES payment_schedules (id) ON DELETE CASCADE,
+    run_date    date NOT NULL,
+    payment_id  uuid REFERENCES payments (id) ON DELETE SET NULL,
+    status      text NOT NULL,
+    error       text NOT NULL DEFAULT '',
+    ran_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX payment_schedule_runs_once ON payment_schedule_runs (schedule_id, run_date) WHERE status = 'succeeded';
+
+CREATE TABLE calendars (
+    name        text PRIMARY KEY,
+    definition  json NOT NULL,
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE payment_routes (
+    payment_id      uuid PRIMARY KEY REFERENCES payments (id) ON DELETE CASCADE,
+    scheme          text NOT NULL,
+    rule            text NOT NULL DEFAULT '',
+    version         text NOT NULL DEFAULT '',
+    rationale       text[] NOT NULL,
+    overridden_by   text NOT NULL DEFAULT '',
+    override_reason text NOT NULL DEFAULT '',
+    decided_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE screening_cases (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    payment_id      uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+    status          text NOT NULL DEFAULT 'open',
+    hits            json NOT NULL,
+    decided_by      text NOT NULL DEFAULT '',
+    decision_note   text NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    decided_at      timestamptz
+);
+
+CREATE INDEX screening_cases_open ON screening_cases (organisation_id, created_at) WHERE status = 'open';
+
+CREATE TABLE fraud_events (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    payment_id      uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+    key             text NOT NULL,
+    account         text NOT NULL,
+    currency        text NOT NULL,
+    amount          numeric NOT NULL,
+    occurred_at     timestamptz NOT NULL
+);
+
+CREATE INDEX fraud_events_window ON fraud_events (organisation_id, key, account, currency, occurred_at);
+
+CREATE TABLE fraud_decisions (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id  uuid NOT NULL REFERENCES payments (id) ON DELETE CASCADE,
+    event       text NOT NULL,
+    outcome     text NOT NULL,
+    rules       text[] NOT NULL,
+    reasons     text[] NOT NULL,
+    version     text NOT NULL DEFAULT '',
+    reviewed_by text NOT NULL DEFAULT '',
+    decided_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX fraud_decisions_payment ON fraud_decisions (payment_id, decided_at);
+
+CREATE TABLE approval_requests (
+    payment_id      uuid PRIMARY KEY REFERENCES payments (id) ON DELETE CASCADE,
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    maker           text NOT NULL DEFAULT '',
+    policy          text NOT NULL,
+    required        integer NOT NULL,
+    status          text NOT NULL DEFAULT 'pending',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    decided_at      timestamptz
+);
+
+CREATE INDEX approval_requests_pending ON approval_requests (organisation_id, created_at) WHERE status = 'pending';
+
+CREATE TABLE approvals (
+    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id  uuid NOT NULL REFERENCES approval_requests (payment_id) ON DELETE CASCADE,
+    approver    text NOT NULL,
+    decision    text NOT NULL,
+    comment     text NOT NULL DEFAULT '',
+    decided_at  timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (payment_id, approver)
+);
+
+-- Row level security is the second line of defence behind the organisation
+-- filters of the queries. Every transaction of the service sets
+-- payments.organisation_id to the organisation it acts for, or to '*' for
+-- the background jobs that act for every organisation. Without the setting
+-- no rows are visible. The policies are forced so they apply to the owner
+-- of the tables too, only superusers bypass them.
+CREATE FUNCTION current_organisation_allows(organisation_id uuid) RETURNS boolean
+    LANGUAGE sql STABLE AS $$
+        SELECT current_setting('payments.organisation_id', true) = '*'
+            OR organisation_id::text = current_setting('payments.organisation_id', true)
+    $$;
+
+ALTER TABLE payments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE payments FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON payments
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE statements ENABLE ROW LEVEL SECURITY;
+ALTER TABLE statements FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON statements
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE reconciliation_exceptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reconciliation_exceptions FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON reconciliation_exceptions
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE payment_schedules ENABLE ROW LEVEL SECURITY;
+ALTER TABLE payment_schedules FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON payment_schedules
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE screening_cases ENABLE ROW LEVEL SECURITY;
+ALTER TABLE screening_cases FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON screening_cases
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE fraud_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE fraud_events FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON fraud_events
+    USING (current_organisation_allows(organisation_id));
+
+ALTER TABLE approval_requests ENABLE ROW LEVEL SECURITY;
+ALTER TABLE approval_requests FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON approval_requests
+    USING (current_organisation_allows(organisation_id));
+
+-- The tables without an organisation_id follow the visibility of their parent
+ALTER TABLE statement_entries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE statement_entries FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON statement_entries
+    USING (EXISTS (SELECT 1 FROM statements s WHERE s.id = statement_id));
+
+ALTER TABLE reconciliations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE reconciliations FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON reconciliations
+    USING (EXISTS (SELECT 1 FROM payments p WHERE p.id = payment_id));
+
+ALTER TABLE payment_schedule_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE payment_schedule_runs FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON payment_schedule_runs
+    USING (EXISTS (SELECT 1 FROM payment_schedules s WHERE s.id = schedule_id));
+
+ALTER TABLE payment_routes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE payment_routes FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON payment_routes
+    USING (EXISTS (SELECT 1 FROM payments p WHERE p.id = payment_id));
+
+ALTER TABLE fraud_decisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE fraud_decisions FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON fraud_decisions
+    USING (EXISTS (SELECT 1 FROM payments p WHERE p.id = payment_id));
+
+ALTER TABLE approvals ENABLE ROW LEVEL SECURITY;
+ALTER TABLE approvals FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON approvals
+    USING (EXISTS (SELECT 1 FROM approval_requests a WHERE a.payment_id = approvals.payment_id));
+
+-- API keys are looked up before the organisation of a request is known so
+-- they are not subject to row level security
+CREATE TABLE api_keys (
+    id              uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    name            text NOT NULL,
+    prefix          text NOT NULL UNIQUE,
+    hash            text NOT NULL,
+    scopes          text[] NOT NULL DEFAULT '{}',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    revoked_at      timestamptz
+);
+
+-- Token buckets of the distributed rate limiting. The buckets are keyed by
+-- client before the organisation of a request is known.
+CREATE TABLE rate_limits (
+    key        text PRIMARY KEY,
+    tokens     double precision NOT NULL,
+    updated_at timestamptz NOT NULL
+);
+
+CREATE TABLE payment_quota_usage (
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    period          text NOT NULL,
+    period_start    date NOT NULL,
+    used            integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (organisation_id, period, period_start)
+);
+
+ALTER TABLE payment_quota_usage ENABLE ROW LEVEL SECURITY;
+ALTER TABLE payment_quota_usage FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON payment_quota_usage
+    USING (current_organisation_allows(organisation_id));
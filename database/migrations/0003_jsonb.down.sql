@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS payments_end_to_end_reference;
+DROP INDEX IF EXISTS payments_attributes;
+
+ALTER TABLE screening_cases ALTER COLUMN hits TYPE json USING hits::json;
+ALTER TABLE calendars ALTER COLUMN definition TYPE json USING definition::json;
+ALTER TABLE payment_schedules ALTER COLUMN attributes TYPE json USING attributes::json;
+ALTER TABLE payments ALTER COLUMN attributes TYPE json USING attributes::json;
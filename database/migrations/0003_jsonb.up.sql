@@ -0,0 +1,9 @@
+-- jsonb is parsed once on write and can be indexed. It does not keep the
+-- formatting and the order of the keys of the documents.
+ALTER TABLE payments ALTER COLUMN attributes TYPE jsonb USING attributes::jsonb;
+ALTER TABLE payment_schedules ALTER COLUMN attributes TYPE jsonb USING attributes::jsonb;
+ALTER TABLE calendars ALTER COLUMN definition TYPE jsonb USING definition::jsonb;
+ALTER TABLE screening_cases ALTER COLUMN hits TYPE jsonb USING hits::jsonb;
+
+CREATE INDEX payments_attributes ON payments USING gin (attributes jsonb_path_ops);
+CREATE INDEX payments_end_to_end_reference ON payments ((attributes->>'end_to_end_reference'));
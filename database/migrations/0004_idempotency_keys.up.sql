@@ -0,0 +1,20 @@
+-- The responses of the requests with an Idempotency-Key so their retries
+-- are answered without repeating them. The status is null while the first
+-- request is being processed.
+CREATE TABLE idempotency_keys (
+    organisation_id uuid NOT NULL REFERENCES organisations (id),
+    key             text NOT NULL,
+    request_hash    text NOT NULL,
+    status          integer,
+    content_type    text NOT NULL DEFAULT '',
+    body            bytea,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (organisation_id, key)
+);
+
+CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at);
+
+ALTER TABLE idempotency_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE idempotency_keys FORCE ROW LEVEL SECURITY;
+CREATE POLICY organisation_isolation ON idempotency_keys
+    USING (current_organisation_allows(organisation_id));
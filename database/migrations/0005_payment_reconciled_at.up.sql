@@ -0,0 +1,5 @@
+-- The time a payment was matched to the statement entry that settled it,
+-- kept on the payment so it is listed and fetched with it
+ALTER TABLE payments ADD COLUMN reconciled_at timestamptz;
+
+UPDATE payments p SET reconciled_at = r.matched_at FROM reconciliations r WHERE r.payment_id = p.id;
@@ -0,0 +1 @@
+ALTER TABLE payment_schedules DROP COLUMN created_by;
@@ -0,0 +1,3 @@
+-- The user that created a schedule is the maker of its payments, so they
+-- can not approve them
+ALTER TABLE payment_schedules ADD COLUMN created_by text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP INDEX statements_organisation_id_reference;
@@ -0,0 +1,4 @@
+-- A statement is uploaded once per organisation, so an upload that is sent
+-- again does not reconcile its entries twice
+CREATE UNIQUE INDEX statements_organisation_id_reference ON statements (organisation_id, reference)
+    WHERE reference <> '';
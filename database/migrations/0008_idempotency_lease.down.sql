@@ -0,0 +1,4 @@
+ALTER TABLE idempotency_keys
+    DROP COLUMN etag,
+    DROP COLUMN location,
+    DROP COLUMN updated_at;
@@ -0,0 +1,7 @@
+-- A request that is processed for longer than its lease is taken over by a
+-- retry, so the key of a request that died is not stuck. The Location and
+-- the ETag of the response are replayed with it.
+ALTER TABLE idempotency_keys
+    ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now(),
+    ADD COLUMN location   text NOT NULL DEFAULT '',
+    ADD COLUMN etag       text NOT NULL DEFAULT '';
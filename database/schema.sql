@@ -1,10 +1,3 @@
+-- The tables are created by the migrations of the service, run
+-- payments migrate up or start it with -migrate
 CREATE DATABASE payments;
-
-\connect payments
-
-CREATE EXTENSION "uuid-ossp";
-
-CREATE TABLE payments (
-    id          uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
-    attributes  json
-);
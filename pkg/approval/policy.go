@@ -0,0 +1,95 @@
+package approval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// AnyCurrency is the currency of the policy applied when no other matches
+const AnyCurrency = "*"
+
+// Policy requires a number of approvers for the payments in the currency
+// with an amount at or above the threshold
+type Policy struct {
+	Currency  string          `json:"currency"`
+	Threshold decimal.Decimal `json:"threshold"`
+	Approvers int             `json:"approvers"`
+}
+
+// String describes the policy
+func (p *Policy) String() string {
+	return fmt.Sprintf("%s >= %s requires %d approvers", p.Currency, p.Threshold, p.Approvers)
+}
+
+// PolicySet is a versioned set of approval policies
+type PolicySet struct {
+	Version  string   `json:"version"`
+	Checksum string   `json:"checksum"`
+	Policies []Policy `json:"policies"`
+}
+
+// ParsePolicySet parses and validates a policy set
+func ParsePolicySet(data []byte) (*PolicySet, error) {
+	ps := &PolicySet{}
+	if err := json.Unmarshal(data, ps); err != nil {
+		return nil, fmt.Errorf("invalid approval policies: %v", err)
+	}
+
+	if ps.Version == "" {
+		return nil, fmt.Errorf("invalid approval policies: missing version")
+	}
+
+	for i, p := range ps.Policies {
+		if p.Currency == "" {
+			return nil, fmt.Errorf("invalid approval policies: policy %d needs a currency", i+1)
+		}
+		if p.Approvers < 1 {
+			return nil, fmt.Errorf("invalid approval policies: policy %d needs at least one approver", i+1)
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	ps.Checksum = hex.EncodeToString(sum[:])
+	return ps, nil
+}
+
+// LoadPolicySet reads a policy set from a file
+func LoadPolicySet(path string) (*PolicySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePolicySet(data)
+}
+
+// Required returns the policy that applies to the amount in the currency or
+// nil if the payment needs no approval. The policies of the currency take
+// precedence over the ones of any currency and the policy with the highest
+// reached threshold wins.
+func (ps *PolicySet) Required(currency string, amount decimal.Decimal) *Policy {
+	for _, wanted := range []string{currency, AnyCurrency} {
+		var match *Policy
+		found := false
+		for i, p := range ps.Policies {
+			if !strings.EqualFold(p.Currency, wanted) {
+				continue
+			}
+			found = true
+			if amount.GreaterThanOrEqual(p.Threshold) && (match == nil || p.Threshold.GreaterThan(match.Threshold)) {
+				match = &ps.Policies[i]
+			}
+		}
+		if found {
+			return match
+		}
+	}
+
+	return nil
+}
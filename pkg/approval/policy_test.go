@@ -0,0 +1,54 @@
+package approval
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRequired(t *testing.T) {
+	policies, err := LoadPolicySet("../../rules/approvals.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		currency  string
+		amount    string
+		approvers int
+	}{
+		"BelowThreshold":    {currency: "GBP", amount: "9999.99", approvers: 0},
+		"AtThreshold":       {currency: "GBP", amount: "10000", approvers: 1},
+		"HigherThreshold":   {currency: "GBP", amount: "300000", approvers: 2},
+		"CaseInsensitive":   {currency: "eur", amount: "20000", approvers: 1},
+		"AnyCurrency":       {currency: "USD", amount: "5000", approvers: 2},
+		"AnyCurrencyBelow":  {currency: "USD", amount: "4999", approvers: 0},
+		"CurrencyOverrides": {currency: "GBP", amount: "6000", approvers: 0},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			policy := policies.Required(tc.currency, decimal.RequireFromString(tc.amount))
+			approvers := 0
+			if policy != nil {
+				approvers = policy.Approvers
+			}
+
+			if approvers != tc.approvers {
+				t.Errorf("expected %d approvers, got %d", tc.approvers, approvers)
+			}
+		})
+	}
+}
+
+func TestParsePolicySetInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"NoVersion":   `{"policies": []}`,
+		"NoCurrency":  `{"version": "1", "policies": [{"threshold": "10", "approvers": 1}]}`,
+		"NoApprovers": `{"version": "1", "policies": [{"currency": "GBP", "threshold": "10"}]}`,
+	} {
+		if _, err := ParsePolicySet([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package approval
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the approval resources
+const (
+	Type         = "PaymentApproval"
+	DecisionType = "ApprovalDecision"
+	BulkType     = "BulkApproval"
+	ResultType   = "BulkApprovalResult"
+)
+
+// ResourceData is the data of the approval request resource
+type ResourceData struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	Attributes *Request `json:"attributes"`
+
+	links.Resource
+}
+
+// Resource is a single approval request resource
+type Resource struct {
+	Data *ResourceData `json:"data"`
+}
+
+func newResourceData(req *Request, self string) *ResourceData {
+	return &ResourceData{
+		ID:         req.PaymentID,
+		Type:       Type,
+		Attributes: req,
+		Resource:   links.Resource{Links: links.Links{Self: self}},
+	}
+}
+
+// NewResource creates new resource from Request
+func NewResource(req *Request, self string) *Resource {
+	return &Resource{Data: newResourceData(req, self)}
+}
+
+// Render implements render.Render
+func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ListResource is a list of approval requests resource
+type ListResource struct {
+	Data []*ResourceData `json:"data"`
+	links.Resource
+}
+
+// NewListResource returns new approval request list resource
+func NewListResource(requests []Request, self string) *ListResource {
+	list := &ListResource{
+		Data:     []*ResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range requests {
+		list.Data = append(list.Data, newResourceData(&requests[i], "/payments/"+requests[i].PaymentID+"/approvals"))
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// DecisionResource is the optional request body of an approve or reject action
+type DecisionResource struct {
+	Data *struct {
+		Type       string `json:"type"`
+		Attributes struct {
+			Comment string `json:"comment"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Bind implements render.Binder
+func (resource *DecisionResource) Bind(r *http.Request) error {
+	if resource.Data != nil && resource.Data.Type != DecisionType {
+		return fmt.Errorf("wrong type")
+	}
+
+	return nil
+}
+
+// Comment returns the comment of the decision
+func (resource *DecisionResource) Comment() string {
+	if resource.Data == nil {
+		return ""
+	}
+	return resource.Data.Attributes.Comment
+}
+
+// BulkResource is the request body of a bulk approval
+type BulkResource struct {
+	Data *struct {
+		Type       string `json:"type"`
+		Attributes struct {
+			PaymentIDs []string `json:"payment_ids"`
+			Comment    string   `json:"comment"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Bind implements render.Binder
+func (resource *BulkResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != BulkType {
+		return fmt.Errorf("wrong type")
+	}
+
+	if len(resource.Data.Attributes.PaymentIDs) == 0 {
+		return fmt.Errorf("payment_ids are required")
+	}
+
+	return nil
+}
+
+// Result is the outcome of approving a single payment of a batch
+type Result struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ResultListResource is the response of a bulk approval
+type ResultListResource struct {
+	Data []*ResultResourceData `json:"data"`
+	links.Resource
+}
+
+// ResultResourceData is the data of a bulk approval result
+type ResultResourceData struct {
+	ID         string  `json:"id"`
+	Type       string  `json:"type"`
+	Attributes *Result `json:"attributes"`
+}
+
+// NewResultListResource returns new bulk approval result list resource
+func NewResultListResource(results []Result, self string) *ResultListResource {
+	list := &ResultListResource{
+		Data:     []*ResultResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range results {
+		list.Data = append(list.Data, &ResultResourceData{
+			ID:         results[i].PaymentID,
+			Type:       ResultType,
+			Attributes: &results[i],
+		})
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ResultListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,285 @@
+package approval
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Statuses of an approval request
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Decisions of an approver
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// Errors of the approval decisions
+var (
+	ErrNotPending      = errors.New("payment is not waiting for approval")
+	ErrSelfApproval    = errors.New("the creator of a payment can not approve it")
+	ErrAlreadyDecided  = errors.New("approver already decided on the payment")
+	ErrMissingApprover = errors.New("approver is required")
+)
+
+// Errors of the changes of the payments that require approvals
+var (
+	ErrUnderApproval = errors.New("payment under approval can not be updated")
+	ErrRequested     = errors.New("approvals of the payment were already requested")
+)
+
+// Request is the approval a payment waits for
+type Request struct {
+	PaymentID      string     `db:"payment_id"      json:"-"`
+	OrganisationID string     `db:"organisation_id" json:"-"`
+	Maker          string     `db:"maker"           json:"maker"`
+	Policy         string     `db:"policy"          json:"policy"`
+	Required       int        `db:"required"        json:"required"`
+	Status         string     `db:"status"          json:"status"`
+	CreatedAt      time.Time  `db:"created_at"      json:"created_at"`
+	DecidedAt      *time.Time `db:"decided_at"      json:"decided_at,omitempty"`
+
+	Approvals []Approval `db:"-" json:"approvals"`
+}
+
+// Approval is the decision of a single approver
+type Approval struct {
+	ID        string    `db:"id"         json:"-"`
+	PaymentID string    `db:"payment_id" json:"-"`
+	Approver  string    `db:"approver"   json:"approver"`
+	Decision  string    `db:"decision"   json:"decision"`
+	Comment   string    `db:"comment"    json:"comment,omitempty"`
+	DecidedAt time.Time `db:"decided_at" json:"decided_at"`
+}
+
+// Require makes the payment of the organisation wait for the approvals of
+// the policy. A payment that is held by other checks keeps its status and
+// is released into pending approval.
+func Require(db *sqlx.DB, org, paymentID, maker string, policy *Policy) error {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := RequireTx(tx, org, paymentID, maker, policy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RequireTx requires the approvals of the payment of the organisation within
+// a transaction scoped to it
+func RequireTx(tx *sqlx.Tx, org, paymentID, maker string, policy *Policy) error {
+	_, err := tx.Exec(tx.Rebind(
+		`INSERT INTO approval_requests (payment_id, organisation_id, maker, policy, required)
+		SELECT id, organisation_id, ?, ?, ? FROM payments WHERE id=? AND organisation_id=?`),
+		maker, policy.String(), policy.Approvers, paymentID, org,
+	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return ErrRequested
+	} else if err != nil {
+		return err
+	}
+
+	var status string
+	if err := tx.Get(&status, tx.Rebind(
+		`SELECT status FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), paymentID, org,
+	); err != nil {
+		return err
+	}
+	if status != payment.StatusCreated {
+		return nil
+	}
+
+	return payment.SetStatusTx(tx, org, paymentID, payment.StatusPendingApproval)
+}
+
+// PendingTx reports if the payment of the organisation waits for approvals
+// within a transaction scoped to it
+func PendingTx(tx *sqlx.Tx, org, paymentID string) (bool, error) {
+	var pending bool
+	err := tx.Get(&pending, tx.Rebind(
+		`SELECT EXISTS (SELECT 1 FROM approval_requests WHERE payment_id=? AND organisation_id=? AND status=?)`),
+		paymentID, org, StatusPending,
+	)
+	return pending, err
+}
+
+// Decide records the decision of an approver on a payment of the
+// organisation. A rejection rejects the payment and enough approvals
+// release it. The hook runs if the payment is released to created and may be
+// nil.
+func Decide(db *sqlx.DB, org, paymentID, approver, decision, comment string, released payment.Hook) error {
+	if approver == "" {
+		return ErrMissingApprover
+	}
+
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	req := Request{}
+	if err := tx.Get(&req, tx.Rebind(
+		`SELECT * FROM approval_requests WHERE payment_id=? AND organisation_id=? FOR UPDATE`), paymentID, org,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotPending
+		}
+		return err
+	}
+	if req.Status != StatusPending {
+		return ErrNotPending
+	}
+	if req.Maker != "" && req.Maker == approver {
+		return ErrSelfApproval
+	}
+
+	var decided bool
+	if err := tx.Get(&decided, tx.Rebind(
+		`SELECT EXISTS (SELECT 1 FROM approvals WHERE payment_id=? AND approver=?)`), paymentID, approver,
+	); err != nil {
+		return err
+	}
+	if decided {
+		return ErrAlreadyDecided
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`INSERT INTO approvals (payment_id, approver, decision, comment) VALUES (?, ?, ?, ?)`),
+		paymentID, approver, decision, comment,
+	); err != nil {
+		return err
+	}
+
+	status := StatusPending
+	if decision == DecisionReject {
+		status = StatusRejected
+	} else {
+		var approved int
+		if err := tx.Get(&approved, tx.Rebind(
+			`SELECT count(*) FROM approvals WHERE payment_id=? AND decision=?`), paymentID, DecisionApprove,
+		); err != nil {
+			return err
+		}
+		if approved >= req.Required {
+			status = StatusApproved
+		}
+	}
+
+	if status == StatusPending {
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`UPDATE approval_requests SET status=?, decided_at=now() WHERE payment_id=? AND organisation_id=?`), status, paymentID, org,
+	); err != nil {
+		return err
+	}
+
+	var paymentStatus string
+	if err := tx.Get(&paymentStatus, tx.Rebind(
+		`SELECT status FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), paymentID, org,
+	); err != nil {
+		return err
+	}
+
+	switch {
+	case status == StatusRejected:
+		err = payment.SetStatusTx(tx, org, paymentID, payment.StatusRejected)
+	case paymentStatus == payment.StatusPendingApproval:
+		if err = payment.SetStatusTx(tx, org, paymentID, payment.StatusCreated); err == nil && released != nil {
+			err = released(tx, paymentID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get gets the approval request of a payment of the organisation with its approvals
+func Get(db *sqlx.DB, org, paymentID string) (*Request, error) {
+	req := Request{Approvals: []Approval{}}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		if err := tx.Get(&req,
+			"SELECT * FROM approval_requests WHERE payment_id=$1 AND organisation_id=$2", paymentID, org,
+		); err != nil {
+			return err
+		}
+
+		err := tx.Select(&req.Approvals, "SELECT * FROM approvals WHERE payment_id=$1 ORDER BY decided_at", paymentID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// SelectFor gets the approval requests of the payments of the organisation
+// with their approvals
+func SelectFor(db *sqlx.DB, org string, paymentIDs []string) ([]Request, error) {
+	requests := []Request{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		if err := tx.Select(&requests,
+			"SELECT * FROM approval_requests WHERE payment_id = ANY($1) AND organisation_id=$2 ORDER BY payment_id",
+			pq.Array(paymentIDs), org,
+		); err != nil {
+			return err
+		}
+
+		approvals := []Approval{}
+		if err := tx.Select(&approvals,
+			"SELECT * FROM approvals WHERE payment_id = ANY($1) ORDER BY decided_at", pq.Array(paymentIDs),
+		); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		byPayment := map[string]*Request{}
+		for i := range requests {
+			requests[i].Approvals = []Approval{}
+			byPayment[requests[i].PaymentID] = &requests[i]
+		}
+		for _, a := range approvals {
+			if req, ok := byPayment[a.PaymentID]; ok {
+				req.Approvals = append(req.Approvals, a)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// SelectPending gets the requests of the organisation waiting for approvals
+func SelectPending(db *sqlx.DB, org string) ([]Request, error) {
+	requests := []Request{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&requests,
+			"SELECT * FROM approval_requests WHERE organisation_id=$1 AND status=$2 ORDER BY created_at", org, StatusPending)
+	}); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
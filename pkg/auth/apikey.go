@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// KeyPrefix starts every API key so leaked keys are easy to spot
+const KeyPrefix = "pk_"
+
+// APIKeyHeader carries an API key as an alternative to the Authorization header
+const APIKeyHeader = "X-API-Key"
+
+// APIKey is a stored API key. Only the hash of its secret is kept, the key
+// itself is shown once when it is created.
+type APIKey struct {
+	ID             string         `db:"id"              json:"id"`
+	OrganisationID string         `db:"organisation_id" json:"organisation_id"`
+	Name           string         `db:"name"            json:"name"`
+	Prefix         string         `db:"prefix"          json:"prefix"`
+	Hash           string         `db:"hash"            json:"-"`
+	Scopes         pq.StringArray `db:"scopes"          json:"scopes"`
+	CreatedAt      time.Time      `db:"created_at"      json:"created_at"`
+	RevokedAt      *time.Time     `db:"revoked_at"      json:"revoked_at,omitempty"`
+}
+
+// CreateKey creates an API key of the organisation and returns the key
+func CreateKey(db *sqlx.DB, org, name string, scopes []string) (string, *APIKey, error) {
+	key, prefix, secret, err := newKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	k := APIKey{}
+	if err := db.Get(&k, db.Rebind(
+		`INSERT INTO api_keys (organisation_id, name, prefix, hash, scopes) VALUES (?, ?, ?, ?, ?) RETURNING *`),
+		org, name, prefix, hashSecret(secret), pq.StringArray(scopes),
+	); err != nil {
+		return "", nil, err
+	}
+
+	return key, &k, nil
+}
+
+// SelectKeys gets the API keys of the organisation or of all organisations
+// if it is empty
+func SelectKeys(db *sqlx.DB, org string) ([]APIKey, error) {
+	query := "SELECT * FROM api_keys ORDER BY created_at"
+	args := []interface{}{}
+	if org != "" {
+		query = "SELECT * FROM api_keys WHERE organisation_id=$1 ORDER BY created_at"
+		args = append(args, org)
+	}
+
+	keys := []APIKey{}
+	if err := db.Select(&keys, query, args...); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeKey revokes an API key so it no longer authenticates
+func RevokeKey(db *sqlx.DB, id string) error {
+	res, err := db.Exec(`UPDATE api_keys SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// APIKeys authenticates the requests with the API keys stored in the database
+type APIKeys struct {
+	DB *sqlx.DB
+}
+
+// Authenticate implements Authenticator. The key is read from the X-API-Key
+// header or from an Authorization header with the ApiKey scheme.
+func (a APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		key = credentials(r, "ApiKey")
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	prefix, secret, ok := parseKey(key)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	k := APIKey{}
+	if err := a.DB.Get(&k,
+		"SELECT * FROM api_keys WHERE prefix=$1 AND revoked_at IS NULL", prefix,
+	); err == sql.ErrNoRows {
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		ID:           k.ID,
+		Organisation: k.OrganisationID,
+		Method:       MethodAPIKey,
+		Scopes:       k.Scopes,
+	}, nil
+}
+
+// newKey generates a key made of a public prefix used to find it and a
+// secret of which only the hash is stored
+func newKey() (key, prefix, secret string, err error) {
+	b := make([]byte, 6+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(b[:6])
+	secret = base64.RawURLEncoding.EncodeToString(b[6:])
+	return KeyPrefix + prefix + "." + secret, prefix, secret, nil
+}
+
+func parseKey(key string) (prefix, secret string, ok bool) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, KeyPrefix), ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// hashSecret hashes a secret. The secrets are random so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
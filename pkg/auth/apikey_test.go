@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, secret, err := newKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, KeyPrefix) {
+		t.Errorf("expected the key to start with %s, got %s", KeyPrefix, key)
+	}
+
+	p, s, ok := parseKey(key)
+	if !ok || p != prefix || s != secret {
+		t.Errorf("expected %s and %s, got %s and %s", prefix, secret, p, s)
+	}
+
+	other, _, _, err := newKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("expected different keys")
+	}
+}
+
+func TestParseKeyInvalid(t *testing.T) {
+	for _, key := range []string{"", "abc.def", "pk_", "pk_abc", "pk_.def", "pk_abc."} {
+		if _, _, ok := parseKey(key); ok {
+			t.Errorf("%q: expected an invalid key", key)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	none := AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		return nil, ErrNoCredentials
+	})
+	invalid := AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		return nil, ErrInvalidCredentials
+	})
+	alice := AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		return &Principal{ID: "alice"}, nil
+	})
+
+	testCases := map[string]struct {
+		chain Chain
+		id    string
+		err   error
+	}{
+		"Empty":          {chain: Chain{}, err: ErrNoCredentials},
+		"NoCredentials":  {chain: Chain{none, none}, err: ErrNoCredentials},
+		"SkipsNone":      {chain: Chain{none, alice}, id: "alice"},
+		"StopsAtInvalid": {chain: Chain{invalid, alice}, err: ErrInvalidCredentials},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p, err := tc.chain.Authenticate(httptest.NewRequest("GET", "/", nil))
+			if err != tc.err {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if err == nil && p.ID != tc.id {
+				t.Errorf("expected %s, got %s", tc.id, p.ID)
+			}
+		})
+	}
+}
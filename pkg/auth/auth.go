@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Methods of authentication
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Errors of the authentication
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Invalid reports if the error rejects the credentials rather than fails to
+// check them
+func Invalid(err error) bool {
+	switch err {
+	case ErrInvalidCredentials, ErrMalformedToken, ErrUnknownKey, ErrBadSignature,
+		ErrTokenExpired, ErrTokenNotYetValid, ErrWrongIssuer, ErrWrongAudience:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID           string   `json:"id"`
+	Organisation string   `json:"organisation"`
+	Method       string   `json:"method"`
+	Scopes       []string `json:"scopes"`
+}
+
+type key int
+
+const keyPrincipal key = iota
+
+// NewContext returns a context carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, keyPrincipal, p)
+}
+
+// FromContext returns the principal of the context
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(keyPrincipal).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator authenticates the caller of a request. It returns
+// ErrNoCredentials if the request has no credentials it understands.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc is a function used as an Authenticator
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// Chain tries the authenticators in order until one of them finds its
+// credentials in the request
+type Chain []Authenticator
+
+// Authenticate implements Authenticator
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return p, err
+	}
+
+	return nil, ErrNoCredentials
+}
+
+// credentials returns the credentials of the Authorization header with the scheme
+func credentials(r *http.Request, scheme string) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], scheme) {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
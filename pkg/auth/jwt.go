@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Signature algorithms of the JWT bearer tokens
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// Errors of the token verification
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrBadSignature     = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrWrongIssuer      = errors.New("wrong token issuer")
+	ErrWrongAudience    = errors.New("wrong token audience")
+)
+
+// JWK is a single key of a JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// KeySet are the keys tokens are verified with by key id
+type KeySet struct {
+	keys map[string]verificationKey
+}
+
+// LoadJWKS loads a JSON Web Key Set file
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set. The algorithm of a key is inferred
+// from its type if it is not set.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]verificationKey{}}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", jwk.Kid, err)
+		}
+		if _, ok := set.keys[jwk.Kid]; ok {
+			return nil, fmt.Errorf("duplicate key %q", jwk.Kid)
+		}
+		set.keys[jwk.Kid] = key
+	}
+
+	if len(set.keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	return set, nil
+}
+
+func (jwk JWK) verificationKey() (verificationKey, error) {
+	switch jwk.Kty {
+	case "oct":
+		if jwk.Alg != "" && jwk.Alg != AlgHS256 {
+			return verificationKey{}, fmt.Errorf("unsupported algorithm %s", jwk.Alg)
+		}
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(k) == 0 {
+			return verificationKey{}, errors.New("invalid symmetric key")
+		}
+		return verificationKey{alg: AlgHS256, key: k}, nil
+
+	case "RSA":
+		if jwk.Alg != "" && jwk.Alg != AlgRS256 {
+			return verificationKey{}, fmt.Errorf("unsupported algorithm %s", jwk.Alg)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil || len(n) == 0 {
+			return verificationKey{}, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return verificationKey{}, errors.New("invalid RSA exponent")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return verificationKey{alg: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}}, nil
+
+	case "EC":
+		if jwk.Alg != "" && jwk.Alg != AlgES256 {
+			return verificationKey{}, fmt.Errorf("unsupported algorithm %s", jwk.Alg)
+		}
+		if jwk.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return verificationKey{}, errors.New("invalid EC point")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return verificationKey{}, errors.New("EC point is not on the curve")
+		}
+		return verificationKey{alg: AlgES256, key: key}, nil
+	}
+
+	return verificationKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// Audience is the aud claim which is a single string or a list of strings
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = Audience(list)
+	return nil
+}
+
+func (a Audience) contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims are the claims of a token the service uses
+type Claims struct {
+	Issuer       string   `json:"iss"`
+	Subject      string   `json:"sub"`
+	Audience     Audience `json:"aud"`
+	ExpiresAt    int64    `json:"exp"`
+	NotBefore    int64    `json:"nbf"`
+	IssuedAt     int64    `json:"iat"`
+	Organisation string   `json:"org"`
+	Scope        string   `json:"scope"`
+}
+
+// Verifier verifies JWT bearer tokens against a key set and checks their
+// issuer, audience and validity period
+type Verifier struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	// Leeway allows for clock skew between the issuer and the service
+	Leeway time.Duration
+
+	now func() time.Time
+}
+
+// NewVerifier returns a verifier of the tokens of the issuer for the audience
+func NewVerifier(keys *KeySet, issuer, audience string) *Verifier {
+	return &Verifier{Keys: keys, Issuer: issuer, Audience: audience, now: time.Now}
+}
+
+// Verify verifies the token and returns its claims
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm is fixed by the key so a token can not pick a weaker one
+	if header.Alg != key.alg {
+		return nil, ErrBadSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !verifySignature(key, parts[0]+"."+parts[1], signature) {
+		return nil, ErrBadSignature
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	t := now()
+	if claims.ExpiresAt == 0 || !t.Before(time.Unix(claims.ExpiresAt, 0).Add(v.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && t.Add(v.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, ErrWrongIssuer
+	}
+	if v.Audience != "" && !claims.Audience.contains(v.Audience) {
+		return nil, ErrWrongAudience
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) key(kid string) (verificationKey, error) {
+	if v.Keys == nil {
+		return verificationKey{}, ErrUnknownKey
+	}
+
+	if key, ok := v.Keys.keys[kid]; ok {
+		return key, nil
+	}
+	// A token without a key id is accepted only if there is no choice
+	if kid == "" && len(v.Keys.keys) == 1 {
+		for _, key := range v.Keys.keys {
+			return key, nil
+		}
+	}
+
+	return verificationKey{}, ErrUnknownKey
+}
+
+// Authenticate implements Authenticator for bearer tokens. The subject of
+// the token is the principal, the org claim its organisation and the scope
+// claim its space separated scopes.
+func (v *Verifier) Authenticate(r *http.Request) (*Principal, error) {
+	token := credentials(r, "Bearer")
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{
+		ID:           claims.Subject,
+		Organisation: claims.Organisation,
+		Method:       MethodJWT,
+		Scopes:       strings.Fields(claims.Scope),
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func verifySignature(key verificationKey, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch k := key.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	}
+
+	return false
+}
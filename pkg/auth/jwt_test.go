@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding.EncodeToString
+
+// pad left pads a big endian number to 32 bytes
+func pad(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+type signingKeys struct {
+	hmac []byte
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+}
+
+func newSigningKeys(t *testing.T) *signingKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &signingKeys{hmac: []byte("a shared secret of the issuer"), rsa: rsaKey, ec: ecKey}
+}
+
+func (k *signingKeys) jwks() []byte {
+	return []byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hs", "k": %q},
+		{"kty": "RSA", "kid": "rs", "alg": "RS256", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`,
+		b64(k.hmac),
+		b64(k.rsa.N.Bytes()), b64(big.NewInt(int64(k.rsa.E)).Bytes()),
+		b64(pad(k.ec.X.Bytes())), b64(pad(k.ec.Y.Bytes())),
+	))
+}
+
+func (k *signingKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.hmac)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case AlgRS256:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case AlgES256:
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(pad(r.Bytes()), pad(s.Bytes())...)
+	}
+
+	return signed + "." + b64(signature)
+}
+
+func TestVerify(t *testing.T) {
+	keys := newSigningKeys(t)
+	set, err := ParseJWKS(keys.jwks())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	verifier := NewVerifier(set, "https://issuer.example.com", "payments")
+	verifier.Leeway = time.Minute
+	verifier.now = func() time.Time { return now }
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://issuer.example.com",
+			"sub":   "alice",
+			"aud":   []string{"payments", "other"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"org":   "00000000-0000-0000-0000-000000000001",
+			"scope": "payments:read payments:write",
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	testCases := map[string]struct {
+		token string
+		err   error
+	}{
+		"HS256":           {token: keys.sign(t, AlgHS256, "hs", claims(nil))},
+		"RS256":           {token: keys.sign(t, AlgRS256, "rs", claims(nil))},
+		"ES256":           {token: keys.sign(t, AlgES256, "es", claims(nil))},
+		"SingleAudience":  {token: keys.sign(t, AlgES256, "es", claims(map[string]interface{}{"aud": "payments"}))},
+		"WithinLeeway":    {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))},
+		"Expired":         {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})), err: ErrTokenExpired},
+		"NoExpiry":        {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"exp": nil})), err: ErrTokenExpired},
+		"NotYetValid":     {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})), err: ErrTokenNotYetValid},
+		"WrongIssuer":     {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"iss": "https://evil.example.com"})), err: ErrWrongIssuer},
+		"WrongAudience":   {token: keys.sign(t, AlgRS256, "rs", claims(map[string]interface{}{"aud": "ledger"})), err: ErrWrongAudience},
+		"UnknownKey":      {token: keys.sign(t, AlgRS256, "other", claims(nil)), err: ErrUnknownKey},
+		"EncryptionKey":   {token: keys.sign(t, AlgRS256, "enc", claims(nil)), err: ErrUnknownKey},
+		"AlgorithmSwitch": {token: keys.sign(t, AlgHS256, "rs", claims(nil)), err: ErrBadSignature},
+		"AlgorithmNone":   {token: b64([]byte(`{"alg":"none","kid":"rs"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".", err: ErrBadSignature},
+		"Tampered":        {token: tamper(keys.sign(t, AlgES256, "es", claims(nil))), err: ErrBadSignature},
+		"Malformed":       {token: "not.a-token", err: ErrMalformedToken},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := verifier.Verify(tc.token)
+			if tc.err != nil {
+				if err != tc.err {
+					t.Errorf("expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Subject != "alice" {
+				t.Errorf("expected subject alice, got %q", c.Subject)
+			}
+		})
+	}
+}
+
+// tamper replaces the claims of the token keeping its signature
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = b64([]byte(`{"sub":"mallory","exp":9999999999}`))
+	return strings.Join(parts, ".")
+}
+
+func TestVerifierAuthenticate(t *testing.T) {
+	keys := newSigningKeys(t)
+	set, err := ParseJWKS(keys.jwks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewVerifier(set, "", "")
+
+	r := httptest.NewRequest("GET", "/payments", nil)
+	if _, err := verifier.Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("expected no credentials, got %v", err)
+	}
+
+	r.Header.Set("Authorization", "Bearer "+keys.sign(t, AlgHS256, "hs", map[string]interface{}{
+		"sub": "alice", "org": "00000000-0000-0000-0000-000000000001", "scope": "payments:read admin",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	p, err := verifier.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "alice" || p.Organisation != "00000000-0000-0000-0000-000000000001" || p.Method != MethodJWT {
+		t.Errorf("unexpected principal %+v", p)
+	}
+	if len(p.Scopes) != 2 || p.Scopes[0] != "payments:read" || p.Scopes[1] != "admin" {
+		t.Errorf("unexpected scopes %v", p.Scopes)
+	}
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"NoKeys":      `{"keys": []}`,
+		"UnknownType": `{"keys": [{"kty": "OKP", "kid": "a"}]}`,
+		"WrongAlg":    `{"keys": [{"kty": "RSA", "kid": "a", "alg": "PS256", "n": "AQAB", "e": "AQAB"}]}`,
+		"WrongCurve":  `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-384", "x": "AA", "y": "AA"}]}`,
+		"Duplicate":   `{"keys": [{"kty": "oct", "kid": "a", "k": "AQAB"}, {"kty": "oct", "kid": "a", "k": "AQAB"}]}`,
+		"EmptySecret": `{"keys": [{"kty": "oct", "kid": "a", "k": ""}]}`,
+		"NotOnTheCurve": `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-256",
+			"x": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE", "y": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE"}]}`,
+	} {
+		if _, err := ParseJWKS([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
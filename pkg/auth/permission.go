@@ -0,0 +1,86 @@
+package auth
+
+import "fmt"
+
+// Permission allows a principal to use a group of the endpoints. The scopes
+// of a principal grant its permissions.
+type Permission string
+
+// Permissions of the service
+const (
+	PermissionRead    Permission = "payments:read"
+	PermissionWrite   Permission = "payments:write"
+	PermissionApprove Permission = "payments:approve"
+	PermissionAdmin   Permission = "admin"
+)
+
+// Permissions are all the permissions in the order they are reported
+var Permissions = []Permission{PermissionRead, PermissionWrite, PermissionApprove, PermissionAdmin}
+
+// implied are the permissions granted by a permission besides itself. Making
+// changes or approving them requires seeing them and admin can do anything.
+var implied = map[Permission][]Permission{
+	PermissionWrite:   {PermissionRead},
+	PermissionApprove: {PermissionRead},
+	PermissionAdmin:   {PermissionRead, PermissionWrite, PermissionApprove},
+}
+
+// ValidScope reports if the scope is one of the permissions
+func ValidScope(scope string) bool {
+	for _, perm := range Permissions {
+		if scope == string(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionError is returned when a principal lacks the permission of an endpoint
+type PermissionError struct {
+	Permission Permission
+}
+
+func (err *PermissionError) Error() string {
+	return fmt.Sprintf("permission %s is required", err.Permission)
+}
+
+// Permissions returns the effective permissions of the principal. Scopes
+// that are not permissions are ignored.
+func (p *Principal) Permissions() []Permission {
+	granted := map[Permission]bool{}
+	for _, scope := range p.Scopes {
+		if !ValidScope(scope) {
+			continue
+		}
+		granted[Permission(scope)] = true
+		for _, perm := range implied[Permission(scope)] {
+			granted[perm] = true
+		}
+	}
+
+	perms := []Permission{}
+	for _, perm := range Permissions {
+		if granted[perm] {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// Can reports if the principal has the permission
+func (p *Principal) Can(perm Permission) bool {
+	for _, granted := range p.Permissions() {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns a PermissionError if the principal lacks the permission
+func (p *Principal) Require(perm Permission) error {
+	if p == nil || !p.Can(perm) {
+		return &PermissionError{Permission: perm}
+	}
+	return nil
+}
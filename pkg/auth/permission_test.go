@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	testCases := map[string]struct {
+		scopes   []string
+		expected []Permission
+	}{
+		"None":    {scopes: nil, expected: []Permission{}},
+		"Read":    {scopes: []string{"payments:read"}, expected: []Permission{PermissionRead}},
+		"Write":   {scopes: []string{"payments:write"}, expected: []Permission{PermissionRead, PermissionWrite}},
+		"Approve": {scopes: []string{"payments:approve"}, expected: []Permission{PermissionRead, PermissionApprove}},
+		"Admin":   {scopes: []string{"admin"}, expected: Permissions},
+		"Unknown": {scopes: []string{"openid", "payments:delete"}, expected: []Permission{}},
+		"Mixed":   {scopes: []string{"payments:approve", "profile", "payments:write"}, expected: []Permission{PermissionRead, PermissionWrite, PermissionApprove}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p := &Principal{ID: "alice", Scopes: tc.scopes}
+			if perms := p.Permissions(); !reflect.DeepEqual(perms, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, perms)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	reader := &Principal{ID: "reporting", Scopes: []string{"payments:read"}}
+	if err := reader.Require(PermissionRead); err != nil {
+		t.Errorf("expected read to be allowed, got %v", err)
+	}
+
+	err := reader.Require(PermissionWrite)
+	if perr, ok := err.(*PermissionError); !ok || perr.Permission != PermissionWrite {
+		t.Errorf("expected missing %s, got %v", PermissionWrite, err)
+	}
+
+	var anonymous *Principal
+	if err := anonymous.Require(PermissionRead); err == nil {
+		t.Error("expected no principal to be denied")
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// PermissionsType is the type of the permissions resource
+const PermissionsType = "Permissions"
+
+// PermissionsAttributes are the attributes of the permissions resource
+type PermissionsAttributes struct {
+	Organisation string       `json:"organisation"`
+	Method       string       `json:"method"`
+	Scopes       []string     `json:"scopes"`
+	Permissions  []Permission `json:"permissions"`
+}
+
+// PermissionsData is the data of the permissions resource
+type PermissionsData struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes *PermissionsAttributes `json:"attributes"`
+
+	links.Resource
+}
+
+// PermissionsResource reports the effective permissions of a principal
+type PermissionsResource struct {
+	Data *PermissionsData `json:"data"`
+}
+
+// NewPermissionsResource creates new resource from Principal
+func NewPermissionsResource(p *Principal, self string) *PermissionsResource {
+	scopes := p.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &PermissionsResource{Data: &PermissionsData{
+		ID:   p.ID,
+		Type: PermissionsType,
+		Attributes: &PermissionsAttributes{
+			Organisation: p.Organisation,
+			Method:       p.Method,
+			Scopes:       scopes,
+			Permissions:  p.Permissions(),
+		},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}}
+}
+
+// Render implements render.Render
+func (resource *PermissionsResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
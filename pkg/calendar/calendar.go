@@ -0,0 +1,241 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the time zone database as the service runs from a scratch image
+	_ "time/tzdata"
+)
+
+// DateLayout is the layout of the dates in the calendar definitions
+const DateLayout = "2006-01-02"
+
+// Roll conventions for dates that are not business days
+const (
+	Following         = "following"
+	Preceding         = "preceding"
+	ModifiedFollowing = "modified_following"
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Holiday is a single non business day
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name,omitempty"`
+}
+
+// Definition is the serialised form of a calendar as kept in data files
+type Definition struct {
+	Name     string    `json:"name"`
+	TimeZone string    `json:"timezone,omitempty"`
+	Weekend  []string  `json:"weekend,omitempty"`
+	CutOff   string    `json:"cut_off,omitempty"`
+	Holidays []Holiday `json:"holidays"`
+}
+
+// Calendar is a business day calendar of a currency or a payment scheme
+type Calendar struct {
+	definition Definition
+
+	location *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[string]string
+	cutOff   time.Duration
+}
+
+// New validates a definition and returns the calendar for it.
+// Saturday and Sunday are the weekend unless the definition says otherwise.
+func New(def Definition) (*Calendar, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("calendar without name")
+	}
+
+	c := &Calendar{
+		definition: def,
+		location:   time.UTC,
+		weekend:    map[time.Weekday]bool{},
+		holidays:   map[string]string{},
+	}
+
+	if def.TimeZone != "" {
+		location, err := time.LoadLocation(def.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: invalid timezone %q", def.Name, def.TimeZone)
+		}
+		c.location = location
+	}
+
+	weekend := def.Weekend
+	if weekend == nil {
+		weekend = []string{"SA", "SU"}
+	}
+	for _, day := range weekend {
+		weekday, ok := weekdays[strings.ToUpper(day)]
+		if !ok {
+			return nil, fmt.Errorf("calendar %s: invalid weekend day %q", def.Name, day)
+		}
+		c.weekend[weekday] = true
+	}
+	if len(c.weekend) == 7 {
+		return nil, fmt.Errorf("calendar %s: no business days", def.Name)
+	}
+
+	for _, h := range def.Holidays {
+		if _, err := time.Parse(DateLayout, h.Date); err != nil {
+			return nil, fmt.Errorf("calendar %s: invalid holiday date %q", def.Name, h.Date)
+		}
+		c.holidays[h.Date] = h.Name
+	}
+
+	if def.CutOff != "" {
+		cutOff, err := parseClock(def.CutOff)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: %v", def.Name, err)
+		}
+		c.cutOff = cutOff
+	}
+
+	sort.Slice(c.definition.Holidays, func(i, j int) bool {
+		return c.definition.Holidays[i].Date < c.definition.Holidays[j].Date
+	})
+
+	return c, nil
+}
+
+// Name returns the name of the calendar
+func (c *Calendar) Name() string {
+	return c.definition.Name
+}
+
+// Definition returns the definition the calendar was created from
+func (c *Calendar) Definition() Definition {
+	return c.definition
+}
+
+// IsBusinessDay reports if the date is neither a weekend day nor a holiday
+func (c *Calendar) IsBusinessDay(date time.Time) bool {
+	if c.weekend[date.Weekday()] {
+		return false
+	}
+	_, holiday := c.holidays[date.Format(DateLayout)]
+	return !holiday
+}
+
+// Next returns the first business day after the date
+func (c *Calendar) Next(date time.Time) time.Time {
+	return c.AddBusinessDays(date, 1)
+}
+
+// Previous returns the last business day before the date
+func (c *Calendar) Previous(date time.Time) time.Time {
+	return c.AddBusinessDays(date, -1)
+}
+
+// AddBusinessDays moves the date by n business days, backwards if n is negative
+func (c *Calendar) AddBusinessDays(date time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+
+	date = day(date)
+	for n > 0 {
+		date = date.AddDate(0, 0, step)
+		if c.IsBusinessDay(date) {
+			n--
+		}
+	}
+
+	return date
+}
+
+// Roll moves a date that is not a business day according to the convention
+func (c *Calendar) Roll(date time.Time, convention string) (time.Time, error) {
+	date = day(date)
+	if c.IsBusinessDay(date) {
+		return date, nil
+	}
+
+	switch convention {
+	case "", Following:
+		return c.Next(date), nil
+	case Preceding:
+		return c.Previous(date), nil
+	case ModifiedFollowing:
+		next := c.Next(date)
+		if next.Month() != date.Month() {
+			return c.Previous(date), nil
+		}
+		return next, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unknown roll convention %q", convention)
+}
+
+// ProcessingDate returns the date a payment requested for the given date can
+// be processed when submitted at now. Requests for today after the cut-off
+// time and requests for past dates move to the next business day.
+func (c *Calendar) ProcessingDate(requested, now time.Time) time.Time {
+	local := now.In(c.location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	date := day(requested)
+	if date.Before(today) {
+		date = today
+	}
+
+	if date.Equal(today) && c.cutOff != 0 {
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.location)
+		if local.Sub(midnight) >= c.cutOff {
+			return c.Next(date)
+		}
+	}
+
+	if !c.IsBusinessDay(date) {
+		return c.Next(date)
+	}
+
+	return date
+}
+
+// SettlementDate returns the date a payment processed on the given date
+// settles when the scheme settles lag business days after processing
+func (c *Calendar) SettlementDate(processing time.Time, lag int) time.Time {
+	date, _ := c.Roll(processing, Following)
+	return c.AddBusinessDays(date, lag)
+}
+
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid cut-off time %q", s)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid cut-off time %q", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid cut-off time %q", s)
+	}
+
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
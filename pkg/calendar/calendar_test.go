@@ -0,0 +1,89 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	c, err := New(Definition{
+		Name:     "GBP",
+		TimeZone: "Europe/London",
+		CutOff:   "16:00",
+		Holidays: []Holiday{{Date: "2018-12-25"}, {Date: "2018-12-26"}, {Date: "2019-01-01"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(s string) time.Time {
+		d, err := time.Parse(DateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	at := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	testCases := map[string]struct {
+		got      func() time.Time
+		expected string
+	}{
+		"NextOverHolidays": {
+			got:      func() time.Time { return c.Next(date("2018-12-24")) },
+			expected: "2018-12-27",
+		},
+		"PreviousOverWeekend": {
+			got:      func() time.Time { return c.Previous(date("2018-12-31")) },
+			expected: "2018-12-28",
+		},
+		"RollPreceding": {
+			got: func() time.Time {
+				d, _ := c.Roll(date("2018-12-26"), Preceding)
+				return d
+			},
+			expected: "2018-12-24",
+		},
+		"RollModifiedFollowing": {
+			got: func() time.Time {
+				d, _ := c.Roll(date("2018-03-31"), ModifiedFollowing)
+				return d
+			},
+			expected: "2018-03-30",
+		},
+		"SettlementDate": {
+			got:      func() time.Time { return c.SettlementDate(date("2018-12-22"), 2) },
+			expected: "2018-12-28",
+		},
+		"ProcessingBeforeCutOff": {
+			got:      func() time.Time { return c.ProcessingDate(date("2018-12-24"), at("2018-12-24T15:59:00Z")) },
+			expected: "2018-12-24",
+		},
+		"ProcessingAfterCutOff": {
+			got:      func() time.Time { return c.ProcessingDate(date("2018-12-24"), at("2018-12-24T16:00:00Z")) },
+			expected: "2018-12-27",
+		},
+		"ProcessingAfterCutOffSummerTime": {
+			got:      func() time.Time { return c.ProcessingDate(date("2018-07-02"), at("2018-07-02T15:30:00Z")) },
+			expected: "2018-07-03",
+		},
+		"ProcessingInThePast": {
+			got:      func() time.Time { return c.ProcessingDate(date("2018-12-20"), at("2018-12-29T10:00:00Z")) },
+			expected: "2018-12-31",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.got().Format(DateLayout); got != tc.expected {
+				t.Errorf("got %s, want %s", got, tc.expected)
+			}
+		})
+	}
+}
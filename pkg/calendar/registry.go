@@ -0,0 +1,191 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+// Registry holds the calendars by name. Calendars are named after the
+// currency (GBP) or the payment scheme (FPS) they apply to.
+type Registry struct {
+	mu        sync.RWMutex
+	calendars map[string]*Calendar
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{calendars: map[string]*Calendar{}}
+}
+
+// Get returns the calendar with the given name
+func (r *Registry) Get(name string) (*Calendar, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.calendars[name]
+	return c, ok
+}
+
+// Lookup returns the first calendar found for the names
+func (r *Registry) Lookup(names ...string) (*Calendar, bool) {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if c, ok := r.Get(name); ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// List returns all calendars ordered by name
+func (r *Registry) List() []*Calendar {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	calendars := []*Calendar{}
+	for _, c := range r.calendars {
+		calendars = append(calendars, c)
+	}
+	sort.Slice(calendars, func(i, j int) bool { return calendars[i].Name() < calendars[j].Name() })
+
+	return calendars
+}
+
+// Put adds or replaces a calendar
+func (r *Registry) Put(c *Calendar) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calendars[c.Name()] = c
+}
+
+// LoadDir loads every *.json calendar definition in the directory
+func (r *Registry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		def := Definition{}
+		if err := json.Unmarshal(data, &def); err != nil {
+			return fmt.Errorf("calendar %s: %v", file, err)
+		}
+
+		c, err := New(def)
+		if err != nil {
+			return err
+		}
+		r.Put(c)
+	}
+
+	return nil
+}
+
+// Load loads the calendars managed through the API. They take precedence
+// over the calendars from the data files.
+func (r *Registry) Load(db *sqlx.DB) error {
+	defs := []json.RawMessage{}
+	if err := db.Select(&defs, "SELECT definition FROM calendars"); err != nil {
+		return err
+	}
+
+	for _, raw := range defs {
+		def := Definition{}
+		if err := json.Unmarshal(raw, &def); err != nil {
+			return err
+		}
+
+		c, err := New(def)
+		if err != nil {
+			return err
+		}
+		r.Put(c)
+	}
+
+	return nil
+}
+
+// Watch loads the calendars managed through the API every interval until
+// the context is cancelled, so the changes made on the other replicas are
+// picked up
+func (r *Registry) Watch(ctx context.Context, db *sqlx.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := r.Load(db); err != nil {
+			slog.Error("reloading calendars failed", logging.Error(err))
+		}
+	}
+}
+
+// Save persists the calendar and adds it to the registry
+func (r *Registry) Save(db *sqlx.DB, c *Calendar) error {
+	def, err := json.Marshal(c.Definition())
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(db.Rebind(
+		`INSERT INTO calendars (name, definition) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET definition=EXCLUDED.definition, updated_at=now()`),
+		c.Name(), string(def),
+	); err != nil {
+		return err
+	}
+
+	r.Put(c)
+	return nil
+}
+
+// AdjustPayment moves the processing date of the payment to the date it
+// can be processed on according to the calendar of its scheme or currency.
+// Payments without a processing date or a calendar are left unchanged.
+func (r *Registry) AdjustPayment(p *payment.Payment, now time.Time) error {
+	details, err := p.Details()
+	if err != nil {
+		return err
+	}
+	if details.ProcessingDate.IsZero() {
+		return nil
+	}
+
+	c, ok := r.Lookup(details.PaymentScheme, details.Currency)
+	if !ok {
+		return nil
+	}
+
+	date := c.ProcessingDate(details.ProcessingDate, now)
+	if date.Equal(details.ProcessingDate) {
+		return nil
+	}
+
+	return p.SetAttributes(map[string]interface{}{
+		"processing_date": date.Format(payment.DateLayout),
+	})
+}
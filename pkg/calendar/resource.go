@@ -0,0 +1,123 @@
+package calendar
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the calendar resources
+const (
+	Type            = "Calendar"
+	BusinessDayType = "BusinessDay"
+)
+
+// ResourceData is the data of the calendar resource
+type ResourceData struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Attributes *Definition `json:"attributes"`
+
+	links.Resource
+}
+
+func newResourceData(c *Calendar, self string) *ResourceData {
+	def := c.Definition()
+	return &ResourceData{
+		ID:         c.Name(),
+		Type:       Type,
+		Attributes: &def,
+		Resource:   links.Resource{Links: links.Links{Self: self}},
+	}
+}
+
+// Resource is a single calendar resource
+type Resource struct {
+	Data *ResourceData `json:"data"`
+}
+
+// NewResource creates new resource from Calendar
+func NewResource(c *Calendar, self string) *Resource {
+	return &Resource{Data: newResourceData(c, self)}
+}
+
+// Bind implements render.Binder
+func (resource *Resource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != Type {
+		return fmt.Errorf("wrong type")
+	}
+
+	if resource.Data.Attributes == nil {
+		return fmt.Errorf("no calendar")
+	}
+
+	return nil
+}
+
+// Render implements render.Render
+func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ListResource is a list of calendars resource
+type ListResource struct {
+	Data []*ResourceData `json:"data"`
+	links.Resource
+}
+
+// NewListResource returns new calendars list resource
+func NewListResource(calendars []*Calendar, self string) *ListResource {
+	list := &ListResource{
+		Data:     []*ResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for _, c := range calendars {
+		list.Data = append(list.Data, newResourceData(c, self+"/"+c.Name()))
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// BusinessDay answers business day questions about a date
+type BusinessDay struct {
+	Date                string `json:"date"`
+	IsBusinessDay       bool   `json:"is_business_day"`
+	Convention          string `json:"convention"`
+	RolledDate          string `json:"rolled_date"`
+	NextBusinessDay     string `json:"next_business_day"`
+	PreviousBusinessDay string `json:"previous_business_day"`
+	SettlementDate      string `json:"settlement_date"`
+}
+
+// BusinessDayResource is a business day resource
+type BusinessDayResource struct {
+	Data struct {
+		ID         string       `json:"id"`
+		Type       string       `json:"type"`
+		Attributes *BusinessDay `json:"attributes"`
+	} `json:"data"`
+}
+
+// NewBusinessDayResource creates new business day resource for the calendar
+func NewBusinessDayResource(c *Calendar, b *BusinessDay) *BusinessDayResource {
+	resource := &BusinessDayResource{}
+	resource.Data.ID = c.Name() + "/" + b.Date
+	resource.Data.Type = BusinessDayType
+	resource.Data.Attributes = b
+	return resource
+}
+
+// Render implements render.Render
+func (resource *BusinessDayResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
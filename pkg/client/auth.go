@@ -0,0 +1,35 @@
+package client
+
+import "net/http"
+
+// Authenticator adds the credentials to the requests
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// AuthenticatorFunc is a function authenticating the requests, like one
+// refreshing tokens
+type AuthenticatorFunc func(r *http.Request) error
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// APIKey authenticates the requests with an API key
+type APIKey string
+
+// Authenticate implements Authenticator
+func (k APIKey) Authenticate(r *http.Request) error {
+	r.Header.Set("X-API-Key", string(k))
+	return nil
+}
+
+// BearerToken authenticates the requests with a JWT bearer token
+type BearerToken string
+
+// Authenticate implements Authenticator
+func (t BearerToken) Authenticate(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
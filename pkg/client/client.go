@@ -0,0 +1,265 @@
+// Package client is the Go client of the payments API
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/jsonapi"
+)
+
+// Retry is how the idempotent requests that failed for reasons that may
+// pass are retried
+type Retry struct {
+	// Attempts is the most times a request is sent, 1 disables the retries
+	Attempts int
+	// MinBackoff is the wait before the first retry. It doubles for each
+	// retry up to MaxBackoff and is jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetry retries a request three times within a few seconds
+var DefaultRetry = Retry{Attempts: 4, MinBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// Client calls the payments API
+type Client struct {
+	// BaseURL is the URL the paths of the API are relative to like
+	// https://payments.example.com
+	BaseURL string
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Auth authenticates the requests, they are sent without credentials
+	// if nil
+	Auth      Authenticator
+	Retry     Retry
+	UserAgent string
+}
+
+// New returns a client of the API at the URL authenticating the requests
+// with the authenticator
+func New(baseURL string, auth Authenticator) *Client {
+	return &Client{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		Auth:      auth,
+		Retry:     DefaultRetry,
+		UserAgent: "payments-go",
+	}
+}
+
+type (
+	idempotencyKey struct{}
+	ifMatch        struct{}
+)
+
+// WithIdempotencyKey sets the idempotency key of the requests creating
+// resources with the context instead of a random one, for retrying them
+// across processes
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// WithIfMatch makes the updates and deletes with the context fail with
+// http.StatusPreconditionFailed if the payment changed since it was read
+// with the ETag
+func WithIfMatch(ctx context.Context, etag string) context.Context {
+	return context.WithValue(ctx, ifMatch{}, etag)
+}
+
+// newIdempotencyKey returns the key of the context or a random UUID
+func newIdempotencyKey(ctx context.Context) string {
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && key != "" {
+		return key
+	}
+
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// request is a call of the API
+type request struct {
+	method string
+	path   string
+	body   interface{}
+	// idempotencyKey makes the POST requests safe to retry
+	idempotencyKey string
+	// accept is the media type of the response, JSON if empty
+	accept string
+}
+
+// idempotent reports if the request can be sent again without repeating
+// its effect
+func (r *request) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return r.idempotencyKey != ""
+	}
+	return false
+}
+
+// do sends the request, retrying it if it is idempotent, and decodes the
+// response into v. It returns the headers of the response.
+func (c *Client) do(ctx context.Context, req *request, v interface{}) (http.Header, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	attempts := 1
+	if req.idempotent() && c.Retry.Attempts > 1 {
+		attempts = c.Retry.Attempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil {
+			err = decode(resp, v)
+		}
+		if err == nil {
+			return resp.Header, nil
+		}
+
+		wait, retry := c.backoff(ctx, req, err, attempt)
+		if !retry || attempt >= attempts {
+			return nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req *request, body []byte) (*http.Response, error) {
+	url := req.path
+	if strings.HasPrefix(url, "/") {
+		url = c.BaseURL + url
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if req.accept != "" {
+		r.Header.Set("Accept", req.accept)
+	} else {
+		r.Header.Set("Accept", jsonapi.MediaType)
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", jsonapi.MediaType)
+	}
+	if c.UserAgent != "" {
+		r.Header.Set("User-Agent", c.UserAgent)
+	}
+	if req.idempotencyKey != "" {
+		r.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	if etag, ok := ctx.Value(ifMatch{}).(string); ok && req.method != http.MethodGet {
+		r.Header.Set("If-Match", etag)
+	}
+	if c.Auth != nil {
+		if err := c.Auth.Authenticate(r); err != nil {
+			return nil, err
+		}
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(r)
+}
+
+// backoff returns how long to wait before retrying the request that failed
+// with the error or false if it should not be retried
+func (c *Client) backoff(ctx context.Context, req *request, err error, attempt int) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	if apiErr, ok := err.(*Error); ok {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		case http.StatusConflict:
+			// The service asks to retry a request with an idempotency key
+			// while the first one with the key is still being processed
+			if req.idempotencyKey == "" || apiErr.RetryAfter == 0 {
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+		retryAfter = apiErr.RetryAfter
+	}
+
+	// Full jitter keeps the clients failing together from retrying together
+	wait := time.Duration(float64(c.Retry.MinBackoff) * math.Pow(2, float64(attempt-1)))
+	if wait > c.Retry.MaxBackoff || wait <= 0 {
+		wait = c.Retry.MaxBackoff
+	}
+	wait = wait/2 + time.Duration(mathrand.Int63n(int64(wait/2)+1))
+
+	if retryAfter > 0 {
+		// Waiting longer than allowed is left to the caller
+		if c.Retry.MaxBackoff > 0 && retryAfter > c.Retry.MaxBackoff {
+			return 0, false
+		}
+		wait = retryAfter
+	}
+	return wait, true
+}
+
+// decode decodes the successful response into v or returns the error of
+// the response
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := newError(resp.StatusCode, data)
+		if s := resp.Header.Get("Retry-After"); s != "" {
+			if seconds, err := strconv.Atoi(s); err == nil {
+				apiErr.RetryAfter = time.Duration(seconds) * time.Second
+			}
+		}
+		return apiErr
+	}
+
+	if v == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
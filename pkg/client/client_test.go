@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastRetry retries without slowing the tests down
+var fastRetry = Retry{Attempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+const paymentJSON = `{"data":{"id":"4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43","attributes":{"amount":"100.21"},"type":"Payment","meta":{"status":"created"}}}`
+
+// recorder answers the requests with the statuses in order, the last one
+// repeated, and records the requests
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	rec.requests = append(rec.requests, r)
+	rec.bodies = append(rec.bodies, string(body))
+
+	status := rec.statuses[0]
+	if len(rec.statuses) > 1 {
+		rec.statuses = rec.statuses[1:]
+	}
+	if status >= http.StatusBadRequest {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"errors":[{"status":"%d","title":%q,"detail":"failed","source":{"pointer":"/data"},"meta":{"trace_id":"abc"}}]}`, status, http.StatusText(status))
+		return
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(paymentJSON))
+}
+
+func newTestClient(t *testing.T, statuses ...int) (*Client, *recorder) {
+	rec := &recorder{statuses: statuses}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL, APIKey("secret"))
+	c.Retry = fastRetry
+	return c, rec
+}
+
+func TestRetries(t *testing.T) {
+	testCases := map[string]struct {
+		statuses []int
+		call     func(c *Client) error
+		requests int
+		status   int
+	}{
+		"GetRecovers": {
+			statuses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			call:     func(c *Client) error { _, err := c.GetPayment(context.Background(), "id"); return err },
+			requests: 2,
+		},
+		"GetGivesUp": {
+			statuses: []int{http.StatusBadGateway},
+			call:     func(c *Client) error { _, err := c.GetPayment(context.Background(), "id"); return err },
+			requests: 3,
+			status:   http.StatusBadGateway,
+		},
+		"GetNotFound": {
+			statuses: []int{http.StatusNotFound},
+			call:     func(c *Client) error { _, err := c.GetPayment(context.Background(), "id"); return err },
+			requests: 1,
+			status:   http.StatusNotFound,
+		},
+		"CreateRecovers": {
+			statuses: []int{http.StatusTooManyRequests, http.StatusCreated},
+			call: func(c *Client) error {
+				_, err := c.CreatePayment(context.Background(), map[string]string{"amount": "100.21"})
+				return err
+			},
+			requests: 2,
+		},
+		"PatchNotRetried": {
+			statuses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			call: func(c *Client) error {
+				_, err := c.PatchPayment(context.Background(), "id", map[string]string{"amount": "100.21"})
+				return err
+			},
+			requests: 1,
+			status:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, rec := newTestClient(t, tc.statuses...)
+
+			err := tc.call(c)
+			if StatusCode(err) != tc.status {
+				t.Errorf("expected status %d, got %v", tc.status, err)
+			}
+			if len(rec.requests) != tc.requests {
+				t.Errorf("expected %d requests, got %d", tc.requests, len(rec.requests))
+			}
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	c, rec := newTestClient(t, http.StatusServiceUnavailable, http.StatusCreated)
+
+	if _, err := c.CreatePayment(context.Background(), json.RawMessage(`{"amount":"100.21"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	key := rec.requests[0].Header.Get("Idempotency-Key")
+	if len(key) != 36 {
+		t.Errorf("expected a generated key, got %q", key)
+	}
+	if retried := rec.requests[1].Header.Get("Idempotency-Key"); retried != key {
+		t.Errorf("expected the retry to reuse %q, got %q", key, retried)
+	}
+	if rec.bodies[0] != `{"data":{"type":"Payment","attributes":{"amount":"100.21"}}}` {
+		t.Errorf("unexpected body %s", rec.bodies[0])
+	}
+
+	ctx := WithIdempotencyKey(context.Background(), "order-42")
+	if _, err := c.CreatePayment(ctx, map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if key := rec.requests[2].Header.Get("Idempotency-Key"); key != "order-42" {
+		t.Errorf("expected the key of the context, got %q", key)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	handler := func(retryAfter string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}
+
+	srv := httptest.NewServer(handler("60"))
+	defer srv.Close()
+	c := New(srv.URL, nil)
+	c.Retry = fastRetry
+
+	// Waiting a minute is longer than the backoff allows
+	start := time.Now()
+	_, err := c.GetPayment(context.Background(), "id")
+	apiErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if apiErr.RetryAfter != time.Minute {
+		t.Errorf("expected to retry after a minute, got %s", apiErr.RetryAfter)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected to give up, waited %s", time.Since(start))
+	}
+}
+
+func TestBackoffInProgress(t *testing.T) {
+	inProgress := &Error{StatusCode: http.StatusConflict, RetryAfter: time.Second}
+	testCases := map[string]struct {
+		req   *request
+		err   error
+		retry bool
+	}{
+		"WithKey":       {req: &request{method: http.MethodPost, idempotencyKey: "order-42"}, err: inProgress, retry: true},
+		"WithoutKey":    {req: &request{method: http.MethodPut}, err: inProgress},
+		"OtherConflict": {req: &request{method: http.MethodPost, idempotencyKey: "order-42"}, err: &Error{StatusCode: http.StatusConflict}},
+		"ReusedKey":     {req: &request{method: http.MethodPost, idempotencyKey: "order-42"}, err: &Error{StatusCode: http.StatusUnprocessableEntity}},
+		"ServerError":   {req: &request{method: http.MethodPost, idempotencyKey: "order-42"}, err: &Error{StatusCode: http.StatusServiceUnavailable}, retry: true},
+	}
+
+	c := New("", nil)
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			wait, retry := c.backoff(context.Background(), tc.req, tc.err, 1)
+			if retry != tc.retry {
+				t.Errorf("expected retry %t, got %t", tc.retry, retry)
+			}
+			if tc.err == inProgress && retry && wait != time.Second {
+				t.Errorf("expected to wait for Retry-After, got %s", wait)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	c, _ := newTestClient(t, http.StatusForbidden)
+
+	_, err := c.GetPayment(context.Background(), "id")
+	expected := &Error{StatusCode: http.StatusForbidden, Status: "Forbidden", Message: "failed", Pointer: "/data", TraceID: "abc"}
+	if apiErr, ok := err.(*Error); !ok || *apiErr != *expected {
+		t.Errorf("expected %+v, got %+v", expected, err)
+	}
+	if err.Error() != "payments: 403 Forbidden failed" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	c, rec := newTestClient(t, http.StatusServiceUnavailable)
+	c.Retry = Retry{Attempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetPayment(ctx, "id"); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline, got %v", err)
+	}
+	if len(rec.requests) != 1 {
+		t.Errorf("expected no retries, got %d requests", len(rec.requests))
+	}
+}
+
+func TestAuthenticators(t *testing.T) {
+	testCases := map[string]struct {
+		auth   Authenticator
+		header string
+		value  string
+	}{
+		"APIKey":      {auth: APIKey("secret"), header: "X-API-Key", value: "secret"},
+		"BearerToken": {auth: BearerToken("token"), header: "Authorization", value: "Bearer token"},
+		"Func": {
+			auth: AuthenticatorFunc(func(r *http.Request) error {
+				r.Header.Set("X-Signature", "signed")
+				return nil
+			}),
+			header: "X-Signature",
+			value:  "signed",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, rec := newTestClient(t, http.StatusOK)
+			c.Auth = tc.auth
+
+			if _, err := c.GetPayment(context.Background(), "id"); err != nil {
+				t.Fatal(err)
+			}
+			if value := rec.requests[0].Header.Get(tc.header); value != tc.value {
+				t.Errorf("expected %s %q, got %q", tc.header, tc.value, value)
+			}
+		})
+	}
+}
+
+func TestIterator(t *testing.T) {
+	pages := map[string]string{
+		"": `{"data":[{"id":"1","type":"Payment","attributes":{}},{"id":"2","type":"Payment","attributes":{}}],
+			"links":{"self":"/payments?page[size]=2","next":"/payments?page[size]=2&page[after]=2"}}`,
+		"2": `{"data":[{"id":"3","type":"Payment","attributes":{}}],"links":{"self":"/payments?page[size]=2&page[after]=2"}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pages[r.URL.Query().Get("page[after]")]))
+	}))
+	defer srv.Close()
+
+	it := New(srv.URL, nil).Payments(context.Background(), 2)
+	var ids []string
+	for it.Next() {
+		ids = append(ids, it.Payment().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("expected all the payments, got %v", ids)
+	}
+}
+
+func TestPaymentsFiltered(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Query().Get("page[after]") == "" {
+			w.Write([]byte(`{"data":[{"id":"1","type":"Payment","attributes":{}}],
+				"links":{"next":"/payments?page[size]=1&page[after]=1&filter[currency]=GBP&filter[status]=created"}}`))
+			return
+		}
+		w.Write([]byte(`{"data":[],"links":{}}`))
+	}))
+	defer srv.Close()
+
+	filter := Filter{Status: "created", Attributes: map[string]string{"currency": "GBP"}}
+	it := New(srv.URL, nil).PaymentsFiltered(context.Background(), filter, 1)
+	for it.Next() {
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"filter%5Bcurrency%5D=GBP&filter%5Bstatus%5D=created&page%5Bsize%5D=1",
+		"page[size]=1&page[after]=1&filter[currency]=GBP&filter[status]=created",
+	}
+	if fmt.Sprint(queries) != fmt.Sprint(expected) {
+		t.Errorf("expected the filter in every request %v, got %v", expected, queries)
+	}
+}
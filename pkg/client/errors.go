@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrors "github.com/VMitov/payments/pkg/errors"
+)
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	// Status describes the kind of the error and Message the error itself
+	Status  string
+	Message string
+	Code    string
+	// Pointer is the JSON Pointer to the member of the request and
+	// Parameter the query parameter causing the error, if known
+	Pointer   string
+	Parameter string
+	// TraceID identifies the request in the traces and the logs of the
+	// service
+	TraceID string
+	// RetryAfter is how long the service asked to wait before retrying
+	RetryAfter time.Duration
+}
+
+func newError(statusCode int, body []byte) *Error {
+	e := &Error{StatusCode: statusCode}
+
+	var doc apierrors.Document
+	if err := json.Unmarshal(body, &doc); err != nil || len(doc.Errors) == 0 {
+		// Errors of proxies in front of the service
+		e.Status = http.StatusText(statusCode)
+		e.Message = strings.TrimSpace(string(body))
+		return e
+	}
+
+	// The service responds with a single error
+	obj := doc.Errors[0]
+	e.Status = obj.Title
+	e.Message = obj.Detail
+	e.Code = obj.Code
+	if obj.Source != nil {
+		e.Pointer = obj.Source.Pointer
+		e.Parameter = obj.Source.Parameter
+	}
+	if obj.Meta != nil {
+		e.TraceID = obj.Meta.TraceID
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("payments: %d %s", e.StatusCode, e.Status)
+	if e.Message != "" {
+		msg += " " + e.Message
+	}
+	return msg
+}
+
+// StatusCode returns the HTTP status of the error response or 0 if the
+// error is not one
+func StatusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports if the resource does not exist
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsModified reports if the payment changed since it was read with the ETag
+// given to WithIfMatch
+func IsModified(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event is a change of a payment
+type Event struct {
+	Type      string    `json:"type"`
+	PaymentID string    `json:"payment_id"`
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"`
+	Time      time.Time `json:"time"`
+}
+
+// EventStream is the stream of the changes of the payments
+//
+//	stream, err := c.Events(ctx)
+//	defer stream.Close()
+//	for stream.Next() {
+//		e := stream.Event()
+//	}
+//	if err := stream.Err(); err != nil {
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+	event   Event
+	err     error
+}
+
+// Events opens the stream of the changes of the payments made from now on.
+// The stream ends when the context is cancelled, the server shuts down or
+// the client falls behind, the changes until it is opened again are missed.
+func (c *Client) Events(ctx context.Context) (*EventStream, error) {
+	resp, err := c.send(ctx, &request{method: http.MethodGet, path: "/events", accept: "text/event-stream"}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, decode(resp, nil)
+	}
+
+	return &EventStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next waits for the next event. It returns false when the stream ends.
+func (s *EventStream) Next() bool {
+	var data strings.Builder
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			s.event = Event{}
+			if s.err = json.Unmarshal([]byte(data.String()), &s.event); s.err != nil {
+				return false
+			}
+			return true
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// The comments keeping the stream alive and the event names, which
+		// are in the data as well, are skipped
+	}
+
+	s.err = s.scanner.Err()
+	return false
+}
+
+// Event returns the current event
+func (s *EventStream) Event() Event {
+	return s.event
+}
+
+// Err returns the error that ended the stream, nil if the server ended it
+func (s *EventStream) Err() error {
+	if s.err == context.Canceled {
+		return nil
+	}
+	return s.err
+}
+
+// Close closes the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
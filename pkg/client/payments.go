@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Payment is a payment of the API
+type Payment struct {
+	ID         string
+	Attributes json.RawMessage
+	// Status and Kind are set by the service
+	Status     string
+	Kind       string
+	OriginalID string
+	// ETag is the version of the payment for WithIfMatch, it is only set
+	// for a single payment
+	ETag string
+}
+
+// Decode decodes the attributes of the payment into v
+func (p *Payment) Decode(v interface{}) error {
+	return json.Unmarshal(p.Attributes, v)
+}
+
+// resourceData is the JSON:API data of a payment
+type resourceData struct {
+	Type       string          `json:"type"`
+	ID         string          `json:"id,omitempty"`
+	Attributes json.RawMessage `json:"attributes"`
+	Meta       *struct {
+		Status string `json:"status"`
+		Kind   string `json:"kind"`
+	} `json:"meta,omitempty"`
+	Relationships map[string]struct {
+		Data *struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	} `json:"relationships,omitempty"`
+}
+
+func (data *resourceData) payment() *Payment {
+	p := &Payment{ID: data.ID, Attributes: data.Attributes, Kind: "payment"}
+	if data.Meta != nil {
+		p.Status = data.Meta.Status
+		if data.Meta.Kind != "" {
+			p.Kind = data.Meta.Kind
+		}
+	}
+	if original, ok := data.Relationships["original"]; ok && original.Data != nil {
+		p.OriginalID = original.Data.ID
+	}
+	return p
+}
+
+type resource struct {
+	Data *resourceData `json:"data"`
+}
+
+type listResource struct {
+	Data  []*resourceData `json:"data"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+// newResource returns the resource of the attributes, encoding them if
+// they are not JSON already
+func newResource(attributes interface{}) (*resource, error) {
+	raw, ok := attributes.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(attributes); err != nil {
+			return nil, err
+		}
+	}
+	return &resource{Data: &resourceData{Type: "Payment", Attributes: raw}}, nil
+}
+
+func paymentPath(id string) string {
+	return "/payments/" + url.PathEscape(id)
+}
+
+// GetPayment returns the payment with the id
+func (c *Client) GetPayment(ctx context.Context, id string) (*Payment, error) {
+	var res resource
+	header, err := c.do(ctx, &request{method: http.MethodGet, path: paymentPath(id)}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.payment(header)
+}
+
+// CreatePayment creates a payment with the attributes. The request is sent
+// with an idempotency key so it is retried without creating the payment
+// twice.
+func (c *Client) CreatePayment(ctx context.Context, attributes interface{}) (*Payment, error) {
+	body, err := newResource(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var res resource
+	req := &request{
+		method:         http.MethodPost,
+		path:           "/payments",
+		body:           body,
+		idempotencyKey: newIdempotencyKey(ctx),
+	}
+	header, err := c.do(ctx, req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.payment(header)
+}
+
+// UpdatePayment replaces the attributes of the payment
+func (c *Client) UpdatePayment(ctx context.Context, id string, attributes interface{}) (*Payment, error) {
+	return c.changePayment(ctx, http.MethodPut, id, attributes)
+}
+
+// PatchPayment merges the patch into the attributes of the payment as a
+// JSON merge patch, null removes an attribute. It is not retried since
+// patches like appending to a list are not idempotent.
+func (c *Client) PatchPayment(ctx context.Context, id string, patch interface{}) (*Payment, error) {
+	return c.changePayment(ctx, http.MethodPatch, id, patch)
+}
+
+func (c *Client) changePayment(ctx context.Context, method, id string, attributes interface{}) (*Payment, error) {
+	body, err := newResource(attributes)
+	if err != nil {
+		return nil, err
+	}
+	body.Data.ID = id
+
+	var res resource
+	header, err := c.do(ctx, &request{method: method, path: paymentPath(id), body: body}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.payment(header)
+}
+
+// DeletePayment deletes the payment
+func (c *Client) DeletePayment(ctx context.Context, id string) error {
+	_, err := c.do(ctx, &request{method: http.MethodDelete, path: paymentPath(id)}, nil)
+	return err
+}
+
+// Page is a page of payments
+type Page struct {
+	Payments []*Payment
+	// Next is the id of the last payment of the page if there are more,
+	// for listing the next page
+	Next string
+	// next is the link of the next page
+	next string
+}
+
+// Filter selects the listed payments by their status, kind and attributes.
+// The zero filter selects all of them.
+type Filter struct {
+	Status string
+	Kind   string
+	// Attributes are the string values of the attributes at their dotted
+	// paths, like beneficiary_party.name
+	Attributes map[string]string
+}
+
+// query adds the parameters of the filter to the query
+func (f Filter) query(query url.Values) {
+	if f.Status != "" {
+		query.Set("filter[status]", f.Status)
+	}
+	if f.Kind != "" {
+		query.Set("filter[kind]", f.Kind)
+	}
+	for path, value := range f.Attributes {
+		query.Set("filter["+path+"]", value)
+	}
+}
+
+// ListPayments returns a page of up to size payments after the one with
+// the id, the first page if after is empty
+func (c *Client) ListPayments(ctx context.Context, size int, after string) (*Page, error) {
+	return c.ListPaymentsFiltered(ctx, Filter{}, size, after)
+}
+
+// ListPaymentsFiltered returns a page of up to size payments selected by
+// the filter after the one with the id, the first page if after is empty
+func (c *Client) ListPaymentsFiltered(ctx context.Context, filter Filter, size int, after string) (*Page, error) {
+	query := url.Values{}
+	query.Set("page[size]", fmt.Sprint(size))
+	if after != "" {
+		query.Set("page[after]", after)
+	}
+	filter.query(query)
+	return c.listPayments(ctx, "/payments?"+query.Encode())
+}
+
+func (c *Client) listPayments(ctx context.Context, path string) (*Page, error) {
+	var res listResource
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: path}, &res); err != nil {
+		return nil, err
+	}
+
+	page := &Page{Payments: make([]*Payment, 0, len(res.Data)), next: res.Links.Next}
+	for _, data := range res.Data {
+		page.Payments = append(page.Payments, data.payment())
+	}
+	if page.next != "" && len(page.Payments) > 0 {
+		page.Next = page.Payments[len(page.Payments)-1].ID
+	}
+	return page, nil
+}
+
+func (res *resource) payment(header http.Header) (*Payment, error) {
+	if res.Data == nil {
+		return nil, fmt.Errorf("payments: response without data")
+	}
+	p := res.Data.payment()
+	p.ETag = header.Get("ETag")
+	return p, nil
+}
+
+// Iterator iterates all the payments page by page
+//
+//	it := c.Payments(ctx, 100)
+//	for it.Next() {
+//		p := it.Payment()
+//	}
+//	if err := it.Err(); err != nil {
+type Iterator struct {
+	ctx    context.Context
+	client *Client
+	next   string
+
+	page    []*Payment
+	payment *Payment
+	err     error
+}
+
+// Payments returns an iterator of all the payments fetching them in pages
+// of the size
+func (c *Client) Payments(ctx context.Context, size int) *Iterator {
+	return c.PaymentsFiltered(ctx, Filter{}, size)
+}
+
+// PaymentsFiltered returns an iterator of the payments selected by the filter
+// fetching them in pages of the size. The links of the next pages keep the
+// filter.
+func (c *Client) PaymentsFiltered(ctx context.Context, filter Filter, size int) *Iterator {
+	query := url.Values{}
+	query.Set("page[size]", fmt.Sprint(size))
+	filter.query(query)
+	return &Iterator{
+		ctx:    ctx,
+		client: c,
+		next:   "/payments?" + query.Encode(),
+	}
+}
+
+// Next advances to the next payment, fetching the next page if needed. It
+// returns false at the end or on an error.
+func (it *Iterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == "" {
+			it.payment = nil
+			return false
+		}
+
+		page, err := it.client.listPayments(it.ctx, it.next)
+		if err != nil {
+			it.err = err
+			continue
+		}
+		it.page, it.next = page.Payments, page.next
+	}
+
+	it.payment, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Payment returns the current payment
+func (it *Iterator) Payment() *Payment {
+	return it.payment
+}
+
+// Err returns the error that stopped the iteration
+func (it *Iterator) Err() error {
+	return it.err
+}
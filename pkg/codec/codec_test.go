@@ -0,0 +1,198 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testResource struct {
+	Data testData `json:"data"`
+}
+
+type testData struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// testDocument has the values every codec keeps, strings included
+func testDocument() *testResource {
+	return &testResource{Data: testData{
+		ID:   "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43",
+		Type: "Payment",
+		Attributes: map[string]interface{}{
+			"amount":            "100.21",
+			"reference":         "Payment for Em's piano lessons <3 & more",
+			"beneficiary_party": map[string]interface{}{"name": "W Owens", "account_number": "31926819"},
+			"charges":           []interface{}{"GBP", "USD"},
+		},
+	}}
+}
+
+func TestRoundTrip(t *testing.T) {
+	typed := map[string]interface{}{
+		"data": map[string]interface{}{
+			"id": "1",
+			"attributes": map[string]interface{}{
+				"units":    json.Number("12345678901234567890"),
+				"negative": json.Number("-40000"),
+				"rate":     json.Number("0.5"),
+				"small":    json.Number("-3"),
+				"urgent":   true,
+				"memo":     nil,
+				"empty":    map[string]interface{}{},
+				"none":     []interface{}{},
+				"blank":    "",
+				"1st":      "not an XML name",
+			},
+		},
+	}
+
+	codecs := map[string]struct {
+		codec Codec
+		typed bool
+	}{
+		"JSON":        {codec: JSON, typed: true},
+		"XML":         {codec: XML, typed: true},
+		"MessagePack": {codec: MessagePack, typed: true},
+		"CSV":         {codec: CSV},
+	}
+
+	for name, tc := range codecs {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := tc.codec.Encode(buf, testDocument()); err != nil {
+				t.Fatal(err)
+			}
+			decoded := &testResource{}
+			if err := tc.codec.Decode(buf, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, testDocument()) {
+				t.Errorf("expected %+v, got %+v", testDocument(), decoded)
+			}
+
+			if !tc.typed {
+				return
+			}
+			buf.Reset()
+			if err := tc.codec.Encode(buf, typed); err != nil {
+				t.Fatal(err)
+			}
+			// The numbers are kept exactly as they are in the raw JSON
+			var got json.RawMessage
+			if err := tc.codec.Decode(buf, &got); err != nil {
+				t.Fatal(err)
+			}
+			want, _ := json.Marshal(typed)
+			if !jsonEqual(got, want) {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func jsonEqual(a, b []byte) bool {
+	var x, y interface{}
+	decode := func(data []byte, v *interface{}) {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		dec.Decode(v)
+	}
+	decode(a, &x)
+	decode(b, &y)
+	return reflect.DeepEqual(x, y)
+}
+
+func TestEncode(t *testing.T) {
+	doc := map[string]interface{}{"compact": true, "schema": 0}
+	list := struct {
+		Data []testData     `json:"data"`
+		Meta map[string]int `json:"meta"`
+	}{
+		Data: []testData{
+			{ID: "1", Type: "Payment", Attributes: map[string]interface{}{"amount": "1.00"}},
+			{ID: "2", Type: "Payment", Attributes: map[string]interface{}{"currency": "GBP", "amount": "2.00"}},
+		},
+		Meta: map[string]int{"count": 2},
+	}
+
+	testCases := map[string]struct {
+		codec    Codec
+		v        interface{}
+		expected string
+	}{
+		"MessagePack": {
+			codec: MessagePack, v: doc,
+			expected: "\x82\xa7compact\xc3\xa6schema\x00",
+		},
+		"XML": {
+			codec: XML, v: list,
+			expected: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<document><data type="array">` +
+				`<item><id>1</id><type>Payment</type><attributes><amount>1.00</amount></attributes></item>` +
+				`<item><id>2</id><type>Payment</type><attributes><amount>2.00</amount><currency>GBP</currency></attributes></item>` +
+				`</data><meta><count type="number">2</count></meta></document>` + "\n",
+		},
+		"CSV": {
+			codec: CSV, v: list,
+			expected: "id,type,attributes.amount,attributes.currency\n1,Payment,1.00,\n2,Payment,2.00,GBP\n",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := tc.codec.Encode(buf, tc.v); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tc.expected {
+				t.Errorf("expected\n%s\ngot\n%s", hex.Dump([]byte(tc.expected)), hex.Dump(buf.Bytes()))
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	testCases := map[string]struct {
+		codec Codec
+		body  string
+	}{
+		"XMLNumber":          {codec: XML, body: `<document><n type="number">1e</n></document>`},
+		"XMLType":            {codec: XML, body: `<document><n type="date">2020-01-01</n></document>`},
+		"XMLUnclosed":        {codec: XML, body: `<document><data>`},
+		"MessagePackKey":     {codec: MessagePack, body: "\x81\x01\x02"},
+		"MessagePackShort":   {codec: MessagePack, body: "\x92\x01"},
+		"MessagePackExt":     {codec: MessagePack, body: "\xd4\x01\x00"},
+		"MessagePackDeep":    {codec: MessagePack, body: strings.Repeat("\x91", maxDepth+2)},
+		"MessagePackString":  {codec: MessagePack, body: "\xdb\xff\xff\xff\xffshort"},
+		"CSVFieldsPerRecord": {codec: CSV, body: "id,type\n1\n"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var v interface{}
+			if err := tc.codec.Decode(strings.NewReader(tc.body), &v); err == nil {
+				t.Errorf("expected an error, got %v", v)
+			}
+		})
+	}
+}
+
+func TestDecodeCSV(t *testing.T) {
+	const body = "type,attributes.payment_ids.0,attributes.payment_ids.1,attributes.comment\n" +
+		"BulkApproval,1,2,\n"
+
+	var v interface{}
+	if err := CSV.Decode(strings.NewReader(body), &v); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(v)
+	if expected := `{"data":{"attributes":{"payment_ids":["1","2"]},"type":"BulkApproval"}}`; string(got) != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// CSV is the CSV codec. The rows are the resource objects of the data of
+// the document, or its errors, flattened to the columns of their dotted
+// paths, like attributes.beneficiary_party.name, with the indexes of the
+// arrays for the items. The other members of the document are left out.
+// The values are decoded as strings, the empty cells are left out and a
+// single row is decoded as the data of the document rather than a list.
+var CSV Codec = csvCodec{}
+
+type csvCodec struct{}
+
+// maxIndex bounds the indexes of the arrays in the columns
+const maxIndex = 10000
+
+func (csvCodec) Encode(w io.Writer, v interface{}) error {
+	value, err := valueOf(v)
+	if err != nil {
+		return err
+	}
+
+	var header []string
+	columns := map[string]int{}
+	rows := []map[string]string{}
+	for _, item := range tabulate(value) {
+		row := map[string]string{}
+		flatten("", item, func(path, cell string) {
+			if _, ok := columns[path]; !ok {
+				columns[path] = len(header)
+				header = append(header, path)
+			}
+			row[path] = cell
+		})
+		rows = append(rows, row)
+	}
+	if len(header) == 0 {
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for path, cell := range row {
+			record[columns[path]] = cell
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tabulate returns the items the rows are made of: the data of the
+// document, its errors without data, or the whole document
+func tabulate(value interface{}) []interface{} {
+	if obj, ok := value.(Object); ok {
+		for _, name := range []string{"data", "errors"} {
+			if member, ok := obj.Get(name); ok {
+				if list, ok := member.([]interface{}); ok {
+					return list
+				}
+				return []interface{}{member}
+			}
+		}
+	}
+	return []interface{}{value}
+}
+
+// flatten calls cell with the path and the text of every scalar of the value
+func flatten(path string, value interface{}, cell func(path, text string)) {
+	join := func(name string) string {
+		if path == "" {
+			return name
+		}
+		return path + "." + name
+	}
+
+	switch value := value.(type) {
+	case Object:
+		for _, m := range value {
+			flatten(join(m.Name), m.Value, cell)
+		}
+	case []interface{}:
+		for i, item := range value {
+			flatten(join(strconv.Itoa(i)), item, cell)
+		}
+	case string:
+		cell(path, value)
+	case json.Number:
+		cell(path, value.String())
+	case bool:
+		cell(path, strconv.FormatBool(value))
+	}
+}
+
+func (csvCodec) Decode(r io.Reader, v interface{}) error {
+	defer io.Copy(ioutil.Discard, r)
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return assign(Object{{Name: "data", Value: []interface{}{}}}, v)
+	} else if err != nil {
+		return err
+	}
+
+	rows := []interface{}{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var row interface{} = Object{}
+		for i, path := range header {
+			if record[i] != "" {
+				row = unflatten(row, strings.Split(path, "."), record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 1 {
+		return assign(Object{{Name: "data", Value: rows[0]}}, v)
+	}
+	return assign(Object{{Name: "data", Value: rows}}, v)
+}
+
+// unflatten returns the value with the cell set at the path, the numbers of
+// the path index arrays
+func unflatten(value interface{}, path []string, cell string) interface{} {
+	if len(path) == 0 {
+		return cell
+	}
+
+	if index, err := strconv.Atoi(path[0]); err == nil && index >= 0 && index < maxIndex {
+		list, _ := value.([]interface{})
+		for len(list) <= index {
+			list = append(list, nil)
+		}
+		list[index] = unflatten(list[index], path[1:], cell)
+		return list
+	}
+
+	obj, _ := value.(Object)
+	for i := range obj {
+		if obj[i].Name == path[0] {
+			obj[i].Value = unflatten(obj[i].Value, path[1:], cell)
+			return obj
+		}
+	}
+	return append(obj, Member{Name: path[0], Value: unflatten(nil, path[1:], cell)})
+}
@@ -0,0 +1,306 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// MessagePack is the MessagePack codec. The numbers are encoded as the
+// smallest integers that hold them, or as 64-bit floats if they are not
+// integers. Binary strings are decoded as strings and extensions are not
+// supported.
+var MessagePack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	value, err := valueOf(v)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encodeMsgpack(buf, value); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func encodeMsgpack(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if value {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		return encodeMsgpackNumber(buf, value)
+	case string:
+		writeMsgpackHeader(buf, len(value), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(value)
+	case []interface{}:
+		writeMsgpackHeader(buf, len(value), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range value {
+			if err := encodeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case Object:
+		writeMsgpackHeader(buf, len(value), 0x80, 16, 0, 0xde, 0xdf)
+		for _, m := range value {
+			writeMsgpackHeader(buf, len(m.Name), 0xa0, 32, 0xd9, 0xda, 0xdb)
+			buf.WriteString(m.Name)
+			if err := encodeMsgpack(buf, m.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected %T", value)
+	}
+	return nil
+}
+
+// writeMsgpackHeader writes the length in the fix format if it is below
+// fixMax, or in the 8, 16 or 32-bit format, the formats that are 0 are not
+// used
+func writeMsgpackHeader(buf *bytes.Buffer, n int, fix byte, fixMax int, f8, f16, f32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case f8 != 0 && n <= math.MaxUint8:
+		buf.WriteByte(f8)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(f16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(f32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+func encodeMsgpackNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		switch {
+		case i >= 0 && i <= math.MaxInt8:
+			buf.WriteByte(byte(i))
+		case i < 0 && i >= -32:
+			buf.WriteByte(byte(int8(i)))
+		case i >= 0 && i <= math.MaxUint8:
+			buf.WriteByte(0xcc)
+			buf.WriteByte(byte(i))
+		case i >= 0 && i <= math.MaxUint16:
+			buf.WriteByte(0xcd)
+			binary.Write(buf, binary.BigEndian, uint16(i))
+		case i >= 0 && i <= math.MaxUint32:
+			buf.WriteByte(0xce)
+			binary.Write(buf, binary.BigEndian, uint32(i))
+		case i >= 0:
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, uint64(i))
+		case i >= math.MinInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(int8(i)))
+		case i >= math.MinInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+		return nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, u)
+		return nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(0xcb)
+	binary.Write(buf, binary.BigEndian, f)
+	return nil
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	defer io.Copy(ioutil.Discard, r)
+
+	value, err := decodeMsgpack(bufio.NewReader(r), 0)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	return assign(value, v)
+}
+
+func decodeMsgpack(r *bufio.Reader, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errDepth
+	}
+
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return json.Number(strconv.Itoa(int(b))), nil
+	case b >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(b)))), nil
+	case b&0xf0 == 0x80:
+		return decodeMsgpackMap(r, int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return decodeMsgpackArray(r, int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return readMsgpackString(r, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return readMsgpackSized(r, 1, readMsgpackString)
+	case 0xc5, 0xda:
+		return readMsgpackSized(r, 2, readMsgpackString)
+	case 0xc6, 0xdb:
+		return readMsgpackSized(r, 4, readMsgpackString)
+	case 0xca:
+		var f float32
+		if err := binary.Read(r, binary.BigEndian, &f); err != nil {
+			return nil, err
+		}
+		return msgpackFloat(float64(f), 32)
+	case 0xcb:
+		var f float64
+		if err := binary.Read(r, binary.BigEndian, &f); err != nil {
+			return nil, err
+		}
+		return msgpackFloat(f, 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := readMsgpackUint(r, 1<<(b-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := readMsgpackUint(r, size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend the integer of the size
+		shift := uint(64 - 8*size)
+		return json.Number(strconv.FormatInt(int64(u<<shift)>>shift, 10)), nil
+	case 0xdc:
+		return readMsgpackSized(r, 2, func(r *bufio.Reader, n int) (interface{}, error) { return decodeMsgpackArray(r, n, depth) })
+	case 0xdd:
+		return readMsgpackSized(r, 4, func(r *bufio.Reader, n int) (interface{}, error) { return decodeMsgpackArray(r, n, depth) })
+	case 0xde:
+		return readMsgpackSized(r, 2, func(r *bufio.Reader, n int) (interface{}, error) { return decodeMsgpackMap(r, n, depth) })
+	case 0xdf:
+		return readMsgpackSized(r, 4, func(r *bufio.Reader, n int) (interface{}, error) { return decodeMsgpackMap(r, n, depth) })
+	}
+	return nil, fmt.Errorf("unsupported MessagePack format 0x%02x", b)
+}
+
+func decodeMsgpackArray(r *bufio.Reader, n, depth int) (interface{}, error) {
+	list := []interface{}{}
+	for i := 0; i < n; i++ {
+		item, err := decodeMsgpack(r, depth+1)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func decodeMsgpackMap(r *bufio.Reader, n, depth int) (interface{}, error) {
+	obj := Object{}
+	for i := 0; i < n; i++ {
+		key, err := decodeMsgpack(r, depth+1)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("MessagePack map key %v is not a string", key)
+		}
+		value, err := decodeMsgpack(r, depth+1)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		obj = append(obj, Member{Name: name, Value: value})
+	}
+	return obj, nil
+}
+
+// readMsgpackSized reads the length of the size and then the value of the
+// length
+func readMsgpackSized(r *bufio.Reader, size int, read func(r *bufio.Reader, n int) (interface{}, error)) (interface{}, error) {
+	n, err := readMsgpackUint(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return read(r, int(n))
+}
+
+func readMsgpackUint(r *bufio.Reader, size int) (uint64, error) {
+	var u uint64
+	for i := 0; i < size; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		u = u<<8 | uint64(b)
+	}
+	return u, nil
+}
+
+// readMsgpackString reads the string of the length. The buffer grows with
+// the data read rather than the declared length.
+func readMsgpackString(r *bufio.Reader, n int) (interface{}, error) {
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, r, int64(n)); err != nil {
+		return nil, noEOF(err)
+	}
+	return buf.String(), nil
+}
+
+func msgpackFloat(f float64, bitSize int) (interface{}, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("unsupported MessagePack number %v", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, bitSize)), nil
+}
+
+// noEOF turns the end of the data in the middle of a value into an error
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
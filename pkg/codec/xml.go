@@ -0,0 +1,198 @@
+package codec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// XML is the XML codec. The document is the root element, the members of
+// the objects are elements of their names and the items of the arrays are
+// item elements. The values other than strings and objects are marked with
+// a type attribute: number, boolean, null or array. The members with names
+// that are not XML names are member elements with a name attribute.
+//
+//	<document><data><id>1</id><meta><count type="number">2</count></meta></data></document>
+var XML Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+// xmlName matches the member names that are usable as element names
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	value, err := valueOf(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, "document", value); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func encodeXML(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !xmlName.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "xml") {
+		start.Name.Local = "member"
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "name"}, Value: name})
+	}
+
+	var text, typ string
+	switch value := value.(type) {
+	case nil:
+		typ = "null"
+	case bool:
+		typ, text = "boolean", strconv.FormatBool(value)
+	case json.Number:
+		typ, text = "number", value.String()
+	case string:
+		text = value
+	case []interface{}:
+		typ = "array"
+	case Object:
+		if len(value) == 0 {
+			typ = "object"
+		}
+	default:
+		return fmt.Errorf("unexpected %T", value)
+	}
+	if typ != "" {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "type"}, Value: typ})
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXML(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case Object:
+		for _, m := range value {
+			if err := encodeXML(enc, m.Name, m.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		if text != "" {
+			if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	defer io.Copy(ioutil.Discard, r)
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			value, err := decodeXML(dec, start, 0)
+			if err != nil {
+				return err
+			}
+			return assign(value, v)
+		}
+	}
+}
+
+func decodeXML(dec *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errDepth
+	}
+
+	typ := xmlAttr(start, "type")
+	text := &strings.Builder{}
+	obj, list := Object{}, []interface{}{}
+	children := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			children = true
+			value, err := decodeXML(dec, tok, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if typ == "array" {
+				list = append(list, value)
+				continue
+			}
+			name := tok.Name.Local
+			if n := xmlAttr(tok, "name"); name == "member" && n != "" {
+				name = n
+			}
+			obj = append(obj, Member{Name: name, Value: value})
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			return xmlValue(start.Name.Local, typ, text.String(), obj, list, children)
+		}
+	}
+}
+
+func xmlValue(name, typ, text string, obj Object, list []interface{}, children bool) (interface{}, error) {
+	switch typ {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid boolean %q", name, text)
+		}
+		return b, nil
+	case "number":
+		n := strings.TrimSpace(text)
+		if !jsonNumber.MatchString(n) {
+			return nil, fmt.Errorf("%s: invalid number %q", name, text)
+		}
+		return json.Number(n), nil
+	case "array":
+		return list, nil
+	case "object":
+		return obj, nil
+	case "":
+		if children {
+			return obj, nil
+		}
+		return text, nil
+	}
+	return nil, fmt.Errorf("%s: unknown type %q", name, typ)
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/VMitov/payments/pkg/logging"
+)
+
+// Sources of the settings from the lowest precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// Config layers the settings of a flag set. The defaults of the flags are
+// overridden by the config file, the environment variables and the flags
+// given on the command line, in that order.
+//
+// A setting is named after its flag. The config file nests it by the dashes
+// of the name and the environment variable is the upper case name prefixed
+// like PAYMENTS_RATE_LIMIT_READ. Secrets are read from the file named by the
+// setting with a -file suffix in the config file or a _FILE suffix in the
+// environment.
+type Config struct {
+	// Prefix of the environment variables
+	Prefix string
+	// FileFlag is the name of the flag with the path of the config file
+	FileFlag string
+
+	flags     *flag.FlagSet
+	lookupEnv func(string) (string, bool)
+
+	mu        sync.RWMutex
+	raw       map[string]string
+	sources   map[string]string
+	secrets   map[string]bool
+	explicit  map[string]bool
+	reloaders map[string]func(value string) error
+}
+
+// Setting is the effective value of a setting
+type Setting struct {
+	Name       string
+	Value      string
+	Source     string
+	Reloadable bool
+}
+
+type value struct {
+	value  string
+	source string
+	origin string
+	secret bool
+}
+
+// New returns the configuration of the flag set
+func New(flags *flag.FlagSet, prefix string) *Config {
+	return &Config{
+		Prefix:    prefix,
+		FileFlag:  "config",
+		flags:     flags,
+		lookupEnv: os.LookupEnv,
+		raw:       map[string]string{},
+		sources:   map[string]string{},
+		secrets:   map[string]bool{},
+		explicit:  map[string]bool{},
+		reloaders: map[string]func(string) error{},
+	}
+}
+
+// Errors are the problems of a configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  " + err.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+// Err returns the errors or nil if there are none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Load parses the command line and sets the flags that are not given on it
+// from the environment and the config file. All the invalid settings are
+// reported together.
+func (c *Config) Load(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flags.VisitAll(func(f *flag.Flag) {
+		c.raw[f.Name], c.sources[f.Name] = f.DefValue, SourceDefault
+	})
+	c.flags.Visit(func(f *flag.Flag) {
+		c.raw[f.Name], c.sources[f.Name] = f.Value.String(), SourceFlag
+		c.explicit[f.Name] = true
+	})
+
+	values, errs := c.layers()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := values[name]
+		if err := c.flags.Set(name, v.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s from %s: %v", name, v.origin, err))
+			continue
+		}
+		c.raw[name], c.sources[name], c.secrets[name] = v.value, v.source, v.secret
+	}
+	return errs.Err()
+}
+
+// OnReload makes the setting reloadable by applying its new values. An
+// error keeps the previous value.
+func (c *Config) OnReload(name string, apply func(value string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloaders[name] = apply
+}
+
+// Reload reads the environment and the config file again and applies the
+// changed reloadable settings. The changes of the other settings are logged
+// as they need a restart.
+func (c *Config) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values, errs := c.layers()
+	if len(errs) != 0 {
+		return errs
+	}
+
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if c.explicit[f.Name] {
+			return
+		}
+		v, ok := values[f.Name]
+		if !ok {
+			v = value{value: f.DefValue, source: SourceDefault, origin: "the default"}
+		}
+		if v.value == c.raw[f.Name] {
+			return
+		}
+
+		apply, ok := c.reloaders[f.Name]
+		if !ok {
+			slog.Warn("setting changed, restart to apply it", slog.String("setting", f.Name))
+			return
+		}
+
+		previous := c.raw[f.Name]
+		if err := c.flags.Set(f.Name, v.value); err != nil {
+			errs = append(errs, fmt.Errorf("%s from %s: %v", f.Name, v.origin, err))
+			return
+		}
+		if err := apply(v.value); err != nil {
+			c.flags.Set(f.Name, previous)
+			errs = append(errs, fmt.Errorf("%s from %s: %v", f.Name, v.origin, err))
+			return
+		}
+		c.raw[f.Name], c.sources[f.Name], c.secrets[f.Name] = v.value, v.source, v.secret
+		slog.Info("applied setting", slog.String("setting", f.Name), slog.String("source", v.source))
+	})
+	return errs.Err()
+}
+
+// Watch reloads the configuration on the signals until the context is
+// cancelled
+func (c *Config) Watch(ctx context.Context, signals ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+
+		if err := c.Reload(); err != nil {
+			slog.Error("reloading configuration failed", logging.Error(err))
+		}
+	}
+}
+
+// Source returns where the value of the setting comes from
+func (c *Config) Source(name string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sources[name]
+}
+
+// Settings returns the effective settings by name with the secrets redacted
+func (c *Config) Settings() []Setting {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var settings []Setting
+	c.flags.VisitAll(func(f *flag.Flag) {
+		s := Setting{
+			Name:       f.Name,
+			Value:      Redact(f.Name, f.Value.String()),
+			Source:     c.sources[f.Name],
+			Reloadable: c.reloaders[f.Name] != nil,
+		}
+		if c.secrets[f.Name] && s.Value != "" {
+			s.Value = logging.Redacted
+		}
+		settings = append(settings, s)
+	})
+	return settings
+}
+
+// Effective returns the effective values by name with the secrets redacted
+func (c *Config) Effective() map[string]string {
+	values := map[string]string{}
+	for _, s := range c.Settings() {
+		values[s.Name] = s.Value
+	}
+	return values
+}
+
+// Print writes the effective settings as YAML annotated with their sources
+func (c *Config) Print(w io.Writer) error {
+	for _, s := range c.Settings() {
+		comment := s.Source
+		if s.Reloadable {
+			comment += ", reloadable"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s # %s\n", s.Name, quoteYAML(s.Value), comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layers returns the values of the settings not given on the command line
+// with the environment overriding the config file
+func (c *Config) layers() (map[string]value, Errors) {
+	values := map[string]value{}
+	var errs Errors
+
+	if path := c.file(); path != "" {
+		settings, err := ReadFile(path)
+		if err != nil {
+			return nil, Errors{err}
+		}
+		keys := make([]string, 0, len(settings))
+		for key := range settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name, v, err := c.resolve(key, settings[key], SourceFile, path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !c.explicit[name] {
+				values[name] = v
+			}
+		}
+	}
+
+	c.flags.VisitAll(func(f *flag.Flag) {
+		if c.explicit[f.Name] {
+			return
+		}
+		env := c.envName(f.Name)
+		if path, ok := c.lookupEnv(env + "_FILE"); ok {
+			v, err := readSecret(f.Name, path, SourceEnv, env+"_FILE")
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			values[f.Name] = v
+		}
+		if s, ok := c.lookupEnv(env); ok {
+			values[f.Name] = value{value: s, source: SourceEnv, origin: env}
+		}
+	})
+
+	return values, errs
+}
+
+// resolve finds the flag of the key and reads the value of the secret keys
+// from their files
+func (c *Config) resolve(key, s, source, origin string) (string, value, error) {
+	if c.flags.Lookup(key) != nil {
+		return key, value{value: s, source: source, origin: origin}, nil
+	}
+
+	name := strings.TrimSuffix(key, "-file")
+	if name == key || c.flags.Lookup(name) == nil {
+		return "", value{}, fmt.Errorf("unknown setting %s in %s", key, origin)
+	}
+	v, err := readSecret(name, s, source, origin)
+	return name, v, err
+}
+
+// readSecret reads the value of the setting from the file without its
+// trailing newline
+func readSecret(name, path, source, origin string) (value, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return value{}, fmt.Errorf("reading %s from %s failed: %v", name, origin, err)
+	}
+	return value{
+		value:  strings.TrimRight(string(data), "\r\n"),
+		source: source,
+		origin: path,
+		secret: true,
+	}, nil
+}
+
+// file returns the path of the config file given on the command line, in
+// the environment or by default
+func (c *Config) file() string {
+	f := c.flags.Lookup(c.FileFlag)
+	if f == nil {
+		return ""
+	}
+	if c.explicit[f.Name] {
+		return f.Value.String()
+	}
+	if path, ok := c.lookupEnv(c.envName(f.Name)); ok {
+		return path
+	}
+	return f.DefValue
+}
+
+func (c *Config) envName(name string) string {
+	return c.Prefix + "_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
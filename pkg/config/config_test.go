@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("payments", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.String("config", "", "config file")
+	fs.String("addr", ":8000", "address:port")
+	fs.String("db", "postgres://postgres@localhost:5432/payments", "database")
+	fs.String("log-level", "info", "level of the logs")
+	fs.Int("quota-daily", 0, "daily quota")
+	fs.Duration("ready-timeout", 2*time.Second, "readiness timeout")
+	fs.String("jwt-secret", "", "secret")
+	return fs
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbFile := writeFile(t, dir, "db", "postgres://app:hunter2@db:5432/payments\n")
+	file := writeFile(t, dir, "payments.yaml", fmt.Sprintf(`
+addr: ":9000"
+db-file: %s
+log-level: debug
+quota:
+  daily: 100
+`, dbFile))
+
+	fs := newFlags()
+	c := New(fs, "PAYMENTS")
+	env := map[string]string{
+		"PAYMENTS_CONFIG":      file,
+		"PAYMENTS_QUOTA_DAILY": "200",
+		"PAYMENTS_LOG_LEVEL":   "warn",
+	}
+	c.lookupEnv = func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	if err := c.Load([]string{"-log-level", "error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct{ value, source string }{
+		"addr":          {":9000", SourceFile},
+		"db":            {"postgres://app:hunter2@db:5432/payments", SourceFile},
+		"quota-daily":   {"200", SourceEnv},
+		"log-level":     {"error", SourceFlag},
+		"ready-timeout": {"2s", SourceDefault},
+	}
+	for name, e := range expected {
+		if got := fs.Lookup(name).Value.String(); got != e.value {
+			t.Errorf("expected %s to be %s, got %s", name, e.value, got)
+		}
+		if got := c.Source(name); got != e.source {
+			t.Errorf("expected %s from %s, got %s", name, e.source, got)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := c.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`addr: ":9000" # file`,
+		`db: "[REDACTED]" # file`,
+		`log-level: error # flag`,
+		`ready-timeout: 2s # default`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected %s in\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("expected the secret to be redacted, got\n%s", out.String())
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "payments.toml", `
+ready-timeout = "soon"
+jwt-secret-file = "/missing"
+
+[quota]
+weekly = 5
+`)
+
+	c := New(newFlags(), "PAYMENTS")
+	c.lookupEnv = func(name string) (string, bool) {
+		if name == "PAYMENTS_QUOTA_DAILY" {
+			return "many", true
+		}
+		return "", false
+	}
+
+	err = c.Load([]string{"-config", file})
+	expected := []string{
+		"invalid configuration:",
+		"  reading jwt-secret from " + file + " failed: open /missing: no such file or directory",
+		"  unknown setting quota-weekly in " + file,
+		`  quota-daily from PAYMENTS_QUOTA_DAILY: parse error`,
+		`  ready-timeout from ` + file + `: parse error`,
+	}
+	if err == nil || err.Error() != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%v", strings.Join(expected, "\n"), err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := writeFile(t, dir, "payments.json", `{"log-level": "info", "quota": {"daily": 100}, "addr": ":9000"}`)
+
+	fs := newFlags()
+	c := New(fs, "PAYMENTS")
+	c.lookupEnv = func(string) (string, bool) { return "", false }
+	if err := c.Load([]string{"-config", file}); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied []string
+	c.OnReload("log-level", func(value string) error {
+		if value != "debug" && value != "info" {
+			return fmt.Errorf("unknown level %s", value)
+		}
+		applied = append(applied, "log-level="+value)
+		return nil
+	})
+	c.OnReload("quota-daily", func(value string) error {
+		applied = append(applied, "quota-daily="+value)
+		return nil
+	})
+
+	writeFile(t, dir, "payments.json", `{"log-level": "debug", "addr": ":9001"}`)
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "[log-level=debug quota-daily=0]"; fmt.Sprint(applied) != expected {
+		t.Errorf("expected %s, got %v", expected, applied)
+	}
+	if got := fs.Lookup("quota-daily").Value.String(); got != "0" || c.Source("quota-daily") != SourceDefault {
+		t.Errorf("expected the removed quota to be the default, got %s from %s", got, c.Source("quota-daily"))
+	}
+	if got := fs.Lookup("addr").Value.String(); got != ":9000" {
+		t.Errorf("expected the address to need a restart, got %s", got)
+	}
+
+	writeFile(t, dir, "payments.json", `{"log-level": "verbose"}`)
+	err = c.Reload()
+	if err == nil || !strings.Contains(err.Error(), "log-level from "+file+": unknown level verbose") {
+		t.Errorf("expected the invalid level to fail, got %v", err)
+	}
+	if got := fs.Lookup("log-level").Value.String(); got != "debug" {
+		t.Errorf("expected the previous level to be kept, got %s", got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	testCases := map[string]struct {
+		name, value, expected string
+	}{
+		"URL":              {name: "db", value: "postgres://app:hunter2@db:5432/payments?sslmode=disable", expected: "postgres://app:REDACTED@db:5432/payments?sslmode=disable"},
+		"URLWithoutSecret": {name: "db", value: "postgres://app@db:5432/payments", expected: "postgres://app@db:5432/payments"},
+		"URLParams":        {name: "db", value: "postgres://app@db/payments?sslmode=verify-full&sslpassword=hunter2&sslkey=/keys/app.key&password=hunter2", expected: "postgres://app@db/payments?sslmode=verify-full&sslpassword=REDACTED&sslkey=REDACTED&password=REDACTED"},
+		"KeyValue":         {name: "db", value: "host=db user=app password=hunter2", expected: "host=db user=app password=[REDACTED]"},
+		"KeyValueSSL":      {name: "db", value: "host=db sslkey=/keys/app.key sslpassword=hunter2", expected: "host=db sslkey=[REDACTED] sslpassword=[REDACTED]"},
+		"SecretFlag":       {name: "jwt-secret", value: "hunter2", expected: "[REDACTED]"},
+		"EmptySecret":      {name: "api-key", value: "", expected: ""},
+		"Plain":            {name: "addr", value: ":8000", expected: ":8000"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := Redact(tc.name, tc.value); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
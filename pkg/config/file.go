@@ -0,0 +1,359 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadFile reads the settings of a YAML, JSON or TOML file by its extension.
+// The nested keys are joined by dashes like the names of the flags.
+func ReadFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		settings, err = ParseYAML(data)
+	case ".json":
+		settings, err = ParseJSON(data)
+	case ".toml":
+		settings, err = ParseTOML(data)
+	default:
+		return nil, fmt.Errorf("unknown format of config file %s, expected .yaml, .json or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s failed: %v", path, err)
+	}
+	return settings, nil
+}
+
+// ParseJSON parses the settings of a JSON object
+func ParseJSON(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	settings := map[string]string{}
+	if err := flattenJSON(settings, "", doc); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func flattenJSON(settings map[string]string, prefix string, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if err := flattenJSON(settings, join(prefix, key), nested); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, ok := jsonScalar(item)
+			if !ok {
+				return fmt.Errorf("%s: lists can only hold values", prefix)
+			}
+			items[i] = s
+		}
+		settings[prefix] = strings.Join(items, ",")
+		return nil
+	}
+
+	s, _ := jsonScalar(v)
+	settings[prefix] = s
+	return nil
+}
+
+func jsonScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// ParseYAML parses the settings of a YAML document of nested mappings with
+// values and lists of values. Anchors, multi-line strings and multiple
+// documents are not supported.
+func ParseYAML(data []byte) (map[string]string, error) {
+	settings := map[string]string{}
+
+	type level struct {
+		indent int
+		prefix string
+	}
+	levels := []level{{indent: -1}}
+	list := ""
+	listIndent := -1
+
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		content := strings.TrimRight(stripComment(line), " \t\r")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		indent := len(content) - len(trimmed)
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if list == "" || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item without a key", n)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			if settings[list] == "" {
+				settings[list] = item
+			} else {
+				settings[list] += "," + item
+			}
+			continue
+		}
+		list = ""
+
+		for indent <= levels[len(levels)-1].indent {
+			levels = levels[:len(levels)-1]
+		}
+
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 || (colon+1 < len(trimmed) && trimmed[colon+1] != ' ') {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, err := yamlScalar(strings.TrimSpace(trimmed[:colon]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		key = join(levels[len(levels)-1].prefix, key)
+		rest := strings.TrimSpace(trimmed[colon+1:])
+
+		if rest == "" {
+			// A nested mapping or a list follows
+			levels = append(levels, level{indent: indent, prefix: key})
+			list, listIndent = key, indent
+			settings[key] = ""
+			continue
+		}
+		value, err := yamlScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		settings[key] = value
+	}
+
+	// Keys of nested mappings are not settings themselves
+	for key, value := range settings {
+		if value == "" && hasNested(settings, key) {
+			delete(settings, key)
+		}
+	}
+	return settings, nil
+}
+
+func hasNested(settings map[string]string, key string) bool {
+	for other := range settings {
+		if strings.HasPrefix(other, key+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func yamlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case strings.HasPrefix(s, "["):
+		return inlineList(s, yamlScalar)
+	case strings.HasPrefix(s, "{"):
+		return "", fmt.Errorf("flow mappings are not supported")
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
+
+// ParseTOML parses the settings of a TOML document of tables with values
+// and arrays of values. Inline tables and arrays of tables are not
+// supported.
+func ParseTOML(data []byte) (map[string]string, error) {
+	settings := map[string]string{}
+	table := ""
+
+	for i, line := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table %s", n, line)
+			}
+			key, err := tomlKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			table = key
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, err := tomlKey(line[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		value, err := tomlValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		settings[join(table, key)] = value
+	}
+	return settings, nil
+}
+
+func tomlKey(s string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(s, ".") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, `"`) {
+			unquoted, err := strconv.Unquote(part)
+			if err != nil {
+				return "", fmt.Errorf("invalid key %s", s)
+			}
+			part = unquoted
+		}
+		if part == "" {
+			return "", fmt.Errorf("invalid key %s", s)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "-"), nil
+}
+
+func tomlValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "["):
+		return inlineList(s, tomlValue)
+	case s == "":
+		return "", fmt.Errorf("missing value")
+	}
+	return s, nil
+}
+
+// inlineList joins the values of [a, b] by commas like the flags of lists
+func inlineList(s string, scalar func(string) (string, error)) (string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return "", fmt.Errorf("unterminated list %s", s)
+	}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return "", nil
+	}
+
+	var items []string
+	for _, item := range splitList(inner) {
+		value, err := scalar(strings.TrimSpace(item))
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// splitList splits the items by the commas outside of quotes
+func splitList(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// stripComment removes the comment from the line unless the # is quoted
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// join nests the key in the prefix by a dash like the names of the flags
+func join(prefix, key string) string {
+	key = strings.ToLower(strings.Replace(key, "_", "-", -1))
+	if prefix == "" {
+		return key
+	}
+	return prefix + "-" + key
+}
+
+// quoteYAML quotes the values that would not be read back as they are
+func quoteYAML(s string) string {
+	if s == "" || strings.ContainsAny(s, ":#'\"[]{},&*!|>%@`") || strings.TrimSpace(s) != s || s == "~" || s == "null" {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	expected := map[string]string{
+		"db":              "postgres://app@db:5432/payments",
+		"log-level":       "debug",
+		"rate-limit-read": "100/m:20",
+		"quota-daily":     "500",
+		"watchlists":      "ofac.csv,eu.xml",
+		"tls-cert":        "",
+	}
+
+	testCases := map[string]struct {
+		parse func([]byte) (map[string]string, error)
+		doc   string
+	}{
+		"YAML": {parse: ParseYAML, doc: `
+# settings of the service
+db: "postgres://app@db:5432/payments"
+log_level: debug # overridden in production
+rate-limit:
+  read: 100/m:20
+quota:
+  daily: 500
+watchlists:
+  - ofac.csv
+  - 'eu.xml'
+tls-cert:
+`},
+		"JSON": {parse: ParseJSON, doc: `{
+	"db": "postgres://app@db:5432/payments",
+	"log_level": "debug",
+	"rate-limit": {"read": "100/m:20"},
+	"quota": {"daily": 500},
+	"watchlists": ["ofac.csv", "eu.xml"],
+	"tls-cert": null
+}`},
+		"TOML": {parse: ParseTOML, doc: `
+# settings of the service
+db = "postgres://app@db:5432/payments"
+log_level = 'debug'
+tls-cert = ""
+watchlists = ["ofac.csv", "eu.xml"]
+
+[rate-limit]
+read = "100/m:20"
+
+[quota]
+daily = 500
+`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			settings, err := tc.parse([]byte(tc.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(settings, expected) {
+				t.Errorf("expected %v, got %v", expected, settings)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := map[string]struct {
+		parse    func([]byte) (map[string]string, error)
+		doc      string
+		expected string
+	}{
+		"YAMLNoValue":      {parse: ParseYAML, doc: "db\n", expected: "line 1: expected key: value"},
+		"YAMLTabs":         {parse: ParseYAML, doc: "quota:\n\tdaily: 1\n", expected: "line 2: tabs are not allowed for indentation"},
+		"YAMLOrphanItem":   {parse: ParseYAML, doc: "- a\n", expected: "line 1: list item without a key"},
+		"YAMLFlowMapping":  {parse: ParseYAML, doc: "quota: {daily: 1}\n", expected: "line 1: flow mappings are not supported"},
+		"YAMLUnterminated": {parse: ParseYAML, doc: "db: 'postgres\n", expected: "line 1: unterminated string 'postgres"},
+		"TOMLNoValue":      {parse: ParseTOML, doc: "[quota]\ndaily =\n", expected: "line 2: missing value"},
+		"TOMLTableArray":   {parse: ParseTOML, doc: "[[quota]]\n", expected: "line 1: invalid table [[quota]]"},
+		"JSONSyntax":       {parse: ParseJSON, doc: `{"db": }`, expected: "invalid character '}' looking for beginning of value"},
+		"JSONNestedList":   {parse: ParseJSON, doc: `{"watchlists": [["a"]]}`, expected: "watchlists: lists can only hold values"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.parse([]byte(tc.doc))
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
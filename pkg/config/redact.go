@@ -0,0 +1,62 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/VMitov/payments/pkg/logging"
+)
+
+// secretWords are the words in the names of the settings that hold secrets
+var secretWords = []string{"secret", "password", "token", "key"}
+
+// secretParams are the parameters of the connection strings that hold
+// secrets
+var secretParams = map[string]bool{"password": true, "sslkey": true, "sslpassword": true}
+
+// Redact hides the values of the secret settings and the passwords and the
+// other secret parameters of the URLs and connection strings
+func Redact(name, value string) string {
+	for _, word := range secretWords {
+		if strings.Contains(strings.ToLower(name), word) && value != "" {
+			return logging.Redacted
+		}
+	}
+
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+		redacted := false
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				redacted = true
+			}
+		}
+		// The parameters are rewritten in place to keep their order
+		params := strings.Split(u.RawQuery, "&")
+		for i, p := range params {
+			if key := strings.SplitN(p, "=", 2)[0]; secretParams[key] {
+				params[i] = key + "=REDACTED"
+				redacted = true
+			}
+		}
+		if redacted {
+			u.RawQuery = strings.Join(params, "&")
+			return u.String()
+		}
+		return value
+	}
+
+	// key=value connection strings
+	parts := strings.Fields(value)
+	redacted := false
+	for i, p := range parts {
+		if key := strings.SplitN(p, "=", 2); len(key) == 2 && secretParams[key[0]] {
+			parts[i] = key[0] + "=" + logging.Redacted
+			redacted = true
+		}
+	}
+	if redacted {
+		return strings.Join(parts, " ")
+	}
+	return value
+}
@@ -1,23 +1,128 @@
 package errors
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/VMitov/payments/pkg/links"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/trace"
 	"github.com/go-chi/render"
 )
 
-// ErrResponse error response
+// ErrResponse error response, rendered as a JSON:API document with the
+// error
 type ErrResponse struct {
-	Err            error `json:"-"`
-	HTTPStatusCode int   `json:"-"`
+	Err            error
+	HTTPStatusCode int
 
-	StatusText string `json:"status"`
-	AppCode    int64  `json:"code,omitempty"`
-	ErrorText  string `json:"error,omitempty"`
+	StatusText string
+	AppCode    int64
+	ErrorText  string
+	TraceID    string
+	// Source is the part of the request causing the error, taken from Err
+	// when not set
+	Source *Source
 }
 
 // Render writes json representation of the ErrResponse to http.ResponseWriter
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	render.Status(r, e.HTTPStatusCode)
+	// The clients see the message but the cause is only in the logs
+	if e.HTTPStatusCode >= http.StatusInternalServerError && e.Err != nil {
+		logging.Add(r.Context(), logging.Error(e.Err))
+	}
+	if sc := trace.FromContext(r.Context()).SpanContext(); sc.IsValid() {
+		e.TraceID = sc.TraceID.String()
+	}
+	var sourceErr *SourceError
+	if e.Source == nil && errors.As(e.Err, &sourceErr) {
+		e.Source = &sourceErr.Source
+	}
 	return nil
 }
+
+// Document returns the JSON:API document of the error
+func (e *ErrResponse) Document() *Document {
+	obj := &Object{
+		Status: strconv.Itoa(e.HTTPStatusCode),
+		Title:  e.StatusText,
+		Detail: e.ErrorText,
+		Source: e.Source,
+	}
+	if e.AppCode != 0 {
+		obj.Code = strconv.FormatInt(e.AppCode, 10)
+	}
+	if e.TraceID != "" {
+		obj.Meta = &Meta{TraceID: e.TraceID}
+	}
+	return &Document{Errors: []*Object{obj}, Document: links.NewDocument()}
+}
+
+// MarshalJSON implements json.Marshaler
+func (e *ErrResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Document())
+}
+
+// Document is a JSON:API document of errors
+type Document struct {
+	Errors []*Object `json:"errors"`
+	links.Document
+}
+
+// Object is an error of a document
+type Object struct {
+	Status string  `json:"status"`
+	Code   string  `json:"code,omitempty"`
+	Title  string  `json:"title"`
+	Detail string  `json:"detail,omitempty"`
+	Source *Source `json:"source,omitempty"`
+	Meta   *Meta   `json:"meta,omitempty"`
+}
+
+// Meta is the non-standard information about an error
+type Meta struct {
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// Source is the part of the request causing an error
+type Source struct {
+	// Pointer is the JSON Pointer (RFC 6901) to the member of the document
+	// of the request
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Header    string `json:"header,omitempty"`
+}
+
+// SourceError is an error caused by a part of the request
+type SourceError struct {
+	Source Source
+	Err    error
+}
+
+// Pointer returns the error caused by the member of the document of the
+// request at the JSON Pointer
+func Pointer(pointer string, err error) error {
+	return &SourceError{Source: Source{Pointer: pointer}, Err: err}
+}
+
+// Parameter returns the error caused by the query parameter
+func Parameter(name string, err error) error {
+	return &SourceError{Source: Source{Parameter: name}, Err: err}
+}
+
+// Header returns the error caused by the header of the request
+func Header(name string, err error) error {
+	return &SourceError{Source: Source{Header: name}, Err: err}
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,174 @@
+// Package events streams the changes of the payments to the clients
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Types of the events
+const (
+	PaymentCreated = "payment.created"
+	PaymentUpdated = "payment.updated"
+	PaymentDeleted = "payment.deleted"
+)
+
+// Channel is the postgres channel the events are sent through
+const Channel = "payment_events"
+
+// Event is a change of a payment
+type Event struct {
+	Type      string    `json:"type"`
+	PaymentID string    `json:"payment_id"`
+	Kind      string    `json:"kind,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Time      time.Time `json:"time"`
+
+	Organisation string `json:"-"`
+}
+
+// notification is an event sent through postgres
+type notification struct {
+	Event
+	Organisation string `json:"organisation"`
+}
+
+// Publisher publishes the events
+type Publisher interface {
+	Publish(e Event) error
+}
+
+// bufferSize is how many events a subscriber may fall behind
+const bufferSize = 64
+
+// Broker delivers the events to the subscribers of their organisation
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]string
+	closed      bool
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]string{}}
+}
+
+// Subscribe returns the events of the organisation and the function ending
+// the subscription. The channel is closed when the subscriber falls too
+// far behind, so it does not miss events silently, or the broker closes.
+func (b *Broker) Subscribe(org string) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, bufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = org
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish delivers the event to the subscribers of its organisation
+func (b *Broker) Publish(e Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, org := range b.subscribers {
+		if org != e.Organisation {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// Close ends all the subscriptions
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.closed = true
+}
+
+// Notifier publishes the events to the brokers of all the replicas through
+// postgres
+type Notifier struct {
+	DB *sqlx.DB
+}
+
+// Publish implements Publisher
+func (n Notifier) Publish(e Event) error {
+	payload, err := json.Marshal(notification{Event: e, Organisation: e.Organisation})
+	if err != nil {
+		return err
+	}
+	_, err = n.DB.Exec(`SELECT pg_notify($1, $2)`, Channel, string(payload))
+	return err
+}
+
+// Listen delivers the events sent through postgres to the broker until the
+// context is cancelled
+func Listen(ctx context.Context, dbconn string, b *Broker) {
+	listener := pq.NewListener(dbconn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Warn("events listener", logging.Error(err))
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		slog.Error("listening for events failed", logging.Error(err))
+		return
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			go listener.Ping()
+		case n := <-listener.Notify:
+			// The events sent while reconnecting are lost
+			if n == nil {
+				slog.Warn("events listener reconnected, events may have been missed")
+				continue
+			}
+
+			var e notification
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				slog.Error("decoding event failed", logging.Error(err))
+				continue
+			}
+			e.Event.Organisation = e.Organisation
+			b.Publish(e.Event)
+		}
+	}
+}
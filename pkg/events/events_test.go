@@ -0,0 +1,61 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	mine, cancel := b.Subscribe("org")
+	defer cancel()
+	other, cancelOther := b.Subscribe("other")
+	defer cancelOther()
+
+	b.Publish(Event{Type: PaymentCreated, PaymentID: "1", Organisation: "org"})
+
+	if e := <-mine; e.PaymentID != "1" {
+		t.Errorf("expected the event of the organisation, got %+v", e)
+	}
+	select {
+	case e := <-other:
+		t.Errorf("expected no events of other organisations, got %+v", e)
+	default:
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe("org")
+	defer cancel()
+
+	for i := 0; i <= bufferSize; i++ {
+		b.Publish(Event{Type: PaymentCreated, Organisation: "org"})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != bufferSize {
+		t.Errorf("expected %d events before the subscription ended, got %d", bufferSize, received)
+	}
+}
+
+func TestBrokerClose(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe("org")
+	b.Close()
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Error("expected the subscription to end")
+	}
+	if _, ok := <-mustSubscribe(b); ok {
+		t.Error("expected no subscriptions after closing")
+	}
+}
+
+func mustSubscribe(b *Broker) <-chan Event {
+	ch, _ := b.Subscribe("org")
+	return ch
+}
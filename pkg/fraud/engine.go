@@ -0,0 +1,92 @@
+package fraud
+
+import (
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/payment"
+)
+
+// Engine evaluates payments with the rule set from a file and reloads the
+// rules when the file changes
+type Engine struct {
+	path string
+
+	mu    sync.RWMutex
+	rules *RuleSet
+}
+
+// NewEngine returns an engine with the rules loaded from the file
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Rules returns the rule set in use
+func (e *Engine) Rules() *RuleSet {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.rules
+}
+
+// Reload reads the rules file again and switches to it if it changed.
+// The rules in use are kept when the file is invalid.
+func (e *Engine) Reload() (changed bool, err error) {
+	data, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return false, err
+	}
+
+	rules, err := ParseRuleSet(data)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.rules != nil && e.rules.Checksum == rules.Checksum {
+		return false, nil
+	}
+	e.rules = rules
+	return true, nil
+}
+
+// Watch reloads the rules every interval until the context is cancelled
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := e.Reload()
+		if err != nil {
+			slog.Error("reloading fraud rules failed", logging.Error(err))
+		} else if changed {
+			slog.Info("loaded fraud rules", slog.String("version", e.Rules().Version))
+		}
+	}
+}
+
+// Evaluate runs the rules of the event for the payment
+func (e *Engine) Evaluate(p *payment.Payment, counters Counters, event string, now time.Time) (*Decision, error) {
+	c, err := NewCandidate(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Rules().Evaluate(c, counters, event, now)
+}
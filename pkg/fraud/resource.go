@@ -0,0 +1,86 @@
+package fraud
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the fraud resources
+const (
+	DecisionType = "FraudDecision"
+	ReviewType   = "FraudReview"
+)
+
+// DecisionResourceData is the data of the fraud decision resource
+type DecisionResourceData struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Attributes *StoredDecision `json:"attributes"`
+}
+
+// DecisionListResource is a list of fraud decisions resource
+type DecisionListResource struct {
+	Data []*DecisionResourceData `json:"data"`
+	links.Resource
+}
+
+// NewDecisionListResource returns new fraud decision list resource
+func NewDecisionListResource(decisions []StoredDecision, self string) *DecisionListResource {
+	list := &DecisionListResource{
+		Data:     []*DecisionResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range decisions {
+		list.Data = append(list.Data, &DecisionResourceData{
+			ID:         decisions[i].ID,
+			Type:       DecisionType,
+			Attributes: &decisions[i],
+		})
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *DecisionListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ReviewAttributes are the decision of a reviewer on a held payment. The
+// reviewer is the user that makes the request.
+type ReviewAttributes struct {
+	Outcome string `json:"outcome"`
+	Note    string `json:"note"`
+}
+
+// ReviewResource is the request body of a review
+type ReviewResource struct {
+	Data *struct {
+		Type       string            `json:"type"`
+		Attributes *ReviewAttributes `json:"attributes"`
+	} `json:"data"`
+}
+
+// Bind implements render.Binder
+func (resource *ReviewResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != ReviewType {
+		return fmt.Errorf("wrong type")
+	}
+
+	review := resource.Data.Attributes
+	if review == nil {
+		return fmt.Errorf("no attributes")
+	}
+
+	if review.Outcome != OutcomeAllow && review.Outcome != OutcomeBlock {
+		return fmt.Errorf("outcome must be %s or %s", OutcomeAllow, OutcomeBlock)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package fraud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/shopspring/decimal"
+)
+
+// Outcomes of the rules in increasing severity
+const (
+	OutcomeAllow = "allow"
+	OutcomeHold  = "hold"
+	OutcomeBlock = "block"
+)
+
+var severity = map[string]int{OutcomeAllow: 0, OutcomeHold: 1, OutcomeBlock: 2}
+
+// Events the rules are evaluated on. The rules without events are evaluated
+// on the creation of the payments, their updates and their releases from
+// approval or screening.
+const (
+	EventCreate   = "create"
+	EventUpdate   = "update"
+	EventRelease  = "release"
+	EventRefund   = payment.KindRefund
+	EventReversal = payment.KindReversal
+	EventReview   = "review"
+)
+
+// defaultEvents are the events of the rules without events
+var defaultEvents = []string{EventCreate, EventUpdate, EventRelease}
+
+// Types of rules
+const (
+	// TypeNewBeneficiary matches large amounts to a beneficiary account
+	// first paid within the window
+	TypeNewBeneficiary = "new_beneficiary"
+	// TypeVelocity matches when the payments to or from an account within
+	// the window exceed a count or a total amount
+	TypeVelocity = "velocity"
+	// TypeNearThreshold matches amounts just under a threshold
+	TypeNearThreshold = "near_threshold"
+)
+
+// Accounts counted by the velocity rules
+const (
+	KeyBeneficiary = "beneficiary"
+	KeyDebtor      = "debtor"
+)
+
+// Duration is a time.Duration written as a string such as "1h" in the rules
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Rule produces its outcome for the payments matching it
+type Rule struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Outcome    string   `json:"outcome"`
+	Events     []string `json:"events,omitempty"`
+	Currencies []string `json:"currencies,omitempty"`
+
+	Key        string            `json:"key,omitempty"`
+	Window     Duration          `json:"window,omitempty"`
+	MinAmount  *decimal.Decimal  `json:"min_amount,omitempty"`
+	MaxCount   int               `json:"max_count,omitempty"`
+	MaxAmount  *decimal.Decimal  `json:"max_amount,omitempty"`
+	Thresholds []decimal.Decimal `json:"thresholds,omitempty"`
+	Margin     decimal.Decimal   `json:"margin,omitempty"`
+}
+
+// RuleSet is a versioned set of fraud rules
+type RuleSet struct {
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	Rules    []Rule `json:"rules"`
+}
+
+// ParseRuleSet parses and validates a rule set
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("invalid fraud rules: %v", err)
+	}
+
+	if rs.Version == "" {
+		return nil, fmt.Errorf("invalid fraud rules: missing version")
+	}
+
+	names := map[string]bool{}
+	for i, rule := range rs.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("invalid fraud rules: rule %d needs a name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("invalid fraud rules: duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Outcome != OutcomeHold && rule.Outcome != OutcomeBlock {
+			return nil, fmt.Errorf("invalid fraud rules: rule %s has unknown outcome %q", rule.Name, rule.Outcome)
+		}
+
+		switch rule.Type {
+		case TypeNewBeneficiary:
+			if rule.MinAmount == nil {
+				return nil, fmt.Errorf("invalid fraud rules: rule %s needs a min_amount", rule.Name)
+			}
+		case TypeVelocity:
+			if rule.Key != KeyBeneficiary && rule.Key != KeyDebtor {
+				return nil, fmt.Errorf("invalid fraud rules: rule %s has unknown key %q", rule.Name, rule.Key)
+			}
+			if rule.Window.Duration <= 0 || (rule.MaxCount == 0 && rule.MaxAmount == nil) {
+				return nil, fmt.Errorf("invalid fraud rules: rule %s needs a window and a max_count or max_amount", rule.Name)
+			}
+		case TypeNearThreshold:
+			if len(rule.Thresholds) == 0 || !rule.Margin.IsPositive() {
+				return nil, fmt.Errorf("invalid fraud rules: rule %s needs thresholds and a margin", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("invalid fraud rules: rule %s has unknown type %q", rule.Name, rule.Type)
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	rs.Checksum = hex.EncodeToString(sum[:])
+	return rs, nil
+}
+
+// Candidate is what the rules know about a payment
+type Candidate struct {
+	Amount      decimal.Decimal
+	Currency    string
+	Beneficiary string
+	Debtor      string
+}
+
+// NewCandidate returns the fraud candidate for a payment
+func NewCandidate(p *payment.Payment) (*Candidate, error) {
+	details, err := p.Details()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Candidate{
+		Amount:      details.Amount,
+		Currency:    details.Currency,
+		Beneficiary: details.BeneficiaryAccount,
+		Debtor:      details.DebtorAccount,
+	}, nil
+}
+
+// account returns the account of the candidate counted by the key
+func (c *Candidate) account(key string) string {
+	if key == KeyDebtor {
+		return c.Debtor
+	}
+	return c.Beneficiary
+}
+
+// Counters are the velocity counters of the accounts
+type Counters interface {
+	// Window returns the number and total amount of the payments in the
+	// currency to or from the account since the time
+	Window(key, account, currency string, since time.Time) (count int, total decimal.Decimal, err error)
+	// FirstSeen returns when the account was first paid or nil if never
+	FirstSeen(account string) (*time.Time, error)
+}
+
+// Decision is the outcome of the rules for a payment and why
+type Decision struct {
+	Event   string   `json:"event"`
+	Outcome string   `json:"outcome"`
+	Rules   []string `json:"rules"`
+	Reasons []string `json:"reasons"`
+	Version string   `json:"version"`
+}
+
+// Evaluate runs the rules of the event for the candidate. The most severe
+// outcome of the matching rules wins and the payment is allowed if none match.
+func (rs *RuleSet) Evaluate(c *Candidate, counters Counters, event string, now time.Time) (*Decision, error) {
+	decision := &Decision{
+		Event:   event,
+		Outcome: OutcomeAllow,
+		Rules:   []string{},
+		Reasons: []string{},
+		Version: rs.Version,
+	}
+
+	for _, rule := range rs.Rules {
+		if !rule.applies(c, event) {
+			continue
+		}
+
+		reason, err := rule.match(c, counters, now)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			continue
+		}
+
+		decision.Rules = append(decision.Rules, rule.Name)
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("rule %s (%s): %s", rule.Name, rule.Outcome, reason))
+		if severity[rule.Outcome] > severity[decision.Outcome] {
+			decision.Outcome = rule.Outcome
+		}
+	}
+
+	return decision, nil
+}
+
+// applies reports if the rule is evaluated for the candidate on the event
+func (rule *Rule) applies(c *Candidate, event string) bool {
+	events := rule.Events
+	if len(events) == 0 {
+		events = defaultEvents
+	}
+	if !contains(events, event) {
+		return false
+	}
+
+	return len(rule.Currencies) == 0 || contains(rule.Currencies, c.Currency)
+}
+
+// match returns why the rule matches the candidate or empty if it does not
+func (rule *Rule) match(c *Candidate, counters Counters, now time.Time) (string, error) {
+	switch rule.Type {
+	case TypeNewBeneficiary:
+		if c.Beneficiary == "" || c.Amount.LessThan(*rule.MinAmount) {
+			return "", nil
+		}
+
+		first, err := counters.FirstSeen(c.Beneficiary)
+		if err != nil {
+			return "", err
+		}
+
+		window := rule.Window.Duration
+		if window == 0 {
+			window = 24 * time.Hour
+		}
+		if first != nil && first.Before(now.Add(-window)) {
+			return "", nil
+		}
+		return fmt.Sprintf("%s %s to beneficiary first seen within %s", c.Amount, c.Currency, window), nil
+
+	case TypeVelocity:
+		account := c.account(rule.Key)
+		if account == "" {
+			return "", nil
+		}
+
+		count, total, err := counters.Window(rule.Key, account, c.Currency, now.Add(-rule.Window.Duration))
+		if err != nil {
+			return "", err
+		}
+
+		// The counters hold the earlier payments so the candidate is added
+		count++
+		total = total.Add(c.Amount)
+		if rule.MaxCount != 0 && count > rule.MaxCount {
+			return fmt.Sprintf("%d payments for %s account within %s exceed %d", count, rule.Key, rule.Window.Duration, rule.MaxCount), nil
+		}
+		if rule.MaxAmount != nil && total.GreaterThan(*rule.MaxAmount) {
+			return fmt.Sprintf("%s %s for %s account within %s exceed %s", total, c.Currency, rule.Key, rule.Window.Duration, rule.MaxAmount), nil
+		}
+		return "", nil
+
+	case TypeNearThreshold:
+		for _, threshold := range rule.Thresholds {
+			floor := threshold.Sub(threshold.Mul(rule.Margin))
+			if c.Amount.LessThan(threshold) && !c.Amount.LessThan(floor) {
+				return fmt.Sprintf("amount %s just under threshold %s", c.Amount, threshold), nil
+			}
+		}
+		return "", nil
+	}
+
+	return "", nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package fraud
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type event struct {
+	key, account, currency string
+	amount                 decimal.Decimal
+	at                     time.Time
+}
+
+type memoryCounters []event
+
+func (m memoryCounters) Window(key, account, currency string, since time.Time) (int, decimal.Decimal, error) {
+	count, total := 0, decimal.Zero
+	for _, e := range m {
+		if e.key == key && e.account == account && e.currency == currency && e.at.After(since) {
+			count++
+			total = total.Add(e.amount)
+		}
+	}
+	return count, total, nil
+}
+
+func (m memoryCounters) FirstSeen(account string) (*time.Time, error) {
+	var first *time.Time
+	for i, e := range m {
+		if e.key == KeyBeneficiary && e.account == account && (first == nil || e.at.Before(*first)) {
+			first = &m[i].at
+		}
+	}
+	return first, nil
+}
+
+func TestEvaluate(t *testing.T) {
+	data, err := ioutil.ReadFile("../../rules/fraud.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ParseRuleSet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	amount := decimal.RequireFromString
+	known := event{key: KeyBeneficiary, account: "400300/31926819", currency: "GBP", amount: amount("10"), at: now.AddDate(0, -1, 0)}
+
+	burst := memoryCounters{known}
+	for i := 0; i < 5; i++ {
+		burst = append(burst, event{key: KeyBeneficiary, account: known.account, currency: "GBP", amount: amount("10"), at: now.Add(-time.Duration(i+1) * time.Minute)})
+	}
+
+	testCases := map[string]struct {
+		candidate Candidate
+		counters  memoryCounters
+		event     string
+		outcome   string
+		rules     []string
+	}{
+		"Allow": {
+			candidate: Candidate{Amount: amount("100"), Currency: "GBP", Beneficiary: known.account},
+			counters:  memoryCounters{known},
+			event:     EventCreate,
+			outcome:   OutcomeAllow,
+			rules:     []string{},
+		},
+		"LargeToNewBeneficiary": {
+			candidate: Candidate{Amount: amount("15000"), Currency: "GBP", Beneficiary: "203301/12345678"},
+			counters:  memoryCounters{known},
+			event:     EventCreate,
+			outcome:   OutcomeHold,
+			rules:     []string{"large-to-new-beneficiary"},
+		},
+		"LargeToKnownBeneficiary": {
+			candidate: Candidate{Amount: amount("15000"), Currency: "GBP", Beneficiary: known.account},
+			counters:  memoryCounters{known},
+			event:     EventCreate,
+			outcome:   OutcomeAllow,
+			rules:     []string{},
+		},
+		"ManyPaymentsInAnHour": {
+			candidate: Candidate{Amount: amount("10"), Currency: "GBP", Beneficiary: known.account},
+			counters:  burst,
+			event:     EventCreate,
+			outcome:   OutcomeHold,
+			rules:     []string{"beneficiary-hourly-count"},
+		},
+		"DebtorDailyAmount": {
+			candidate: Candidate{Amount: amount("600000"), Currency: "GBP", Beneficiary: known.account, Debtor: "GB29XABC10161234567801"},
+			counters: memoryCounters{known,
+				{key: KeyDebtor, account: "GB29XABC10161234567801", currency: "GBP", amount: amount("500000"), at: now.Add(-time.Hour)},
+			},
+			event:   EventCreate,
+			outcome: OutcomeBlock,
+			rules:   []string{"debtor-daily-amount"},
+		},
+		"JustUnderThreshold": {
+			candidate: Candidate{Amount: amount("9950"), Currency: "GBP", Beneficiary: known.account},
+			counters:  memoryCounters{known},
+			event:     EventCreate,
+			outcome:   OutcomeHold,
+			rules:     []string{"just-under-approval-threshold"},
+		},
+		"UpdateJustUnderThreshold": {
+			candidate: Candidate{Amount: amount("9950"), Currency: "GBP", Beneficiary: known.account},
+			counters:  memoryCounters{known},
+			event:     EventUpdate,
+			outcome:   OutcomeHold,
+			rules:     []string{"just-under-approval-threshold"},
+		},
+		"ReleaseLargeToNewBeneficiary": {
+			candidate: Candidate{Amount: amount("15000"), Currency: "GBP", Beneficiary: "203301/12345678"},
+			counters:  memoryCounters{known},
+			event:     EventRelease,
+			outcome:   OutcomeHold,
+			rules:     []string{"large-to-new-beneficiary"},
+		},
+		"ReleaseJustUnderThreshold": {
+			candidate: Candidate{Amount: amount("9950"), Currency: "GBP", Beneficiary: known.account},
+			counters:  memoryCounters{known},
+			event:     EventRelease,
+			outcome:   OutcomeAllow,
+			rules:     []string{},
+		},
+		"RefundJustUnderThreshold": {
+			candidate: Candidate{Amount: amount("249000"), Currency: "GBP", Beneficiary: "203301/12345678"},
+			counters:  memoryCounters{known},
+			event:     EventRefund,
+			outcome:   OutcomeHold,
+			rules:     []string{"just-under-approval-threshold"},
+		},
+		"MostSevereWins": {
+			candidate: Candidate{Amount: amount("249000"), Currency: "GBP", Beneficiary: "203301/12345678", Debtor: "GB29XABC10161234567801"},
+			counters: memoryCounters{known,
+				{key: KeyDebtor, account: "GB29XABC10161234567801", currency: "GBP", amount: amount("990000"), at: now.Add(-time.Hour)},
+			},
+			event:   EventCreate,
+			outcome: OutcomeBlock,
+			rules:   []string{"large-to-new-beneficiary", "debtor-daily-amount", "just-under-approval-threshold"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d, err := rules.Evaluate(&tc.candidate, tc.counters, tc.event, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d.Outcome != tc.outcome {
+				t.Errorf("expected %s, got %s: %v", tc.outcome, d.Outcome, d.Reasons)
+			}
+			if !reflect.DeepEqual(d.Rules, tc.rules) {
+				t.Errorf("expected rules %v, got %v", tc.rules, d.Rules)
+			}
+			if len(d.Reasons) != len(d.Rules) {
+				t.Errorf("expected a reason per rule, got %v", d.Reasons)
+			}
+		})
+	}
+}
+
+func TestParseRuleSetInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"NoVersion":      `{"rules": []}`,
+		"UnknownType":    `{"version": "1", "rules": [{"name": "a", "type": "magic", "outcome": "hold"}]}`,
+		"UnknownOutcome": `{"version": "1", "rules": [{"name": "a", "type": "near_threshold", "outcome": "maybe", "thresholds": ["10"], "margin": "0.1"}]}`,
+		"NoWindow":       `{"version": "1", "rules": [{"name": "a", "type": "velocity", "outcome": "hold", "key": "debtor", "max_count": 1}]}`,
+		"BadWindow":      `{"version": "1", "rules": [{"name": "a", "type": "velocity", "outcome": "hold", "key": "debtor", "window": "soon"}]}`,
+	} {
+		if _, err := ParseRuleSet([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
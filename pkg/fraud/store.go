@@ -0,0 +1,226 @@
+package fraud
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// StoredDecision is a decision attached to a payment
+type StoredDecision struct {
+	ID         string         `db:"id"          json:"-"`
+	PaymentID  string         `db:"payment_id"  json:"payment_id"`
+	Event      string         `db:"event"       json:"event"`
+	Outcome    string         `db:"outcome"     json:"outcome"`
+	Rules      pq.StringArray `db:"rules"       json:"rules"`
+	Reasons    pq.StringArray `db:"reasons"     json:"reasons"`
+	Version    string         `db:"version"     json:"version,omitempty"`
+	ReviewedBy string         `db:"reviewed_by" json:"reviewed_by,omitempty"`
+	DecidedAt  time.Time      `db:"decided_at"  json:"decided_at"`
+}
+
+// DBCounters are the velocity counters of an organisation kept in the
+// fraud_events table. The events of the excluded payment are not counted, so
+// a payment that is evaluated again is not counted against itself.
+type DBCounters struct {
+	DB           sqlx.Queryer
+	Organisation string
+	Exclude      string
+}
+
+// Window implements Counters
+func (c DBCounters) Window(key, account, currency string, since time.Time) (int, decimal.Decimal, error) {
+	var row struct {
+		Count int             `db:"count"`
+		Total decimal.Decimal `db:"total"`
+	}
+	query, args := c.exclude(
+		`SELECT count(*) AS count, COALESCE(sum(amount), 0) AS total FROM fraud_events
+		WHERE organisation_id=$1 AND key=$2 AND account=$3 AND currency=$4 AND occurred_at > $5`,
+		c.Organisation, key, account, currency, since,
+	)
+	err := sqlx.Get(c.DB, &row, query, args...)
+	return row.Count, row.Total, err
+}
+
+// FirstSeen implements Counters
+func (c DBCounters) FirstSeen(account string) (*time.Time, error) {
+	var first *time.Time
+	query, args := c.exclude(
+		`SELECT min(occurred_at) FROM fraud_events WHERE organisation_id=$1 AND key=$2 AND account=$3`,
+		c.Organisation, KeyBeneficiary, account,
+	)
+	err := sqlx.Get(c.DB, &first, query, args...)
+	return first, err
+}
+
+// exclude leaves the events of the excluded payment out of the query
+func (c DBCounters) exclude(query string, args ...interface{}) (string, []interface{}) {
+	if c.Exclude == "" {
+		return query, args
+	}
+	return fmt.Sprintf("%s AND payment_id <> $%d", query, len(args)+1), append(args, c.Exclude)
+}
+
+// Apply attaches the decision to the payment of the organisation and holds
+// or rejects the payment according to its outcome. The payments of create
+// events are counted by the velocity counters and the ones of update events
+// are counted again with their new details.
+func Apply(db *sqlx.DB, org, paymentID string, p *payment.Payment, d *Decision, now time.Time) error {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ApplyTx(tx, org, paymentID, p, d, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApplyTx applies the decision to the payment of the organisation within a
+// transaction scoped to it
+func ApplyTx(tx *sqlx.Tx, org, paymentID string, p *payment.Payment, d *Decision, now time.Time) (err error) {
+	if err := save(tx, paymentID, d, ""); err != nil {
+		return err
+	}
+
+	switch d.Outcome {
+	case OutcomeHold:
+		err = payment.SetStatusTx(tx, org, paymentID, payment.StatusHeld)
+	case OutcomeBlock:
+		err = payment.SetStatusTx(tx, org, paymentID, payment.StatusRejected)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch d.Event {
+	case EventCreate:
+		return record(tx, paymentID, p, now)
+	case EventUpdate:
+		if _, err := tx.Exec(tx.Rebind(`DELETE FROM fraud_events WHERE payment_id=?`), paymentID); err != nil {
+			return err
+		}
+		return record(tx, paymentID, p, now)
+	}
+
+	return nil
+}
+
+// Save attaches the decision to the payment of the organisation without
+// changing it
+func Save(db *sqlx.DB, org, paymentID string, d *Decision) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return save(tx, paymentID, d, "")
+	})
+}
+
+// ErrMissingReviewer is returned when a review has no reviewer
+var ErrMissingReviewer = errors.New("reviewer is required")
+
+// Review releases or rejects a held payment of the organisation and records
+// the decision of the reviewer
+func Review(db *sqlx.DB, org, paymentID, outcome, reviewer, note string) error {
+	if reviewer == "" {
+		return ErrMissingReviewer
+	}
+
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if outcome == OutcomeBlock {
+		err = payment.SetStatusTx(tx, org, paymentID, payment.StatusRejected)
+	} else {
+		err = payment.ReleaseTx(tx, org, paymentID, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	d := &Decision{Event: EventReview, Outcome: outcome, Rules: []string{}, Reasons: []string{}}
+	if note != "" {
+		d.Reasons = append(d.Reasons, note)
+	}
+	if err := save(tx, paymentID, d, reviewer); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PendingHold reports if the latest decision of the payment of the
+// organisation holds it
+func PendingHold(db *sqlx.DB, org, paymentID string) (bool, error) {
+	var outcome string
+	err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&outcome,
+			`SELECT d.outcome FROM fraud_decisions d JOIN payments p ON p.id=d.payment_id
+			WHERE d.payment_id=$1 AND p.organisation_id=$2 ORDER BY d.decided_at DESC LIMIT 1`, paymentID, org,
+		)
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return outcome == OutcomeHold, err
+}
+
+// SelectDecisions gets the decisions attached to a payment of the organisation
+func SelectDecisions(db *sqlx.DB, org, paymentID string) ([]StoredDecision, error) {
+	decisions := []StoredDecision{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&decisions,
+			`SELECT d.* FROM fraud_decisions d JOIN payments p ON p.id=d.payment_id
+			WHERE d.payment_id=$1 AND p.organisation_id=$2 ORDER BY d.decided_at`, paymentID, org,
+		)
+	}); err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+func save(db sqlx.Execer, paymentID string, d *Decision, reviewer string) error {
+	_, err := db.Exec(
+		`INSERT INTO fraud_decisions (payment_id, event, outcome, rules, reasons, version, reviewed_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		paymentID, d.Event, d.Outcome, pq.StringArray(d.Rules), pq.StringArray(d.Reasons), d.Version, reviewer,
+	)
+	return err
+}
+
+func record(tx *sqlx.Tx, paymentID string, p *payment.Payment, now time.Time) error {
+	c, err := NewCandidate(p)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{KeyBeneficiary, KeyDebtor} {
+		account := c.account(key)
+		if account == "" {
+			continue
+		}
+
+		if _, err := tx.Exec(tx.Rebind(
+			`INSERT INTO fraud_events (organisation_id, payment_id, key, account, currency, amount, occurred_at)
+			SELECT organisation_id, id, ?, ?, ?, ?, ? FROM payments WHERE id=?`),
+			key, account, c.Currency, c.Amount, now, paymentID,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
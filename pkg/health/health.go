@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Statuses of the checks and of the report
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// ErrTimeout is the error of a check that did not finish in time
+var ErrTimeout = errors.New("check timed out")
+
+// Check is a check of a dependency of the service
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the outcome of all the checks
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// OK reports if all the checks passed
+func (r *Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the checks and caches their report so frequent probes do
+// not load the dependencies
+type Checker struct {
+	// TTL is how long a report is reused
+	TTL time.Duration
+
+	mu     sync.Mutex
+	checks []Check
+	report *Report
+	// running is closed when the running checks finish
+	running chan struct{}
+
+	now func() time.Time
+}
+
+// NewChecker returns a checker reusing its reports for the ttl
+func NewChecker(ttl time.Duration) *Checker {
+	return &Checker{TTL: ttl, now: time.Now}
+}
+
+// Add adds a check failing if it does not finish within the timeout
+func (c *Checker) Add(name string, timeout time.Duration, run func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, Check{Name: name, Timeout: timeout, Run: run})
+	c.report = nil
+}
+
+// Check returns the cached report or runs the checks. Concurrent callers
+// wait for the same run.
+func (c *Checker) Check(ctx context.Context) *Report {
+	c.mu.Lock()
+	if c.report != nil && c.now().Sub(c.report.CheckedAt) < c.TTL {
+		report := c.report
+		c.mu.Unlock()
+		return report
+	}
+
+	running := c.running
+	if running == nil {
+		running = make(chan struct{})
+		c.running = running
+		checks := append([]Check{}, c.checks...)
+		go c.run(checks, running)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		return &Report{Status: StatusFailing, CheckedAt: c.now(), Checks: []Result{}}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.report
+}
+
+func (c *Checker) run(checks []Check, running chan struct{}) {
+	report := &Report{Status: StatusOK, CheckedAt: c.now(), Checks: make([]Result, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = runCheck(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	c.mu.Lock()
+	c.report = report
+	c.running = nil
+	c.mu.Unlock()
+	close(running)
+}
+
+// runCheck runs the check and gives up on it after its timeout even if it
+// ignores the context
+func runCheck(check Check) Result {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), check.Timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	res := Result{
+		Name:       check.Name,
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	var runs int32
+
+	c := NewChecker(5 * time.Second)
+	c.now = func() time.Time { return now }
+	c.Add("database", time.Second, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	report := c.Check(context.Background())
+	if !report.OK() || len(report.Checks) != 1 || report.Checks[0].Status != StatusOK {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	now = now.Add(4 * time.Second)
+	c.Check(context.Background())
+	if runs != 1 {
+		t.Errorf("expected the cached report, got %d runs", runs)
+	}
+
+	now = now.Add(time.Second)
+	c.Check(context.Background())
+	if runs != 2 {
+		t.Errorf("expected the checks to run again, got %d runs", runs)
+	}
+}
+
+func TestCheckFailing(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	c := NewChecker(0)
+	c.Add("database", time.Second, func(ctx context.Context) error { return nil })
+	c.Add("migrations", time.Second, func(ctx context.Context) error { return errors.New("version 3 is not applied") })
+	c.Add("stuck", 10*time.Millisecond, func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+
+	report := c.Check(context.Background())
+	if report.OK() {
+		t.Fatalf("expected a failing report, got %+v", report)
+	}
+
+	expected := map[string]string{"database": "", "migrations": "version 3 is not applied", "stuck": ErrTimeout.Error()}
+	for _, res := range report.Checks {
+		if res.Error != expected[res.Name] {
+			t.Errorf("expected %s to fail with %q, got %q", res.Name, expected[res.Name], res.Error)
+		}
+	}
+}
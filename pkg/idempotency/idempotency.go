@@ -0,0 +1,122 @@
+// Package idempotency stores the responses of the requests with an
+// idempotency key so their retries are answered without repeating them
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// Header is the header of the idempotency key of a request
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks the responses repeated for a retry
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength is the longest key accepted
+const MaxKeyLength = 255
+
+var (
+	// ErrInProgress is returned for a retry of a request still being
+	// processed
+	ErrInProgress = errors.New("a request with the Idempotency-Key is still being processed")
+	// ErrReused is returned for a different request with the key of
+	// another one
+	ErrReused = errors.New("the Idempotency-Key was used for a different request")
+)
+
+// Response is the response stored under a key
+type Response struct {
+	Hash        string `db:"request_hash"`
+	Status      *int   `db:"status"`
+	ContentType string `db:"content_type"`
+	Location    string `db:"location"`
+	ETag        string `db:"etag"`
+	Body        []byte `db:"body"`
+}
+
+// Replayable returns the error of replaying the response for the request
+// with the hash or nil if it can be replayed
+func (r *Response) Replayable(hash string) error {
+	switch {
+	case r.Hash != hash:
+		return ErrReused
+	case r.Status == nil:
+		return ErrInProgress
+	}
+	return nil
+}
+
+// Hash identifies the request by its method, path and body
+func Hash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims the key of the organisation for the request with the hash.
+// The key of the same request still being processed is taken over if it was
+// claimed before expired, as the request claiming it is assumed dead. It
+// returns nil if the key is claimed and the response stored under it
+// otherwise.
+func Begin(db *sqlx.DB, org, key, hash string, expired time.Time) (*Response, error) {
+	var stored *Response
+	err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(tx.Rebind(
+			`INSERT INTO idempotency_keys (organisation_id, key, request_hash) VALUES (?, ?, ?)
+			ON CONFLICT (organisation_id, key) DO UPDATE SET updated_at=now()
+			WHERE idempotency_keys.status IS NULL AND idempotency_keys.request_hash=EXCLUDED.request_hash
+			AND idempotency_keys.updated_at < ?`), org, key, hash, expired)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return err
+		}
+
+		stored = &Response{}
+		return tx.Get(stored, tx.Rebind(
+			`SELECT request_hash, status, content_type, location, etag, body FROM idempotency_keys WHERE organisation_id=? AND key=?`),
+			org, key)
+	})
+	return stored, err
+}
+
+// Complete stores the response of the request of the key
+func Complete(db *sqlx.DB, org, key string, res *Response) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(tx.Rebind(
+			`UPDATE idempotency_keys SET status=?, content_type=?, location=?, etag=?, body=?, updated_at=now()
+			WHERE organisation_id=? AND key=?`),
+			res.Status, res.ContentType, res.Location, res.ETag, res.Body, org, key)
+		return err
+	})
+}
+
+// Release forgets the key so the request can be retried
+func Release(db *sqlx.DB, org, key string) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(tx.Rebind(`DELETE FROM idempotency_keys WHERE organisation_id=? AND key=?`), org, key)
+		return err
+	})
+}
+
+// Prune deletes the keys of all the organisations claimed before the time
+func Prune(db *sqlx.DB, before time.Time) (int64, error) {
+	var deleted int64
+	err := tenant.Scoped(db, tenant.System, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
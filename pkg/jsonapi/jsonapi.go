@@ -0,0 +1,202 @@
+// Package jsonapi negotiates and encodes the JSON:API documents of the
+// requests and the responses, as JSON or as the XML, CSV and MessagePack
+// representations of the documents
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/VMitov/payments/pkg/codec"
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+)
+
+// MediaType is the media type of the JSON:API documents
+const MediaType = "application/vnd.api+json"
+
+// ErrUnsupportedMediaType is returned for the request bodies of a media type
+// none of the formats has
+var ErrUnsupportedMediaType = stderrors.New("unsupported media type")
+
+// supported reports if the parameters of the JSON:API media type are
+// supported. No extensions are supported and the profiles are ignored.
+func supported(params map[string]string) bool {
+	for name := range params {
+		if name != "profile" {
+			return false
+		}
+	}
+	return true
+}
+
+// SupportedContentType reports if the Content-Type of the request is
+// supported, the JSON:API media type with no parameters but profile
+func SupportedContentType(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != MediaType {
+		return true
+	}
+	return supported(params)
+}
+
+// Format is a representation of the documents, chosen by the extension of
+// the URL or by the Accept header
+type Format struct {
+	// Extension is the extension of the URLs of the format, like xml
+	Extension string
+	MediaType string
+	codec.Codec
+}
+
+// Formats are the representations of the documents, the first is the default
+var Formats = []*Format{
+	{Extension: "json", MediaType: MediaType, Codec: codec.JSON},
+	{Extension: "xml", MediaType: "application/xml", Codec: codec.XML},
+	{Extension: "csv", MediaType: "text/csv", Codec: codec.CSV},
+	{Extension: "msgpack", MediaType: "application/msgpack", Codec: codec.MessagePack},
+}
+
+// aliases are the other media types of the formats
+var aliases = map[string]string{
+	"application/json":      MediaType,
+	"text/xml":              "application/xml",
+	"application/x-msgpack": "application/msgpack",
+}
+
+// formatOf returns the format of the media type or the extension, nil if
+// there is none
+func formatOf(mediaType, extension string) *Format {
+	if alias, ok := aliases[mediaType]; ok {
+		mediaType = alias
+	}
+	for _, f := range Formats {
+		if (mediaType != "" && f.MediaType == mediaType) || (extension != "" && f.Extension == extension) {
+			return f
+		}
+	}
+	return nil
+}
+
+// extension returns the extension of the URL of the request taken by
+// middleware.URLFormat
+func extension(r *http.Request) string {
+	ext, _ := r.Context().Value(middleware.URLFormatCtxKey).(string)
+	return ext
+}
+
+// ErrNotAcceptable is returned for the requests accepting none of the
+// formats
+var ErrNotAcceptable = stderrors.New("not acceptable")
+
+// Negotiate returns the format of the response to the request, the format
+// of the extension of the URL or else the one Accept prefers. The requests
+// accepting none of the formats get JSON:API unless they accept only
+// JSON:API with parameters other than profile.
+func Negotiate(r *http.Request) (*Format, error) {
+	if ext := extension(r); ext != "" {
+		if f := formatOf("", ext); f != nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("%w: no format of the extension %q", ErrNotAcceptable, ext)
+	}
+
+	var best *Format
+	bestQ, refused := 0.0, false
+	for _, field := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(field))
+		if err != nil {
+			continue
+		}
+
+		// The weight belongs to the Accept header, not to the media type
+		q := 1.0
+		if weight, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(weight, 64); err != nil {
+				continue
+			}
+			delete(params, "q")
+		}
+
+		var f *Format
+		switch mediaType {
+		case "*/*", "application/*":
+			f = Formats[0]
+		case MediaType:
+			if !supported(params) {
+				refused = true
+				continue
+			}
+			f = Formats[0]
+		default:
+			f = formatOf(mediaType, "")
+		}
+		if f != nil && q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+
+	if best == nil && refused {
+		return nil, errors.Header("Accept", fmt.Errorf("%w: %s is accepted only with parameters that are not supported", ErrNotAcceptable, MediaType))
+	} else if best == nil {
+		return Formats[0], nil
+	}
+	return best, nil
+}
+
+// Respond writes the value as a document of the negotiated format, it
+// replaces render.Respond. The documents of the requests that fail the
+// negotiation are JSON:API.
+func Respond(w http.ResponseWriter, r *http.Request, v interface{}) {
+	format, err := Negotiate(r)
+	if err != nil {
+		format = Formats[0]
+	}
+
+	buf := &bytes.Buffer{}
+	if err := format.Encode(buf, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.MediaType)
+	w.Header().Add("Vary", "Accept")
+	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
+		w.WriteHeader(status)
+	}
+	w.Write(buf.Bytes())
+}
+
+// Decode decodes the document of the request in the format of its
+// Content-Type, it replaces render.Decode. The bodies of the requests
+// without Content-Type are in the format of the extension of the URL, or
+// JSON:API.
+func Decode(r *http.Request, v interface{}) error {
+	format := Formats[0]
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			format = formatOf(mediaType, "")
+		}
+		if err != nil || format == nil {
+			return errors.Header("Content-Type", fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType))
+		}
+	} else if f := formatOf("", extension(r)); f != nil {
+		format = f
+	}
+
+	err := format.Decode(r.Body, v)
+	// The members of the wrong type are pointed at
+	var typeErr *json.UnmarshalTypeError
+	if stderrors.As(err, &typeErr) && typeErr.Field != "" {
+		return errors.Pointer("/"+strings.Replace(typeErr.Field, ".", "/", -1), err)
+	}
+	return err
+}
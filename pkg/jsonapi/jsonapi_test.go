@@ -0,0 +1,123 @@
+package jsonapi
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VMitov/payments/pkg/errors"
+	"github.com/go-chi/chi/middleware"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := map[string]struct {
+		accept, extension string
+		expected          string
+	}{
+		"None":                 {expected: MediaType},
+		"Any":                  {accept: "*/*", expected: MediaType},
+		"JSON":                 {accept: "application/json", expected: MediaType},
+		"JSON:API":             {accept: MediaType, expected: MediaType},
+		"Weight":               {accept: MediaType + "; q=0.5", expected: MediaType},
+		"Profile":              {accept: MediaType + `; profile="a b"`, expected: MediaType},
+		"Extension":            {accept: MediaType + `; ext="a"`},
+		"Charset":              {accept: MediaType + "; charset=utf-8"},
+		"OneWithout":           {accept: MediaType + `; ext="a", ` + MediaType, expected: MediaType},
+		"OnlyUnsupported":      {accept: MediaType + `; ext="a", text/html`},
+		"Unknown":              {accept: "text/html", expected: MediaType},
+		"XML":                  {accept: "application/xml", expected: "application/xml"},
+		"TextXML":              {accept: "text/xml", expected: "application/xml"},
+		"CSV":                  {accept: "text/csv", expected: "text/csv"},
+		"MessagePack":          {accept: "application/x-msgpack", expected: "application/msgpack"},
+		"Preferred":            {accept: "application/xml; q=0.5, text/csv; q=0.9, */*; q=0.1", expected: "text/csv"},
+		"ExtensionOverWeights": {accept: MediaType, extension: "msgpack", expected: "application/msgpack"},
+		"ExtensionUnknown":     {extension: "html"},
+		"ExtensionJSON":        {accept: "text/csv", extension: "json", expected: MediaType},
+		"ExtensionDespiteExt":  {accept: MediaType + `; ext="a"`, extension: "xml", expected: "application/xml"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", test.accept)
+			r = r.WithContext(context.WithValue(r.Context(), middleware.URLFormatCtxKey, test.extension))
+
+			format, err := Negotiate(r)
+			if test.expected == "" {
+				if !stderrors.Is(err, ErrNotAcceptable) {
+					t.Errorf("expected not acceptable, got %v, %v", format, err)
+				}
+			} else if err != nil || format.MediaType != test.expected {
+				t.Errorf("expected %s, got %v, %v", test.expected, format, err)
+			}
+		})
+	}
+}
+
+func TestSupportedContentType(t *testing.T) {
+	tests := map[string]bool{
+		"":                            true,
+		"application/json":            true,
+		MediaType:                     true,
+		MediaType + `; profile="a"`:   true,
+		MediaType + `; ext="a"`:       false,
+		MediaType + "; charset=utf-8": false,
+	}
+	for contentType, expected := range tests {
+		if got := SupportedContentType(contentType); got != expected {
+			t.Errorf("%q: expected %t, got %t", contentType, expected, got)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		contentType string
+		body        string
+		source      errors.Source
+		unsupported bool
+	}{
+		"JSON:API":      {contentType: MediaType, body: `{"data":{"id":"1"}}`},
+		"JSON":          {contentType: "application/json", body: `{"data":{"id":"1"}}`},
+		"NoContentType": {body: `{"data":{"id":"1"}}`},
+		"XML":           {contentType: "application/xml", body: `<document><data><id>1</id></data></document>`},
+		"CSV":           {contentType: "text/csv", body: "id\n1\n"},
+		"TextPlain": {
+			contentType: "text/plain", body: `{"data":{"id":"1"}}`,
+			source: errors.Source{Header: "Content-Type"}, unsupported: true,
+		},
+		"WrongType": {
+			contentType: MediaType, body: `{"data":{"id":1}}`,
+			source: errors.Source{Pointer: "/data/id"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+			if test.contentType != "" {
+				r.Header.Set("Content-Type", test.contentType)
+			}
+
+			var v struct {
+				Data struct {
+					ID string `json:"id"`
+				} `json:"data"`
+			}
+			err := Decode(r, &v)
+
+			var sourceErr *errors.SourceError
+			if test.source == (errors.Source{}) {
+				if err != nil || v.Data.ID != "1" {
+					t.Errorf("expected the document, got %+v, %v", v, err)
+				}
+			} else if !stderrors.As(err, &sourceErr) || sourceErr.Source != test.source {
+				t.Errorf("expected an error of %+v, got %v", test.source, err)
+			}
+			if got := stderrors.Is(err, ErrUnsupportedMediaType); got != test.unsupported {
+				t.Errorf("expected unsupported %t, got %v", test.unsupported, err)
+			}
+		})
+	}
+}
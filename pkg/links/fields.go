@@ -0,0 +1,154 @@
+package links
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Fieldset is the sparse fieldset of a type, the names of the attributes and
+// the relationships its resource objects are limited to. Dotted names
+// select members of the objects of the attributes, like
+// beneficiary_party.name.
+type Fieldset []string
+
+var (
+	fieldName     = regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+	fieldsetParam = regexp.MustCompile(`^fields\[([^\]]+)\]$`)
+)
+
+// ParseFieldset parses the comma separated names of the fields[TYPE]
+// parameter
+func ParseFieldset(s string) (Fieldset, error) {
+	fields := Fieldset{}
+	if s == "" {
+		return fields, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		if !fieldName.MatchString(name) {
+			return nil, fmt.Errorf("invalid field %q", name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// Fieldsets are the sparse fieldsets by type, a type without one has all
+// its fields
+type Fieldsets map[string]Fieldset
+
+// FieldsetType returns the type of the fields[TYPE] query parameter
+func FieldsetType(param string) (string, bool) {
+	m := fieldsetParam.FindStringSubmatch(param)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Has reports if the fieldset has the attribute or the relationship
+func (f Fieldset) Has(name string) bool {
+	if f == nil {
+		return true
+	}
+	for _, field := range f {
+		if field == name || strings.HasPrefix(field, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Top returns the top-level names of the attributes of the fieldset
+func (f Fieldset) Top() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, field := range f {
+		name := strings.SplitN(field, ".", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Attributes returns the attributes limited to the fieldset. The members
+// missing from the attributes are left out.
+func (f Fieldset) Attributes(attributes json.RawMessage) (json.RawMessage, error) {
+	if f == nil || len(attributes) == 0 || string(attributes) == "null" {
+		return attributes, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(attributes, &values); err != nil {
+		return nil, err
+	}
+
+	projected := map[string]interface{}{}
+	for _, field := range f {
+		project(projected, values, strings.Split(field, "."))
+	}
+	return json.Marshal(projected)
+}
+
+// project copies the member at the path from the values to the projection
+func project(projected, values map[string]interface{}, path []string) {
+	value, ok := values[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		projected[path[0]] = value
+		return
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	next, ok := projected[path[0]].(map[string]interface{})
+	if !ok {
+		next = map[string]interface{}{}
+		projected[path[0]] = next
+	}
+	project(next, object, path[1:])
+	if len(next) == 0 {
+		delete(projected, path[0])
+	}
+}
+
+// Object is a resource object of any type
+type Object struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Attributes    json.RawMessage `json:"attributes,omitempty"`
+	Relationships Relationships   `json:"relationships,omitempty"`
+	Meta          json.RawMessage `json:"meta,omitempty"`
+	Links         *Links          `json:"links,omitempty"`
+}
+
+// Object returns the resource object limited to the fieldset
+func (f Fieldset) Object(data interface{}) (*Object, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(encoded, obj); err != nil {
+		return nil, err
+	}
+
+	if obj.Attributes, err = f.Attributes(obj.Attributes); err != nil {
+		return nil, err
+	}
+	for name := range obj.Relationships {
+		if !f.Has(name) {
+			delete(obj.Relationships, name)
+		}
+	}
+	return obj, nil
+}
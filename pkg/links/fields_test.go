@@ -0,0 +1,91 @@
+package links
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFieldsetAttributes(t *testing.T) {
+	const attributes = `{"amount":"100.21","currency":"GBP","beneficiary_party":{"name":"W Owens","account_number":"31926819"}}`
+
+	testCases := map[string]struct {
+		fields   string
+		expected string
+	}{
+		"Top":     {fields: "amount,currency", expected: `{"amount":"100.21","currency":"GBP"}`},
+		"Nested":  {fields: "amount,beneficiary_party.name", expected: `{"amount":"100.21","beneficiary_party":{"name":"W Owens"}}`},
+		"Object":  {fields: "beneficiary_party", expected: `{"beneficiary_party":{"account_number":"31926819","name":"W Owens"}}`},
+		"Missing": {fields: "amount,reference,currency.code,debtor_party.name", expected: `{"amount":"100.21"}`},
+		"None":    {fields: "", expected: `{}`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fields, err := ParseFieldset(tc.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			projected, err := fields.Attributes(json.RawMessage(attributes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(projected) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, projected)
+			}
+		})
+	}
+
+	if projected, _ := Fieldset(nil).Attributes(json.RawMessage(attributes)); string(projected) != attributes {
+		t.Errorf("expected all the attributes without a fieldset, got %s", projected)
+	}
+}
+
+func TestParseFieldset(t *testing.T) {
+	for _, s := range []string{"amount,", "amount,,currency", "beneficiary_party.", "amount currency"} {
+		if _, err := ParseFieldset(s); err == nil {
+			t.Errorf("expected %q to fail", s)
+		}
+	}
+
+	fields, err := ParseFieldset("currency,beneficiary_party.name,amount,beneficiary_party.account_number")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top := fields.Top(); !reflect.DeepEqual(top, []string{"amount", "beneficiary_party", "currency"}) {
+		t.Errorf("expected the top-level names, got %v", top)
+	}
+	if !fields.Has("beneficiary_party") || fields.Has("beneficiary") || fields.Has("refunds") {
+		t.Errorf("expected only the names of the fieldset, got %v", fields)
+	}
+
+	if typ, ok := FieldsetType("fields[Payment]"); !ok || typ != "Payment" {
+		t.Errorf("expected Payment, got %q", typ)
+	}
+	if _, ok := FieldsetType("page[size]"); ok {
+		t.Error("expected page[size] not to be a fieldset")
+	}
+}
+
+func TestFieldsetObject(t *testing.T) {
+	data := map[string]interface{}{
+		"id":         "1",
+		"type":       "Payment",
+		"attributes": map[string]string{"amount": "100.21", "currency": "GBP"},
+		"relationships": Relationships{
+			"refunds":  Related("/payments/1/refunds", nil),
+			"original": Related("/payments/2", &Identifier{Type: "Payment", ID: "2"}),
+		},
+	}
+
+	obj, err := Fieldset{"amount", "refunds"}.Object(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(obj.Attributes) != `{"amount":"100.21"}` {
+		t.Errorf("expected the amount, got %s", obj.Attributes)
+	}
+	if _, ok := obj.Relationships["refunds"]; !ok || len(obj.Relationships) != 1 {
+		t.Errorf("expected only the refunds, got %v", obj.Relationships)
+	}
+}
@@ -1,11 +1,66 @@
 package links
 
+import "errors"
+
+// ErrType is returned for the resource objects of a type the endpoint does
+// not take
+var ErrType = errors.New("wrong type")
+
 // Links contains links related to the resource
 type Links struct {
 	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
 }
 
 // Resource is a resource with links
 type Resource struct {
 	Links Links `json:"links"`
 }
+
+// RelationshipLinks contains the links of a relationship
+type RelationshipLinks struct {
+	Self    string `json:"self,omitempty"`
+	Related string `json:"related,omitempty"`
+}
+
+// Identifier identifies a related resource
+type Identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Relationship is a relationship of a resource to other resources
+type Relationship struct {
+	Links *RelationshipLinks `json:"links,omitempty"`
+	Data  interface{}        `json:"data,omitempty"`
+}
+
+// Relationships maps relationship names to relationships
+type Relationships map[string]*Relationship
+
+// Related returns the relationship linking the related resources at the URL
+func Related(url string, data interface{}) *Relationship {
+	return &Relationship{Links: &RelationshipLinks{Related: url}, Data: data}
+}
+
+// Version is the version of JSON:API the documents follow
+const Version = "1.1"
+
+// JSONAPI describes the implementation of JSON:API serving the document
+type JSONAPI struct {
+	Version string `json:"version"`
+}
+
+// Document holds the top-level members of a document besides its data or
+// errors
+type Document struct {
+	// Included are the resource objects related to the data
+	Included []interface{}          `json:"included,omitempty"`
+	JSONAPI  *JSONAPI               `json:"jsonapi,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+// NewDocument returns the top-level members of a document of the version
+func NewDocument() Document {
+	return Document{JSONAPI: &JSONAPI{Version: Version}}
+}
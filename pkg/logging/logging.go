@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted replaces the values of the sensitive fields
+const Redacted = "[REDACTED]"
+
+// sensitive are the keys of the values never written to the logs. They
+// cover the credentials and the parties of the payment attributes.
+var sensitive = map[string]bool{
+	"authorization":  true,
+	"x-api-key":      true,
+	"api_key":        true,
+	"password":       true,
+	"secret":         true,
+	"token":          true,
+	"name":           true,
+	"account_name":   true,
+	"account_number": true,
+	"iban":           true,
+	"address":        true,
+}
+
+// Sensitive reports if the values of the key are redacted
+func Sensitive(key string) bool {
+	return sensitive[strings.ToLower(key)]
+}
+
+// New returns a logger writing JSON lines at the level or above
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}))
+}
+
+// redact replaces the sensitive attributes and the sensitive fields of the
+// JSON documents logged as json.RawMessage
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	if raw, ok := a.Value.Any().(json.RawMessage); ok {
+		return slog.Any(a.Key, RedactJSON(raw))
+	}
+	return a
+}
+
+// RedactJSON returns the JSON document with the values of the sensitive
+// fields replaced. A document that can not be parsed is dropped entirely.
+func RedactJSON(raw json.RawMessage) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return Redacted
+	}
+	return redactValue(v)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if Sensitive(k) {
+				v[k] = Redacted
+			} else {
+				v[k] = redactValue(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
+
+// Error returns the attributes of an error with the messages of the errors
+// it wraps and the stack of where it was created if it has one
+func Error(err error) slog.Attr {
+	attrs := []any{slog.String("message", err.Error())}
+
+	chain := []string{}
+	for e := err; e != nil; e = unwrap(e) {
+		// pkg/errors wraps the message and the stack separately
+		if msg := e.Error(); len(chain) == 0 || chain[len(chain)-1] != msg {
+			chain = append(chain, msg)
+		}
+	}
+	if len(chain) > 1 {
+		attrs = append(attrs, slog.Any("chain", chain))
+	}
+
+	if st, ok := deepestStack(err); ok {
+		attrs = append(attrs, slog.String("stack", strings.TrimSpace(fmt.Sprintf("%+v", st.StackTrace()))))
+	}
+
+	return slog.Group("error", attrs...)
+}
+
+// unwrap returns the error wrapped by pkg/errors or by fmt.Errorf
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Cause() error }:
+		return e.Cause()
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+type stackTracer interface {
+	StackTrace() errors.StackTrace
+}
+
+// deepestStack finds the stack of the innermost error that has one as it
+// is closest to where the error happened
+func deepestStack(err error) (stackTracer, bool) {
+	var found stackTracer
+	for e := err; e != nil; e = unwrap(e) {
+		if st, ok := e.(stackTracer); ok {
+			found = st
+		}
+	}
+	return found, found != nil
+}
+
+type key int
+
+const (
+	keyLogger key = iota
+	keyFields
+)
+
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, keyLogger, l)
+}
+
+// FromContext returns the logger of the context or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(keyLogger).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// Fields are attributes collected while a request is handled and logged
+// with it when it is done
+type Fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithFields returns a context collecting fields
+func WithFields(ctx context.Context) (context.Context, *Fields) {
+	f := &Fields{}
+	return context.WithValue(ctx, keyFields, f), f
+}
+
+// Add adds attributes to the fields of the context if it collects them
+func Add(ctx context.Context, attrs ...slog.Attr) {
+	f, ok := ctx.Value(keyFields).(*Fields)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	f.attrs = append(f.attrs, attrs...)
+	f.mu.Unlock()
+}
+
+// Attrs returns the collected attributes
+func (f *Fields) Attrs() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr{}, f.attrs...)
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRedact(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, slog.LevelInfo)
+
+	attributes := json.RawMessage(`{"amount":"10.00","beneficiary_party":{"name":"Jane Doe","account_number":"12345678","bank_id":"403000"},"parties":[{"Name":"John"}]}`)
+	logger.Info("payment", slog.Any("attributes", attributes), slog.String("authorization", "Bearer token"), slog.String("route", "/payments"))
+	logger.Debug("hidden")
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %s: %v", buf.String(), err)
+	}
+	attrs, _ := json.Marshal(line["attributes"])
+	expected := `{"amount":"10.00","beneficiary_party":{"account_number":"[REDACTED]","bank_id":"403000","name":"[REDACTED]"},"parties":[{"Name":"[REDACTED]"}]}`
+	if string(attrs) != expected {
+		t.Errorf("expected %s, got %s", expected, attrs)
+	}
+	if line["authorization"] != Redacted || line["route"] != "/payments" {
+		t.Errorf("unexpected line %s", buf.String())
+	}
+
+	if got := RedactJSON(json.RawMessage(`{"name":`)); got != Redacted {
+		t.Errorf("expected invalid JSON to be redacted, got %v", got)
+	}
+}
+
+func TestError(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, slog.LevelInfo)
+
+	err := errors.Wrap(fmt.Errorf("query: %w", errors.New("connection refused")), "listing payments")
+	logger.Error("request", Error(err))
+
+	line := struct {
+		Error struct {
+			Message string   `json:"message"`
+			Chain   []string `json:"chain"`
+			Stack   string   `json:"stack"`
+		} `json:"error"`
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"listing payments: query: connection refused", "query: connection refused", "connection refused"}
+	if strings.Join(line.Error.Chain, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected chain %q, got %q", expected, line.Error.Chain)
+	}
+	if line.Error.Message != expected[0] {
+		t.Errorf("expected message %q, got %q", expected[0], line.Error.Message)
+	}
+	// The innermost stack is where the error was created
+	if !strings.Contains(line.Error.Stack, "TestError") {
+		t.Errorf("expected the stack of the error, got %q", line.Error.Stack)
+	}
+}
+
+func TestFields(t *testing.T) {
+	Add(context.Background(), slog.String("ignored", "without fields"))
+
+	ctx, fields := WithFields(context.Background())
+	Add(ctx, slog.String("principal", "alice"))
+	Add(ctx, slog.String("organisation", "acme"))
+
+	attrs := fields.Attrs()
+	if len(attrs) != 2 || attrs[0].Key != "principal" || attrs[1].Value.String() != "acme" {
+		t.Errorf("unexpected fields %v", attrs)
+	}
+
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("expected the default logger without one in the context")
+	}
+}
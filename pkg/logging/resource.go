@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// LevelType is the type of the log level resource
+const LevelType = "LogLevel"
+
+// LevelData is the data of the log level resource
+type LevelData struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Level string `json:"level"`
+	} `json:"attributes"`
+
+	links.Resource
+}
+
+// LevelResource is the level of the logs of the service
+type LevelResource struct {
+	Data *LevelData `json:"data"`
+
+	level slog.Level
+}
+
+// NewLevelResource creates new resource from the level
+func NewLevelResource(level slog.Level, self string) *LevelResource {
+	data := &LevelData{
+		ID:       "log-level",
+		Type:     LevelType,
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	data.Attributes.Level = strings.ToLower(level.String())
+	return &LevelResource{Data: data, level: level}
+}
+
+// Level returns the parsed level of a bound resource
+func (resource *LevelResource) Level() slog.Level {
+	return resource.level
+}
+
+// Bind implements render.Binder
+func (resource *LevelResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != LevelType {
+		return fmt.Errorf("wrong type")
+	}
+
+	return resource.level.UnmarshalText([]byte(resource.Data.Attributes.Level))
+}
+
+// Render implements render.Render
+func (resource *LevelResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
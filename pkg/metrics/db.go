@@ -0,0 +1,34 @@
+package metrics
+
+import "database/sql"
+
+// Stats reports the statistics of a database connection pool like sql.DB
+// and sqlx.DB do
+type Stats interface {
+	Stats() sql.DBStats
+}
+
+// RegisterDBStats registers the statistics of the connection pool read when
+// the metrics are collected
+func (reg *Registry) RegisterDBStats(db Stats) {
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+
+	reg.NewGaugeFunc("payments_db_max_open_connections", "Maximum number of open connections to the database.", false,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("payments_db_open_connections", "Number of established connections to the database.", false,
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("payments_db_in_use_connections", "Number of connections in use.", false,
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("payments_db_idle_connections", "Number of idle connections.", false,
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewGaugeFunc("payments_db_wait_count_total", "Number of connections waited for.", true,
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewGaugeFunc("payments_db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", true,
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewGaugeFunc("payments_db_max_idle_closed_total", "Number of connections closed due to the maximum of idle connections.", true,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewGaugeFunc("payments_db_max_lifetime_closed_total", "Number of connections closed due to their maximum lifetime.", true,
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
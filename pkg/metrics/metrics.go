@@ -0,0 +1,363 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the metrics of the packages are registered in
+var Default = NewRegistry()
+
+// Registry is a set of metrics exposed together
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(f family) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	for _, existing := range reg.families {
+		if existing.name() == f.name() {
+			panic("metrics: duplicate metric " + f.name())
+		}
+	}
+	reg.families = append(reg.families, f)
+}
+
+// WriteTo writes the metrics in the Prometheus text format
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.mu.Lock()
+	families := append([]family{}, reg.families...)
+	reg.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the metrics of the registry
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		reg.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// desc describes a metric family
+type desc struct {
+	Name   string
+	Help   string
+	Labels []string
+	kind   string
+}
+
+func (d *desc) name() string {
+	return d.Name
+}
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.Name, escapeHelp(d.Help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.Name, d.kind)
+}
+
+// key joins the label values of a series
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.Labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.Name, len(d.Labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labels formats the labels of a series with the extra label if it is set
+func (d *desc) labels(key string, extra ...string) string {
+	pairs := []string{}
+	if len(d.Labels) != 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.Labels[i]+`="`+escapeValue(value)+`"`)
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeValue(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a family of values that only go up
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates a counter registered in the registry
+func (reg *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{Name: name, Help: help, Labels: labels, kind: "counter"}, values: map[string]float64{}}
+	reg.register(c)
+	return c
+}
+
+// NewCounter creates a counter registered in the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// Inc adds one to the series with the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a non negative value to the series with the label values
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.Name + " can not decrease")
+	}
+	key := c.key(values)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.Name, c.labels(key), formatFloat(c.values[key]))
+	}
+}
+
+// Gauge is a family of values that go up and down
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge creates a gauge registered in the registry
+func (reg *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{Name: name, Help: help, Labels: labels, kind: "gauge"}, values: map[string]float64{}}
+	reg.register(g)
+	return g
+}
+
+// NewGauge creates a gauge registered in the default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// Set sets the series with the label values
+func (g *Gauge) Set(v float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Add adds to the series with the label values
+func (g *Gauge) Add(v float64, values ...string) {
+	key := g.key(values)
+
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Inc adds one to the series with the label values
+func (g *Gauge) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec subtracts one from the series with the label values
+func (g *Gauge) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.Name, g.labels(key), formatFloat(g.values[key]))
+	}
+}
+
+// GaugeFunc is a gauge without labels read when the metrics are collected
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates a gauge function registered in the registry. Counter
+// makes it a counter for values that only go up.
+func (reg *Registry) NewGaugeFunc(name, help string, counter bool, fn func() float64) *GaugeFunc {
+	kind := "gauge"
+	if counter {
+		kind = "counter"
+	}
+	g := &GaugeFunc{desc: desc{Name: name, Help: help, kind: kind}, fn: fn}
+	reg.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.Name, formatFloat(g.fn()))
+}
+
+// Histogram is a family of distributions of observed values
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a histogram with the bucket upper bounds registered
+// in the registry
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{
+		desc:    desc{Name: name, Help: help, Labels: labels, kind: "histogram"},
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	reg.register(h)
+	return h
+}
+
+// NewHistogram creates a histogram registered in the default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Observe adds a value to the series with the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(key, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.Name, h.labels(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.Name, h.labels(key), s.count)
+	}
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueEscaper.Replace(s)
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("http_requests_total", "Requests by route.", "route", "code")
+	inFlight := reg.NewGauge("http_in_flight", "Requests in flight.")
+	latency := reg.NewHistogram("latency_seconds", "Latency\nof the requests.", []float64{1, 0.1}, "route")
+	reg.NewGaugeFunc("answer", "The answer.", false, func() float64 { return 42 })
+
+	requests.Inc("/payments", "200")
+	requests.Add(2, "/payments", "200")
+	requests.Inc(`/say "hi"`, "500")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.Observe(0.05, "/payments")
+	latency.Observe(0.5, "/payments")
+	latency.Observe(2, "/payments")
+
+	expected := `# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+# HELP http_in_flight Requests in flight.
+# TYPE http_in_flight gauge
+http_in_flight 1
+# HELP http_requests_total Requests by route.
+# TYPE http_requests_total counter
+http_requests_total{route="/payments",code="200"} 3
+http_requests_total{route="/say \"hi\"",code="500"} 1
+# HELP latency_seconds Latency\nof the requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/payments",le="0.1"} 1
+latency_seconds_bucket{route="/payments",le="1"} 2
+latency_seconds_bucket{route="/payments",le="+Inf"} 3
+latency_seconds_sum{route="/payments"} 2.55
+latency_seconds_count{route="/payments"} 3
+`
+
+	buf := &bytes.Buffer{}
+	if _, err := reg.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("events_total", "Events.").Inc()
+
+	resp := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := resp.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("expected content type %s, got %s", ContentType, ct)
+	}
+	if !bytes.Contains(resp.Body.Bytes(), []byte("events_total 1\n")) {
+		t.Errorf("expected the counter, got %s", resp.Body.String())
+	}
+}
+
+type stats sql.DBStats
+
+func (s stats) Stats() sql.DBStats {
+	return sql.DBStats(s)
+}
+
+func TestRegisterDBStats(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterDBStats(stats{OpenConnections: 5, InUse: 3, Idle: 2, WaitDuration: 1500 * time.Millisecond})
+
+	buf := &bytes.Buffer{}
+	reg.WriteTo(buf)
+	for _, line := range []string{
+		"payments_db_open_connections 5\n",
+		"payments_db_in_use_connections 3\n",
+		"# TYPE payments_db_wait_duration_seconds_total counter\n",
+		"payments_db_wait_duration_seconds_total 1.5\n",
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(line)) {
+			t.Errorf("expected %q in\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a duplicate metric to panic")
+		}
+	}()
+
+	reg := NewRegistry()
+	reg.NewCounter("events_total", "Events.")
+	reg.NewGauge("events_total", "Events.")
+}
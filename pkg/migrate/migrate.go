@@ -0,0 +1,337 @@
+// Package migrate applies the versioned migrations of the schema
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// lockID is the key of the advisory lock that keeps the replicas from
+// migrating at the same time
+const lockID = 0x7061796d656e7473 // "payments"
+
+// Migration is a versioned change of the schema with the SQL applying and
+// reverting it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the SQL applying the migration so changes to applied
+// migrations are detected
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+var filename = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the migrations of the directory named like 0001_name.up.sql
+// and 0001_name.down.sql ordered by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		match := filename.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid version of %s", e.Name())
+		}
+		sql, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, errors.Errorf("migrations %s and %s have the same version", m, e.Name())
+		}
+		if match[3] == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("migration %s has no up.sql", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Applied is a migration recorded in the schema_migrations table
+type Applied struct {
+	Version   int64     `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Status is the state of a migration in the database
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+	// Modified is set if the migration changed after it was applied
+	Modified bool
+	// Missing is set if the applied migration is not known
+	Missing bool
+}
+
+// Migrator applies the migrations to the database. Every migration runs
+// in its own transaction holding an advisory lock so the replicas starting
+// together apply each migration once.
+type Migrator struct {
+	DB         *sqlx.DB
+	Migrations []Migration
+}
+
+// New returns a migrator of the migrations
+func New(db *sqlx.DB, migrations []Migration) *Migrator {
+	return &Migrator{DB: db, Migrations: migrations}
+}
+
+// Up applies the pending migrations in order and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	for {
+		var next *Migration
+		err := m.locked(ctx, func(tx *sqlx.Tx, applied map[int64]Applied) error {
+			for i, migration := range m.Migrations {
+				a, ok := applied[migration.Version]
+				if ok && a.Checksum != migration.Checksum() {
+					return errors.Errorf("migration %s was changed after it was applied", migration)
+				}
+				if !ok {
+					next = &m.Migrations[i]
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+
+			if _, err := tx.ExecContext(ctx, next.Up); err != nil {
+				return errors.Wrapf(err, "applying migration %s failed", next)
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				next.Version, next.Name, next.Checksum())
+			return err
+		})
+		if err != nil || next == nil {
+			return done, err
+		}
+		done = append(done, *next)
+	}
+}
+
+// Down reverts the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	for ; steps > 0; steps-- {
+		var last *Migration
+		err := m.locked(ctx, func(tx *sqlx.Tx, applied map[int64]Applied) error {
+			for i := len(m.Migrations) - 1; i >= 0; i-- {
+				if _, ok := applied[m.Migrations[i].Version]; ok {
+					last = &m.Migrations[i]
+					break
+				}
+			}
+			if last == nil {
+				return nil
+			}
+			if last.Down == "" {
+				return errors.Errorf("migration %s cannot be reverted, it has no down.sql", last)
+			}
+
+			if _, err := tx.ExecContext(ctx, last.Down); err != nil {
+				return errors.Wrapf(err, "reverting migration %s failed", last)
+			}
+			_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version=$1`, last.Version)
+			return err
+		})
+		if err != nil || last == nil {
+			return done, err
+		}
+		done = append(done, *last)
+	}
+	return done, nil
+}
+
+// Baseline records the migrations up to the version as applied without
+// running them, for databases created before the migrations
+func (m *Migrator) Baseline(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(tx *sqlx.Tx, applied map[int64]Applied) error {
+		for _, migration := range m.Migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				migration.Version, migration.Name, migration.Checksum()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the state of the known migrations followed by the applied
+// migrations that are not known
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var status []Status
+	err := m.locked(ctx, func(tx *sqlx.Tx, applied map[int64]Applied) error {
+		known := map[int64]bool{}
+		for _, migration := range m.Migrations {
+			known[migration.Version] = true
+			s := Status{Migration: migration}
+			if a, ok := applied[migration.Version]; ok {
+				at := a.AppliedAt
+				s.AppliedAt = &at
+				s.Modified = a.Checksum != migration.Checksum()
+			}
+			status = append(status, s)
+		}
+
+		var missing []Status
+		for _, a := range applied {
+			if !known[a.Version] {
+				at := a.AppliedAt
+				missing = append(missing, Status{
+					Migration: Migration{Version: a.Version, Name: a.Name},
+					AppliedAt: &at,
+					Missing:   true,
+				})
+			}
+		}
+		sort.Slice(missing, func(i, j int) bool { return missing[i].Version < missing[j].Version })
+		status = append(status, missing...)
+		return nil
+	})
+	return status, err
+}
+
+// Version returns the version of the last applied migration or 0
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version sql.NullInt64
+	err := m.DB.GetContext(ctx, &version, `SELECT max(version) FROM schema_migrations`)
+	return version.Int64, err
+}
+
+// Check reports if the database is missing migrations or has ones that
+// are not known, like when a replica of an older version starts
+func (m *Migrator) Check(ctx context.Context) error {
+	if len(m.Migrations) == 0 {
+		return nil
+	}
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	latest := m.Migrations[len(m.Migrations)-1].Version
+	switch {
+	case version < latest:
+		return errors.Errorf("schema version %d is behind %d, run the migrations", version, latest)
+	case version > latest:
+		return errors.Errorf("schema version %d is ahead of %d", version, latest)
+	}
+	return nil
+}
+
+// locked runs the function in a transaction holding the migration lock
+// with the applied migrations, failing if any of them changed since
+func (m *Migrator) locked(ctx context.Context, f func(tx *sqlx.Tx, applied map[int64]Applied) error) error {
+	tx, err := m.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return errors.Wrap(err, "locking migrations failed")
+	}
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    bigint PRIMARY KEY,
+		name       text NOT NULL,
+		checksum   text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	var rows []Applied
+	if err := tx.SelectContext(ctx, &rows, `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`); err != nil {
+		return err
+	}
+	applied := map[int64]Applied{}
+	for _, a := range rows {
+		applied[a.Version] = a
+	}
+
+	if err := f(tx, applied); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Create writes the empty up and down files of the next migration to the
+// directory and returns their paths
+func Create(dir, name string) (string, string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", errors.Errorf("invalid migration name %q, use letters, digits and underscores", name)
+	}
+	migrations, err := Load(os.DirFS(dir), ".")
+	if err != nil {
+		return "", "", err
+	}
+
+	next := Migration{Version: 1, Name: name}
+	if len(migrations) != 0 {
+		next.Version = migrations[len(migrations)-1].Version + 1
+	}
+
+	up := filepath.Join(dir, next.String()+".up.sql")
+	down := filepath.Join(dir, next.String()+".down.sql")
+	for _, f := range []string{up, down} {
+		if err := ioutil.WriteFile(f, []byte("-- "+filepath.Base(f)+"\n"), 0644); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
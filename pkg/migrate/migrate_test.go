@@ -0,0 +1,218 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/VMitov/payments/database"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "initial", Up: "CREATE TABLE payments (id uuid)", Down: "DROP TABLE payments"},
+	{Version: 2, Name: "jsonb", Up: "ALTER TABLE payments ADD attributes jsonb", Down: "ALTER TABLE payments DROP attributes"},
+}
+
+func expectLocked(mock sqlmock.Sqlmock, applied ...Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+	for _, m := range applied {
+		rows.AddRow(m.Version, m.Name, m.Checksum(), time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery("SELECT version, name, checksum, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+func newMock(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sqlx.NewDb(mockDB, "sqlmock"), mock
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_jsonb.up.sql":     {Data: []byte(testMigrations[1].Up)},
+		"migrations/0002_jsonb.down.sql":   {Data: []byte(testMigrations[1].Down)},
+		"migrations/0001_initial.up.sql":   {Data: []byte(testMigrations[0].Up)},
+		"migrations/0001_initial.down.sql": {Data: []byte(testMigrations[0].Down)},
+		"migrations/README.md":             {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(migrations, testMigrations) {
+		t.Errorf("expected %v, got %v", testMigrations, migrations)
+	}
+
+	fsys["migrations/0002_other.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	if _, err := Load(fsys, "migrations"); err == nil {
+		t.Error("expected the duplicate version to fail")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load(database.Migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) || m.Down == "" {
+			t.Errorf("expected migration %d with a down.sql, got %s", i+1, m)
+		}
+	}
+	if len(migrations) < 3 || migrations[2].Name != "jsonb" {
+		t.Errorf("expected the jsonb migration third, got %v", migrations)
+	}
+	if initial := migrations[0]; initial.Name != "initial" || strings.Contains(initial.Up, "organisation") {
+		t.Errorf("expected the schema before the migrations first, got %s", initial.Up)
+	}
+}
+
+func TestUp(t *testing.T) {
+	db, mock := newMock(t)
+	defer db.Close()
+
+	expectLocked(mock, testMigrations[0])
+	mock.ExpectExec("ALTER TABLE payments ADD attributes jsonb").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(2, "jsonb", testMigrations[1].Checksum()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectLocked(mock, testMigrations...)
+	mock.ExpectCommit()
+
+	applied, err := New(db, testMigrations).Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("expected migration 2 to be applied, got %v", applied)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpModified(t *testing.T) {
+	db, mock := newMock(t)
+	defer db.Close()
+
+	changed := testMigrations[0]
+	changed.Up = "CREATE TABLE payments (id text)"
+	expectLocked(mock, changed)
+	mock.ExpectRollback()
+
+	_, err := New(db, testMigrations).Up(context.Background())
+	if err == nil || err.Error() != "migration 0001_initial was changed after it was applied" {
+		t.Errorf("expected the changed migration to fail, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDown(t *testing.T) {
+	db, mock := newMock(t)
+	defer db.Close()
+
+	expectLocked(mock, testMigrations...)
+	mock.ExpectExec("ALTER TABLE payments DROP attributes").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := New(db, testMigrations).Down(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Errorf("expected migration 2 to be reverted, got %v", reverted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db, mock := newMock(t)
+	defer db.Close()
+
+	unknown := Migration{Version: 3, Name: "newer", Up: "SELECT 1"}
+	expectLocked(mock, testMigrations[0], unknown)
+	mock.ExpectCommit()
+
+	status, err := New(db, testMigrations).Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 3 {
+		t.Fatalf("expected 3 migrations, got %v", status)
+	}
+	if status[0].AppliedAt == nil || status[0].Modified {
+		t.Errorf("expected migration 1 to be applied, got %+v", status[0])
+	}
+	if status[1].AppliedAt != nil {
+		t.Errorf("expected migration 2 to be pending, got %+v", status[1])
+	}
+	if !status[2].Missing || status[2].Name != "newer" {
+		t.Errorf("expected the unknown migration to be missing, got %+v", status[2])
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testCases := map[string]struct {
+		version  interface{}
+		expected string
+	}{
+		"Current": {version: 2},
+		"Behind":  {version: 1, expected: "schema version 1 is behind 2, run the migrations"},
+		"Empty":   {version: nil, expected: "schema version 0 is behind 2, run the migrations"},
+		"Ahead":   {version: 3, expected: "schema version 3 is ahead of 2"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db, mock := newMock(t)
+			defer db.Close()
+			mock.ExpectQuery("SELECT max\\(version\\) FROM schema_migrations").
+				WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(tc.version))
+
+			err := New(db, testMigrations).Check(context.Background())
+			if (err == nil && tc.expected != "") || (err != nil && err.Error() != tc.expected) {
+				t.Errorf("expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "0001_initial.up.sql"), []byte("SELECT 1"), 0644)
+
+	up, down, err := Create(dir, "add_refunds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0002_add_refunds.up.sql" || filepath.Base(down) != "0002_add_refunds.down.sql" {
+		t.Errorf("expected the next version, got %s and %s", up, down)
+	}
+
+	if _, _, err := Create(dir, "add refunds"); err == nil {
+		t.Error("expected the invalid name to fail")
+	}
+}
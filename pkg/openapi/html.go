@@ -0,0 +1,213 @@
+package openapi
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// section is the operations of a tag on the reference page
+type section struct {
+	Tag        Tag
+	Operations []*Operation
+}
+
+// sections returns the operations grouped by their first tag in the order
+// of the tags of the document
+func (d *Document) sections() []section {
+	byTag := map[string][]*Operation{}
+	for _, item := range d.Paths {
+		for _, op := range item {
+			tag := ""
+			if len(op.Tags) > 0 {
+				tag = op.Tags[0]
+			}
+			byTag[tag] = append(byTag[tag], op)
+		}
+	}
+
+	var sections []section
+	add := func(tag Tag) {
+		ops := byTag[tag.Name]
+		if len(ops) == 0 {
+			return
+		}
+		sort.Slice(ops, func(i, j int) bool {
+			if ops[i].Path != ops[j].Path {
+				return ops[i].Path < ops[j].Path
+			}
+			return methodOrder(ops[i].Method) < methodOrder(ops[j].Method)
+		})
+		sections = append(sections, section{Tag: tag, Operations: ops})
+		delete(byTag, tag.Name)
+	}
+	for _, tag := range d.Tags {
+		add(tag)
+	}
+	var rest []string
+	for tag := range byTag {
+		rest = append(rest, tag)
+	}
+	sort.Strings(rest)
+	for _, tag := range rest {
+		add(Tag{Name: tag})
+	}
+	return sections
+}
+
+func methodOrder(method string) int {
+	return strings.Index("GET HEAD POST PUT PATCH DELETE", method)
+}
+
+// typeName describes the type of the schema on the reference page
+func typeName(s *Schema) template.HTML {
+	if s == nil {
+		return "any"
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		return template.HTML(`<a href="#schema-` + template.HTMLEscapeString(name) + `">` + template.HTMLEscapeString(name) + `</a>`)
+	}
+	if len(s.AnyOf) > 0 {
+		var names []string
+		for _, alternative := range s.AnyOf {
+			names = append(names, string(typeName(alternative)))
+		}
+		return template.HTML(strings.Join(names, " | "))
+	}
+
+	var names []string
+	for _, t := range s.types() {
+		switch {
+		case t == "array":
+			names = append(names, "array of "+string(typeName(s.Items)))
+		case t == "object" && s.AdditionalProperties != nil && s.AdditionalProperties != false:
+			if additional, ok := s.AdditionalProperties.(*Schema); ok {
+				names = append(names, "map of "+string(typeName(additional)))
+				continue
+			}
+			names = append(names, t)
+		case s.Format != "" && t == "string":
+			names = append(names, t+" ("+template.HTMLEscapeString(s.Format)+")")
+		default:
+			names = append(names, template.HTMLEscapeString(t))
+		}
+	}
+	if len(names) == 0 {
+		return "any"
+	}
+	return template.HTML(strings.Join(names, " | "))
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*Schema:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*Response:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*MediaType:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var reference = template.Must(template.New("reference").Funcs(template.FuncMap{
+	"type":     typeName,
+	"keys":     sortedKeys,
+	"contains": contains,
+	"lower":    strings.ToLower,
+	"response": func(c *Components, r *Response) *Response {
+		if r.Ref != "" {
+			return c.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+		}
+		return r
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Info.Title}} {{.Info.Version}}</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 60em; padding: 1em; line-height: 1.4; }
+code, .path { font-family: monospace; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; vertical-align: top; }
+.method { display: inline-block; width: 4.5em; font-weight: bold; }
+.get { color: #06c; } .post { color: #080; } .put, .patch { color: #a60; } .delete { color: #c00; }
+section.operation { border-top: 1px solid #ddd; margin-top: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<p>{{.Info.Description}}</p>
+<p>The description of the API is served as <a href="/openapi.json">OpenAPI {{.OpenAPI}}</a>.</p>
+{{$d := .}}
+<nav><ul>
+{{range .Sections}}<li><a href="#tag-{{.Tag.Name}}">{{.Tag.Name}}</a><ul>
+{{range .Operations}}<li><a href="#{{.OperationID}}"><span class="method {{lower .Method}}">{{.Method}}</span> <span class="path">{{.Path}}</span></a></li>
+{{end}}</ul></li>
+{{end}}<li><a href="#schemas">Schemas</a></li>
+</ul></nav>
+{{range .Sections}}
+<h2 id="tag-{{.Tag.Name}}">{{.Tag.Name}}</h2>
+<p>{{.Tag.Description}}</p>
+{{range .Operations}}
+<section class="operation" id="{{.OperationID}}">
+<h3><span class="method {{lower .Method}}">{{.Method}}</span> <span class="path">{{.Path}}</span></h3>
+<p><strong>{{.Summary}}</strong></p>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Parameters}}<table>
+<tr><th>Parameter</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+{{range .Parameters}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td>{{type .Schema}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>{{end}}
+{{with .RequestBody}}{{$body := .}}<p>Request body{{if .Required}} (required){{end}}: {{.Description}}</p>
+<table>{{range $mt := keys .Content}}<tr><td><code>{{$mt}}</code></td><td>{{type (index $body.Content $mt).Schema}}</td></tr>{{end}}</table>{{end}}
+<table>
+<tr><th>Status</th><th>Description</th><th>Content</th></tr>
+{{$op := .}}{{range $status := keys .Responses}}{{with response $d.Components (index $op.Responses $status)}}{{$resp := .}}<tr><td>{{$status}}</td><td>{{.Description}}</td><td>{{range $mt := keys .Content}}<code>{{$mt}}</code> {{type (index $resp.Content $mt).Schema}}<br>{{end}}</td></tr>
+{{end}}{{end}}</table>
+</section>
+{{end}}{{end}}
+<h2 id="schemas">Schemas</h2>
+{{range $name := keys .Components.Schemas}}{{with index $d.Components.Schemas $name}}
+<section id="schema-{{$name}}">
+<h3>{{$name}}</h3>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+{{if .Properties}}<table>
+<tr><th>Property</th><th>Type</th><th>Required</th></tr>
+{{$s := .}}{{range $prop := keys .Properties}}<tr><td><code>{{$prop}}</code></td><td>{{type (index $s.Properties $prop)}}</td><td>{{if contains $s.Required $prop}}yes{{end}}</td></tr>
+{{end}}</table>{{else}}<p>{{type .}}</p>{{end}}
+</section>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// page is the document with its sections for the reference page
+type page struct {
+	*Document
+	Sections []section
+}
+
+// HTML writes the reference page of the API
+func (d *Document) HTML(w io.Writer) error {
+	return reference.Execute(w, page{Document: d, Sections: d.sections()})
+}
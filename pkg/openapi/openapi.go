@@ -0,0 +1,162 @@
+// Package openapi describes the API as an OpenAPI 3.1 document
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the version of OpenAPI of the documents
+const Version = "3.1.0"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components *Components           `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem are the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+// Operation is a method of a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security overrides the security of the document, empty for the
+	// operations without authentication
+	Security *[]map[string][]string `json:"security,omitempty"`
+
+	// Method and Path locate the operation in the document
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+// Parameter is a parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of the request of an operation
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Header is a header of a response
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType is the schema of a media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// SecurityScheme is a way to authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Components are the definitions shared by the operations
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+
+	types   map[reflect.Type]*Schema
+	names   map[string]reflect.Type
+	aliases map[reflect.Type]string
+}
+
+// New returns a document without operations
+func New(info Info) *Document {
+	d := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: &Components{
+			Schemas:         map[string]*Schema{},
+			Responses:       map[string]*Response{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+			types:           map[reflect.Type]*Schema{},
+			names:           map[string]reflect.Type{},
+			aliases:         map[reflect.Type]string{},
+		},
+	}
+	d.Components.Define(time.Time{}, &Schema{Type: "string", Format: "date-time"})
+	return d
+}
+
+// Add adds the operation to the path of the document
+func (d *Document) Add(method, path string, op *Operation) *Operation {
+	op.Method, op.Path = strings.ToUpper(method), path
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+	return op
+}
+
+// Operation returns the operation of the method and the path
+func (d *Document) Operation(method, path string) *Operation {
+	return d.Paths[path][strings.ToLower(method)]
+}
+
+// JSON returns the content of JSON described by the value
+func (c *Components) JSON(v interface{}) map[string]*MediaType {
+	return c.Content("application/json", v)
+}
+
+// Content returns the content of the media type described by the value
+func (c *Components) Content(mediaType string, v interface{}) map[string]*MediaType {
+	return map[string]*MediaType{mediaType: {Schema: c.SchemaOf(v)}}
+}
+
+// ResponseRef refers to a response of the components
+func ResponseRef(name string) *Response {
+	return &Response{Ref: "#/components/responses/" + name}
+}
@@ -0,0 +1,197 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Account struct {
+	Name    string            `json:"name"`
+	Number  *string           `json:"number,omitempty"`
+	Opened  time.Time         `json:"opened"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Raw     json.RawMessage   `json:"raw,omitempty"`
+	Parent  *Account          `json:"parent,omitempty"`
+	ignored string
+	Skipped string `json:"-"`
+}
+
+type Owned struct {
+	Account
+	Owner string `json:"owner"`
+	Name  int    `json:"name"`
+}
+
+func newTestDocument() *Document {
+	d := New(Info{Title: "Test", Version: "1"})
+	d.Add("GET", "/accounts/{id}", &Operation{
+		OperationID: "getAccount",
+		Tags:        []string{"Accounts"},
+		Responses: map[string]*Response{
+			"200":     {Description: "The account", Content: d.Components.JSON(Account{})},
+			"204":     {Description: "Nothing"},
+			"default": ResponseRef("Error"),
+		},
+	})
+	d.Components.Responses["Error"] = &Response{
+		Description: "The error",
+		Content: map[string]*MediaType{"application/json": {Schema: &Schema{
+			Type:       "object",
+			Required:   []string{"status"},
+			Properties: map[string]*Schema{"status": {Type: "string"}},
+		}}},
+	}
+	return d
+}
+
+func TestSchemaOf(t *testing.T) {
+	d := newTestDocument()
+	c := d.Components
+
+	if s := c.SchemaOf(Account{}); s.Ref != "#/components/schemas/OpenapiAccount" {
+		t.Fatalf("got ref %q", s.Ref)
+	}
+	account := c.Schemas["OpenapiAccount"]
+	if account == nil {
+		t.Fatal("no schema of the account")
+	}
+	if got, want := strings.Join(account.Required, ","), "name,opened,tags"; got != want {
+		t.Errorf("got required %s, want %s", got, want)
+	}
+	if account.AdditionalProperties != false {
+		t.Errorf("got additional properties %v", account.AdditionalProperties)
+	}
+
+	tests := map[string]struct {
+		property string
+		types    string
+		format   string
+	}{
+		"string":      {"name", "string", ""},
+		"pointer":     {"number", "string,null", ""},
+		"time":        {"opened", "string", "date-time"},
+		"slice":       {"tags", "array,null", ""},
+		"map":         {"labels", "object,null", ""},
+		"raw message": {"raw", "", ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := account.Properties[test.property]
+			if s == nil {
+				t.Fatalf("no %s", test.property)
+			}
+			if got := strings.Join(s.types(), ","); got != test.types {
+				t.Errorf("got types %s, want %s", got, test.types)
+			}
+			if s.Format != test.format {
+				t.Errorf("got format %s, want %s", s.Format, test.format)
+			}
+		})
+	}
+
+	for _, property := range []string{"ignored", "Skipped", "-"} {
+		if _, ok := account.Properties[property]; ok {
+			t.Errorf("%s is described", property)
+		}
+	}
+	if parent := account.Properties["parent"]; len(parent.AnyOf) != 2 || parent.AnyOf[0].Ref != "#/components/schemas/OpenapiAccount" {
+		t.Errorf("got parent %+v", parent)
+	}
+
+	c.SchemaOf(Owned{})
+	owned := c.Schemas["OpenapiOwned"]
+	if got := strings.Join(owned.types(), ","); got != "object" {
+		t.Errorf("got types %s of the embedding struct", got)
+	}
+	if got := owned.Properties["name"].types(); len(got) != 1 || got[0] != "integer" {
+		t.Errorf("got name %v, want the field of the embedding struct", got)
+	}
+	if _, ok := owned.Properties["opened"]; !ok {
+		t.Error("the fields of the embedded struct are not described")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := newTestDocument()
+
+	tests := map[string]struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+		err         string
+	}{
+		"valid": {
+			"/accounts/{id}", 200, "application/json",
+			`{"name":"a","opened":"2026-01-02T00:00:00Z","tags":null,"labels":{"a":"b"},"parent":{"name":"b","opened":"x","tags":["c"]}}`,
+			"",
+		},
+		"missing property": {
+			"/accounts/{id}", 200, "application/json", `{"name":"a","tags":[]}`, "opened is required",
+		},
+		"unknown property": {
+			"/accounts/{id}", 200, "application/json", `{"name":"a","opened":"x","tags":[],"other":1}`, "other is not expected",
+		},
+		"wrong type": {
+			"/accounts/{id}", 200, "application/json", `{"name":1,"opened":"x","tags":[]}`, "#/name: expected string",
+		},
+		"wrong item": {
+			"/accounts/{id}", 200, "application/json", `{"name":"a","opened":"x","tags":[1]}`, "#/tags/0",
+		},
+		"no body": {
+			"/accounts/{id}", 200, "application/json", ``, "has no body",
+		},
+		"empty response": {
+			"/accounts/{id}", 204, "", ``, "",
+		},
+		"default response": {
+			"/accounts/{id}", 404, "application/json; charset=utf-8", `{"status":"Not found"}`, "",
+		},
+		"wrong content type": {
+			"/accounts/{id}", 200, "text/plain", `name`, `"text/plain" is not documented`,
+		},
+		"undocumented": {
+			"/accounts", 200, "application/json", `{}`, "GET /accounts is not documented",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := d.ValidateResponse("GET", test.path, test.status, test.contentType, []byte(test.body))
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got error %v", err)
+			case test.err != "" && err == nil:
+				t.Errorf("got no error, want %q", test.err)
+			case test.err != "" && !strings.Contains(err.Error(), test.err):
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestHTML(t *testing.T) {
+	d := newTestDocument()
+	d.Tags = []Tag{{Name: "Accounts", Description: "The <accounts>"}}
+
+	var buf bytes.Buffer
+	if err := d.HTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		`<h2 id="tag-Accounts">Accounts</h2>`,
+		`The &lt;accounts&gt;`,
+		`<section class="operation" id="getAccount">`,
+		`<a href="#schema-OpenapiAccount">OpenapiAccount</a>`,
+		`<td>default</td><td>The error</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("%s not on the page", want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Schema is a JSON Schema of a value
+type Schema struct {
+	Ref         string `json:"$ref,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is the name of the type or the names of the types the value may
+	// be of, any type if nil
+	Type       interface{}        `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	// AdditionalProperties is false or the schema of the properties not in
+	// Properties
+	AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+	Items                *Schema     `json:"items,omitempty"`
+	AnyOf                []*Schema   `json:"anyOf,omitempty"`
+}
+
+// types returns the names of the types of the schema
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// Nullable returns the schema allowing null as well
+func Nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	types := s.types()
+	if types == nil {
+		return s
+	}
+	for _, t := range types {
+		if t == "null" {
+			return s
+		}
+	}
+	nullable := *s
+	nullable.Type = append(append([]string{}, types...), "null")
+	return &nullable
+}
+
+var (
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Define sets the schema of the type of the value instead of the one
+// reflected from it, for the types encoding themselves
+func (c *Components) Define(v interface{}, s *Schema) {
+	c.types[reflect.TypeOf(v)] = s
+}
+
+// Named names the schema of the type of the value instead of the name of
+// its package and type
+func (c *Components) Named(v interface{}, name string) {
+	t := reflect.TypeOf(v)
+	c.aliases[t] = name
+	c.names[name] = t
+}
+
+// SchemaOf returns the schema of the JSON encoding of the value. The named
+// structs are added to the schemas of the components and referred to.
+func (c *Components) SchemaOf(v interface{}) *Schema {
+	return c.schema(reflect.TypeOf(v))
+}
+
+func (c *Components) schema(t reflect.Type) *Schema {
+	if s, ok := c.types[t]; ok {
+		return s
+	}
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		return Nullable(c.schema(t.Elem()))
+	case t == rawMessageType:
+		return &Schema{}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: []string{"array", "null"}, Items: c.schema(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: c.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: []string{"object", "null"}, AdditionalProperties: c.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.structSchema(t)
+		}
+		name := c.name(t)
+		if _, ok := c.Schemas[name]; !ok {
+			// Set before reflecting the fields for the recursive types
+			s := &Schema{}
+			c.Schemas[name] = s
+			*s = *c.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// Interfaces hold any value
+	return &Schema{}
+}
+
+// name returns the name of the schema of the named type, prefixed with its
+// package unless it is already
+func (c *Components) name(t reflect.Type) string {
+	if name, ok := c.aliases[t]; ok {
+		return name
+	}
+
+	pkg := upperFirst(path.Base(t.PkgPath()))
+	name := upperFirst(t.Name())
+	if pkg != "Main" && !strings.HasPrefix(name, pkg) {
+		name = pkg + name
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if other, ok := c.names[unique]; !ok || other == t {
+			break
+		}
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	c.names[unique] = t
+	return unique
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+// structSchema returns the schema of the fields of the struct. The fields
+// of the embedded structs are its own unless a shallower field has the
+// name, as encoding/json does.
+func (c *Components) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	c.fields(s, t, false)
+	return s
+}
+
+func (c *Components) fields(s *Schema, t reflect.Type, optional bool) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("json"))
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue
+		}
+
+		field := c.schema(f.Type)
+		if strings.Contains(opts, "string") {
+			field = &Schema{Type: "string"}
+		}
+		s.Properties[name] = field
+		if !optional && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	for _, f := range embedded {
+		ft := f.Type
+		// The fields of a nil embedded struct are left out
+		ptr := ft.Kind() == reflect.Ptr
+		if ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			continue
+		}
+		c.fields(s, ft, optional || ptr)
+	}
+}
+
+func parseTag(tag string) (string, string) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
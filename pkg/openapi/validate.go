@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidateResponse checks the response of the operation of the method and
+// the path against the document
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	op := d.Operation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%s %s: status %d is not documented", method, path, status)
+		}
+	}
+	if ref := resp.Ref; ref != "" {
+		if resp = d.Components.Responses[strings.TrimPrefix(ref, "#/components/responses/")]; resp == nil {
+			return fmt.Errorf("%s %s: unknown response %s", method, path, ref)
+		}
+	}
+
+	if len(body) == 0 {
+		if len(resp.Content) > 0 {
+			return fmt.Errorf("%s %s: status %d has no body", method, path, status)
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s: status %d with %q is not documented", method, path, status, contentType)
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("%s %s: invalid JSON: %v", method, path, err)
+	}
+	if err := d.Validate(v, content.Schema); err != nil {
+		return fmt.Errorf("%s %s: status %d: %v", method, path, status, err)
+	}
+	return nil
+}
+
+// Validate checks the decoded JSON value against the schema
+func (d *Document) Validate(v interface{}, s *Schema) error {
+	return d.validate(v, s, "#")
+}
+
+func (d *Document) validate(v interface{}, s *Schema, at string) error {
+	if s.Ref != "" {
+		ref := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if ref == nil {
+			return fmt.Errorf("%s: unknown schema %s", at, s.Ref)
+		}
+		return d.validate(v, ref, at)
+	}
+
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, alternative := range s.AnyOf {
+			err := d.validate(v, alternative, at)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s: matches none of the schemas: %s", at, strings.Join(errs, "; "))
+	}
+
+	if types := s.types(); types != nil && !hasType(v, types) {
+		return fmt.Errorf("%s: expected %s, got %s", at, strings.Join(types, " or "), typeOf(v))
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, v, s.Enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: %s is required", at, name)
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				switch additional := s.AdditionalProperties.(type) {
+				case bool:
+					if !additional {
+						return fmt.Errorf("%s: %s is not expected", at, name)
+					}
+					continue
+				case *Schema:
+					prop = additional
+				default:
+					continue
+				}
+			}
+			if err := d.validate(v[name], prop, at+"/"+name); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				if err := d.validate(item, s.Items, at+"/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasType(v interface{}, types []string) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,106 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DateLayout is the layout of the dates in the payment attributes
+const DateLayout = "2006-01-02"
+
+// Details are the attributes of a payment that the service understands
+type Details struct {
+	Amount            decimal.Decimal
+	Currency          string
+	EndToEndReference string
+	PaymentScheme     string
+	ProcessingDate    time.Time
+	Urgency           string
+
+	BeneficiaryCountry     string
+	BeneficiaryName        string
+	BeneficiaryAccountName string
+	BeneficiaryAccount     string
+	DebtorName             string
+	DebtorAccountName      string
+	DebtorAccount          string
+}
+
+type rawDetails struct {
+	Amount            string `json:"amount"`
+	Currency          string `json:"currency"`
+	EndToEndReference string `json:"end_to_end_reference"`
+	PaymentScheme     string `json:"payment_scheme"`
+	ProcessingDate    string `json:"processing_date"`
+	Urgency           string `json:"urgency"`
+
+	BeneficiaryParty struct {
+		Country       string `json:"country"`
+		Name          string `json:"name"`
+		AccountName   string `json:"account_name"`
+		AccountNumber string `json:"account_number"`
+		BankID        string `json:"bank_id"`
+	} `json:"beneficiary_party"`
+
+	DebtorParty struct {
+		Name          string `json:"name"`
+		AccountName   string `json:"account_name"`
+		AccountNumber string `json:"account_number"`
+		BankID        string `json:"bank_id"`
+	} `json:"debtor_party"`
+}
+
+// Details parses the known fields from the payment attributes.
+// Missing fields are left with their zero value.
+func (p *Payment) Details() (*Details, error) {
+	raw := rawDetails{}
+	if len(p.Attributes) != 0 {
+		if err := json.Unmarshal(p.Attributes, &raw); err != nil {
+			return nil, fmt.Errorf("invalid attributes: %v", err)
+		}
+	}
+
+	details := &Details{
+		Currency:          raw.Currency,
+		EndToEndReference: raw.EndToEndReference,
+		PaymentScheme:     raw.PaymentScheme,
+		Urgency:           raw.Urgency,
+
+		BeneficiaryCountry:     raw.BeneficiaryParty.Country,
+		BeneficiaryName:        raw.BeneficiaryParty.Name,
+		BeneficiaryAccountName: raw.BeneficiaryParty.AccountName,
+		BeneficiaryAccount:     account(raw.BeneficiaryParty.BankID, raw.BeneficiaryParty.AccountNumber),
+		DebtorName:             raw.DebtorParty.Name,
+		DebtorAccountName:      raw.DebtorParty.AccountName,
+		DebtorAccount:          account(raw.DebtorParty.BankID, raw.DebtorParty.AccountNumber),
+	}
+
+	if raw.Amount != "" {
+		amount, err := decimal.NewFromString(raw.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q", raw.Amount)
+		}
+		details.Amount = amount
+	}
+
+	if raw.ProcessingDate != "" {
+		date, err := time.Parse(DateLayout, raw.ProcessingDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid processing_date %q", raw.ProcessingDate)
+		}
+		details.ProcessingDate = date
+	}
+
+	return details, nil
+}
+
+// account identifies an account by its bank and number or is empty without a number
+func account(bankID, number string) string {
+	if number == "" {
+		return ""
+	}
+	return bankID + "/" + number
+}
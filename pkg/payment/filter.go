@@ -0,0 +1,103 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter selects the payments by their status, kind and attributes. The
+// empty filter selects all of them.
+type Filter struct {
+	Status string
+	Kind   string
+	// Attributes are the string values of the attributes at their dotted
+	// paths, like beneficiary_party.name
+	Attributes map[string]string
+}
+
+// Empty reports if the filter selects all the payments
+func (f Filter) Empty() bool {
+	return f.Status == "" && f.Kind == "" && len(f.Attributes) == 0
+}
+
+// Validate returns the error of an attribute path that is not valid or that
+// conflicts with another one
+func (f Filter) Validate() error {
+	_, err := f.contained()
+	return err
+}
+
+// contained returns the document the attributes of the selected payments
+// contain. The containment is answered by the GIN index of the attributes.
+func (f Filter) contained() (map[string]interface{}, error) {
+	paths := make([]string, 0, len(f.Attributes))
+	for path := range f.Attributes {
+		paths = append(paths, path)
+	}
+	// The shorter paths first so a conflict is found whatever the order
+	sort.Strings(paths)
+
+	doc := map[string]interface{}{}
+	for _, path := range paths {
+		names := strings.Split(path, ".")
+		object := doc
+		for i, name := range names {
+			if name == "" {
+				return nil, errors.Errorf("attribute path %q has an empty name", path)
+			}
+			if i == len(names)-1 {
+				if _, ok := object[name]; ok {
+					return nil, errors.Errorf("attribute path %q conflicts with another one", path)
+				}
+				object[name] = f.Attributes[path]
+				break
+			}
+
+			next, ok := object[name]
+			if !ok {
+				next = map[string]interface{}{}
+				object[name] = next
+			}
+			if object, ok = next.(map[string]interface{}); !ok {
+				return nil, errors.Errorf("attribute path %q conflicts with another one", path)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// where returns the conditions of the filter numbering their parameters from
+// n and the parameters
+func (f Filter) where(n int) (string, []interface{}, error) {
+	var (
+		conds string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		conds += fmt.Sprintf(cond, n+len(args))
+		args = append(args, arg)
+	}
+
+	if f.Status != "" {
+		add(" AND status=$%d", f.Status)
+	}
+	if f.Kind != "" {
+		add(" AND kind=$%d", f.Kind)
+	}
+	if len(f.Attributes) != 0 {
+		doc, err := f.contained()
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return "", nil, err
+		}
+		add(" AND attributes @> $%d", string(data))
+	}
+	return conds, args, nil
+}
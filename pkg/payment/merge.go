@@ -0,0 +1,52 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Merge applies the JSON merge patch of RFC 7396 to the attributes. The
+// members of the patch replace the members of the attributes, the nested
+// objects are merged the same way and null removes a member.
+func Merge(attributes, patch json.RawMessage) (json.RawMessage, error) {
+	var target, changes map[string]interface{}
+	if len(attributes) != 0 {
+		if err := decode(attributes, &target); err != nil {
+			return nil, fmt.Errorf("invalid attributes: %v", err)
+		}
+	}
+	if err := decode(patch, &changes); err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+	if target == nil {
+		target = map[string]interface{}{}
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+// decode keeps the numbers as they are written
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func merge(target, patch map[string]interface{}) map[string]interface{} {
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, name)
+		case map[string]interface{}:
+			nested, ok := target[name].(map[string]interface{})
+			if !ok {
+				nested = map[string]interface{}{}
+			}
+			target[name] = merge(nested, value)
+		default:
+			target[name] = value
+		}
+	}
+	return target
+}
@@ -0,0 +1,36 @@
+package payment
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	testCases := map[string]struct {
+		attributes, patch, expected string
+	}{
+		"Replace":     {attributes: `{"amount":"100.21","currency":"GBP"}`, patch: `{"amount":"50"}`, expected: `{"amount":"50","currency":"GBP"}`},
+		"Add":         {attributes: `{"amount":"100.21"}`, patch: `{"reference":"Invoice 7"}`, expected: `{"amount":"100.21","reference":"Invoice 7"}`},
+		"Remove":      {attributes: `{"amount":"100.21","reference":"Invoice 7"}`, patch: `{"reference":null}`, expected: `{"amount":"100.21"}`},
+		"Nested":      {attributes: `{"debtor_party":{"name":"EJ Brown","account_number":"GB29"}}`, patch: `{"debtor_party":{"name":"E Brown"}}`, expected: `{"debtor_party":{"account_number":"GB29","name":"E Brown"}}`},
+		"ReplaceList": {attributes: `{"charges":[1,2]}`, patch: `{"charges":[3]}`, expected: `{"charges":[3]}`},
+		"Numbers":     {attributes: `{"units":12345678901234567890}`, patch: `{}`, expected: `{"units":12345678901234567890}`},
+		"Empty":       {attributes: ``, patch: `{"amount":"1"}`, expected: `{"amount":"1"}`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			merged, err := Merge(json.RawMessage(tc.attributes), json.RawMessage(tc.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(merged) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, merged)
+			}
+		})
+	}
+
+	if _, err := Merge(json.RawMessage(`{}`), json.RawMessage(`[1]`)); err == nil {
+		t.Error("expected a patch that is not an object to fail")
+	}
+}
@@ -0,0 +1,75 @@
+package payment
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/metrics"
+	"github.com/VMitov/payments/pkg/trace"
+)
+
+var (
+	queryDuration = metrics.NewHistogram("payments_payment_query_duration_seconds",
+		"Duration of the payment operations on the database.", metrics.DefaultBuckets, "operation")
+	createdTotal = metrics.NewCounter("payments_payments_created_total",
+		"Payments created by kind and currency.", "kind", "currency")
+	transitionsTotal = metrics.NewCounter("payments_payment_status_transitions_total",
+		"Status transitions of the payments.", "from", "to")
+)
+
+// operation measures an operation on the database of the payment and traces
+// and logs it with the logger of the context. The returned function ends it
+// with the error it returned.
+func operation(ctx context.Context, name, id string) func(err error) {
+	start := time.Now()
+	_, span := trace.Start(ctx, "payment."+name, trace.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", name)
+	if id != "" {
+		span.SetAttribute("payment.id", id)
+	}
+
+	return func(err error) {
+		elapsed := time.Since(start)
+		queryDuration.Observe(elapsed.Seconds(), name)
+		span.SetError(err)
+		span.End()
+
+		attrs := []slog.Attr{
+			slog.String("operation", name),
+			slog.Float64("duration_ms", float64(elapsed)/float64(time.Millisecond)),
+		}
+		if id != "" {
+			attrs = append(attrs, slog.String("payment_id", id))
+		}
+
+		logger := logging.FromContext(ctx)
+		switch {
+		case err == nil || err == sql.ErrNoRows:
+			logger.LogAttrs(ctx, slog.LevelDebug, "payment operation", attrs...)
+		default:
+			logger.LogAttrs(ctx, slog.LevelWarn, "payment operation failed", append(attrs, logging.Error(err))...)
+		}
+	}
+}
+
+// logCreated logs a created payment. Its attributes are only logged at
+// debug level with the parties redacted.
+func logCreated(ctx context.Context, kind, id string, p *Payment) {
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "payment created",
+		slog.String("payment_id", id), slog.String("kind", kind))
+	logging.FromContext(ctx).LogAttrs(ctx, slog.LevelDebug, "payment attributes",
+		slog.String("payment_id", id), slog.Any("attributes", p.Attributes))
+}
+
+// countCreated counts a created payment by its currency
+func countCreated(kind string, p *Payment) {
+	currency := "unknown"
+	if details, err := p.Details(); err == nil && details.Currency != "" {
+		currency = details.Currency
+	}
+	createdTotal.Inc(kind, currency)
+}
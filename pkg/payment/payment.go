@@ -1,12 +1,21 @@
 package payment
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"path"
+	"time"
 
+	apierrors "github.com/VMitov/payments/pkg/errors"
 	"github.com/VMitov/payments/pkg/links"
+	"github.com/VMitov/payments/pkg/tenant"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
 // Type is the type of the payment resource
@@ -14,8 +23,13 @@ const Type = "Payment"
 
 // Payment is a single payment
 type Payment struct {
-	ID         string          `db:"id"         json:"id"`
-	Attributes json.RawMessage `db:"attributes" json:"attributes"`
+	ID             string          `db:"id"              json:"id"`
+	Attributes     json.RawMessage `db:"attributes"      json:"attributes"`
+	Status         string          `db:"status"          json:"-"`
+	Kind           string          `db:"kind"            json:"-"`
+	OriginalID     *string         `db:"original_id"     json:"-"`
+	OrganisationID string          `db:"organisation_id" json:"-"`
+	ReconciledAt   *time.Time      `db:"reconciled_at"   json:"-"`
 }
 
 // NewFromResource returns Payment from Resource
@@ -26,101 +40,376 @@ func NewFromResource(res *Resource) (*Payment, error) {
 	return res.Data.Payment, nil
 }
 
-// Create persist a payment
-func Create(db *sqlx.DB, pay *Payment) (id string, err error) {
-	rows, err := db.Queryx(
-		db.Rebind(`INSERT INTO payments (attributes) VALUES (?) RETURNING id`),
-		string(pay.Attributes),
-	)
-	if err != nil {
+// ErrExists is returned when the id generated by the client is taken
+var ErrExists = errors.New("payment already exists")
+
+// Hook runs with the id of a payment within the transaction that creates or
+// changes it. The payment is left as it was if the hook fails.
+type Hook func(tx *sqlx.Tx, id string) error
+
+// Create persist a payment of the organisation, with the id of the payment
+// if it is set. The hook may be nil.
+func Create(ctx context.Context, db *sqlx.DB, org string, pay *Payment, hook Hook) (id string, err error) {
+	done := operation(ctx, "create", "")
+	defer func() { done(err) }()
+
+	err = tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		if id, err = CreateTx(tx, org, pay); err != nil || hook == nil {
+			return err
+		}
+		return hook(tx, id)
+	})
+	if err == nil {
+		logCreated(ctx, KindPayment, id, pay)
+	}
+	return id, err
+}
+
+// CreateTx persist a payment of the organisation within a transaction
+func CreateTx(tx *sqlx.Tx, org string, pay *Payment) (id string, err error) {
+	if org == "" {
+		return "", tenant.ErrNoOrganisation
+	}
+
+	var rows *sqlx.Rows
+	if pay.ID != "" {
+		rows, err = tx.Queryx(
+			tx.Rebind(`INSERT INTO payments (id, organisation_id, attributes) VALUES (?, ?, ?) RETURNING id`),
+			pay.ID, org, string(pay.Attributes),
+		)
+	} else {
+		rows, err = tx.Queryx(
+			tx.Rebind(`INSERT INTO payments (organisation_id, attributes) VALUES (?, ?) RETURNING id`),
+			org, string(pay.Attributes),
+		)
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return "", ErrExists
+	} else if err != nil {
 		return "", err
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
 		return "", fmt.Errorf("error getting id")
 	}
 
 	rows.Scan(&id)
+	pay.OrganisationID = org
+	countCreated(KindPayment, pay)
 	return id, nil
 }
 
-// Update updates payment
-func Update(db *sqlx.DB, id string, pay *Payment) error {
-	_, err := db.Exec(
-		db.Rebind(`UPDATE payments SET attributes=? WHERE id=?`),
-		string(pay.Attributes), id,
-	)
+// ErrLocked is returned when the payment can not be changed or deleted in
+// its status. Held payments wait for the decision of a reviewer and rejected
+// payments are kept as they were rejected.
+var ErrLocked = errors.New("payment can not be changed in its status")
+
+// Locked reports if a payment in the status can not be changed or deleted
+func Locked(status string) bool {
+	return status == StatusHeld || status == StatusRejected
+}
+
+// Update updates payment of the organisation. The hook may be nil.
+func Update(ctx context.Context, db *sqlx.DB, org, id string, pay *Payment, hook Hook) (err error) {
+	done := operation(ctx, "update", id)
+	defer func() { done(err) }()
+
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return updateTx(tx, org, id, "", pay, hook)
+	})
+}
+
+// ErrModified is returned when the payment changed since it was read
+var ErrModified = errors.New("payment was modified")
+
+// ETag identifies the version of the payment for the conditional updates
+func (p *Payment) ETag() string {
+	h := sha256.New()
+	h.Write([]byte(p.Status))
+	h.Write([]byte{0})
+	h.Write(p.Attributes)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// UpdateIfMatch updates the payment of the organisation if it is still the
+// version of the ETag. The hook may be nil.
+func UpdateIfMatch(ctx context.Context, db *sqlx.DB, org, id, etag string, pay *Payment, hook Hook) (err error) {
+	done := operation(ctx, "update", id)
+	defer func() { done(err) }()
+
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return updateTx(tx, org, id, etag, pay, hook)
+	})
+}
+
+// updateTx updates the payment if it is not locked and, unless the ETag is
+// empty, still the version of the ETag
+func updateTx(tx *sqlx.Tx, org, id, etag string, pay *Payment, hook Hook) error {
+	current := Payment{}
+	if err := tx.Get(&current, "SELECT * FROM payments WHERE id=$1 AND organisation_id=$2 FOR UPDATE", id, org); err != nil {
+		return err
+	}
+	if etag != "" && current.ETag() != etag {
+		return ErrModified
+	}
+	if Locked(current.Status) {
+		return ErrLocked
+	}
+
+	if _, err := tx.Exec(
+		tx.Rebind(`UPDATE payments SET attributes=? WHERE id=? AND organisation_id=?`),
+		string(pay.Attributes), id, org,
+	); err != nil {
+		return err
+	}
+
+	if hook == nil {
+		return nil
+	}
+	return hook(tx, id)
+}
+
+// Delete deleted payment of the organisation unless it is locked
+func Delete(ctx context.Context, db *sqlx.DB, org, id string) (err error) {
+	done := operation(ctx, "delete", id)
+	defer func() { done(err) }()
+
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		var status string
+		if err := tx.Get(&status, tx.Rebind(`SELECT status FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), id, org); err != nil {
+			return err
+		}
+		if Locked(status) {
+			return ErrLocked
+		}
+
+		_, err := tx.Exec(tx.Rebind(`DELETE FROM payments WHERE id=? AND organisation_id=?`), id, org)
+		return err
+	})
+}
+
+// columns returns the columns of the payments selected for the fieldset and
+// their arguments starting from the placeholder n. The attributes are
+// limited to the top-level names of the fieldset, the nested ones are left
+// to the resource.
+func columns(fields links.Fieldset, n int) (string, []interface{}) {
+	if fields == nil {
+		return "*", nil
+	}
+	return fmt.Sprintf(`id, organisation_id, status, kind, original_id, reconciled_at,
+		(SELECT COALESCE(jsonb_object_agg(key, value), '{}') FROM jsonb_each(attributes) WHERE key = ANY($%d)) AS attributes`, n),
+		[]interface{}{pq.Array(fields.Top())}
+}
+
+// Select gets all payments of the organisation selected by the filter
+func Select(ctx context.Context, db *sqlx.DB, org string, filter Filter, fields links.Fieldset) (_ []Payment, err error) {
+	done := operation(ctx, "select", "")
+	defer func() { done(err) }()
+
+	cols, args := columns(fields, 2)
+	where, whereArgs, err := filter.where(2 + len(args))
+	if err != nil {
+		return nil, err
+	}
+	payments := []Payment{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&payments, "SELECT "+cols+" FROM payments WHERE organisation_id=$1"+where,
+			append(append([]interface{}{org}, args...), whereArgs...)...)
+	}); err != nil {
+		return nil, err
+	}
 
-	return err
+	return payments, nil
 }
 
-// Delete deleted payment
-func Delete(db *sqlx.DB, id string) error {
-	_, err := db.Exec(db.Rebind(`DELETE FROM payments WHERE id=?`), id)
-	return err
+// SelectPage gets up to size payments of the organisation selected by the
+// filter ordered by id after the id, which is empty for the first page, and
+// reports if there are more
+func SelectPage(ctx context.Context, db *sqlx.DB, org string, filter Filter, after string, size int, fields links.Fieldset) (_ []Payment, more bool, err error) {
+	done := operation(ctx, "select", "")
+	defer func() { done(err) }()
+
+	if after == "" {
+		after = "00000000-0000-0000-0000-000000000000"
+	}
+
+	cols, args := columns(fields, 4)
+	where, whereArgs, err := filter.where(4 + len(args))
+	if err != nil {
+		return nil, false, err
+	}
+	payments := []Payment{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&payments,
+			"SELECT "+cols+" FROM payments WHERE organisation_id=$1 AND id > $2"+where+" ORDER BY id LIMIT $3",
+			append(append([]interface{}{org, after, size + 1}, args...), whereArgs...)...)
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if len(payments) > size {
+		return payments[:size], true, nil
+	}
+	return payments, false, nil
 }
 
-// Select gets all payments
-func Select(db *sqlx.DB) ([]Payment, error) {
+// SelectIn gets the payments of the organisation with the ids
+func SelectIn(ctx context.Context, db *sqlx.DB, org string, ids []string, fields links.Fieldset) (_ []Payment, err error) {
+	done := operation(ctx, "select", "")
+	defer func() { done(err) }()
+
+	cols, args := columns(fields, 3)
 	payments := []Payment{}
-	if err := db.Select(&payments, "SELECT * FROM payments"); err != nil {
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&payments,
+			"SELECT "+cols+" FROM payments WHERE organisation_id=$1 AND id = ANY($2) ORDER BY id",
+			append([]interface{}{org, pq.Array(ids)}, args...)...)
+	}); err != nil {
 		return nil, err
 	}
 
 	return payments, nil
 }
 
-// Get gets single payments
-func Get(db *sqlx.DB, id string) (*Payment, error) {
+// Get gets single payments of the organisation
+func Get(ctx context.Context, db *sqlx.DB, org, id string) (_ *Payment, err error) {
+	done := operation(ctx, "get", id)
+	defer func() { done(err) }()
+
+	payment := Payment{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&payment, "SELECT * FROM payments WHERE id=$1 AND organisation_id=$2", id, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+// GetTx gets the payment of the organisation within a transaction scoped to
+// it
+func GetTx(tx *sqlx.Tx, org, id string) (*Payment, error) {
 	payment := Payment{}
-	if err := db.Get(&payment, "SELECT * FROM payments WHERE id=$1", id); err != nil {
+	if err := tx.Get(&payment, tx.Rebind(`SELECT * FROM payments WHERE id=? AND organisation_id=?`), id, org); err != nil {
 		return nil, err
 	}
 
 	return &payment, nil
 }
 
+// Meta is the non-standard information about a payment resource. The
+// reconciled time is set once the payment is matched to a statement entry.
+type Meta struct {
+	Status       string     `json:"status,omitempty"`
+	Kind         string     `json:"kind,omitempty"`
+	ReconciledAt *time.Time `json:"reconciled_at,omitempty"`
+}
+
 // ResourceData is the data of the payment resource
 type ResourceData struct {
 	*Payment
 
-	Type string `json:"type"`
+	Type          string              `json:"type"`
+	Relationships links.Relationships `json:"relationships,omitempty"`
+	Meta          *Meta               `json:"meta,omitempty"`
 
 	links.Resource
 }
 
 func newResourceData(p *Payment, self string) *ResourceData {
-	return &ResourceData{
+	data := &ResourceData{
 		Payment:  p,
 		Type:     Type,
 		Resource: links.Resource{Links: links.Links{Self: self}},
 	}
+
+	if p.Status != "" {
+		data.Meta = &Meta{Status: p.Status, ReconciledAt: p.ReconciledAt}
+		if p.Kind != KindPayment {
+			data.Meta.Kind = p.Kind
+		}
+	}
+
+	switch {
+	case p.OriginalID != nil:
+		data.Relationships = links.Relationships{
+			"original": links.Related(path.Dir(self)+"/"+*p.OriginalID, &links.Identifier{Type: Type, ID: *p.OriginalID}),
+		}
+	case p.Status == StatusPartiallyRefunded || p.Status == StatusRefunded || p.Status == StatusReversed:
+		data.Relationships = links.Relationships{
+			"refunds": links.Related(self+"/refunds", nil),
+		}
+	}
+
+	return data
+}
+
+// Relate sets the relationship of the payment to the related resources
+func (data *ResourceData) Relate(name string, rel *links.Relationship) {
+	if data.Relationships == nil {
+		data.Relationships = links.Relationships{}
+	}
+	data.Relationships[name] = rel
+}
+
+// Sparse limits the attributes and the relationships of the payment to the
+// fieldset. The attributes are projected on a copy of the payment, so the
+// payment keeps its ETag.
+func (data *ResourceData) Sparse(fields links.Fieldset) error {
+	if fields == nil {
+		return nil
+	}
+
+	attributes, err := fields.Attributes(data.Payment.Attributes)
+	if err != nil {
+		return err
+	}
+	p := *data.Payment
+	p.Attributes = attributes
+	data.Payment = &p
+
+	for name := range data.Relationships {
+		if !fields.Has(name) {
+			delete(data.Relationships, name)
+		}
+	}
+	if len(data.Relationships) == 0 {
+		data.Relationships = nil
+	}
+	return nil
 }
 
 // Resource is a single payment resource
 type Resource struct {
 	Data *ResourceData `json:"data"`
+	links.Document
 }
 
 // NewResource create new resource from Payment
 func NewResource(p *Payment, self string) *Resource {
 	return &Resource{
-		Data: newResourceData(p, self),
+		Data:     newResourceData(p, self),
+		Document: links.NewDocument(),
 	}
 }
 
 // Bind implements render.Binder
 func (resource *Resource) Bind(r *http.Request) error {
 	if resource.Data == nil {
-		return fmt.Errorf("no data")
+		return apierrors.Pointer("/data", fmt.Errorf("no data"))
 	}
 
-	if resource.Data.Type != Type {
-		return fmt.Errorf("wrong type")
+	switch resource.Data.Type {
+	case Type:
+	case "":
+		return apierrors.Pointer("/data/type", fmt.Errorf("no type"))
+	default:
+		return apierrors.Pointer("/data/type", links.ErrType)
 	}
 
 	if resource.Data.Payment == nil || resource.Data.Payment.Attributes == nil {
-		return fmt.Errorf("no payment")
+		return apierrors.Pointer("/data/attributes", fmt.Errorf("no payment"))
 	}
 
 	// TODO: Validate the attributes json based on the business requirements.
@@ -136,19 +425,28 @@ func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
 type ListResource struct {
 	Data []*ResourceData `json:"data"`
 	links.Resource
+	links.Document
 }
 
 // NewListResource returns new payments list resource
 func NewListResource(payments []Payment, self string) *ListResource {
+	return NewRelatedListResource(payments, self, self)
+}
+
+// NewRelatedListResource returns new payments list resource for payments
+// related to another resource. The payments are linked under base.
+func NewRelatedListResource(payments []Payment, self, base string) *ListResource {
 	listResource := &ListResource{
 		Data:     []*ResourceData{},
 		Resource: links.Resource{Links: links.Links{Self: self}},
+		Document: links.NewDocument(),
 	}
 	for i := range payments {
 		listResource.Data = append(
-			listResource.Data, newResourceData(&payments[i], self+"/"+payments[i].ID),
+			listResource.Data, newResourceData(&payments[i], base+"/"+payments[i].ID),
 		)
 	}
+	listResource.Meta = map[string]interface{}{"count": len(listResource.Data)}
 
 	return listResource
 }
@@ -0,0 +1,202 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/VMitov/payments/pkg/links"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Kinds of payments
+const (
+	KindPayment  = "payment"
+	KindRefund   = "refund"
+	KindReversal = "reversal"
+)
+
+var (
+	// ErrNotRefundable is returned when the payment can not be refunded
+	ErrNotRefundable = errors.New("payment can not be refunded")
+	// ErrRefundExceedsOriginal is returned when the refunded amounts would exceed the original amount
+	ErrRefundExceedsOriginal = errors.New("refunds exceed the original amount")
+	// ErrInvalidRefundAmount is returned when the amount of the refund is not a positive amount
+	ErrInvalidRefundAmount = errors.New("invalid refund amount")
+	// ErrRefundCurrency is returned when the currency of the refund differs from the original currency
+	ErrRefundCurrency = errors.New("refund currency differs from the original")
+)
+
+// Refund persists a refund or a reversal of the original payment of the
+// organisation and updates the status of the original. A reversal always
+// returns the remaining amount. A refund without an amount refunds the
+// remaining amount. The hook may be nil.
+func Refund(ctx context.Context, db *sqlx.DB, org, originalID, kind string, refund *Payment, hook Hook) (id string, err error) {
+	done := operation(ctx, kind, originalID)
+	defer func() { done(err) }()
+
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	original := Payment{}
+	if err := tx.Get(&original, tx.Rebind(
+		`SELECT * FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), originalID, org,
+	); err != nil {
+		return "", err
+	}
+	if original.Kind != KindPayment {
+		return "", errors.Wrap(ErrNotRefundable, "refunds can not be refunded")
+	}
+
+	originalDetails, err := original.Details()
+	if err != nil {
+		return "", err
+	}
+
+	var refunded decimal.Decimal
+	if err := tx.Get(&refunded, tx.Rebind(
+		`SELECT COALESCE(SUM((attributes->>'amount')::numeric), 0) FROM payments WHERE original_id=?`),
+		originalID,
+	); err != nil {
+		return "", err
+	}
+	remaining := originalDetails.Amount.Sub(refunded)
+
+	details, err := refund.Details()
+	if err != nil {
+		return "", errors.Wrap(ErrInvalidRefundAmount, err.Error())
+	}
+	if details.Amount.IsNegative() {
+		return "", errors.Wrapf(ErrInvalidRefundAmount, "%s is negative", details.Amount)
+	}
+	if details.Currency != "" && details.Currency != originalDetails.Currency {
+		return "", errors.Wrapf(ErrRefundCurrency, "%s is not %s", details.Currency, originalDetails.Currency)
+	}
+
+	// The refund is in the minor units of the original, so the amount that
+	// is checked is the amount that is refunded
+	places := -originalDetails.Amount.Exponent()
+	if places < 0 {
+		places = 0
+	}
+	if !details.Amount.Equal(details.Amount.Round(places)) {
+		return "", errors.Wrapf(ErrInvalidRefundAmount, "%s has more than %d decimal places", details.Amount, places)
+	}
+
+	amount := details.Amount
+	if kind == KindReversal || amount.IsZero() {
+		amount = remaining
+	}
+	if !amount.IsPositive() {
+		return "", errors.Wrap(ErrNotRefundable, "nothing left to refund")
+	}
+	if amount.GreaterThan(remaining) {
+		return "", errors.Wrapf(ErrRefundExceedsOriginal, "%s remaining", remaining)
+	}
+
+	if err := refund.SetAttributes(map[string]interface{}{
+		"amount":   amount.StringFixed(places),
+		"currency": originalDetails.Currency,
+	}); err != nil {
+		return "", err
+	}
+
+	status := StatusPartiallyRefunded
+	if kind == KindReversal {
+		status = StatusReversed
+	} else if amount.Equal(remaining) {
+		status = StatusRefunded
+	}
+	if err := SetStatusTx(tx, org, originalID, status); errors.Cause(err) == ErrInvalidTransition {
+		return "", errors.Wrap(ErrNotRefundable, err.Error())
+	} else if err != nil {
+		return "", err
+	}
+
+	if err := tx.Get(&id, tx.Rebind(
+		`INSERT INTO payments (organisation_id, attributes, kind, original_id) VALUES (?, ?, ?, ?) RETURNING id`),
+		org, string(refund.Attributes), kind, originalID,
+	); err != nil {
+		return "", err
+	}
+
+	if hook != nil {
+		if err := hook(tx, id); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	countCreated(kind, refund)
+	logCreated(ctx, kind, id, refund)
+	return id, nil
+}
+
+// SelectRefunds gets the refunds and reversals of a payment of the organisation
+func SelectRefunds(ctx context.Context, db *sqlx.DB, org, originalID string) (_ []Payment, err error) {
+	done := operation(ctx, "select_refunds", originalID)
+	defer func() { done(err) }()
+
+	payments := []Payment{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&payments,
+			"SELECT * FROM payments WHERE original_id=$1 AND organisation_id=$2", originalID, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// SelectRefundsOf gets the refunds and reversals of the payments of the
+// organisation
+func SelectRefundsOf(ctx context.Context, db *sqlx.DB, org string, originalIDs []string, fields links.Fieldset) (_ []Payment, err error) {
+	done := operation(ctx, "select_refunds", "")
+	defer func() { done(err) }()
+
+	cols, args := columns(fields, 3)
+	payments := []Payment{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&payments,
+			"SELECT "+cols+" FROM payments WHERE original_id = ANY($1) AND organisation_id=$2 ORDER BY id",
+			append([]interface{}{pq.Array(originalIDs), org}, args...)...)
+	}); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// SetAttributes sets top level attributes of the payment
+func (p *Payment) SetAttributes(values map[string]interface{}) error {
+	attributes := map[string]json.RawMessage{}
+	if len(p.Attributes) != 0 {
+		if err := json.Unmarshal(p.Attributes, &attributes); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range values {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		attributes[k] = raw
+	}
+
+	raw, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
+	p.Attributes = raw
+	return nil
+}
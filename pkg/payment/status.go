@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Payment statuses
+const (
+	StatusCreated           = "created"
+	StatusHeld              = "held"
+	StatusPendingApproval   = "pending_approval"
+	StatusSubmitted         = "submitted"
+	StatusSettled           = "settled"
+	StatusRejected          = "rejected"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+	StatusReversed          = "reversed"
+)
+
+// ErrInvalidTransition is returned when a payment can not move to a status
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+var transitions = map[string][]string{
+	StatusCreated:           {StatusHeld, StatusPendingApproval, StatusSubmitted, StatusRejected, StatusPartiallyRefunded, StatusRefunded, StatusReversed},
+	StatusSubmitted:         {StatusSettled, StatusRejected, StatusPartiallyRefunded, StatusRefunded, StatusReversed},
+	StatusSettled:           {StatusPartiallyRefunded, StatusRefunded, StatusReversed},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded, StatusReversed},
+	StatusHeld:              {StatusHeld, StatusCreated, StatusPendingApproval, StatusRejected},
+	StatusPendingApproval:   {StatusCreated, StatusHeld, StatusRejected},
+}
+
+// CanTransition reports if a payment can move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the payment of the organisation to a new status if the
+// transition is allowed
+func SetStatus(db *sqlx.DB, org, id, to string) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return SetStatusTx(tx, org, id, to)
+	})
+}
+
+// SetStatusTx moves the payment of the organisation to a new status within a
+// transaction scoped to it
+func SetStatusTx(tx *sqlx.Tx, org, id, to string) error {
+	var from string
+	if err := tx.Get(&from, tx.Rebind(
+		`SELECT status FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), id, org,
+	); err != nil {
+		return err
+	}
+
+	if !CanTransition(from, to) {
+		return errors.Wrapf(ErrInvalidTransition, "from %s to %s", from, to)
+	}
+
+	if _, err := tx.Exec(tx.Rebind(`UPDATE payments SET status=? WHERE id=? AND organisation_id=?`), to, id, org); err != nil {
+		return err
+	}
+
+	transitionsTotal.Inc(from, to)
+	return nil
+}
+
+// ReleaseTx moves a held payment of the organisation back to created or to
+// pending approval when it still waits for approvals. The hook runs if the
+// payment is moved to created and may be nil.
+func ReleaseTx(tx *sqlx.Tx, org, id string, released Hook) error {
+	var pending bool
+	if err := tx.Get(&pending, tx.Rebind(
+		`SELECT EXISTS (SELECT 1 FROM approval_requests WHERE payment_id=? AND organisation_id=? AND status='pending')`), id, org,
+	); err != nil {
+		return err
+	}
+
+	if pending {
+		return SetStatusTx(tx, org, id, StatusPendingApproval)
+	}
+	if err := SetStatusTx(tx, org, id, StatusCreated); err != nil || released == nil {
+		return err
+	}
+	return released(tx, id)
+}
@@ -0,0 +1,122 @@
+package quota
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// Periods of the quotas
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// Limits are the numbers of payments an organisation can create in a day
+// and in a month. Zero does not limit the period.
+type Limits struct {
+	Daily   int
+	Monthly int
+}
+
+// Enabled reports if the limits limit anything
+func (l Limits) Enabled() bool {
+	return l.Daily > 0 || l.Monthly > 0
+}
+
+// Usage is the use of the quota of a period
+type Usage struct {
+	Period string    `json:"period"`
+	Start  time.Time `json:"start"`
+	Reset  time.Time `json:"reset"`
+	Used   int       `json:"used"`
+	// Limit and Remaining are omitted when the period is not limited
+	Limit     int `json:"limit,omitempty"`
+	Remaining int `json:"remaining,omitempty"`
+}
+
+// ExceededError is returned when creating a payment would exceed a quota
+type ExceededError struct {
+	Period string
+	Limit  int
+	Reset  time.Time
+}
+
+func (err *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %d payments exceeded until %s", err.Period, err.Limit, err.Reset.Format(time.RFC3339))
+}
+
+type period struct {
+	name         string
+	limit        int
+	start, reset time.Time
+}
+
+// periods are the periods containing the time. They start at midnight UTC.
+func (l Limits) periods(now time.Time) []period {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	return []period{
+		{name: PeriodDaily, limit: l.Daily, start: day, reset: day.AddDate(0, 0, 1)},
+		{name: PeriodMonthly, limit: l.Monthly, start: month, reset: month.AddDate(0, 1, 0)},
+	}
+}
+
+// Consume counts the creation of a payment of the organisation against its
+// quotas or returns an ExceededError without counting it
+func Consume(db *sqlx.DB, org string, limits Limits, now time.Time) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return ConsumeTx(tx, org, limits, now)
+	})
+}
+
+// ConsumeTx consumes the quotas within a transaction scoped to the
+// organisation. The counts are rolled back with the transaction.
+func ConsumeTx(tx *sqlx.Tx, org string, limits Limits, now time.Time) error {
+	for _, p := range limits.periods(now) {
+		var used int
+		if err := tx.Get(&used, tx.Rebind(
+			`INSERT INTO payment_quota_usage (organisation_id, period, period_start, used) VALUES (?, ?, ?, 1)
+			ON CONFLICT (organisation_id, period, period_start) DO UPDATE SET used = payment_quota_usage.used + 1
+			RETURNING used`), org, p.name, p.start,
+		); err != nil {
+			return err
+		}
+
+		if p.limit > 0 && used > p.limit {
+			return &ExceededError{Period: p.name, Limit: p.limit, Reset: p.reset}
+		}
+	}
+
+	return nil
+}
+
+// Get gets the usage of the quotas of the organisation in the periods
+// containing the time
+func Get(db *sqlx.DB, org string, limits Limits, now time.Time) ([]Usage, error) {
+	usage := []Usage{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		for _, p := range limits.periods(now) {
+			u := Usage{Period: p.name, Start: p.start, Reset: p.reset, Limit: p.limit}
+			if err := tx.Get(&u.Used, tx.Rebind(
+				`SELECT COALESCE(SUM(used), 0) FROM payment_quota_usage WHERE organisation_id=? AND period=? AND period_start=?`),
+				org, p.name, p.start,
+			); err != nil {
+				return err
+			}
+			if p.limit > 0 && u.Used < p.limit {
+				u.Remaining = p.limit - u.Used
+			}
+			usage = append(usage, u)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
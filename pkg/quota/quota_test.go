@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+const org = "00000000-0000-0000-0000-000000000001"
+
+func TestConsume(t *testing.T) {
+	now := time.Date(2018, 10, 31, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+	day := time.Date(2018, 10, 31, 0, 0, 0, 0, time.UTC)
+	month := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		limits   Limits
+		daily    int
+		monthly  int
+		exceeded string
+	}{
+		"Unlimited":       {limits: Limits{}, daily: 500, monthly: 9000},
+		"WithinLimits":    {limits: Limits{Daily: 10, Monthly: 100}, daily: 10, monthly: 100},
+		"DailyExceeded":   {limits: Limits{Daily: 10, Monthly: 100}, daily: 11, exceeded: PeriodDaily},
+		"MonthlyExceeded": {limits: Limits{Monthly: 100}, daily: 50, monthly: 101, exceeded: PeriodMonthly},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("INSERT INTO payment_quota_usage").WithArgs(org, PeriodDaily, day).
+				WillReturnRows(sqlmock.NewRows([]string{"used"}).AddRow(tc.daily))
+			if tc.exceeded != PeriodDaily {
+				mock.ExpectQuery("INSERT INTO payment_quota_usage").WithArgs(org, PeriodMonthly, month).
+					WillReturnRows(sqlmock.NewRows([]string{"used"}).AddRow(tc.monthly))
+			}
+			if tc.exceeded == "" {
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			err = Consume(sqlx.NewDb(mockDB, "sqlmock"), org, tc.limits, now)
+			if tc.exceeded == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if e, ok := err.(*ExceededError); !ok || e.Period != tc.exceeded {
+				t.Errorf("expected %s quota exceeded, got %v", tc.exceeded, err)
+			} else if e.Period == PeriodDaily && !e.Reset.Equal(day.AddDate(0, 0, 1)) {
+				t.Errorf("expected the quota to reset at %s, got %s", day.AddDate(0, 0, 1), e.Reset)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package quota
+
+import (
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Type is the type of the quota usage resource
+const Type = "QuotaUsage"
+
+// ResourceData is the data of the quota usage resource
+type ResourceData struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Periods []Usage `json:"periods"`
+	} `json:"attributes"`
+
+	links.Resource
+}
+
+// Resource is the quota usage of an organisation
+type Resource struct {
+	Data *ResourceData `json:"data"`
+}
+
+// NewResource creates new resource from the usage of the organisation
+func NewResource(org string, usage []Usage, self string) *Resource {
+	data := &ResourceData{
+		ID:       org,
+		Type:     Type,
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	data.Attributes.Periods = usage
+	return &Resource{Data: data}
+}
+
+// Render implements render.Render
+func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
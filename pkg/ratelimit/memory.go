@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneEvery is the number of takes between removing the full buckets
+const pruneEvery = 10000
+
+// Memory keeps the buckets in memory. The limits hold per replica.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemory returns an empty in memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*memoryBucket{}}
+}
+
+// Take implements Store
+func (m *Memory) Take(key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.takes++
+	if m.takes%pruneEvery == 0 {
+		m.prune(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{Tokens: float64(limit.Burst), Updated: now}}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+
+	return b.take(limit, now), nil
+}
+
+// prune removes the buckets that have refilled since they were used as they
+// are the same as new ones
+func (m *Memory) prune(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.Updated) >= b.limit.Window() {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres keeps the buckets in the database so the limits hold across the
+// replicas of the service
+type Postgres struct {
+	DB *sqlx.DB
+}
+
+// Take implements Store. The row of the bucket is locked while it is
+// updated so concurrent requests take tokens one after another.
+func (p Postgres) Take(key string, limit Limit, now time.Time) (Result, error) {
+	tx, err := p.DB.Beginx()
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, $3) ON CONFLICT (key) DO NOTHING`,
+		key, limit.Burst, now,
+	); err != nil {
+		return Result{}, err
+	}
+
+	b := bucket{}
+	if err := tx.Get(&b, `SELECT tokens, updated_at FROM rate_limits WHERE key=$1 FOR UPDATE`, key); err != nil {
+		return Result{}, err
+	}
+
+	res := b.take(limit, now)
+	if _, err := tx.Exec(
+		`UPDATE rate_limits SET tokens=$2, updated_at=$3 WHERE key=$1`, key, b.Tokens, b.Updated,
+	); err != nil {
+		return Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// Prune deletes the buckets not used since the time. They are recreated full
+// when they are used again.
+func (p Postgres) Prune(before time.Time) error {
+	_, err := p.DB.Exec(`DELETE FROM rate_limits WHERE updated_at < $1`, before)
+	return err
+}
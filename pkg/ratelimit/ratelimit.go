@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Classes of the routes with separate limits
+const (
+	ClassRead   = "read"
+	ClassWrite  = "write"
+	ClassExport = "export"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second that holds up
+// to Burst tokens. Every request takes a token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+var periods = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// ParseLimit parses a limit like 100/m of requests per second, minute or
+// hour. The burst is the number of requests unless it follows a colon as in
+// 100/m:20. An empty limit or 0 disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return Limit{}, nil
+	}
+
+	rate, burst := s, ""
+	if i := strings.Index(s, ":"); i != -1 {
+		rate, burst = s[:i], s[i+1:]
+	}
+
+	parts := strings.SplitN(rate, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/period", s)
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid number of requests in limit %q", s)
+	}
+	period, ok := periods[parts[1]]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid period in limit %q, expected s, m or h", s)
+	}
+
+	l := Limit{Rate: float64(n) / period.Seconds(), Burst: n}
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst in limit %q", s)
+		}
+	}
+
+	return l, nil
+}
+
+// Enabled reports if the limit limits anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Window is the time it takes the empty bucket to refill
+func (l Limit) Window() time.Duration {
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a denied request is allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the clients
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+// bucket is the state of a token bucket
+type bucket struct {
+	Tokens  float64   `db:"tokens"`
+	Updated time.Time `db:"updated_at"`
+}
+
+// take refills the bucket for the time since it was last updated and takes
+// a token if there is one
+func (b *bucket) take(limit Limit, now time.Time) Result {
+	elapsed := now.Sub(b.Updated).Seconds()
+	if elapsed < 0 {
+		// Clocks of the replicas differ
+		elapsed = 0
+	}
+	b.Tokens = math.Min(float64(limit.Burst), b.Tokens+elapsed*limit.Rate)
+	b.Updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / limit.Rate)
+	}
+	res.Remaining = int(math.Floor(b.Tokens))
+	res.Reset = seconds((float64(limit.Burst) - b.Tokens) / limit.Rate)
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestParseLimit(t *testing.T) {
+	testCases := map[string]struct {
+		limit    string
+		expected Limit
+		err      bool
+	}{
+		"Empty":          {limit: "", expected: Limit{}},
+		"Zero":           {limit: "0", expected: Limit{}},
+		"PerSecond":      {limit: "10/s", expected: Limit{Rate: 10, Burst: 10}},
+		"PerMinute":      {limit: "120/m", expected: Limit{Rate: 2, Burst: 120}},
+		"PerHour":        {limit: "3600/h:100", expected: Limit{Rate: 1, Burst: 100}},
+		"NoPeriod":       {limit: "10", err: true},
+		"UnknownPeriod":  {limit: "10/d", err: true},
+		"NegativeNumber": {limit: "-1/s", err: true},
+		"InvalidBurst":   {limit: "10/s:x", err: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			l, err := ParseLimit(tc.limit)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", l)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, l)
+			}
+		})
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	m := NewMemory()
+	limit := Limit{Rate: 1, Burst: 3}
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after      time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{allowed: true, remaining: 2},
+		{allowed: true, remaining: 1},
+		{allowed: true, remaining: 0},
+		{allowed: false, remaining: 0, retryAfter: time.Second},
+		{after: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+		{after: 500 * time.Millisecond, allowed: true, remaining: 0},
+		{after: 10 * time.Second, allowed: true, remaining: 2},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.after)
+		res, err := m.Take("client", limit, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != step.allowed || res.Remaining != step.remaining || res.RetryAfter != step.retryAfter {
+			t.Errorf("step %d: expected allowed %v remaining %d retry after %s, got %+v",
+				i, step.allowed, step.remaining, step.retryAfter, res)
+		}
+		if res.Limit != 3 {
+			t.Errorf("step %d: expected limit 3, got %d", i, res.Limit)
+		}
+	}
+
+	if res, _ := m.Take("other", limit, now); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("expected a separate bucket for another client, got %+v", res)
+	}
+}
+
+func TestPostgresTake(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	now := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	limit := Limit{Rate: 1, Burst: 10}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO rate_limits").WithArgs("read:alice", 10, now).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT tokens, updated_at FROM rate_limits").WithArgs("read:alice").
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_at"}).AddRow(0.5, now.Add(-2*time.Second)))
+	mock.ExpectExec("UPDATE rate_limits").WithArgs("read:alice", 1.5, now).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	res, err := Postgres{DB: sqlx.NewDb(mockDB, "sqlmock")}.Take("read:alice", limit, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 1 || res.Reset != 8500*time.Millisecond {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,198 @@
+package reconcile
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/statement"
+	"github.com/shopspring/decimal"
+)
+
+// Matching methods
+const (
+	MethodReference = "reference"
+	MethodFuzzy     = "fuzzy"
+	MethodManual    = "manual"
+)
+
+// Tolerance configures how strict the automatic matching is
+type Tolerance struct {
+	// Amount is the maximum absolute difference between the amounts
+	Amount decimal.Decimal
+	// Days is the maximum number of days between the processing date
+	// of the payment and the value date of the entry
+	Days int
+	// RequireReference disables matching on amount, currency and date
+	// alone when the end-to-end references differ
+	RequireReference bool
+}
+
+// Pair is a payment matched to a statement entry
+type Pair struct {
+	PaymentID string
+	EntryID   string
+	Method    string
+}
+
+// Result is the outcome of matching payments to statement entries
+type Result struct {
+	Matches           []Pair
+	UnmatchedPayments []Unmatched
+	UnmatchedEntries  []Unmatched
+}
+
+// Unmatched is an item that could not be matched and the reason why
+type Unmatched struct {
+	ID     string
+	Reason string
+}
+
+type candidate struct {
+	id      string
+	details *payment.Details
+	// direction is the side of the account the payment is booked on, the
+	// payments leave it and the refunds and reversals come back to it
+	direction string
+	matched   bool
+}
+
+// MatchEntries pairs the payments with the statement entries.
+// Entries are matched by end-to-end reference first and then, unless the
+// tolerance requires references, by amount, currency and value date when
+// there is exactly one candidate payment.
+// Only payments with a processing date in the period of the entries are
+// reported as unmatched.
+func MatchEntries(payments []payment.Payment, entries []statement.Entry, tol Tolerance) *Result {
+	result := &Result{}
+
+	candidates := []*candidate{}
+	for i := range payments {
+		details, err := payments[i].Details()
+		if err != nil {
+			continue
+		}
+		direction := statement.Debit
+		if payments[i].Kind == payment.KindRefund || payments[i].Kind == payment.KindReversal {
+			direction = statement.Credit
+		}
+		candidates = append(candidates, &candidate{id: payments[i].ID, details: details, direction: direction})
+	}
+
+	byReference := map[string][]*candidate{}
+	for _, c := range candidates {
+		if ref := normaliseReference(c.details.EndToEndReference); ref != "" {
+			byReference[ref] = append(byReference[ref], c)
+		}
+	}
+
+	unmatched := []*statement.Entry{}
+	for i := range entries {
+		e := &entries[i]
+		var found *candidate
+		for _, c := range byReference[normaliseReference(e.Reference)] {
+			if !c.matched && tol.accepts(c, e) {
+				found = c
+				break
+			}
+		}
+
+		if found == nil {
+			unmatched = append(unmatched, e)
+			continue
+		}
+
+		found.matched = true
+		result.Matches = append(result.Matches, Pair{PaymentID: found.id, EntryID: e.ID, Method: MethodReference})
+	}
+
+	for _, e := range unmatched {
+		var found *candidate
+		if !tol.RequireReference {
+			found = tol.single(candidates, e)
+		}
+
+		if found == nil {
+			result.UnmatchedEntries = append(result.UnmatchedEntries, Unmatched{ID: e.ID, Reason: "no matching payment"})
+			continue
+		}
+
+		found.matched = true
+		result.Matches = append(result.Matches, Pair{PaymentID: found.id, EntryID: e.ID, Method: MethodFuzzy})
+	}
+
+	from, to, ok := period(entries)
+	for _, c := range candidates {
+		if c.matched || !ok || c.details.ProcessingDate.IsZero() {
+			continue
+		}
+		date := c.details.ProcessingDate
+		if date.Before(from.AddDate(0, 0, -tol.Days)) || date.After(to.AddDate(0, 0, tol.Days)) {
+			continue
+		}
+		result.UnmatchedPayments = append(result.UnmatchedPayments, Unmatched{ID: c.id, Reason: "no matching statement entry"})
+	}
+
+	return result
+}
+
+// single returns the only unmatched candidate accepted for the entry
+func (tol Tolerance) single(candidates []*candidate, e *statement.Entry) *candidate {
+	var found *candidate
+	for _, c := range candidates {
+		if c.matched || !tol.accepts(c, e) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = c
+	}
+
+	return found
+}
+
+func (tol Tolerance) accepts(c *candidate, e *statement.Entry) bool {
+	d := c.details
+	if e.CreditDebit != c.direction || !strings.EqualFold(d.Currency, e.Currency) {
+		return false
+	}
+
+	if d.Amount.Abs().Sub(e.Amount.Abs()).Abs().GreaterThan(tol.Amount) {
+		return false
+	}
+
+	if d.ProcessingDate.IsZero() {
+		return true
+	}
+
+	return absDays(d.ProcessingDate.Sub(e.ValueDate)) <= tol.Days
+}
+
+func period(entries []statement.Entry) (from, to time.Time, ok bool) {
+	for _, e := range entries {
+		if e.ValueDate.IsZero() {
+			continue
+		}
+		if !ok || e.ValueDate.Before(from) {
+			from = e.ValueDate
+		}
+		if !ok || e.ValueDate.After(to) {
+			to = e.ValueDate
+		}
+		ok = true
+	}
+
+	return from, to, ok
+}
+
+func absDays(d time.Duration) int {
+	if d < 0 {
+		d = -d
+	}
+	return int(d.Hours() / 24)
+}
+
+func normaliseReference(ref string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(ref), ""))
+}
@@ -0,0 +1,115 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/statement"
+	"github.com/shopspring/decimal"
+)
+
+func TestMatchEntries(t *testing.T) {
+	pay := func(id, attributes string) payment.Payment {
+		return payment.Payment{ID: id, Attributes: json.RawMessage(attributes), Kind: payment.KindPayment}
+	}
+	refund := func(id, attributes string) payment.Payment {
+		return payment.Payment{ID: id, Attributes: json.RawMessage(attributes), Kind: payment.KindRefund}
+	}
+	entry := func(id, ref, amount, date string) statement.Entry {
+		valueDate, _ := time.Parse("2006-01-02", date)
+		return statement.Entry{
+			ID: id, Reference: ref, Amount: decimal.RequireFromString(amount),
+			Currency: "GBP", CreditDebit: statement.Debit, ValueDate: valueDate,
+		}
+	}
+	credit := func(e statement.Entry) statement.Entry {
+		e.CreditDebit = statement.Credit
+		return e
+	}
+
+	testCases := map[string]struct {
+		payments []payment.Payment
+		entries  []statement.Entry
+		tol      Tolerance
+		expected *Result
+	}{
+		"Reference": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","end_to_end_reference":"ref 1","processing_date":"2018-10-01"}`),
+			},
+			entries:  []statement.Entry{entry("e1", "REF1", "10", "2018-10-01")},
+			expected: &Result{Matches: []Pair{{PaymentID: "p1", EntryID: "e1", Method: MethodReference}}},
+		},
+		"AmountTolerance": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","end_to_end_reference":"REF1","processing_date":"2018-10-01"}`),
+			},
+			entries:  []statement.Entry{entry("e1", "REF1", "10.05", "2018-10-02")},
+			tol:      Tolerance{Amount: decimal.RequireFromString("0.1"), Days: 1},
+			expected: &Result{Matches: []Pair{{PaymentID: "p1", EntryID: "e1", Method: MethodReference}}},
+		},
+		"Fuzzy": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","processing_date":"2018-10-01"}`),
+				pay("p2", `{"amount":"20.00","currency":"GBP","processing_date":"2018-10-01"}`),
+			},
+			entries: []statement.Entry{entry("e1", "", "20", "2018-10-01")},
+			expected: &Result{
+				Matches:           []Pair{{PaymentID: "p2", EntryID: "e1", Method: MethodFuzzy}},
+				UnmatchedPayments: []Unmatched{{ID: "p1", Reason: "no matching statement entry"}},
+			},
+		},
+		"Ambiguous": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","processing_date":"2018-10-01"}`),
+				pay("p2", `{"amount":"10.00","currency":"GBP","processing_date":"2018-10-01"}`),
+			},
+			entries: []statement.Entry{entry("e1", "", "10", "2018-10-01")},
+			expected: &Result{
+				UnmatchedPayments: []Unmatched{
+					{ID: "p1", Reason: "no matching statement entry"},
+					{ID: "p2", Reason: "no matching statement entry"},
+				},
+				UnmatchedEntries: []Unmatched{{ID: "e1", Reason: "no matching payment"}},
+			},
+		},
+		"RequireReference": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","end_to_end_reference":"REF1"}`),
+			},
+			entries:  []statement.Entry{entry("e1", "REF2", "10", "2018-10-01")},
+			tol:      Tolerance{RequireReference: true},
+			expected: &Result{UnmatchedEntries: []Unmatched{{ID: "e1", Reason: "no matching payment"}}},
+		},
+		"Direction": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","end_to_end_reference":"REF1","processing_date":"2018-10-01"}`),
+				refund("r1", `{"amount":"10.00","currency":"GBP","end_to_end_reference":"REF1","processing_date":"2018-10-01"}`),
+			},
+			entries: []statement.Entry{credit(entry("e1", "REF1", "10", "2018-10-01"))},
+			expected: &Result{
+				Matches:           []Pair{{PaymentID: "r1", EntryID: "e1", Method: MethodReference}},
+				UnmatchedPayments: []Unmatched{{ID: "p1", Reason: "no matching statement entry"}},
+			},
+		},
+		"OutsidePeriod": {
+			payments: []payment.Payment{
+				pay("p1", `{"amount":"10.00","currency":"GBP","processing_date":"2018-12-01"}`),
+			},
+			entries:  []statement.Entry{entry("e1", "", "10", "2018-10-01")},
+			expected: &Result{UnmatchedEntries: []Unmatched{{ID: "e1", Reason: "no matching payment"}}},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := MatchEntries(tc.payments, tc.entries, tc.tol)
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("got %+v, want %+v", result, tc.expected)
+			}
+		})
+	}
+}
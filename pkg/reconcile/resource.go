@@ -0,0 +1,98 @@
+package reconcile
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the reconciliation resources
+const (
+	MatchType     = "Reconciliation"
+	ExceptionType = "ReconciliationException"
+)
+
+// MatchResourceData is the data of the reconciliation resource
+type MatchResourceData struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes *Match `json:"attributes"`
+
+	links.Resource
+}
+
+// MatchResource is a single reconciliation resource
+type MatchResource struct {
+	Data *MatchResourceData `json:"data"`
+}
+
+// NewMatchResource creates new resource from Match
+func NewMatchResource(m *Match, self string) *MatchResource {
+	return &MatchResource{
+		Data: &MatchResourceData{
+			ID:         m.ID,
+			Type:       MatchType,
+			Attributes: m,
+			Resource:   links.Resource{Links: links.Links{Self: self}},
+		},
+	}
+}
+
+// Bind implements render.Binder
+func (resource *MatchResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != MatchType {
+		return fmt.Errorf("wrong type")
+	}
+
+	if resource.Data.Attributes == nil ||
+		resource.Data.Attributes.PaymentID == "" || resource.Data.Attributes.EntryID == "" {
+		return fmt.Errorf("payment_id and entry_id are required")
+	}
+
+	return nil
+}
+
+// Render implements render.Render
+func (resource *MatchResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// ExceptionResourceData is the data of the reconciliation exception resource
+type ExceptionResourceData struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Attributes *Exception `json:"attributes"`
+}
+
+// ExceptionListResource is a list of reconciliation exceptions resource
+type ExceptionListResource struct {
+	Data []*ExceptionResourceData `json:"data"`
+	links.Resource
+}
+
+// NewExceptionListResource returns new reconciliation exceptions list resource
+func NewExceptionListResource(exceptions []Exception, self string) *ExceptionListResource {
+	list := &ExceptionListResource{
+		Data:     []*ExceptionResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range exceptions {
+		list.Data = append(list.Data, &ExceptionResourceData{
+			ID:         exceptions[i].ID,
+			Type:       ExceptionType,
+			Attributes: &exceptions[i],
+		})
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ExceptionListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
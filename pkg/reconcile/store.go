@@ -0,0 +1,216 @@
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/statement"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// Kinds of reconciliation exceptions
+const (
+	KindPayment = "payment"
+	KindEntry   = "entry"
+)
+
+// ErrAlreadyMatched is returned when the payment or the entry is already reconciled
+var ErrAlreadyMatched = errors.New("already reconciled")
+
+// Match links a payment to the statement entry that settled it
+type Match struct {
+	ID        string    `db:"id"         json:"-"`
+	PaymentID string    `db:"payment_id" json:"payment_id"`
+	EntryID   string    `db:"entry_id"   json:"entry_id"`
+	Method    string    `db:"method"     json:"method"`
+	MatchedAt time.Time `db:"matched_at" json:"matched_at"`
+}
+
+// Exception is a payment or a statement entry that needs manual matching
+type Exception struct {
+	ID             string     `db:"id"              json:"-"`
+	OrganisationID string     `db:"organisation_id" json:"-"`
+	Kind           string     `db:"kind"            json:"kind"`
+	ItemID         string     `db:"item_id"         json:"item_id"`
+	Reason         string     `db:"reason"          json:"reason"`
+	CreatedAt      time.Time  `db:"created_at"      json:"created_at"`
+	ResolvedAt     *time.Time `db:"resolved_at"     json:"resolved_at,omitempty"`
+}
+
+// UnreconciledTx gets all payments of the organisation without a matching
+// statement entry and locks them until the end of the transaction, so
+// concurrent reconciliations do not match them twice
+func UnreconciledTx(tx *sqlx.Tx, org string) ([]payment.Payment, error) {
+	payments := []payment.Payment{}
+	if err := tx.Select(&payments,
+		`SELECT * FROM payments WHERE organisation_id=$1 AND reconciled_at IS NULL FOR UPDATE`, org,
+	); err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// ReconcileTx matches the statement entries against the unreconciled
+// payments of the organisation, stores the matches and records exceptions
+// for everything left unmatched within a transaction scoped to it
+func ReconcileTx(tx *sqlx.Tx, org string, entries []statement.Entry, tol Tolerance) (*Result, error) {
+	payments, err := UnreconciledTx(tx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	result := MatchEntries(payments, entries, tol)
+	for _, m := range result.Matches {
+		if err := insertMatch(tx, m.PaymentID, m.EntryID, m.Method, &Match{}); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range result.UnmatchedPayments {
+		if err := insertException(tx, org, KindPayment, u.ID, u.Reason); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range result.UnmatchedEntries {
+		if err := insertException(tx, org, KindEntry, u.ID, u.Reason); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// CreateMatch manually matches a payment to a statement entry of the
+// organisation and resolves the open exceptions of both
+func CreateMatch(db *sqlx.DB, org, paymentID, entryID string) (*Match, error) {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var matched bool
+	if err := tx.Get(&matched, tx.Rebind(
+		`SELECT EXISTS (SELECT 1 FROM reconciliations WHERE payment_id=? OR entry_id=?)`),
+		paymentID, entryID,
+	); err != nil {
+		return nil, err
+	}
+	if matched {
+		return nil, ErrAlreadyMatched
+	}
+
+	match := &Match{}
+	if err := insertMatch(tx, paymentID, entryID, MethodManual, match); err != nil {
+		return nil, err
+	}
+
+	return match, tx.Commit()
+}
+
+// DeleteMatch removes a match of the organisation and reopens exceptions for both sides
+func DeleteMatch(db *sqlx.DB, org, id string) error {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	match := Match{}
+	if err := tx.Get(&match, tx.Rebind(`DELETE FROM reconciliations r USING payments p
+		WHERE r.id=? AND p.id = r.payment_id AND p.organisation_id=? RETURNING r.*`), id, org,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(tx.Rebind(`UPDATE payments SET reconciled_at=NULL WHERE id=?`), match.PaymentID); err != nil {
+		return err
+	}
+
+	if err := insertException(tx, org, KindPayment, match.PaymentID, "manually unmatched"); err != nil {
+		return err
+	}
+	if err := insertException(tx, org, KindEntry, match.EntryID, "manually unmatched"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMatch gets a single match of the organisation
+func GetMatch(db *sqlx.DB, org, id string) (*Match, error) {
+	match := Match{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&match, `SELECT r.* FROM reconciliations r JOIN payments p ON p.id = r.payment_id
+			WHERE r.id=$1 AND p.organisation_id=$2`, id, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+// GetMatchByPayment gets the match of a payment of the organisation
+func GetMatchByPayment(db *sqlx.DB, org, paymentID string) (*Match, error) {
+	match := Match{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&match, `SELECT r.* FROM reconciliations r JOIN payments p ON p.id = r.payment_id
+			WHERE r.payment_id=$1 AND p.organisation_id=$2`, paymentID, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &match, nil
+}
+
+// SelectExceptions gets the exceptions of the organisation, only the open
+// ones unless all is set
+func SelectExceptions(db *sqlx.DB, org string, all bool) ([]Exception, error) {
+	query := "SELECT * FROM reconciliation_exceptions WHERE organisation_id=$1 AND resolved_at IS NULL ORDER BY created_at"
+	if all {
+		query = "SELECT * FROM reconciliation_exceptions WHERE organisation_id=$1 ORDER BY created_at"
+	}
+
+	exceptions := []Exception{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&exceptions, query, org)
+	}); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return exceptions, nil
+}
+
+func insertMatch(tx *sqlx.Tx, paymentID, entryID, method string, match *Match) error {
+	if err := tx.Get(match, tx.Rebind(
+		`INSERT INTO reconciliations (payment_id, entry_id, method) VALUES (?, ?, ?) RETURNING *`),
+		paymentID, entryID, method,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(tx.Rebind(`UPDATE payments SET reconciled_at=? WHERE id=?`), match.MatchedAt, paymentID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(tx.Rebind(
+		`UPDATE reconciliation_exceptions SET resolved_at=now()
+		WHERE resolved_at IS NULL AND ((kind=? AND item_id=?) OR (kind=? AND item_id=?))`),
+		KindPayment, paymentID, KindEntry, entryID,
+	)
+	return err
+}
+
+func insertException(tx *sqlx.Tx, org, kind, itemID, reason string) error {
+	_, err := tx.Exec(tx.Rebind(
+		`INSERT INTO reconciliation_exceptions (organisation_id, kind, item_id, reason)
+		SELECT ?::uuid, ?::text, ?::uuid, ?::text WHERE NOT EXISTS (
+			SELECT 1 FROM reconciliation_exceptions WHERE kind=? AND item_id=? AND resolved_at IS NULL
+		)`),
+		org, kind, itemID, reason, kind, itemID,
+	)
+	return err
+}
@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the routing resources
+const (
+	Type        = "PaymentRoute"
+	RuleSetType = "RoutingRules"
+)
+
+// ResourceData is the data of the route resource
+type ResourceData struct {
+	ID         string `json:"id,omitempty"`
+	Type       string `json:"type"`
+	Attributes *Route `json:"attributes"`
+
+	links.Resource
+}
+
+// Resource is a single route resource
+type Resource struct {
+	Data *ResourceData `json:"data"`
+}
+
+// NewResource creates new resource from Route
+func NewResource(route *Route, self string) *Resource {
+	return &Resource{
+		Data: &ResourceData{
+			ID:         route.PaymentID,
+			Type:       Type,
+			Attributes: route,
+			Resource:   links.Resource{Links: links.Links{Self: self}},
+		},
+	}
+}
+
+// NewDecisionResource creates new route resource from a dry-run decision
+func NewDecisionResource(d *Decision, self string) *Resource {
+	return NewResource(&Route{
+		Scheme:    d.Scheme,
+		Rule:      d.Rule,
+		Version:   d.Version,
+		Rationale: d.Rationale,
+	}, self)
+}
+
+// Render implements render.Render
+func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// OverrideAttributes are the scheme an operator routes a payment to. The
+// operator is the user that makes the request.
+type OverrideAttributes struct {
+	Scheme         string `json:"scheme"`
+	OverrideReason string `json:"override_reason"`
+}
+
+// OverrideResource is the request body of a route override
+type OverrideResource struct {
+	Data *struct {
+		Type       string              `json:"type"`
+		Attributes *OverrideAttributes `json:"attributes"`
+	} `json:"data"`
+}
+
+// Bind implements render.Binder
+func (resource *OverrideResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != Type {
+		return fmt.Errorf("wrong type")
+	}
+
+	if resource.Data.Attributes == nil || resource.Data.Attributes.Scheme == "" {
+		return fmt.Errorf("no scheme")
+	}
+
+	if resource.Data.Attributes.OverrideReason == "" {
+		return fmt.Errorf("override_reason is required")
+	}
+
+	return nil
+}
+
+// RuleSetResource is the rule set resource
+type RuleSetResource struct {
+	Data struct {
+		ID         string   `json:"id"`
+		Type       string   `json:"type"`
+		Attributes *RuleSet `json:"attributes"`
+		links.Resource
+	} `json:"data"`
+}
+
+// NewRuleSetResource creates new resource from RuleSet
+func NewRuleSetResource(rs *RuleSet, self string) *RuleSetResource {
+	resource := &RuleSetResource{}
+	resource.Data.ID = rs.Version
+	resource.Data.Type = RuleSetType
+	resource.Data.Attributes = rs
+	resource.Data.Links.Self = self
+	return resource
+}
+
+// Render implements render.Render
+func (resource *RuleSetResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
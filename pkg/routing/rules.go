@@ -0,0 +1,209 @@
+package routing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/shopspring/decimal"
+)
+
+// Urgency levels of a payment
+const (
+	UrgencyStandard = "standard"
+	UrgencyUrgent   = "urgent"
+)
+
+// Rule makes a payment scheme eligible for the payments matching its conditions.
+// Empty conditions match every payment.
+type Rule struct {
+	Name     string          `json:"name"`
+	Scheme   string          `json:"scheme"`
+	Priority int             `json:"priority,omitempty"`
+	Cost     decimal.Decimal `json:"cost"`
+
+	Currencies   []string         `json:"currencies,omitempty"`
+	Countries    []string         `json:"countries,omitempty"`
+	Urgency      []string         `json:"urgency,omitempty"`
+	MinAmount    *decimal.Decimal `json:"min_amount,omitempty"`
+	MaxAmount    *decimal.Decimal `json:"max_amount,omitempty"`
+	BeforeCutOff bool             `json:"before_cut_off,omitempty"`
+}
+
+// RuleSet is a versioned set of routing rules
+type RuleSet struct {
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	Rules    []Rule `json:"rules"`
+}
+
+// ParseRuleSet parses and validates a rule set
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	rs := &RuleSet{}
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("invalid routing rules: %v", err)
+	}
+
+	if rs.Version == "" {
+		return nil, fmt.Errorf("invalid routing rules: missing version")
+	}
+
+	names := map[string]bool{}
+	for i, rule := range rs.Rules {
+		if rule.Name == "" || rule.Scheme == "" {
+			return nil, fmt.Errorf("invalid routing rules: rule %d needs a name and a scheme", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("invalid routing rules: duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	sum := sha256.Sum256(data)
+	rs.Checksum = hex.EncodeToString(sum[:])
+	return rs, nil
+}
+
+// Candidate is what the rules know about a payment
+type Candidate struct {
+	Amount          decimal.Decimal
+	Currency        string
+	Country         string
+	Urgency         string
+	ProcessingDate  time.Time
+	RequestedScheme string
+}
+
+// NewCandidate returns the routing candidate for a payment
+func NewCandidate(p *payment.Payment) (*Candidate, error) {
+	details, err := p.Details()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Candidate{
+		Amount:          details.Amount,
+		Currency:        details.Currency,
+		Country:         details.BeneficiaryCountry,
+		Urgency:         details.Urgency,
+		ProcessingDate:  details.ProcessingDate,
+		RequestedScheme: details.PaymentScheme,
+	}
+	if c.Urgency == "" {
+		c.Urgency = UrgencyStandard
+	}
+
+	return c, nil
+}
+
+// Decision is the route chosen for a payment and why
+type Decision struct {
+	Scheme    string   `json:"scheme"`
+	Rule      string   `json:"rule"`
+	Version   string   `json:"version"`
+	Rationale []string `json:"rationale"`
+}
+
+// Route chooses the scheme for the candidate. The eligible rule with the
+// lowest cost wins, ties are broken by the higher priority and then by the
+// order of the rules. A requested scheme wins when it is eligible.
+func (rs *RuleSet) Route(c *Candidate, calendars *calendar.Registry, now time.Time) (*Decision, error) {
+	decision := &Decision{Version: rs.Version, Rationale: []string{}}
+
+	eligible := []int{}
+	for i, rule := range rs.Rules {
+		if reason := rule.reject(c, calendars, now); reason != "" {
+			decision.Rationale = append(decision.Rationale, fmt.Sprintf("rule %s (%s) rejected: %s", rule.Name, rule.Scheme, reason))
+			continue
+		}
+		eligible = append(eligible, i)
+	}
+
+	if len(eligible) == 0 {
+		return decision, fmt.Errorf("no eligible payment scheme")
+	}
+
+	sort.SliceStable(eligible, func(i, j int) bool {
+		a, b := rs.Rules[eligible[i]], rs.Rules[eligible[j]]
+		if !a.Cost.Equal(b.Cost) {
+			return a.Cost.LessThan(b.Cost)
+		}
+		return a.Priority > b.Priority
+	})
+
+	chosen := rs.Rules[eligible[0]]
+	reason := "lowest cost"
+	for _, i := range eligible {
+		if c.RequestedScheme != "" && strings.EqualFold(rs.Rules[i].Scheme, c.RequestedScheme) {
+			chosen, reason = rs.Rules[i], "requested scheme"
+			break
+		}
+	}
+
+	for _, i := range eligible {
+		rule := rs.Rules[i]
+		if rule.Name != chosen.Name {
+			decision.Rationale = append(decision.Rationale, fmt.Sprintf("rule %s (%s) eligible at cost %s", rule.Name, rule.Scheme, rule.Cost))
+		}
+	}
+
+	decision.Scheme = chosen.Scheme
+	decision.Rule = chosen.Name
+	decision.Rationale = append(decision.Rationale,
+		fmt.Sprintf("rule %s (%s) chosen at cost %s: %s", chosen.Name, chosen.Scheme, chosen.Cost, reason))
+
+	return decision, nil
+}
+
+// reject returns why the rule does not apply to the candidate or empty if it does
+func (rule *Rule) reject(c *Candidate, calendars *calendar.Registry, now time.Time) string {
+	if len(rule.Currencies) != 0 && !contains(rule.Currencies, c.Currency) {
+		return fmt.Sprintf("currency %q not supported", c.Currency)
+	}
+
+	if len(rule.Countries) != 0 && !contains(rule.Countries, c.Country) {
+		return fmt.Sprintf("destination country %q not supported", c.Country)
+	}
+
+	if len(rule.Urgency) != 0 && !contains(rule.Urgency, c.Urgency) {
+		return fmt.Sprintf("urgency %q not supported", c.Urgency)
+	}
+
+	if rule.MinAmount != nil && c.Amount.LessThan(*rule.MinAmount) {
+		return fmt.Sprintf("amount below %s", rule.MinAmount)
+	}
+
+	if rule.MaxAmount != nil && c.Amount.GreaterThan(*rule.MaxAmount) {
+		return fmt.Sprintf("amount above %s", rule.MaxAmount)
+	}
+
+	if rule.BeforeCutOff && calendars != nil {
+		if cal, ok := calendars.Get(rule.Scheme); ok {
+			requested := c.ProcessingDate
+			if requested.IsZero() {
+				requested = now.In(time.UTC)
+			}
+			requested = time.Date(requested.Year(), requested.Month(), requested.Day(), 0, 0, 0, 0, time.UTC)
+			if !cal.ProcessingDate(requested, now).Equal(requested) {
+				return "past the cut-off time"
+			}
+		}
+	}
+
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
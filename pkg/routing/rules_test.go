@@ -0,0 +1,89 @@
+package routing
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/shopspring/decimal"
+)
+
+func TestRoute(t *testing.T) {
+	data, err := ioutil.ReadFile("../../rules/routing.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ParseRuleSet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendars := calendar.NewRegistry()
+	chaps, err := calendar.New(calendar.Definition{Name: "CHAPS", TimeZone: "Europe/London", CutOff: "16:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calendars.Put(chaps)
+
+	morning := time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC)
+	evening := time.Date(2018, 10, 1, 17, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		candidate Candidate
+		now       time.Time
+		scheme    string
+		err       bool
+	}{
+		"StandardGBP": {
+			candidate: Candidate{Amount: decimal.RequireFromString("100"), Currency: "GBP", Country: "GB", Urgency: UrgencyStandard},
+			scheme:    "BACS",
+		},
+		"UrgentGBP": {
+			candidate: Candidate{Amount: decimal.RequireFromString("100"), Currency: "GBP", Country: "GB", Urgency: UrgencyUrgent},
+			scheme:    "FPS",
+		},
+		"UrgentLargeGBP": {
+			candidate: Candidate{Amount: decimal.RequireFromString("500000"), Currency: "GBP", Country: "GB", Urgency: UrgencyUrgent},
+			now:       morning,
+			scheme:    "CHAPS",
+		},
+		"UrgentLargeGBPAfterCutOff": {
+			candidate: Candidate{Amount: decimal.RequireFromString("500000"), Currency: "GBP", Country: "GB", Urgency: UrgencyUrgent},
+			now:       evening,
+			scheme:    "SWIFT",
+		},
+		"RequestedScheme": {
+			candidate: Candidate{Amount: decimal.RequireFromString("100"), Currency: "GBP", Country: "GB", Urgency: UrgencyStandard, RequestedScheme: "FPS"},
+			scheme:    "FPS",
+		},
+		"EUR": {
+			candidate: Candidate{Amount: decimal.RequireFromString("100"), Currency: "EUR", Country: "DE", Urgency: UrgencyStandard},
+			scheme:    "SEPA",
+		},
+		"USD": {
+			candidate: Candidate{Amount: decimal.RequireFromString("100"), Currency: "USD", Country: "US", Urgency: UrgencyStandard},
+			scheme:    "SWIFT",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			now := tc.now
+			if now.IsZero() {
+				now = morning
+			}
+
+			decision, err := rules.Route(&tc.candidate, calendars, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Scheme != tc.scheme {
+				t.Errorf("got %s, want %s: %v", decision.Scheme, tc.scheme, decision.Rationale)
+			}
+			if decision.Version != rules.Version || len(decision.Rationale) != len(rules.Rules) {
+				t.Errorf("unexpected rationale %v", decision.Rationale)
+			}
+		})
+	}
+}
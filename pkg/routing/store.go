@@ -0,0 +1,105 @@
+package routing
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrUnderApproval is returned when overriding the route of a payment waiting
+// for approvals, which approve the scheme it has
+var ErrUnderApproval = errors.New("payment under approval can not be routed to another scheme")
+
+// Route is the routing decision recorded for a payment
+type Route struct {
+	PaymentID      string         `db:"payment_id"      json:"-"`
+	Scheme         string         `db:"scheme"          json:"scheme"`
+	Rule           string         `db:"rule"            json:"rule,omitempty"`
+	Version        string         `db:"version"         json:"version,omitempty"`
+	Rationale      pq.StringArray `db:"rationale"       json:"rationale"`
+	OverriddenBy   string         `db:"overridden_by"   json:"overridden_by,omitempty"`
+	OverrideReason string         `db:"override_reason" json:"override_reason,omitempty"`
+	DecidedAt      time.Time      `db:"decided_at"      json:"decided_at"`
+}
+
+// Save records the routing decision of a payment of the organisation
+func Save(db *sqlx.DB, org, paymentID string, d *Decision) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return SaveTx(tx, paymentID, d)
+	})
+}
+
+// SaveTx records the routing decision within a transaction scoped to the
+// organisation of the payment
+func SaveTx(tx *sqlx.Tx, paymentID string, d *Decision) error {
+	_, err := tx.Exec(tx.Rebind(
+		`INSERT INTO payment_routes (payment_id, scheme, rule, version, rationale) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (payment_id) DO UPDATE SET scheme=EXCLUDED.scheme, rule=EXCLUDED.rule,
+			version=EXCLUDED.version, rationale=EXCLUDED.rationale,
+			overridden_by='', override_reason='', decided_at=now()`),
+		paymentID, d.Scheme, d.Rule, d.Version, pq.StringArray(d.Rationale),
+	)
+	return err
+}
+
+// Get gets the route of a payment of the organisation
+func Get(db *sqlx.DB, org, paymentID string) (*Route, error) {
+	route := Route{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&route, `SELECT r.* FROM payment_routes r JOIN payments p ON p.id=r.payment_id
+			WHERE r.payment_id=$1 AND p.organisation_id=$2`, paymentID, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &route, nil
+}
+
+// Override sets the scheme of the payment of the organisation chosen by an
+// operator and keeps the rationale of the engine for reference. The payment
+// must still be the version of the ETag unless it is empty, and neither
+// locked nor waiting for approvals.
+func Override(db *sqlx.DB, org, paymentID, etag, scheme, operator, reason string) error {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pay := payment.Payment{}
+	if err := tx.Get(&pay, tx.Rebind(
+		`SELECT * FROM payments WHERE id=? AND organisation_id=? FOR UPDATE`), paymentID, org,
+	); err != nil {
+		return err
+	}
+	if etag != "" && etag != pay.ETag() {
+		return payment.ErrModified
+	}
+	if payment.Locked(pay.Status) {
+		return payment.ErrLocked
+	}
+	if pay.Status == payment.StatusPendingApproval {
+		return ErrUnderApproval
+	}
+	if err := pay.SetAttributes(map[string]interface{}{"payment_scheme": scheme}); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(tx.Rebind(`UPDATE payments SET attributes=? WHERE id=? AND organisation_id=?`), string(pay.Attributes), paymentID, org); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`INSERT INTO payment_routes (payment_id, scheme, rationale, overridden_by, override_reason) VALUES (?, ?, '{}', ?, ?)
+		ON CONFLICT (payment_id) DO UPDATE SET scheme=EXCLUDED.scheme,
+			overridden_by=EXCLUDED.overridden_by, override_reason=EXCLUDED.override_reason, decided_at=now()`),
+		paymentID, scheme, operator, reason,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
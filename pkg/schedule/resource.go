@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/links"
+	"github.com/VMitov/payments/pkg/payment"
+)
+
+// Types of the schedule resources
+const (
+	Type    = "PaymentSchedule"
+	RunType = "PaymentScheduleRun"
+)
+
+// Attributes are the attributes of the schedule resource
+type Attributes struct {
+	Payment     json.RawMessage `json:"payment"`
+	StartDate   string          `json:"start_date"`
+	Recurrence  string          `json:"recurrence,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	NextRunDate string          `json:"next_run_date,omitempty"`
+	Runs        int             `json:"runs"`
+	CreatedBy   string          `json:"created_by,omitempty"`
+}
+
+// ResourceData is the data of the schedule resource
+type ResourceData struct {
+	ID         string      `json:"id,omitempty"`
+	Type       string      `json:"type"`
+	Attributes *Attributes `json:"attributes"`
+
+	links.Resource
+}
+
+func newResourceData(s *Schedule, self string) *ResourceData {
+	attributes := &Attributes{
+		Payment:    s.Attributes,
+		StartDate:  s.StartDate.Format(payment.DateLayout),
+		Recurrence: s.Recurrence,
+		Status:     s.Status,
+		Runs:       s.Runs,
+		CreatedBy:  s.CreatedBy,
+	}
+	if s.NextRun != nil {
+		attributes.NextRunDate = s.NextRun.Format(payment.DateLayout)
+	}
+
+	return &ResourceData{
+		ID:         s.ID,
+		Type:       Type,
+		Attributes: attributes,
+		Resource:   links.Resource{Links: links.Links{Self: self}},
+	}
+}
+
+// Resource is a single schedule resource
+type Resource struct {
+	Data *ResourceData `json:"data"`
+}
+
+// NewResource creates new resource from Schedule
+func NewResource(s *Schedule, self string) *Resource {
+	return &Resource{Data: newResourceData(s, self)}
+}
+
+// Bind implements render.Binder
+func (resource *Resource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != Type {
+		return fmt.Errorf("wrong type")
+	}
+
+	attributes := resource.Data.Attributes
+	if attributes == nil || len(attributes.Payment) == 0 {
+		return fmt.Errorf("no payment")
+	}
+
+	if _, err := time.Parse(payment.DateLayout, attributes.StartDate); err != nil {
+		return fmt.Errorf("invalid start_date %q", attributes.StartDate)
+	}
+
+	if attributes.Recurrence != "" {
+		if _, err := ParseRule(attributes.Recurrence); err != nil {
+			return fmt.Errorf("invalid recurrence: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Render implements render.Render
+func (resource *Resource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NewFromResource returns Schedule from Resource
+func NewFromResource(res *Resource) (*Schedule, error) {
+	start, err := time.Parse(payment.DateLayout, res.Data.Attributes.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		Attributes: res.Data.Attributes.Payment,
+		StartDate:  start,
+		Recurrence: res.Data.Attributes.Recurrence,
+	}, nil
+}
+
+// ListResource is a list of schedules resource
+type ListResource struct {
+	Data []*ResourceData `json:"data"`
+	links.Resource
+}
+
+// NewListResource returns new schedules list resource
+func NewListResource(schedules []Schedule, self string) *ListResource {
+	list := &ListResource{
+		Data:     []*ResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range schedules {
+		list.Data = append(list.Data, newResourceData(&schedules[i], self+"/"+schedules[i].ID))
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RunResourceData is the data of the schedule run resource
+type RunResourceData struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes *Run   `json:"attributes"`
+}
+
+// RunListResource is a list of schedule runs resource
+type RunListResource struct {
+	Data []*RunResourceData `json:"data"`
+	links.Resource
+}
+
+// NewRunListResource returns new schedule runs list resource
+func NewRunListResource(runs []Run, self string) *RunListResource {
+	list := &RunListResource{
+		Data:     []*RunResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range runs {
+		list.Data = append(list.Data, &RunResourceData{ID: runs[i].ID, Type: RunType, Attributes: &runs[i]})
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *RunListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
@@ -0,0 +1,239 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxPeriods bounds the search for the next occurrence of a rule from the
+// period of the date it follows
+const maxPeriods = 1000
+
+// BusinessDays tells the business days of a calendar
+type BusinessDays interface {
+	IsBusinessDay(date time.Time) bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is a subset of the iCalendar RRULE recurrence rule (RFC 5545).
+// Supported parts are FREQ (DAILY, WEEKLY, MONTHLY), INTERVAL, BYDAY,
+// BYMONTHDAY, BYSETPOS, COUNT and UNTIL. For example the last business day
+// of every month is FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1. With a
+// calendar the days BYSETPOS picks from are also its business days, so the
+// holidays are skipped.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	BySetPos   int
+	Count      int
+	Until      time.Time
+}
+
+// ParseRule parses a recurrence rule
+func ParseRule(s string) (*Rule, error) {
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "RRULE:"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			if value != Daily && value != Weekly && value != Monthly {
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("invalid interval %q", value)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("invalid day %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid month day %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "BYSETPOS":
+			if rule.BySetPos, err = strconv.Atoi(value); err != nil || rule.BySetPos == 0 {
+				return nil, fmt.Errorf("invalid set position %q", value)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(value); err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("invalid count %q", value)
+			}
+		case "UNTIL":
+			if len(value) > 8 {
+				value = value[:8]
+			}
+			if rule.Until, err = time.Parse("20060102", value); err != nil {
+				return nil, fmt.Errorf("invalid until %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("missing frequency")
+	}
+	if rule.Count != 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("count and until are mutually exclusive")
+	}
+
+	return rule, nil
+}
+
+// Next returns the first occurrence of the rule starting at start that is
+// after the given date. The second result is false when there are no more
+// occurrences before Until. Count is enforced by the caller. The calendar
+// may be nil.
+func (r *Rule) Next(start, after time.Time, cal BusinessDays) (time.Time, bool) {
+	start, after = day(start), day(after)
+
+	first := r.periodOf(start, after)
+	for period := first; period < first+maxPeriods; period++ {
+		for _, date := range r.period(start, period*r.Interval, cal) {
+			if date.Before(start) || !date.After(after) {
+				continue
+			}
+			if !r.Until.IsZero() && date.After(r.Until) {
+				return time.Time{}, false
+			}
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// periodOf returns the number of the period from start that contains the
+// date, or 0 if the date is before start
+func (r *Rule) periodOf(start, date time.Time) int {
+	if !date.After(start) {
+		return 0
+	}
+
+	var units int
+	switch r.Freq {
+	case Daily:
+		units = int(date.Sub(start).Hours() / 24)
+	case Weekly:
+		units = int(monday(date).Sub(monday(start)).Hours() / 24 / 7)
+	case Monthly:
+		units = (date.Year()-start.Year())*12 + int(date.Month()-start.Month())
+	}
+	return units / r.Interval
+}
+
+// period returns the sorted candidate dates of the n-th unit from start
+func (r *Rule) period(start time.Time, n int, cal BusinessDays) []time.Time {
+	dates := []time.Time{}
+	switch r.Freq {
+	case Daily:
+		return []time.Time{start.AddDate(0, 0, n)}
+	case Weekly:
+		monday := monday(start).AddDate(0, 0, 7*n)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		for _, d := range days {
+			dates = append(dates, monday.AddDate(0, 0, (int(d)+6)%7))
+		}
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+		last := first.AddDate(0, 1, -1).Day()
+		switch {
+		case len(r.ByMonthDay) != 0:
+			for _, d := range r.ByMonthDay {
+				if d < 0 {
+					d = last + d + 1
+				}
+				if d >= 1 && d <= last {
+					dates = append(dates, first.AddDate(0, 0, d-1))
+				}
+			}
+		case len(r.ByDay) != 0:
+			for d := 0; d < last; d++ {
+				date := first.AddDate(0, 0, d)
+				for _, weekday := range r.ByDay {
+					if date.Weekday() == weekday {
+						dates = append(dates, date)
+					}
+				}
+			}
+		default:
+			if start.Day() <= last {
+				dates = append(dates, first.AddDate(0, 0, start.Day()-1))
+			}
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	if r.BySetPos != 0 && len(r.ByDay) != 0 && cal != nil {
+		business := dates[:0]
+		for _, date := range dates {
+			if cal.IsBusinessDay(date) {
+				business = append(business, date)
+			}
+		}
+		dates = business
+	}
+
+	if r.BySetPos != 0 && len(dates) != 0 {
+		pos := r.BySetPos
+		if pos < 0 {
+			pos = len(dates) + pos + 1
+		}
+		if pos < 1 || pos > len(dates) {
+			return nil
+		}
+		return dates[pos-1 : pos]
+	}
+
+	return dates
+}
+
+// monday returns the Monday of the week of the date
+func monday(date time.Time) time.Time {
+	return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
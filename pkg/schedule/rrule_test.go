@@ -0,0 +1,128 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+)
+
+func TestRuleNext(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	testCases := map[string]struct {
+		rule     string
+		start    string
+		n        int
+		expected []string
+	}{
+		"Weekly": {
+			rule:     "FREQ=WEEKLY",
+			start:    "2018-10-03",
+			n:        3,
+			expected: []string{"2018-10-03", "2018-10-10", "2018-10-17"},
+		},
+		"WeeklyByDay": {
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			start:    "2018-10-03",
+			n:        4,
+			expected: []string{"2018-10-05", "2018-10-15", "2018-10-19", "2018-10-29"},
+		},
+		"MonthlyOnDay": {
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=31",
+			start:    "2018-10-01",
+			n:        3,
+			expected: []string{"2018-10-31", "2018-12-31", "2019-01-31"},
+		},
+		"MonthlyLastDay": {
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=-1",
+			start:    "2019-01-15",
+			n:        3,
+			expected: []string{"2019-01-31", "2019-02-28", "2019-03-31"},
+		},
+		"LastBusinessDay": {
+			rule:     "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+			start:    "2018-09-01",
+			n:        3,
+			expected: []string{"2018-09-28", "2018-10-31", "2018-11-30"},
+		},
+		"Until": {
+			rule:     "FREQ=DAILY;UNTIL=20181002",
+			start:    "2018-10-01",
+			n:        3,
+			expected: []string{"2018-10-01", "2018-10-02"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rule, err := ParseRule(tc.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dates := []string{}
+			after := date(tc.start).AddDate(0, 0, -1)
+			for i := 0; i < tc.n; i++ {
+				next, ok := rule.Next(date(tc.start), after, nil)
+				if !ok {
+					break
+				}
+				dates = append(dates, next.Format("2006-01-02"))
+				after = next
+			}
+
+			if !reflect.DeepEqual(dates, tc.expected) {
+				t.Errorf("got %v, want %v", dates, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRuleNextYearsAfterStart(t *testing.T) {
+	start := time.Date(2018, 10, 3, 0, 0, 0, 0, time.UTC)
+	gbp, err := calendar.New(calendar.Definition{Name: "GBP", Holidays: []calendar.Holiday{{Date: "2028-11-30"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		rule     string
+		after    string
+		cal      BusinessDays
+		expected string
+	}{
+		"Daily":           {rule: "FREQ=DAILY", after: "2028-10-03", expected: "2028-10-04"},
+		"EveryOtherWeek":  {rule: "FREQ=WEEKLY;INTERVAL=2", after: "2058-10-03", expected: "2058-10-09"},
+		"Monthly":         {rule: "FREQ=MONTHLY;BYMONTHDAY=-1", after: "2118-10-31", expected: "2118-11-30"},
+		"LastBusinessDay": {rule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1", after: "2028-11-01", cal: gbp, expected: "2028-11-29"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rule, err := ParseRule(tc.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := time.Parse("2006-01-02", tc.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next, ok := rule.Next(start, after, tc.cal)
+			if !ok {
+				t.Fatalf("expected %s, got no occurrence", tc.expected)
+			}
+			if got := next.Format("2006-01-02"); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package schedule
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// Schedule statuses
+const (
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusSuspended = "suspended"
+)
+
+// Run statuses
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// lockClass namespaces the advisory locks taken by the scheduler
+const lockClass = 0x5343
+
+// MaxFailures is the number of failed runs of the same date after which a
+// schedule is suspended rather than retried on every tick
+const MaxFailures = 5
+
+// ErrNotSuspended is returned when resuming a schedule that is not suspended
+var ErrNotSuspended = errors.New("schedule is not suspended")
+
+// Schedule is a one-off future dated or a recurring payment
+type Schedule struct {
+	ID             string          `db:"id"`
+	OrganisationID string          `db:"organisation_id"`
+	Attributes     json.RawMessage `db:"attributes"`
+	StartDate      time.Time       `db:"start_date"`
+	Recurrence     string          `db:"recurrence"`
+	NextRun        *time.Time      `db:"next_run"`
+	Runs           int             `db:"runs"`
+	Status         string          `db:"status"`
+	CreatedBy      string          `db:"created_by"`
+	CreatedAt      time.Time       `db:"created_at"`
+}
+
+// Run is a single execution of a schedule
+type Run struct {
+	ID         string    `db:"id"          json:"-"`
+	ScheduleID string    `db:"schedule_id" json:"schedule_id"`
+	RunDate    time.Time `db:"run_date"    json:"run_date"`
+	PaymentID  *string   `db:"payment_id"  json:"payment_id,omitempty"`
+	Status     string    `db:"status"      json:"status"`
+	Error      string    `db:"error"       json:"error,omitempty"`
+	RanAt      time.Time `db:"ran_at"      json:"ran_at"`
+}
+
+// Rule returns the parsed recurrence rule or nil for one-off schedules
+func (s *Schedule) Rule() (*Rule, error) {
+	if s.Recurrence == "" {
+		return nil, nil
+	}
+	return ParseRule(s.Recurrence)
+}
+
+// calendar returns the calendar of the payments of the schedule or nil
+func (s *Schedule) calendar(calendars *calendar.Registry) BusinessDays {
+	if calendars == nil {
+		return nil
+	}
+	details, err := (&payment.Payment{Attributes: s.Attributes}).Details()
+	if err != nil {
+		return nil
+	}
+	if c, ok := calendars.Lookup(details.PaymentScheme, details.Currency); ok {
+		return c
+	}
+	return nil
+}
+
+// next returns the run date after the given one. The business days are the
+// ones of the calendar of the payments, the registry may be nil.
+func (s *Schedule) next(after time.Time, calendars *calendar.Registry) (*time.Time, error) {
+	rule, err := s.Rule()
+	if err != nil {
+		return nil, err
+	}
+
+	if rule == nil {
+		if after.Before(s.StartDate) {
+			return &s.StartDate, nil
+		}
+		return nil, nil
+	}
+
+	if rule.Count != 0 && s.Runs >= rule.Count {
+		return nil, nil
+	}
+
+	date, ok := rule.Next(s.StartDate, after, s.calendar(calendars))
+	if !ok {
+		return nil, nil
+	}
+	return &date, nil
+}
+
+// Create persists a schedule of the organisation and computes its first run
+// date. The registry may be nil.
+func Create(db *sqlx.DB, org string, s *Schedule, calendars *calendar.Registry) (id string, err error) {
+	s.StartDate = day(s.StartDate)
+	s.Runs = 0
+	if s.NextRun, err = s.next(s.StartDate.AddDate(0, 0, -1), calendars); err != nil {
+		return "", err
+	}
+	if s.NextRun == nil {
+		return "", fmt.Errorf("schedule has no occurrences")
+	}
+
+	err = tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&id, tx.Rebind(
+			`INSERT INTO payment_schedules (organisation_id, attributes, start_date, recurrence, next_run, created_by)
+			VALUES (?, ?, ?, ?, ?, ?) RETURNING id`),
+			org, string(s.Attributes), s.StartDate, s.Recurrence, s.NextRun, s.CreatedBy,
+		)
+	})
+	return id, err
+}
+
+// Get gets a single schedule of the organisation
+func Get(db *sqlx.DB, org, id string) (*Schedule, error) {
+	s := Schedule{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&s, "SELECT * FROM payment_schedules WHERE id=$1 AND organisation_id=$2", id, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Select gets all schedules of the organisation
+func Select(db *sqlx.DB, org string) ([]Schedule, error) {
+	schedules := []Schedule{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&schedules,
+			"SELECT * FROM payment_schedules WHERE organisation_id=$1 ORDER BY created_at", org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Cancel stops an active or suspended schedule of the organisation
+func Cancel(db *sqlx.DB, org, id string) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(tx.Rebind(
+			`UPDATE payment_schedules SET status=?, next_run=NULL WHERE id=? AND organisation_id=? AND status IN (?, ?)`),
+			StatusCancelled, id, org, StatusActive, StatusSuspended,
+		)
+		return err
+	})
+}
+
+// Resume makes a suspended schedule of the organisation active again. It
+// retries the run it was suspended at on the next tick.
+func Resume(db *sqlx.DB, org, id string) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(tx.Rebind(
+			`UPDATE payment_schedules SET status=? WHERE id=? AND organisation_id=? AND status=?`),
+			StatusActive, id, org, StatusSuspended,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotSuspended
+		}
+		return nil
+	})
+}
+
+// SelectRuns gets the run history of a schedule of the organisation
+func SelectRuns(db *sqlx.DB, org, scheduleID string) ([]Run, error) {
+	runs := []Run{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&runs, `SELECT r.* FROM payment_schedule_runs r JOIN payment_schedules s ON s.id=r.schedule_id
+			WHERE r.schedule_id=$1 AND s.organisation_id=$2 ORDER BY r.ran_at`, scheduleID, org)
+	}); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// Hooks are the optional callbacks of a scheduler run
+type Hooks struct {
+	// Prepare adjusts the payment before it is created. The hook it may
+	// return records the adjustments in the transaction that creates it.
+	Prepare func(*payment.Payment) (payment.Hook, error)
+	// Created runs in the transaction that created the payment of the schedule
+	Created func(tx *sqlx.Tx, s *Schedule, paymentID string, p *payment.Payment) error
+	// Committed runs once the payment of the organisation is committed
+	Committed func(org, paymentID string)
+}
+
+// RunDue creates the payments of all schedules due on the day of now.
+// Every schedule is processed under an advisory lock in its own transaction
+// together with the created payment, so concurrent schedulers on several
+// replicas create each payment exactly once. A schedule that fails is
+// logged and does not stop the others. The registry may be nil.
+func RunDue(db *sqlx.DB, now time.Time, calendars *calendar.Registry, hooks Hooks) (created int, err error) {
+	ids := []string{}
+	if err := tenant.Scoped(db, tenant.System, func(tx *sqlx.Tx) error {
+		return tx.Select(&ids,
+			"SELECT id FROM payment_schedules WHERE status=$1 AND next_run <= $2", StatusActive, day(now))
+	}); err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, id := range ids {
+		// Catch up on all the runs missed while no scheduler was running.
+		for {
+			ran, err := runOnce(db, id, now, calendars, hooks)
+			if err != nil {
+				slog.Error("running schedule failed", slog.String("schedule", id), logging.Error(err))
+				failed++
+				break
+			}
+			if !ran {
+				break
+			}
+			created++
+		}
+	}
+
+	if failed != 0 {
+		return created, fmt.Errorf("%d of %d due schedules failed", failed, len(ids))
+	}
+	return created, nil
+}
+
+func runOnce(db *sqlx.DB, id string, now time.Time, calendars *calendar.Registry, hooks Hooks) (bool, error) {
+	tx, err := tenant.Begin(db, tenant.System)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.Get(&locked, tx.Rebind(`SELECT pg_try_advisory_xact_lock(?, hashtext(?))`), lockClass, id); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	s := Schedule{}
+	if err := tx.Get(&s, tx.Rebind(`SELECT * FROM payment_schedules WHERE id=? FOR UPDATE`), id); err != nil {
+		return false, err
+	}
+	if s.Status != StatusActive || s.NextRun == nil || s.NextRun.After(day(now)) {
+		return false, nil
+	}
+
+	// The rest of the run acts on behalf of the organisation of the schedule
+	if err := tenant.Switch(tx, s.OrganisationID); err != nil {
+		return false, err
+	}
+	runDate := *s.NextRun
+
+	pay := &payment.Payment{Attributes: s.Attributes}
+	if err := pay.SetAttributes(map[string]interface{}{
+		"processing_date": runDate.Format(payment.DateLayout),
+	}); err != nil {
+		return false, recordFailure(db, tx, &s, runDate, err)
+	}
+	var prepared payment.Hook
+	if hooks.Prepare != nil {
+		if prepared, err = hooks.Prepare(pay); err != nil {
+			return false, recordFailure(db, tx, &s, runDate, err)
+		}
+	}
+
+	paymentID, err := payment.CreateTx(tx, s.OrganisationID, pay)
+	if err != nil {
+		return false, recordFailure(db, tx, &s, runDate, err)
+	}
+	if prepared != nil {
+		if err := prepared(tx, paymentID); err != nil {
+			return false, recordFailure(db, tx, &s, runDate, err)
+		}
+	}
+	if hooks.Created != nil {
+		if err := hooks.Created(tx, &s, paymentID, pay); err != nil {
+			return false, recordFailure(db, tx, &s, runDate, err)
+		}
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`INSERT INTO payment_schedule_runs (schedule_id, run_date, payment_id, status) VALUES (?, ?, ?, ?)`),
+		s.ID, runDate, paymentID, RunSucceeded,
+	); err != nil {
+		return false, err
+	}
+
+	s.Runs++
+	next, err := s.next(runDate, calendars)
+	if err != nil {
+		return false, err
+	}
+	status := StatusActive
+	if next == nil {
+		status = StatusCompleted
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`UPDATE payment_schedules SET next_run=?, runs=?, status=? WHERE id=?`),
+		next, s.Runs, status, s.ID,
+	); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	if hooks.Committed != nil {
+		hooks.Committed(s.OrganisationID, paymentID)
+	}
+	return true, nil
+}
+
+// recordFailure rolls back the run and stores the failure in the history.
+// The schedule stays due so the run is retried on the next tick, until the
+// run of the date has failed MaxFailures times and the schedule is suspended.
+func recordFailure(db *sqlx.DB, tx *sqlx.Tx, s *Schedule, runDate time.Time, cause error) error {
+	if err := tx.Rollback(); err != nil {
+		return err
+	}
+
+	return tenant.Scoped(db, s.OrganisationID, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(tx.Rebind(
+			`INSERT INTO payment_schedule_runs (schedule_id, run_date, status, error) VALUES (?, ?, ?, ?)`),
+			s.ID, runDate, RunFailed, cause.Error(),
+		); err != nil {
+			return err
+		}
+
+		var failures int
+		if err := tx.Get(&failures, tx.Rebind(
+			`SELECT count(*) FROM payment_schedule_runs WHERE schedule_id=? AND run_date=? AND status=?`),
+			s.ID, runDate, RunFailed,
+		); err != nil {
+			return err
+		}
+		if failures < MaxFailures {
+			return nil
+		}
+
+		slog.Warn("suspending failing schedule", slog.String("schedule", s.ID), slog.Int("failures", failures), logging.Error(cause))
+		_, err := tx.Exec(tx.Rebind(`UPDATE payment_schedules SET status=? WHERE id=?`), StatusSuspended, s.ID)
+		return err
+	})
+}
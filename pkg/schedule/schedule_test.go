@@ -0,0 +1,152 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+const org = "00000000-0000-0000-0000-000000000001"
+
+// TestRunDueFailures runs two due schedules. The first can not be locked and
+// the payment of the second fails, which suspends it once the run of the
+// date has failed MaxFailures times.
+func TestRunDueFailures(t *testing.T) {
+	const (
+		broken  = "216d4da9-e59a-4cc6-8df3-3da6e7580b77"
+		failing = "5a4e3c2b-1d0f-4e8a-9b7c-6d5e4f3a2b1c"
+	)
+	now := time.Date(2018, 10, 31, 9, 0, 0, 0, time.UTC)
+	hooks := Hooks{Prepare: func(*payment.Payment) (payment.Hook, error) { return nil, errors.New("no such calendar") }}
+
+	testCases := map[string]struct {
+		failures  int
+		suspended bool
+	}{
+		"Retried":   {failures: 1},
+		"Suspended": {failures: MaxFailures, suspended: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mockDB.Close()
+
+			expectScoped := func(org string) {
+				mock.ExpectBegin()
+				mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			expectScoped(tenant.System)
+			mock.ExpectQuery("SELECT id FROM payment_schedules").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(broken).AddRow(failing))
+			mock.ExpectCommit()
+
+			expectScoped(tenant.System)
+			mock.ExpectQuery("pg_try_advisory_xact_lock").WithArgs(lockClass, broken).WillReturnError(errors.New("connection reset"))
+			mock.ExpectRollback()
+
+			expectScoped(tenant.System)
+			mock.ExpectQuery("pg_try_advisory_xact_lock").WithArgs(lockClass, failing).
+				WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+			mock.ExpectQuery("SELECT (.+) FROM payment_schedules").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "organisation_id", "attributes", "next_run", "status"}).
+					AddRow(failing, org, []byte(`{"amount":"10.00"}`), day(now), StatusActive))
+			mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectRollback()
+
+			expectScoped(org)
+			mock.ExpectExec("INSERT INTO payment_schedule_runs").WithArgs(failing, day(now), RunFailed, "no such calendar").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT count").WithArgs(failing, day(now), RunFailed).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.failures))
+			if tc.suspended {
+				mock.ExpectExec("UPDATE payment_schedules SET status").WithArgs(StatusSuspended, failing).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			created, err := RunDue(sqlx.NewDb(mockDB, "sqlmock"), now, nil, hooks)
+			if created != 0 {
+				t.Errorf("expected no payments, got %d", created)
+			}
+			if err == nil || err.Error() != "1 of 2 due schedules failed" {
+				t.Errorf("expected 1 of 2 due schedules failed, got %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+// TestRunDuePrepared runs a one-off schedule. The hook returned by Prepare
+// runs in the transaction that creates the payment.
+func TestRunDuePrepared(t *testing.T) {
+	const (
+		id        = "216d4da9-e59a-4cc6-8df3-3da6e7580b77"
+		paymentID = "4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"
+	)
+	now := time.Date(2018, 10, 31, 9, 0, 0, 0, time.UTC)
+
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	expectScoped := func(org string) {
+		mock.ExpectBegin()
+		mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	expectScoped(tenant.System)
+	mock.ExpectQuery("SELECT id FROM payment_schedules").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectCommit()
+
+	expectScoped(tenant.System)
+	mock.ExpectQuery("pg_try_advisory_xact_lock").WithArgs(lockClass, id).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM payment_schedules").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organisation_id", "attributes", "start_date", "next_run", "status"}).
+			AddRow(id, org, []byte(`{"amount":"10.00"}`), day(now), day(now), StatusActive))
+	mock.ExpectExec("set_config").WithArgs(tenant.Setting, org).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO payments").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(paymentID))
+	mock.ExpectExec("INSERT INTO payment_routes").WithArgs(paymentID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO payment_schedule_runs").WithArgs(id, day(now), paymentID, RunSucceeded).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE payment_schedules").WithArgs(sqlmock.AnyArg(), 1, StatusCompleted, id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	expectScoped(tenant.System)
+	mock.ExpectQuery("pg_try_advisory_xact_lock").WithArgs(lockClass, id).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT (.+) FROM payment_schedules").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "organisation_id", "attributes", "status"}).
+			AddRow(id, org, []byte(`{"amount":"10.00"}`), StatusCompleted))
+	mock.ExpectRollback()
+
+	hooks := Hooks{Prepare: func(*payment.Payment) (payment.Hook, error) {
+		return func(tx *sqlx.Tx, id string) error {
+			_, err := tx.Exec("INSERT INTO payment_routes (payment_id) VALUES ($1)", id)
+			return err
+		}, nil
+	}}
+	created, err := RunDue(sqlx.NewDb(mockDB, "sqlmock"), now, nil, hooks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Errorf("expected 1 payment, got %d", created)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
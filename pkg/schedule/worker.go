@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/calendar"
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/jmoiron/sqlx"
+)
+
+// Worker materialises the due payments of the schedules periodically
+type Worker struct {
+	DB       *sqlx.DB
+	Interval time.Duration
+	Now      func() time.Time
+	Hooks    Hooks
+	// Calendars tell the business days of the recurrences, they may be nil
+	Calendars *calendar.Registry
+
+	mu      sync.Mutex
+	lastRun time.Time
+	lastErr error
+}
+
+// NewWorker returns a worker checking for due schedules every interval
+func NewWorker(db *sqlx.DB, interval time.Duration) *Worker {
+	return &Worker{DB: db, Interval: interval, Now: time.Now}
+}
+
+// Run processes the due schedules until the context is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := RunDue(w.DB, w.Now().UTC(), w.Calendars, w.Hooks)
+		w.mu.Lock()
+		w.lastRun, w.lastErr = w.Now(), err
+		w.mu.Unlock()
+		if err != nil {
+			slog.Error("scheduler run failed", slog.Int("created", created), logging.Error(err))
+		} else if created != 0 {
+			slog.Info("created scheduled payments", slog.Int("created", created))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check reports if the last run of the worker failed or if the worker has
+// stopped running
+func (w *Worker) Check(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.lastErr != nil {
+		return fmt.Errorf("last run failed: %v", w.lastErr)
+	}
+	if !w.lastRun.IsZero() && w.Now().Sub(w.lastRun) > 3*w.Interval {
+		return fmt.Errorf("not run since %s", w.lastRun.Format(time.RFC3339))
+	}
+	return nil
+}
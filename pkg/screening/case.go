@@ -0,0 +1,216 @@
+package screening
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/VMitov/payments/pkg/payment"
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+)
+
+// Case statuses
+const (
+	CaseOpen      = "open"
+	CaseCleared   = "cleared"
+	CaseConfirmed = "confirmed"
+)
+
+// Errors of the case decisions
+var (
+	ErrCaseClosed     = errors.New("screening case already decided")
+	ErrMissingOfficer = errors.New("officer is required")
+)
+
+// Hits are the stored hits of a case
+type Hits []Hit
+
+// Value implements driver.Valuer
+func (h Hits) Value() (driver.Value, error) {
+	b, err := json.Marshal(h)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner
+func (h *Hits) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, h)
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	default:
+		return fmt.Errorf("can not scan %T into hits", src)
+	}
+}
+
+// Case is a payment held by a screening hit until a compliance officer
+// clears or confirms it
+type Case struct {
+	ID             string     `db:"id"              json:"-"`
+	OrganisationID string     `db:"organisation_id" json:"-"`
+	PaymentID      string     `db:"payment_id"      json:"payment_id"`
+	Status         string     `db:"status"          json:"status"`
+	Hits           Hits       `db:"hits"            json:"hits"`
+	DecidedBy      string     `db:"decided_by"      json:"decided_by,omitempty"`
+	DecisionNote   string     `db:"decision_note"   json:"decision_note,omitempty"`
+	CreatedAt      time.Time  `db:"created_at"      json:"created_at"`
+	DecidedAt      *time.Time `db:"decided_at"      json:"decided_at,omitempty"`
+}
+
+// Parties returns the named parties of a payment
+func Parties(p *payment.Payment) ([]Party, error) {
+	details, err := p.Details()
+	if err != nil {
+		return nil, err
+	}
+
+	parties := []Party{}
+	for _, party := range []Party{
+		{Role: "beneficiary", Name: details.BeneficiaryName},
+		{Role: "beneficiary", Name: details.BeneficiaryAccountName},
+		{Role: "debtor", Name: details.DebtorName},
+		{Role: "debtor", Name: details.DebtorAccountName},
+	} {
+		if party.Name != "" {
+			parties = append(parties, party)
+		}
+	}
+
+	return parties, nil
+}
+
+// ScreenPayment screens all the named parties of a payment
+func (s *Screener) ScreenPayment(p *payment.Payment) ([]Hit, error) {
+	parties, err := Parties(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ScreenParties(parties), nil
+}
+
+// Hold moves the payment of the organisation to the held status and opens a
+// case for the hits
+func Hold(db *sqlx.DB, org, paymentID string, hits []Hit) (id string, err error) {
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if id, err = HoldTx(tx, org, paymentID, hits); err != nil {
+		return "", err
+	}
+
+	return id, tx.Commit()
+}
+
+// HoldTx holds the payment of the organisation within a transaction scoped
+// to it
+func HoldTx(tx *sqlx.Tx, org, paymentID string, hits []Hit) (id string, err error) {
+	if err := payment.SetStatusTx(tx, org, paymentID, payment.StatusHeld); err != nil {
+		return "", err
+	}
+
+	err = tx.Get(&id, tx.Rebind(
+		`INSERT INTO screening_cases (organisation_id, payment_id, hits) VALUES (?, ?, ?) RETURNING id`),
+		org, paymentID, Hits(hits),
+	)
+	return id, err
+}
+
+// Clear closes the case as a false positive and releases the payment. The
+// hook runs if the payment is released to created and may be nil.
+func Clear(db *sqlx.DB, org, id, officer, note string, released payment.Hook) error {
+	release := func(tx *sqlx.Tx, paymentID string) error {
+		return payment.ReleaseTx(tx, org, paymentID, released)
+	}
+	return decide(db, org, id, CaseCleared, release, officer, note)
+}
+
+// Confirm closes the case as a true match and rejects the payment
+func Confirm(db *sqlx.DB, org, id, officer, note string) error {
+	reject := func(tx *sqlx.Tx, paymentID string) error {
+		return payment.SetStatusTx(tx, org, paymentID, payment.StatusRejected)
+	}
+	return decide(db, org, id, CaseConfirmed, reject, officer, note)
+}
+
+func decide(db *sqlx.DB, org, id, status string, move func(tx *sqlx.Tx, paymentID string) error, officer, note string) error {
+	if officer == "" {
+		return ErrMissingOfficer
+	}
+
+	tx, err := tenant.Begin(db, org)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c := Case{}
+	if err := tx.Get(&c, tx.Rebind(
+		`SELECT * FROM screening_cases WHERE id=? AND organisation_id=? FOR UPDATE`), id, org,
+	); err != nil {
+		return err
+	}
+	if c.Status != CaseOpen {
+		return ErrCaseClosed
+	}
+
+	if _, err := tx.Exec(tx.Rebind(
+		`UPDATE screening_cases SET status=?, decided_by=?, decision_note=?, decided_at=now() WHERE id=?`),
+		status, officer, note, id,
+	); err != nil {
+		return err
+	}
+
+	if err := move(tx, c.PaymentID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// OpenCase reports if the payment of the organisation has an undecided case
+func OpenCase(db *sqlx.DB, org, paymentID string) (open bool, err error) {
+	err = tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&open, `SELECT EXISTS (SELECT 1 FROM screening_cases
+			WHERE payment_id=$1 AND organisation_id=$2 AND status=$3)`, paymentID, org, CaseOpen)
+	})
+	return open, err
+}
+
+// GetCase gets a single case of the organisation
+func GetCase(db *sqlx.DB, org, id string) (*Case, error) {
+	c := Case{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&c, "SELECT * FROM screening_cases WHERE id=$1 AND organisation_id=$2", id, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// SelectCases gets the cases of the organisation with the status or all
+// cases if it is empty
+func SelectCases(db *sqlx.DB, org, status string) ([]Case, error) {
+	cases := []Case{}
+	query := "SELECT * FROM screening_cases WHERE organisation_id=$1 ORDER BY created_at"
+	args := []interface{}{org}
+	if status != "" {
+		query = "SELECT * FROM screening_cases WHERE organisation_id=$1 AND status=$2 ORDER BY created_at"
+		args = append(args, status)
+	}
+
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&cases, query, args...)
+	}); err != nil {
+		return nil, err
+	}
+
+	return cases, nil
+}
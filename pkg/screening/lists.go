@@ -0,0 +1,155 @@
+package screening
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// List names
+const (
+	ListOFAC = "OFAC"
+	ListEU   = "EU"
+)
+
+// Entry is a sanctioned party from a watchlist
+type Entry struct {
+	List     string   `json:"list"`
+	ID       string   `json:"id"`
+	Type     string   `json:"type,omitempty"`
+	Names    []string `json:"names"`
+	Programs []string `json:"programs,omitempty"`
+}
+
+// LoadOFAC reads the OFAC SDN or consolidated list in CSV format.
+// The primary file has the name in the second column and the alternate
+// names file (alt.csv) has it in the fourth; both are keyed by the entity
+// number in the first column.
+func LoadOFAC(r io.Reader) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	entries := []Entry{}
+	index := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OFAC list: %v", err)
+		}
+
+		// Skip the end of file marker and blank lines
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		id := strings.TrimSpace(record[0])
+		var name, typ string
+		var programs []string
+		switch {
+		case len(record) >= 4 && len(record) <= 5:
+			name = ofacField(record[3])
+		default:
+			name = ofacField(record[1])
+			if len(record) > 2 {
+				typ = ofacField(record[2])
+			}
+			if len(record) > 3 && ofacField(record[3]) != "" {
+				programs = strings.Fields(strings.NewReplacer("[", "", "]", "").Replace(ofacField(record[3])))
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		if i, ok := index[id]; ok {
+			entries[i].Names = append(entries[i].Names, name)
+			continue
+		}
+
+		if typ == "" {
+			typ = "individual"
+		}
+		index[id] = len(entries)
+		entries = append(entries, Entry{List: ListOFAC, ID: id, Type: typ, Names: []string{name}, Programs: programs})
+	}
+
+	return entries, nil
+}
+
+// ofacField trims the value and drops the "-0-" OFAC uses for empty fields
+func ofacField(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "-0-" {
+		return ""
+	}
+	return v
+}
+
+type euExport struct {
+	Entities []struct {
+		LogicalID   string `xml:"logicalId,attr"`
+		SubjectType struct {
+			Code string `xml:"code,attr"`
+		} `xml:"subjectType"`
+		NameAliases []struct {
+			WholeName string `xml:"wholeName,attr"`
+		} `xml:"nameAlias"`
+		Regulations []struct {
+			Programme string `xml:"programme,attr"`
+		} `xml:"regulation"`
+	} `xml:"sanctionEntity"`
+}
+
+// LoadEU reads the EU consolidated financial sanctions list in XML format
+func LoadEU(r io.Reader) ([]Entry, error) {
+	export := euExport{}
+	if err := xml.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid EU list: %v", err)
+	}
+
+	entries := []Entry{}
+	for _, e := range export.Entities {
+		entry := Entry{List: ListEU, ID: e.LogicalID, Type: e.SubjectType.Code}
+		for _, alias := range e.NameAliases {
+			if name := strings.TrimSpace(alias.WholeName); name != "" {
+				entry.Names = append(entry.Names, name)
+			}
+		}
+		for _, reg := range e.Regulations {
+			if reg.Programme != "" {
+				entry.Programs = append(entry.Programs, reg.Programme)
+			}
+		}
+		if len(entry.Names) != 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// LoadFile reads a watchlist choosing the format by the file extension
+func LoadFile(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return LoadOFAC(f)
+	case ".xml":
+		return LoadEU(f)
+	default:
+		return nil, fmt.Errorf("unknown watchlist format %q", path)
+	}
+}
@@ -0,0 +1,75 @@
+package screening
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopWords are dropped from names before matching
+var stopWords = map[string]bool{
+	"the": true, "of": true, "and": true, "al": true, "el": true, "bin": true, "ibn": true,
+	"abu": true, "van": true, "von": true, "der": true, "de": true, "la": true, "le": true,
+	"mr": true, "mrs": true, "ms": true, "dr": true,
+	"ltd": true, "limited": true, "llc": true, "inc": true, "corp": true, "corporation": true,
+	"co": true, "company": true, "plc": true, "gmbh": true, "ag": true, "sa": true, "srl": true,
+	"bv": true, "nv": true, "oy": true, "ab": true, "as": true, "jsc": true, "ooo": true, "pjsc": true,
+}
+
+// transliterations maps letters that do not decompose into ASCII letters
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th", 'ł': "l", 'ı': "i",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye",
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i",
+	'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s",
+	'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+// accents maps accented Latin letters to their base letter
+var accents = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ā': 'a', 'ă': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c', 'ď': 'd', 'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ē': 'e',
+	'ė': 'e', 'ę': 'e', 'ě': 'e', 'ğ': 'g', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ī': 'i',
+	'į': 'i', 'ķ': 'k', 'ļ': 'l', 'ľ': 'l', 'ñ': 'n', 'ń': 'n', 'ň': 'n', 'ņ': 'n', 'ò': 'o',
+	'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ō': 'o', 'ő': 'o', 'ř': 'r', 'ś': 's', 'š': 's',
+	'ş': 's', 'ș': 's', 'ť': 't', 'ţ': 't', 'ț': 't', 'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ū': 'u', 'ů': 'u', 'ű': 'u', 'ų': 'u', 'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// Normalise transliterates the name to lower case ASCII, drops punctuation
+// and stop words and returns the remaining tokens in sorted order so that
+// reordered names compare equal
+func Normalise(name string) []string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if base, ok := accents[r]; ok {
+			b.WriteRune(base)
+			continue
+		}
+		if t, ok := transliterations[r]; ok {
+			b.WriteString(t)
+			continue
+		}
+		switch {
+		case r == '\'' || r == '’' || r == '`':
+			// Apostrophes join the parts of a name: O'Brien is obrien
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	tokens := []string{}
+	for _, token := range strings.Fields(b.String()) {
+		if !stopWords[token] {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Strings(tokens)
+
+	return tokens
+}
@@ -0,0 +1,109 @@
+package screening
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Types of the screening resources
+const (
+	CaseType     = "ScreeningCase"
+	DecisionType = "ScreeningDecision"
+)
+
+// CaseResourceData is the data of the screening case resource
+type CaseResourceData struct {
+	ID            string              `json:"id"`
+	Type          string              `json:"type"`
+	Attributes    *Case               `json:"attributes"`
+	Relationships links.Relationships `json:"relationships"`
+
+	links.Resource
+}
+
+// CaseResource is a single screening case resource
+type CaseResource struct {
+	Data *CaseResourceData `json:"data"`
+}
+
+func newCaseResourceData(c *Case, self string) *CaseResourceData {
+	return &CaseResourceData{
+		ID:         c.ID,
+		Type:       CaseType,
+		Attributes: c,
+		Relationships: links.Relationships{
+			"payment": {
+				Links: &links.RelationshipLinks{Related: "/payments/" + c.PaymentID},
+				Data:  &links.Identifier{Type: "Payment", ID: c.PaymentID},
+			},
+		},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+}
+
+// NewCaseResource creates new resource from Case
+func NewCaseResource(c *Case, self string) *CaseResource {
+	return &CaseResource{Data: newCaseResourceData(c, self)}
+}
+
+// Render implements render.Render
+func (resource *CaseResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// CaseListResource is a list of screening cases resource
+type CaseListResource struct {
+	Data []*CaseResourceData `json:"data"`
+	links.Resource
+}
+
+// NewCaseListResource returns new screening case list resource
+func NewCaseListResource(cases []Case, self, base string) *CaseListResource {
+	list := &CaseListResource{
+		Data:     []*CaseResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range cases {
+		list.Data = append(list.Data, newCaseResourceData(&cases[i], base+"/"+cases[i].ID))
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *CaseListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Decision is the decision of a compliance officer on a case. The officer
+// is the user that makes the request.
+type Decision struct {
+	Note string `json:"note"`
+}
+
+// DecisionResource is the request body of a case decision
+type DecisionResource struct {
+	Data *struct {
+		Type       string    `json:"type"`
+		Attributes *Decision `json:"attributes"`
+	} `json:"data"`
+}
+
+// Bind implements render.Binder
+func (resource *DecisionResource) Bind(r *http.Request) error {
+	if resource.Data == nil {
+		return fmt.Errorf("no data")
+	}
+
+	if resource.Data.Type != DecisionType {
+		return fmt.Errorf("wrong type")
+	}
+
+	if resource.Data.Attributes == nil {
+		resource.Data.Attributes = &Decision{}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package screening
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default thresholds of a screener
+const (
+	DefaultThreshold         = 0.92
+	DefaultPhoneticThreshold = 0.85
+)
+
+// Hit is a party name that matched a watchlist entry
+type Hit struct {
+	Role        string   `json:"role"`
+	Name        string   `json:"name"`
+	List        string   `json:"list"`
+	EntryID     string   `json:"entry_id"`
+	MatchedName string   `json:"matched_name"`
+	Programs    []string `json:"programs,omitempty"`
+	Score       float64  `json:"score"`
+	Phonetic    bool     `json:"phonetic"`
+}
+
+type indexedName struct {
+	entry  *Entry
+	name   string
+	tokens []string
+}
+
+// Screener matches names against the loaded watchlists. A name is a hit
+// when its similarity reaches Threshold, or PhoneticThreshold when it also
+// sounds like the listed name.
+type Screener struct {
+	Threshold         float64
+	PhoneticThreshold float64
+
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	names   []indexedName
+}
+
+// NewScreener returns a screener with the default thresholds and no lists
+func NewScreener() *Screener {
+	return &Screener{
+		Threshold:         DefaultThreshold,
+		PhoneticThreshold: DefaultPhoneticThreshold,
+		entries:           map[string]*Entry{},
+	}
+}
+
+// Add adds watchlist entries. Entries with the same list and id are merged
+// so that alternate names can be loaded from a separate file.
+func (s *Screener) Add(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range entries {
+		key := entries[i].List + "/" + entries[i].ID
+		entry, ok := s.entries[key]
+		if !ok {
+			e := entries[i]
+			e.Names = nil
+			entry = &e
+			s.entries[key] = entry
+		}
+		for _, name := range entries[i].Names {
+			entry.Names = append(entry.Names, name)
+			s.names = append(s.names, indexedName{entry: entry, name: name, tokens: Normalise(name)})
+		}
+	}
+}
+
+// Size returns the number of loaded entries
+func (s *Screener) Size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Screen matches a party name against the watchlists and returns the best
+// hit of every matching entry ordered by score
+func (s *Screener) Screen(role, name string) []Hit {
+	tokens := Normalise(name)
+	if len(tokens) == 0 {
+		return nil
+	}
+	joined := strings.Join(tokens, " ")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	best := map[*Entry]Hit{}
+	for _, n := range s.names {
+		score := JaroWinkler(joined, strings.Join(n.tokens, " "))
+		if ts := tokenSimilarity(tokens, n.tokens); ts > score {
+			score = ts
+		}
+		phonetic := phoneticMatch(tokens, n.tokens)
+
+		if score < s.Threshold && !(phonetic && score >= s.PhoneticThreshold) {
+			continue
+		}
+		if hit, ok := best[n.entry]; ok && hit.Score >= score {
+			continue
+		}
+
+		best[n.entry] = Hit{
+			Role:        role,
+			Name:        name,
+			List:        n.entry.List,
+			EntryID:     n.entry.ID,
+			MatchedName: n.name,
+			Programs:    n.entry.Programs,
+			Score:       float64(int(score*1000)) / 1000,
+			Phonetic:    phonetic,
+		}
+	}
+
+	hits := []Hit{}
+	for _, hit := range best {
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].List+hits[i].EntryID < hits[j].List+hits[j].EntryID
+	})
+
+	return hits
+}
+
+// Party is a named party of a payment
+type Party struct {
+	Role string
+	Name string
+}
+
+// ScreenParties screens all the parties and returns their hits
+func (s *Screener) ScreenParties(parties []Party) []Hit {
+	hits := []Hit{}
+	for _, p := range parties {
+		hits = append(hits, s.Screen(p.Role, p.Name)...)
+	}
+	return hits
+}
@@ -0,0 +1,119 @@
+package screening
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNormalise(t *testing.T) {
+	testCases := map[string]struct {
+		name   string
+		tokens []string
+	}{
+		"Reordered":    {name: "HUSSEIN, Saddam", tokens: []string{"hussein", "saddam"}},
+		"Accents":      {name: "José Müller-Lüdenscheidt", tokens: []string{"jose", "ludenscheidt", "muller"}},
+		"Cyrillic":     {name: "Сергей Аксёнов", tokens: []string{"aksenov", "sergey"}},
+		"StopWords":    {name: "The Bank of Cuba Ltd.", tokens: []string{"bank", "cuba"}},
+		"Apostrophe":   {name: "Patrick O'Brien", tokens: []string{"obrien", "patrick"}},
+		"Prefix":       {name: "AL-TIKRITI, Saddam", tokens: []string{"saddam", "tikriti"}},
+		"OnlyStopWord": {name: "Ltd", tokens: []string{}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if tokens := Normalise(tc.name); !reflect.DeepEqual(tokens, tc.tokens) {
+				t.Errorf("expected %v, got %v", tc.tokens, tokens)
+			}
+		})
+	}
+}
+
+func TestJaroWinkler(t *testing.T) {
+	testCases := map[string]struct {
+		a, b  string
+		score float64
+	}{
+		"Equal":         {a: "saddam", b: "saddam", score: 1},
+		"Transposition": {a: "martha", b: "marhta", score: 0.961},
+		"Dixon":         {a: "dixon", b: "dicksonx", score: 0.813},
+		"Different":     {a: "abc", b: "xyz", score: 0},
+		"Empty":         {a: "", b: "abc", score: 0},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if score := JaroWinkler(tc.a, tc.b); math.Abs(score-tc.score) > 0.001 {
+				t.Errorf("expected %.3f, got %.3f", tc.score, score)
+			}
+		})
+	}
+}
+
+func TestSoundex(t *testing.T) {
+	for word, code := range map[string]string{
+		"Robert":   "R163",
+		"Rupert":   "R163",
+		"Ashcraft": "A261",
+		"Tymczak":  "T522",
+		"Pfister":  "P236",
+		"Lee":      "L000",
+	} {
+		if got := Soundex(word); got != code {
+			t.Errorf("%s: expected %s, got %s", word, code, got)
+		}
+	}
+}
+
+func TestScreen(t *testing.T) {
+	s := NewScreener()
+	for _, path := range []string{
+		"../../testdata/watchlists/sdn.csv",
+		"../../testdata/watchlists/alt.csv",
+		"../../testdata/watchlists/eu.xml",
+	} {
+		entries, err := LoadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Add(entries)
+	}
+
+	if s.Size() != 6 {
+		t.Fatalf("expected 6 entries, got %d", s.Size())
+	}
+
+	testCases := map[string]struct {
+		name  string
+		list  string
+		entry string
+	}{
+		"Exact":          {name: "Saddam Hussein", list: ListOFAC, entry: "2674"},
+		"AlternateName":  {name: "National Bank of Cuba", list: ListOFAC, entry: "306"},
+		"Misspelled":     {name: "Sadam Husein", list: ListOFAC, entry: "2674"},
+		"Transliterated": {name: "Dmitry Kovalenko Sergeevich", list: ListOFAC, entry: "9999"},
+		"Cyrillic":       {name: "Аксёнов Сергей Валерьевич", list: ListEU, entry: "2856"},
+		"Entity":         {name: "LIBYAN INVESTMENT AUTHORITY", list: ListEU, entry: "13"},
+		"NoHit":          {name: "Emelia Jane Brown"},
+		"Similar":        {name: "Sandra Hudson"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			hits := s.Screen("beneficiary", tc.name)
+			if tc.entry == "" {
+				if len(hits) != 0 {
+					t.Fatalf("expected no hits, got %+v", hits)
+				}
+				return
+			}
+
+			if len(hits) == 0 {
+				t.Fatalf("expected a hit")
+			}
+			if hits[0].List != tc.list || hits[0].EntryID != tc.entry {
+				t.Errorf("expected %s/%s, got %+v", tc.list, tc.entry, hits[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package screening
+
+import (
+	"strings"
+)
+
+// JaroWinkler returns the Jaro-Winkler similarity of two strings between 0 and 1
+func JaroWinkler(a, b string) float64 {
+	s1, s2 := []rune(a), []rune(b)
+	if len(s1) == 0 && len(s2) == 0 {
+		return 1
+	}
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+
+	window := len(s1)
+	if len(s2) > window {
+		window = len(s2)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matched1 := make([]bool, len(s1))
+	matched2 := make([]bool, len(s2))
+	matches := 0
+	for i := range s1 {
+		from, to := i-window, i+window+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(s2) {
+			to = len(s2)
+		}
+		for j := from; j < to; j++ {
+			if !matched2[j] && s1[i] == s2[j] {
+				matched1[i], matched2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range s1 {
+		if !matched1[i] {
+			continue
+		}
+		for !matched2[j] {
+			j++
+		}
+		if s1[i] != s2[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(s1) && prefix < len(s2) && s1[prefix] == s2[prefix] {
+		prefix++
+	}
+
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// Soundex returns the American Soundex code of an ASCII word
+func Soundex(word string) string {
+	codes := map[byte]byte{
+		'b': '1', 'f': '1', 'p': '1', 'v': '1',
+		'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+		'd': '3', 't': '3',
+		'l': '4',
+		'm': '5', 'n': '5',
+		'r': '6',
+	}
+
+	word = strings.ToLower(word)
+	code := []byte{}
+	var last byte
+	for i := 0; i < len(word) && len(code) < 4; i++ {
+		c := word[i]
+		if c < 'a' || c > 'z' {
+			continue
+		}
+
+		digit, consonant := codes[c]
+		if len(code) == 0 {
+			code = append(code, c-'a'+'A')
+			last = digit
+			continue
+		}
+
+		switch {
+		case consonant && digit != last:
+			code = append(code, digit)
+			last = digit
+		case c == 'h' || c == 'w':
+			// h and w do not separate consonants with the same code
+		case !consonant:
+			last = 0
+		}
+	}
+
+	if len(code) == 0 {
+		return ""
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
+
+// tokenSimilarity matches every token of the shorter name with its most
+// similar token of the other name and averages the similarities
+func tokenSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	total := 0.0
+	for _, ta := range a {
+		best := 0.0
+		for _, tb := range b {
+			if s := JaroWinkler(ta, tb); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+
+	// Penalise names with extra tokens that matched nothing
+	return total / float64(len(a)) * (float64(len(a)) + float64(len(b))) / float64(2*len(b))
+}
+
+// phoneticMatch reports if every token of the shorter name sounds like a
+// token of the other name
+func phoneticMatch(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	codes := map[string]bool{}
+	for _, t := range b {
+		codes[Soundex(t)] = true
+	}
+	for _, t := range a {
+		if !codes[Soundex(t)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+	"github.com/pkg/errors"
+)
+
+// Config is the configuration of the HTTP server
+type Config struct {
+	Addr string
+
+	// Timeouts of reading a whole request, only its headers, writing the
+	// response and waiting for the next request of an idle connection
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	// ShutdownTimeout bounds draining the connections and stopping the
+	// workers once the server is stopped
+	ShutdownTimeout time.Duration
+
+	// TLSCert and TLSKey are the PEM files of the certificate, empty serves
+	// plain HTTP. The files are checked for changes every TLSReload.
+	TLSCert   string
+	TLSKey    string
+	TLSReload time.Duration
+}
+
+// DefaultConfig returns timeouts tight enough that slow clients cannot hold
+// the connections open
+func DefaultConfig(addr string) Config {
+	return Config{
+		Addr:              addr,
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		ShutdownTimeout:   30 * time.Second,
+		TLSReload:         time.Minute,
+	}
+}
+
+type worker struct {
+	name   string
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Server serves the handler and owns the lifecycle of the background workers
+// and the resources they share. Once stopped it drains the connections
+// first, then stops the workers and then closes the resources, each in the
+// order they were added.
+type Server struct {
+	Config Config
+	HTTP   *http.Server
+
+	certs   *Certificates
+	workers []*worker
+	closers []closer
+}
+
+// New returns a server of the configuration, loading the certificate if TLS
+// is configured. The handler is set on HTTP before it runs.
+func New(config Config) (*Server, error) {
+	s := &Server{
+		Config: config,
+		HTTP: &http.Server{
+			Addr:              config.Addr,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+			MaxHeaderBytes:    config.MaxHeaderBytes,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		},
+	}
+
+	if config.TLSCert != "" || config.TLSKey != "" {
+		certs, err := NewCertificates(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading TLS certificate failed")
+		}
+		s.certs = certs
+		s.HTTP.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		if config.TLSReload > 0 {
+			s.Go("tls", func(ctx context.Context) { certs.Watch(ctx, config.TLSReload) })
+		}
+	}
+
+	return s, nil
+}
+
+// Go runs the worker in the background while the server is running. The
+// worker should return once its context is cancelled.
+func (s *Server) Go(name string, run func(ctx context.Context)) {
+	s.workers = append(s.workers, &worker{name: name, run: run})
+}
+
+// OnClose closes the resource once the workers have stopped
+func (s *Server) OnClose(name string, close func() error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// Run listens on the address of the server and serves until the context is
+// cancelled
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Config.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve serves the listener until the context is cancelled or serving fails
+// and then shuts down the server
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	for _, w := range s.workers {
+		var wctx context.Context
+		// The workers keep running while the connections drain
+		wctx, w.cancel = context.WithCancel(context.Background())
+		w.done = make(chan struct{})
+		go func(w *worker) {
+			defer close(w.done)
+			w.run(wctx)
+		}(w)
+	}
+
+	if s.certs != nil {
+		ln = tls.NewListener(ln, s.HTTP.TLSConfig)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- s.HTTP.Serve(ln) }()
+	slog.Info("serving", slog.String("addr", ln.Addr().String()), slog.Bool("tls", s.certs != nil))
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down", slog.Duration("timeout", s.Config.ShutdownTimeout))
+	case err = <-served:
+		err = errors.Wrap(err, "serving failed")
+	}
+
+	if shutdownErr := s.shutdown(); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+func (s *Server) shutdown() error {
+	ctx := context.Background()
+	if s.Config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Config.ShutdownTimeout)
+		defer cancel()
+	}
+
+	var err error
+	if shutdownErr := s.HTTP.Shutdown(ctx); shutdownErr != nil {
+		err = errors.Wrap(shutdownErr, "draining connections failed")
+		s.HTTP.Close()
+	}
+
+	for _, w := range s.workers {
+		w.cancel()
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			slog.Warn("worker did not stop", slog.String("worker", w.name))
+			if err == nil {
+				err = errors.Errorf("stopping worker %s timed out", w.name)
+			}
+		}
+	}
+
+	for _, c := range s.closers {
+		if closeErr := c.close(); closeErr != nil {
+			slog.Warn("closing failed", slog.String("resource", c.name), logging.Error(closeErr))
+			if err == nil {
+				err = errors.Wrapf(closeErr, "closing %s failed", c.name)
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsBeforeStopping(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	config := DefaultConfig("127.0.0.1:0")
+	config.ShutdownTimeout = 5 * time.Second
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HTTP.Handler = handler
+
+	var mu sync.Mutex
+	var stopped []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = append(stopped, name)
+	}
+	for _, name := range []string{"scheduler", "watcher"} {
+		name := name
+		s.Go(name, func(ctx context.Context) {
+			<-ctx.Done()
+			record(name)
+		})
+	}
+	s.OnClose("db", func() error {
+		record("db")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+
+	responses := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	cancel()
+	// The workers keep running while the request is in flight
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if len(stopped) != 0 {
+		t.Errorf("expected nothing stopped before draining, got %v", stopped)
+	}
+	mu.Unlock()
+	close(release)
+
+	if got := <-responses; got != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+	if expected := []string{"scheduler", "watcher", "db"}; !reflect.DeepEqual(stopped, expected) {
+		t.Errorf("expected to stop %v in order, got %v", expected, stopped)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	config := DefaultConfig("127.0.0.1:0")
+	config.ShutdownTimeout = 50 * time.Millisecond
+	s, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stuck := make(chan struct{})
+	defer close(stuck)
+	s.Go("stuck", func(ctx context.Context) { <-stuck })
+	closed := false
+	s.OnClose("db", func() error {
+		closed = true
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = s.Run(ctx)
+	if err == nil || err.Error() != "stopping worker stuck timed out" {
+		t.Errorf("expected the worker to time out, got %v", err)
+	}
+	if !closed {
+		t.Error("expected the resources to be closed anyway")
+	}
+}
+
+func TestCertificatesReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeCertificate(t, certFile, keyFile, "first")
+	certs, err := NewCertificates(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertCommonName(t, certs, "first")
+
+	changed, err := certs.Reload()
+	if err != nil || changed {
+		t.Errorf("expected no reload of unchanged files, got %v, %v", changed, err)
+	}
+
+	writeCertificate(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if changed, err := certs.Reload(); err != nil || !changed {
+		t.Fatalf("expected the renewed certificate to be loaded, got %v, %v", changed, err)
+	}
+	assertCommonName(t, certs, "second")
+
+	ioutil.WriteFile(certFile, []byte("broken"), 0600)
+	later = later.Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if _, err := certs.Reload(); err == nil {
+		t.Error("expected the broken certificate to fail")
+	}
+	assertCommonName(t, certs, "second")
+}
+
+func assertCommonName(t *testing.T, certs *Certificates, expected string) {
+	t.Helper()
+	cert, err := certs.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Subject.CommonName != expected {
+		t.Errorf("expected certificate %s, got %s", expected, parsed.Subject.CommonName)
+	}
+}
+
+func writeCertificate(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+)
+
+// Certificates serves the certificate of the files and reloads it when they
+// change so renewed certificates are picked up without a restart
+type Certificates struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// NewCertificates loads the certificate of the PEM files
+func NewCertificates(certFile, keyFile string) (*Certificates, error) {
+	c := &Certificates{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate again if either of the files has changed
+// since it was loaded. A certificate that fails to load keeps the previous
+// one in use.
+func (c *Certificates) Reload() (bool, error) {
+	modified, err := c.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && !modified.After(c.modified)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.cert, c.modified = &cert, modified
+	c.mu.Unlock()
+	return true, nil
+}
+
+func (c *Certificates) lastModified() (time.Time, error) {
+	var modified time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *Certificates) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Watch reloads the certificate every interval until the context is
+// cancelled
+func (c *Certificates) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := c.Reload()
+		if err != nil {
+			slog.Error("reloading TLS certificate failed", logging.Error(err))
+		} else if changed {
+			slog.Info("reloaded TLS certificate", slog.String("file", c.certFile))
+		}
+	}
+}
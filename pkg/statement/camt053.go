@@ -0,0 +1,148 @@
+package statement
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID       string      `xml:"Id"`
+	Created  string      `xml:"CreDtTm"`
+	IBAN     string      `xml:"Acct>Id>IBAN"`
+	Other    string      `xml:"Acct>Id>Othr>Id"`
+	Currency string      `xml:"Acct>Ccy"`
+	Entries  []camtEntry `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtEntry struct {
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	BookingDate camtDate   `xml:"BookgDt"`
+	ValueDate   camtDate   `xml:"ValDt"`
+	EndToEndIDs []string   `xml:"NtryDtls>TxDtls>Refs>EndToEndId"`
+	Info        string     `xml:"AddtlNtryInf"`
+}
+
+// ParseCAMT053 parses an ISO 20022 camt.053 bank to customer statement
+func ParseCAMT053(r io.Reader) ([]Statement, error) {
+	doc := camtDocument{}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid camt.053: %v", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, fmt.Errorf("invalid camt.053: no statements")
+	}
+
+	statements := []Statement{}
+	for _, s := range doc.Statements {
+		statement := Statement{
+			Format:    FormatCAMT053,
+			Reference: s.ID,
+			Account:   s.IBAN,
+			Currency:  s.Currency,
+		}
+		if statement.Account == "" {
+			statement.Account = s.Other
+		}
+
+		if s.Created != "" {
+			created, err := parseCAMTDate(camtDate{DateTime: s.Created})
+			if err != nil {
+				return nil, err
+			}
+			statement.Date = created
+		}
+
+		for i, e := range s.Entries {
+			entry, err := e.entry()
+			if err != nil {
+				return nil, fmt.Errorf("statement %s entry %d: %v", s.ID, i+1, err)
+			}
+			if entry.Currency == "" {
+				entry.Currency = statement.Currency
+			}
+			statement.Entries = append(statement.Entries, *entry)
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+func (e camtEntry) entry() (*Entry, error) {
+	amount, err := decimal.NewFromString(strings.TrimSpace(e.Amount.Value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", e.Amount.Value)
+	}
+
+	entry := &Entry{
+		Amount:      amount,
+		Currency:    e.Amount.Currency,
+		CreditDebit: e.CreditDebit,
+		Description: strings.TrimSpace(e.Info),
+	}
+	if entry.CreditDebit != Credit && entry.CreditDebit != Debit {
+		return nil, fmt.Errorf("invalid credit/debit indicator %q", e.CreditDebit)
+	}
+
+	for _, id := range e.EndToEndIDs {
+		if id = strings.TrimSpace(id); id != "" && id != "NOTPROVIDED" {
+			entry.Reference = id
+			break
+		}
+	}
+
+	if entry.ValueDate, err = parseCAMTDate(e.ValueDate); err != nil {
+		return nil, err
+	}
+	if entry.BookingDate, err = parseCAMTDate(e.BookingDate); err != nil {
+		return nil, err
+	}
+	if entry.ValueDate.IsZero() {
+		entry.ValueDate = entry.BookingDate
+	}
+
+	return entry, nil
+}
+
+func parseCAMTDate(d camtDate) (time.Time, error) {
+	if d.Date != "" {
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(d.Date))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", d.Date)
+		}
+		return date, nil
+	}
+
+	if d.DateTime != "" {
+		value := strings.TrimSpace(d.DateTime)
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid date time %q", d.DateTime)
+	}
+
+	return time.Time{}, nil
+}
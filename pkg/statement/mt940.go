@@ -0,0 +1,207 @@
+package statement
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var (
+	mt940Tag     = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([\d,]+)$`)
+	mt940EREF    = regexp.MustCompile(`(?:EREF\+|/EREF/)([^/+\s]+)`)
+)
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// ParseMT940 parses a SWIFT MT940 customer statement message.
+// Several statements may follow each other in the same input.
+func ParseMT940(r io.Reader) ([]Statement, error) {
+	fields, err := readMT940Fields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []Statement{}
+	var current *Statement
+	for _, f := range fields {
+		if f.tag == "20" {
+			statements = append(statements, Statement{Format: FormatMT940, Reference: f.value})
+			current = &statements[len(statements)-1]
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("invalid mt940: field :%s: before :20:", f.tag)
+		}
+
+		switch f.tag {
+		case "25":
+			current.Account = f.value
+		case "60F", "60M":
+			m := mt940Balance.FindStringSubmatch(f.value)
+			if m == nil {
+				return nil, fmt.Errorf("invalid mt940: opening balance %q", f.value)
+			}
+			current.Currency = m[3]
+		case "62F", "62M":
+			m := mt940Balance.FindStringSubmatch(f.value)
+			if m == nil {
+				return nil, fmt.Errorf("invalid mt940: closing balance %q", f.value)
+			}
+			date, err := time.Parse("060102", m[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid mt940: closing balance date %q", m[2])
+			}
+			current.Date = date
+		case "61":
+			entry, err := parseMT940Line(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mt940: statement %s: %v", current.Reference, err)
+			}
+			entry.Currency = current.Currency
+			current.Entries = append(current.Entries, *entry)
+		case "86":
+			if len(current.Entries) == 0 {
+				continue
+			}
+			entry := &current.Entries[len(current.Entries)-1]
+			entry.Description = strings.Replace(f.value, "\n", " ", -1)
+			if m := mt940EREF.FindStringSubmatch(entry.Description); m != nil {
+				entry.Reference = m[1]
+			}
+		}
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("invalid mt940: no statements")
+	}
+
+	return statements, nil
+}
+
+func readMT940Fields(r io.Reader) ([]mt940Field, error) {
+	fields := []mt940Field{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r ")
+
+		// Skip the SWIFT envelope blocks and the end of text marker.
+		if strings.HasPrefix(line, "{") {
+			if i := strings.Index(line, "{4:"); i >= 0 {
+				line = line[i+3:]
+			} else {
+				continue
+			}
+		}
+		if line == "" || line == "-" || line == "-}" {
+			continue
+		}
+
+		if m := mt940Tag.FindStringSubmatch(line); m != nil {
+			fields = append(fields, mt940Field{tag: m[1], value: m[2]})
+			continue
+		}
+
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid mt940: unexpected line %q", line)
+		}
+		fields[len(fields)-1].value += "\n" + line
+	}
+
+	return fields, scanner.Err()
+}
+
+// parseMT940Line parses the :61: statement line field.
+// Format: 6!n[4!n]2a[1!a]15d1!a3!c16x[//16x][34x]
+func parseMT940Line(value string) (*Entry, error) {
+	supplementary := ""
+	if i := strings.Index(value, "\n"); i >= 0 {
+		value, supplementary = value[:i], value[i+1:]
+	}
+
+	if len(value) < 6 {
+		return nil, fmt.Errorf("statement line too short %q", value)
+	}
+	valueDate, err := time.Parse("060102", value[:6])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date %q", value[:6])
+	}
+	rest := value[6:]
+
+	entry := &Entry{ValueDate: valueDate, BookingDate: valueDate}
+	if len(rest) >= 4 && isDigits(rest[:4]) {
+		booking, err := time.Parse("0102", rest[:4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry date %q", rest[:4])
+		}
+		entry.BookingDate = time.Date(valueDate.Year(), booking.Month(), booking.Day(), 0, 0, 0, 0, time.UTC)
+		// The entry date may be in the next year from the value date.
+		if entry.BookingDate.Before(valueDate.AddDate(0, -6, 0)) {
+			entry.BookingDate = entry.BookingDate.AddDate(1, 0, 0)
+		}
+		rest = rest[4:]
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "RC"), strings.HasPrefix(rest, "RD"):
+		entry.CreditDebit = map[byte]string{'C': Debit, 'D': Credit}[rest[1]]
+		rest = rest[2:]
+	case strings.HasPrefix(rest, "C"):
+		entry.CreditDebit = Credit
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "D"):
+		entry.CreditDebit = Debit
+		rest = rest[1:]
+	default:
+		return nil, fmt.Errorf("invalid debit/credit mark in %q", value)
+	}
+
+	// Optional funds code
+	if rest != "" && rest[0] >= 'A' && rest[0] <= 'Z' {
+		rest = rest[1:]
+	}
+
+	i := 0
+	for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == ',') {
+		i++
+	}
+	amount, err := decimal.NewFromString(strings.Replace(rest[:i], ",", ".", 1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", rest[:i])
+	}
+	entry.Amount = amount
+	rest = rest[i:]
+
+	if len(rest) < 4 {
+		return nil, fmt.Errorf("missing transaction type in %q", value)
+	}
+	rest = rest[4:]
+
+	reference := rest
+	if i := strings.Index(rest, "//"); i >= 0 {
+		reference = rest[:i]
+	}
+	if reference != "NONREF" {
+		entry.Reference = reference
+	}
+	entry.Description = strings.TrimSpace(supplementary)
+
+	return entry, nil
+}
+
+func isDigits(s string) bool {
+	for i := range s {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package statement
+
+import (
+	"net/http"
+
+	"github.com/VMitov/payments/pkg/links"
+)
+
+// Type is the type of the statement resource
+const Type = "Statement"
+
+// ResourceData is the data of the statement resource
+type ResourceData struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Attributes *Statement `json:"attributes"`
+	Meta       *Summary   `json:"meta,omitempty"`
+}
+
+// Summary is the outcome of the reconciliation of a statement
+type Summary struct {
+	Entries           int `json:"entries"`
+	Matched           int `json:"matched"`
+	UnmatchedPayments int `json:"unmatched_payments"`
+	UnmatchedEntries  int `json:"unmatched_entries"`
+}
+
+// ListResource is a list of statements resource
+type ListResource struct {
+	Data []*ResourceData `json:"data"`
+	links.Resource
+}
+
+// NewListResource returns new statements list resource.
+// Summaries are attached by index when given.
+func NewListResource(statements []Statement, summaries []*Summary, self string) *ListResource {
+	list := &ListResource{
+		Data:     []*ResourceData{},
+		Resource: links.Resource{Links: links.Links{Self: self}},
+	}
+	for i := range statements {
+		data := &ResourceData{
+			ID:         statements[i].ID,
+			Type:       Type,
+			Attributes: &statements[i],
+		}
+		if i < len(summaries) {
+			data.Meta = summaries[i]
+		}
+		list.Data = append(list.Data, data)
+	}
+
+	return list
+}
+
+// Render implements render.Render
+func (list *ListResource) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
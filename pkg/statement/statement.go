@@ -0,0 +1,90 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Supported statement formats
+const (
+	FormatCAMT053 = "camt.053"
+	FormatMT940   = "mt940"
+)
+
+// Credit and debit indicators of an entry
+const (
+	Credit = "CRDT"
+	Debit  = "DBIT"
+)
+
+// Statement is an end-of-day bank statement
+type Statement struct {
+	ID             string    `db:"id"              json:"-"`
+	OrganisationID string    `db:"organisation_id" json:"-"`
+	Format         string    `db:"format"          json:"format"`
+	Reference      string    `db:"reference"       json:"reference"`
+	Account        string    `db:"account"         json:"account"`
+	Currency       string    `db:"currency"        json:"currency"`
+	Date           time.Time `db:"date"            json:"date"`
+	ReceivedAt     time.Time `db:"received_at"     json:"received_at"`
+
+	Entries []Entry `db:"-" json:"-"`
+}
+
+// Entry is a single booked line of a statement
+type Entry struct {
+	ID          string          `db:"id"           json:"-"`
+	StatementID string          `db:"statement_id" json:"statement_id"`
+	Reference   string          `db:"reference"    json:"end_to_end_reference"`
+	Amount      decimal.Decimal `db:"amount"       json:"amount"`
+	Currency    string          `db:"currency"     json:"currency"`
+	CreditDebit string          `db:"credit_debit" json:"credit_debit"`
+	ValueDate   time.Time       `db:"value_date"   json:"value_date"`
+	BookingDate time.Time       `db:"booking_date" json:"booking_date"`
+	Description string          `db:"description"  json:"description"`
+}
+
+// Parse reads statements in the given format
+func Parse(format string, r io.Reader) ([]Statement, error) {
+	switch format {
+	case FormatCAMT053:
+		return ParseCAMT053(r)
+	case FormatMT940:
+		return ParseMT940(r)
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+}
+
+// Detect guesses the format of a statement from its content
+func Detect(data []byte) (string, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return FormatCAMT053, nil
+	case bytes.HasPrefix(trimmed, []byte(":20:")), bytes.HasPrefix(trimmed, []byte("{1:")):
+		return FormatMT940, nil
+	}
+	return "", fmt.Errorf("unknown statement format")
+}
+
+// ParseAuto detects the format of the statement and parses it
+func ParseAuto(r io.Reader) (string, []Statement, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	format, err := Detect(data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	statements, err := Parse(format, bytes.NewReader(data))
+	return format, statements, err
+}
@@ -0,0 +1,60 @@
+package statement
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParse(t *testing.T) {
+	testCases := map[string]struct {
+		file   string
+		format string
+	}{
+		"CAMT053": {file: "../../testdata/statements/camt053.xml", format: FormatCAMT053},
+		"MT940":   {file: "../../testdata/statements/mt940.txt", format: FormatMT940},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			format, statements, err := ParseAuto(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tc.format {
+				t.Errorf("format = %q, want %q", format, tc.format)
+			}
+			if len(statements) != 1 {
+				t.Fatalf("got %d statements, want 1", len(statements))
+			}
+
+			s := statements[0]
+			if s.Reference != "STMT-2018-10-01" || s.Account != "GB33BUKB20201555555555" || s.Currency != "GBP" {
+				t.Errorf("unexpected statement header %+v", s)
+			}
+			if len(s.Entries) != 2 {
+				t.Fatalf("got %d entries, want 2", len(s.Entries))
+			}
+
+			debit, credit := s.Entries[0], s.Entries[1]
+			if debit.Reference != "E2E-0001" || debit.CreditDebit != Debit ||
+				!debit.Amount.Equal(decimal.RequireFromString("100.21")) || debit.Currency != "GBP" ||
+				!debit.ValueDate.Equal(time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected debit entry %+v", debit)
+			}
+			if credit.Reference != "" || credit.CreditDebit != Credit ||
+				!credit.Amount.Equal(decimal.RequireFromString("25")) ||
+				!credit.ValueDate.Equal(time.Date(2018, 10, 2, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected credit entry %+v", credit)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package statement
+
+import (
+	"errors"
+
+	"github.com/VMitov/payments/pkg/tenant"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrExists is returned when the organisation already has a statement with
+// the reference
+var ErrExists = errors.New("statement already exists")
+
+// Create persists a statement of the organisation together with its entries.
+// The ids of the statement and the entries are set on success.
+func Create(db *sqlx.DB, org string, s *Statement) error {
+	return tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return CreateTx(tx, org, s)
+	})
+}
+
+// CreateTx persists a statement of the organisation within a transaction
+// scoped to it
+func CreateTx(tx *sqlx.Tx, org string, s *Statement) error {
+	s.OrganisationID = org
+	err := tx.Get(&s.ID, tx.Rebind(
+		`INSERT INTO statements (organisation_id, format, reference, account, currency, date)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`),
+		org, s.Format, s.Reference, s.Account, s.Currency, s.Date,
+	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return ErrExists
+	} else if err != nil {
+		return err
+	}
+
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		e.StatementID = s.ID
+		if err := tx.Get(&e.ID, tx.Rebind(
+			`INSERT INTO statement_entries
+			(statement_id, reference, amount, currency, credit_debit, value_date, booking_date, description)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+			e.StatementID, e.Reference, e.Amount, e.Currency, e.CreditDebit,
+			e.ValueDate, e.BookingDate, e.Description,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Select gets all statements of the organisation
+func Select(db *sqlx.DB, org string) ([]Statement, error) {
+	statements := []Statement{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Select(&statements,
+			"SELECT * FROM statements WHERE organisation_id=$1 ORDER BY received_at DESC", org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return statements, nil
+}
+
+// GetEntry gets a single statement entry of the organisation
+func GetEntry(db *sqlx.DB, org, id string) (*Entry, error) {
+	entry := Entry{}
+	if err := tenant.Scoped(db, org, func(tx *sqlx.Tx) error {
+		return tx.Get(&entry, `SELECT e.* FROM statement_entries e
+			JOIN statements s ON s.id = e.statement_id
+			WHERE e.id=$1 AND s.organisation_id=$2`, id, org)
+	}); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
@@ -0,0 +1,35 @@
+package tenant
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Organisation is a client organisation the payments belong to
+type Organisation struct {
+	ID        string    `db:"id"         json:"id"`
+	Name      string    `db:"name"       json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// CreateOrganisation persists an organisation
+func CreateOrganisation(db *sqlx.DB, name string) (*Organisation, error) {
+	org := Organisation{}
+	if err := db.Get(&org, `INSERT INTO organisations (name) VALUES ($1) RETURNING *`, name); err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// SelectOrganisations gets all organisations
+func SelectOrganisations(db *sqlx.DB) ([]Organisation, error) {
+	orgs := []Organisation{}
+	if err := db.Select(&orgs, "SELECT * FROM organisations ORDER BY created_at"); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return orgs, nil
+}
@@ -0,0 +1,96 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Setting is the Postgres setting read by the row level security policies
+const Setting = "payments.organisation_id"
+
+// System scopes a transaction to every organisation. It is reserved for the
+// background jobs of the service and is never resolved from a request.
+const System = "*"
+
+// ErrNoOrganisation is returned when a query is not scoped to an organisation
+var ErrNoOrganisation = errors.New("no organisation")
+
+// ErrBypassesPolicies is returned when the database role of the service is
+// a superuser or has BYPASSRLS, which ignore the row level security policies
+var ErrBypassesPolicies = errors.New("database role bypasses row level security")
+
+type key int
+
+const keyOrganisation key = iota
+
+// NewContext returns a context scoped to the organisation
+func NewContext(ctx context.Context, organisationID string) context.Context {
+	return context.WithValue(ctx, keyOrganisation, organisationID)
+}
+
+// FromContext returns the organisation of the context
+func FromContext(ctx context.Context) (string, bool) {
+	org, ok := ctx.Value(keyOrganisation).(string)
+	return org, ok && org != ""
+}
+
+// Begin starts a transaction scoped to the organisation. The row level
+// security policies hide the rows of the other organisations within it.
+func Begin(db *sqlx.DB, organisationID string) (*sqlx.Tx, error) {
+	if organisationID == "" {
+		return nil, ErrNoOrganisation
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Switch(tx, organisationID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Switch scopes the rest of the transaction to another organisation
+func Switch(tx *sqlx.Tx, organisationID string) error {
+	if organisationID == "" {
+		return ErrNoOrganisation
+	}
+
+	_, err := tx.Exec(`SELECT set_config($1, $2, true)`, Setting, organisationID)
+	return err
+}
+
+// Scoped runs the function in a transaction scoped to the organisation and
+// commits it if the function succeeds
+func Scoped(db *sqlx.DB, organisationID string, fn func(tx *sqlx.Tx) error) error {
+	tx, err := Begin(db, organisationID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CheckRole checks that the row level security policies apply to the
+// database role of the connection
+func CheckRole(db *sqlx.DB) error {
+	var bypasses bool
+	if err := db.Get(&bypasses, `SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`); err != nil {
+		return err
+	}
+	if bypasses {
+		return ErrBypassesPolicies
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Headers of the W3C trace context
+const (
+	TraceparentHeader   = "traceparent"
+	TracestateHeader    = "tracestate"
+	TraceresponseHeader = "traceresponse"
+)
+
+// FlagSampled marks a trace recorded by the caller
+const FlagSampled byte = 0x01
+
+// ErrInvalidTraceparent is returned for a traceparent header that can not be parsed
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports if the id is not all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports if the id is not all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is the part of a span propagated to other services
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// IsValid reports if the context has a trace and a span
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats the context as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header. Versions after 00 are
+// parsed by their 00 prefix as the specification requires.
+func ParseTraceparent(header string) (SpanContext, error) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	parts := strings.Split(header[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(header) != 55) {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	sc := SpanContext{}
+	version, err := decodeLower(parts[0])
+	if err != nil || len(version) != 1 {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	traceID, err := decodeLower(parts[1])
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	spanID, err := decodeLower(parts[2])
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+	flags, err := decodeLower(parts[3])
+	if err != nil {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, ErrInvalidTraceparent
+	}
+
+	return sc, nil
+}
+
+// decodeLower decodes lowercase hex as the header allows no other
+func decodeLower(s string) ([]byte, error) {
+	if strings.ToLower(s) != s {
+		return nil, ErrInvalidTraceparent
+	}
+	return hex.DecodeString(s)
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,329 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+)
+
+// Batcher collects the spans and exports them in batches in the background
+// so the requests do not wait for the exporter. Spans are dropped when the
+// exporter falls behind.
+type Batcher struct {
+	exporter Exporter
+	size     int
+	interval time.Duration
+
+	spans chan *SpanData
+	close chan chan struct{}
+}
+
+// NewBatcher returns a batcher exporting batches of up to size spans at
+// least every interval
+func NewBatcher(exporter Exporter, size int, interval time.Duration) *Batcher {
+	b := &Batcher{
+		exporter: exporter,
+		size:     size,
+		interval: interval,
+		spans:    make(chan *SpanData, size*4),
+		close:    make(chan chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Export implements Exporter
+func (b *Batcher) Export(spans []*SpanData) error {
+	for _, s := range spans {
+		select {
+		case b.spans <- s:
+		default:
+			return fmt.Errorf("span %s dropped, the exporter is behind", s.Name)
+		}
+	}
+	return nil
+}
+
+// Check reports if the batcher drops spans because its queue is full
+func (b *Batcher) Check(ctx context.Context) error {
+	if len(b.spans) == cap(b.spans) {
+		return fmt.Errorf("queue of %d spans is full", cap(b.spans))
+	}
+	return nil
+}
+
+// Close exports the collected spans and stops the batcher
+func (b *Batcher) Close() {
+	done := make(chan struct{})
+	b.close <- done
+	<-done
+}
+
+func (b *Batcher) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, b.size)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := b.exporter.Export(batch); err != nil {
+			slog.Error("exporting spans failed", slog.Int("spans", len(batch)), logging.Error(err))
+		}
+		batch = make([]*SpanData, 0, b.size)
+	}
+
+	for {
+		select {
+		case s := <-b.spans:
+			batch = append(batch, s)
+			if len(batch) >= b.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case done := <-b.close:
+			for len(b.spans) > 0 {
+				batch = append(batch, <-b.spans)
+			}
+			flush()
+			close(done)
+			return
+		}
+	}
+}
+
+// OTLP exports the spans to an OpenTelemetry collector with OTLP over HTTP
+// in the JSON encoding
+type OTLP struct {
+	// Endpoint is the URL of the traces like http://localhost:4318/v1/traces
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+}
+
+// Export implements Exporter
+func (o *OTLP) Export(spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range o.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// OTLP span kinds and status codes
+var otlpKinds = map[string]int{KindInternal: 1, KindServer: 2, KindClient: 3}
+
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+// otlpRequest groups the spans by service
+func otlpRequest(spans []*SpanData) *otlpTraces {
+	byService := map[string][]otlpSpan{}
+	services := []string{}
+	for _, s := range spans {
+		if _, ok := byService[s.Service]; !ok {
+			services = append(services, s.Service)
+		}
+
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              otlpKinds[s.Kind],
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        attributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		byService[s.Service] = append(byService[s.Service], span)
+	}
+
+	traces := &otlpTraces{ResourceSpans: []otlpResourceSpans{}}
+	for _, service := range services {
+		rs := otlpResourceSpans{}
+		rs.Resource.Attributes = attributes(map[string]string{"service.name": service})
+		scope := otlpScopeSpans{Spans: byService[service]}
+		scope.Scope.Name = "github.com/VMitov/payments"
+		rs.ScopeSpans = []otlpScopeSpans{scope}
+		traces.ResourceSpans = append(traces.ResourceSpans, rs)
+	}
+	return traces
+}
+
+func attributes(values map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute{Key: k, Value: otlpValue{StringValue: values[k]}})
+	}
+	return attrs
+}
+
+// File writes the spans as JSON lines for local debugging
+type File struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewFile returns an exporter appending to the file or writing to the
+// standard output if the path is -
+func NewFile(path string) (*File, error) {
+	if path == "-" {
+		return &File{w: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{w: f}, nil
+}
+
+// Close closes the file unless it is the standard output
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c, ok := f.w.(io.Closer); ok && f.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+type fileSpan struct {
+	TraceID    string            `json:"trace_id"`
+	SpanID     string            `json:"span_id"`
+	ParentID   string            `json:"parent_id,omitempty"`
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Start      time.Time         `json:"start"`
+	DurationMS float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Export implements Exporter
+func (f *File) Export(spans []*SpanData) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	enc := json.NewEncoder(f.w)
+	for _, s := range spans {
+		line := fileSpan{
+			TraceID:    s.Context.TraceID.String(),
+			SpanID:     s.Context.SpanID.String(),
+			Service:    s.Service,
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Start:      s.Start,
+			DurationMS: float64(s.End.Sub(s.Start)) / float64(time.Millisecond),
+			Attributes: s.Attributes,
+			Error:      s.Error,
+		}
+		if s.Parent.IsValid() {
+			line.ParentID = s.Parent.String()
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
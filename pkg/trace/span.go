@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Kinds of the spans
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+)
+
+// Span is a timed operation of a trace
+type Span struct {
+	tracer *Tracer
+
+	mu   sync.Mutex
+	data SpanData
+}
+
+// SpanData is the recorded span handed to the exporters
+type SpanData struct {
+	Name         string
+	Kind         string
+	Context      SpanContext
+	Parent       SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Error        string
+	Service      string
+	RemoteParent bool
+}
+
+// SpanContext returns the propagated context of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.Context
+}
+
+// SetName renames the span once more is known about the operation
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed with the error
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// End ends the span and exports it. A span is exported only once.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.data.End.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.export(&data)
+}
+
+type key int
+
+const keySpan key = iota
+
+// NewContext returns a context carrying the span
+func NewContext(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, keySpan, s)
+}
+
+// FromContext returns the span of the context
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(keySpan).(*Span)
+	return s
+}
+
+// Start starts a child span of the span of the context. Without a span in
+// the context there is no trace and the returned nil span does nothing.
+func Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	s := parent.tracer.newSpan(name, kind, parent.data.Context, false)
+	return NewContext(ctx, s), s
+}
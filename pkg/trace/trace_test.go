@@ -0,0 +1,175 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	testCases := map[string]struct {
+		header string
+		valid  bool
+	}{
+		"Valid":         {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true},
+		"NotSampled":    {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		"FutureVersion": {header: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds", valid: true},
+		"Empty":         {header: ""},
+		"VersionFF":     {header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"TrailingData":  {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		"Uppercase":     {header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		"ZeroTraceID":   {header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		"ZeroSpanID":    {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		"NotHex":        {header: "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01"},
+		"ShortSpanID":   {header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-0101"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tc.header)
+			if !tc.valid {
+				if err != ErrInvalidTraceparent {
+					t.Errorf("expected an invalid traceparent, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("unexpected context %+v", sc)
+			}
+			if expected := tc.header[:55]; name != "FutureVersion" && sc.Traceparent() != expected {
+				t.Errorf("expected %s, got %s", expected, sc.Traceparent())
+			}
+		})
+	}
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (r *recorder) Export(spans []*SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewTracer("payments", rec)
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	parent.TraceState = "vendor=value"
+
+	ctx, server := tracer.StartRemote(context.Background(), "GET /payments", KindServer, parent)
+	_, child := Start(ctx, "payment.select", KindClient)
+	child.SetAttribute("db.operation", "select")
+	child.SetError(errors.New("connection refused"))
+	child.End()
+	child.End()
+	server.End()
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(rec.spans))
+	}
+	c, s := rec.spans[0], rec.spans[1]
+	if s.Context.TraceID != parent.TraceID || s.Parent != parent.SpanID || !s.RemoteParent || s.Context.TraceState != "vendor=value" {
+		t.Errorf("expected the server span to continue the remote trace, got %+v", s)
+	}
+	if c.Context.TraceID != parent.TraceID || c.Parent != s.Context.SpanID || c.RemoteParent {
+		t.Errorf("expected the child of the server span, got %+v", c)
+	}
+	if c.Error != "connection refused" || c.Attributes["db.operation"] != "select" {
+		t.Errorf("unexpected child span %+v", c)
+	}
+
+	if _, span := Start(context.Background(), "untraced", KindInternal); span != nil {
+		t.Errorf("expected no span without a trace, got %+v", span)
+	}
+
+	_, root := tracer.StartRemote(context.Background(), "GET /payments", KindServer, SpanContext{})
+	if !root.SpanContext().IsValid() || root.data.Parent.IsValid() {
+		t.Errorf("expected a new trace, got %+v", root.data)
+	}
+}
+
+func TestOTLP(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	tracer := NewTracer("payments", nil)
+	_, span := tracer.StartRemote(context.Background(), "GET /payments", KindServer, SpanContext{})
+	span.SetAttribute("http.status_code", "500")
+	span.SetError(errors.New("500 Internal Server Error"))
+	span.data.End = span.data.Start.Add(time.Millisecond)
+
+	o := &OTLP{Endpoint: server.URL + "/v1/traces", Headers: map[string]string{"Authorization": "secret"}}
+	if err := o.Export([]*SpanData{&span.data}); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resource, _ := json.Marshal(rs["resource"])
+	if string(resource) != `{"attributes":[{"key":"service.name","value":{"stringValue":"payments"}}]}` {
+		t.Errorf("unexpected resource %s", resource)
+	}
+	s := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	if s["traceId"] != span.data.Context.TraceID.String() || s["kind"] != float64(2) || s["name"] != "GET /payments" {
+		t.Errorf("unexpected span %v", s)
+	}
+	if _, ok := s["parentSpanId"]; ok {
+		t.Errorf("expected no parent of a root span, got %v", s["parentSpanId"])
+	}
+	status := s["status"].(map[string]interface{})
+	if status["code"] != float64(2) || status["message"] != "500 Internal Server Error" {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	if err := (&OTLP{Endpoint: server.URL + "/wrong"}).Export([]*SpanData{&span.data}); err == nil {
+		t.Error("expected an error from a failing collector")
+	}
+}
+
+func TestFileAndBatcher(t *testing.T) {
+	buf := &bytes.Buffer{}
+	batcher := NewBatcher(&File{w: buf}, 10, time.Hour)
+	tracer := NewTracer("payments", batcher)
+
+	ctx, server := tracer.StartRemote(context.Background(), "GET /payments", KindServer, SpanContext{})
+	_, child := Start(ctx, "payment.select", KindClient)
+	child.End()
+	server.End()
+	batcher.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	line := fileSpan{}
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.Name != "payment.select" || line.ParentID != server.SpanContext().SpanID.String() || line.Service != "payments" {
+		t.Errorf("unexpected line %s", lines[0])
+	}
+}
@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/VMitov/payments/pkg/logging"
+)
+
+// Exporter sends the ended spans somewhere
+type Exporter interface {
+	Export(spans []*SpanData) error
+}
+
+// Tracer starts the traces of a service and hands the ended spans to its
+// exporter
+type Tracer struct {
+	Service  string
+	Exporter Exporter
+
+	clock func() time.Time
+}
+
+// NewTracer returns a tracer of the service exporting with the exporter
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{Service: service, Exporter: exporter, clock: time.Now}
+}
+
+func (t *Tracer) now() time.Time {
+	if t.clock == nil {
+		return time.Now()
+	}
+	return t.clock()
+}
+
+// StartRemote starts a span continuing the trace of the remote parent or a
+// new trace if the parent is not valid
+func (t *Tracer) StartRemote(ctx context.Context, name, kind string, parent SpanContext) (context.Context, *Span) {
+	s := t.newSpan(name, kind, parent, parent.IsValid())
+	return NewContext(ctx, s), s
+}
+
+func (t *Tracer) newSpan(name, kind string, parent SpanContext, remote bool) *Span {
+	sc := SpanContext{SpanID: newSpanID(), Flags: FlagSampled}
+	var parentID SpanID
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.TraceState = parent.TraceState
+		parentID = parent.SpanID
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	return &Span{tracer: t, data: SpanData{
+		Name:         name,
+		Kind:         kind,
+		Context:      sc,
+		Parent:       parentID,
+		Start:        t.now(),
+		Attributes:   map[string]string{},
+		Service:      t.Service,
+		RemoteParent: remote,
+	}}
+}
+
+func (t *Tracer) export(s *SpanData) {
+	if t.Exporter == nil {
+		return
+	}
+	if err := t.Exporter.Export([]*SpanData{s}); err != nil {
+		slog.Error("exporting span failed", logging.Error(err))
+	}
+}